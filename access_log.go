@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats accepted by -access-log-format.
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+)
+
+// clfTimeLayout is the timestamp layout of the Common Log Format.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogger writes one line per request in the Common or Combined Log Format.
+type accessLogger struct {
+	next   http.Handler
+	format string
+	now    func() time.Time
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newAccessLogger(next http.Handler, w io.Writer, format string) (*accessLogger, error) {
+	if format != accessLogCommon && format != accessLogCombined {
+		return nil, fmt.Errorf("unknown access log format: %s (want common or combined)", format)
+	}
+	return &accessLogger{next: next, format: format, now: time.Now, w: w}, nil
+}
+
+// statusRecorder records the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush streams.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type accessLogUserKey struct{}
+
+// setAccessLogUser records the authenticated user of the request with ctx, for
+// handlers behind an accessLogger.
+func setAccessLogUser(ctx context.Context, user string) {
+	if u, ok := ctx.Value(accessLogUserKey{}).(*string); ok {
+		*u = user
+	}
+}
+
+// ServeHTTP implements http.Handler. Streamed responses are logged once they end.
+func (l *accessLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := l.now()
+	rec := &statusRecorder{ResponseWriter: w}
+	user := new(string)
+	l.next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogUserKey{}, user)))
+	if *user == "" {
+		*user = accessLogUser(r)
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	size := "-"
+	if rec.bytes > 0 {
+		size = strconv.FormatInt(rec.bytes, 10)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %s %d %s", host, clfField(*user), start.Format(clfTimeLayout),
+		strconv.Quote(r.Method+" "+r.URL.RequestURI()+" "+r.Proto), rec.status, size)
+	if l.format == accessLogCombined {
+		line += " " + quotedField(r.Referer()) + " " + quotedField(r.UserAgent())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, line)
+}
+
+// accessLogUser returns the authenticated user of a request, which is never the
+// bearer token itself.
+func accessLogUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+// clfField returns "-" for empty fields and drops spaces and control characters,
+// which would break an unquoted field apart.
+func clfField(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// quotedField returns a quoted field, "-" for empty values.
+func quotedField(s string) string {
+	if s == "" {
+		s = "-"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogFormats(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+		// Streaming handlers must still be able to flush through the logger
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush: %v", err)
+		}
+	})
+	at := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.FixedZone("", -7*3600))
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{accessLogCommon, `192.0.2.1 - - [05/Mar/2024:14:07:09 -0700] "POST /v1/chat/completions?x=1 HTTP/1.1" 201 5` + "\n"},
+		{accessLogCombined, `192.0.2.1 - - [05/Mar/2024:14:07:09 -0700] "POST /v1/chat/completions?x=1 HTTP/1.1" 201 5 "-" "sdk/1.0"` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out strings.Builder
+			logger, err := newAccessLogger(handler, &out, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.now = func() time.Time { return at }
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?x=1", nil)
+			req.RemoteAddr = "192.0.2.1:54321"
+			req.Header.Set("User-Agent", "sdk/1.0")
+			logger.ServeHTTP(httptest.NewRecorder(), req)
+
+			if out.String() != tt.want {
+				t.Errorf("got  %q\nwant %q", out.String(), tt.want)
+			}
+		})
+	}
+}
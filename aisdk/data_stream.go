@@ -0,0 +1,147 @@
+// Package aisdk implements the Vercel AI SDK data stream protocol so that
+// `useChat` frontends can consume completions directly.
+package aisdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Stream part type codes, see https://sdk.vercel.ai/docs/ai-sdk-ui/stream-protocol.
+const (
+	partText          = "0"
+	partError         = "3"
+	partToolCall      = "9"
+	partToolResult    = "a"
+	partFinishMessage = "d"
+	partFinishStep    = "e"
+)
+
+// FinishReason represents why the model stopped generating.
+type FinishReason string
+
+const (
+	FinishReasonStop          FinishReason = "stop"
+	FinishReasonLength        FinishReason = "length"
+	FinishReasonContentFilter FinishReason = "content-filter"
+	FinishReasonToolCalls     FinishReason = "tool-calls"
+	FinishReasonError         FinishReason = "error"
+	FinishReasonOther         FinishReason = "other"
+	FinishReasonUnknown       FinishReason = "unknown"
+)
+
+// Usage represents token usage as reported in finish parts.
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+}
+
+type toolCallPart struct {
+	ToolCallID string          `json:"toolCallId"`
+	ToolName   string          `json:"toolName"`
+	Args       json.RawMessage `json:"args"`
+}
+
+type toolResultPart struct {
+	ToolCallID string `json:"toolCallId"`
+	Result     any    `json:"result"`
+}
+
+type finishPart struct {
+	FinishReason FinishReason `json:"finishReason"`
+	Usage        *Usage       `json:"usage,omitempty"`
+	IsContinued  *bool        `json:"isContinued,omitempty"`
+}
+
+// Writer writes data stream protocol parts to an underlying writer.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer that writes data stream parts to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Text writes a text part.
+func (w *Writer) Text(text string) error {
+	return w.write(partText, text)
+}
+
+// ToolCall writes a tool call part. args should be a JSON object; anything else is
+// replaced by an empty object since clients cannot parse it.
+func (w *Writer) ToolCall(id, name string, args json.RawMessage) error {
+	if len(args) == 0 || !json.Valid(args) {
+		args = json.RawMessage("{}")
+	}
+	return w.write(partToolCall, toolCallPart{ToolCallID: id, ToolName: name, Args: args})
+}
+
+// ToolResult writes the result of a tool call executed on the server side.
+func (w *Writer) ToolResult(id string, result any) error {
+	return w.write(partToolResult, toolResultPart{ToolCallID: id, Result: result})
+}
+
+// Write implements io.Writer by writing p as a text part, so a Writer can receive
+// streamed content directly.
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.Text(string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Error writes an error part.
+func (w *Writer) Error(msg string) error {
+	return w.write(partError, msg)
+}
+
+// Finish writes the finish step and finish message parts that end the stream.
+// usage may be nil when the upstream did not report token counts.
+func (w *Writer) Finish(reason FinishReason, usage *Usage) error {
+	isContinued := false
+	if err := w.write(partFinishStep, finishPart{FinishReason: reason, Usage: usage, IsContinued: &isContinued}); err != nil {
+		return err
+	}
+	return w.write(partFinishMessage, finishPart{FinishReason: reason, Usage: usage})
+}
+
+// FinishReasonFromOpenAI maps an OpenAI-style finish_reason to its AI SDK equivalent.
+func FinishReasonFromOpenAI(reason string) FinishReason {
+	switch reason {
+	case "stop":
+		return FinishReasonStop
+	case "length":
+		return FinishReasonLength
+	case "content_filter":
+		return FinishReasonContentFilter
+	case "tool_calls", "function_call":
+		return FinishReasonToolCalls
+	case "":
+		return FinishReasonUnknown
+	default:
+		return FinishReasonOther
+	}
+}
+
+func (w *Writer) write(code string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if _, err = fmt.Fprintf(w.w, "%s:%s\n", code, data); err != nil {
+		return err
+	}
+
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package aisdk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriterFraming(t *testing.T) {
+	var out strings.Builder
+	w := NewWriter(&out)
+	if err := w.Text("Hello, \"world\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ToolCall("call_1", "search", json.RawMessage(`{"q":"go"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ToolCall("call_2", "now", json.RawMessage(`not json`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ToolResult("call_1", map[string]int{"hits": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Error("upstream failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Finish(FinishReasonFromOpenAI("tool_calls"), &Usage{PromptTokens: 3, CompletionTokens: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `0:"Hello, \"world\"\n"
+0:"!"
+9:{"toolCallId":"call_1","toolName":"search","args":{"q":"go"}}
+9:{"toolCallId":"call_2","toolName":"now","args":{}}
+a:{"toolCallId":"call_1","result":{"hits":2}}
+3:"upstream failed"
+e:{"finishReason":"tool-calls","usage":{"promptTokens":3,"completionTokens":5},"isContinued":false}
+d:{"finishReason":"tool-calls","usage":{"promptTokens":3,"completionTokens":5}}
+`
+	if out.String() != want {
+		t.Errorf("stream =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestFinishReasonFromOpenAI(t *testing.T) {
+	for reason, want := range map[string]FinishReason{
+		"stop":           FinishReasonStop,
+		"length":         FinishReasonLength,
+		"content_filter": FinishReasonContentFilter,
+		"tool_calls":     FinishReasonToolCalls,
+		"function_call":  FinishReasonToolCalls,
+		"":               FinishReasonUnknown,
+		"something_new":  FinishReasonOther,
+	} {
+		if got := FinishReasonFromOpenAI(reason); got != want {
+			t.Errorf("FinishReasonFromOpenAI(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Errors matched by API errors with errors.Is, so that callers can tell failures
+// apart without parsing messages.
+var (
+	// ErrUnauthorized matches requests rejected for a missing, invalid or expired token.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrBadRequest matches requests the service rejected as invalid.
+	ErrBadRequest = errors.New("bad request")
+	// ErrNotFound matches requests for unknown models or endpoints.
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited matches rate limited requests, including *RateLimitError.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrContentFiltered matches prompts and responses blocked by the content filter,
+	// including *ContentFilterError.
+	ErrContentFiltered = errors.New("content filtered")
+)
+
+// contentFilterCodes are the error codes of prompts rejected by the content filter.
+var contentFilterCodes = []string{"content_filter", "ResponsibleAIPolicyViolation"}
+
+// APIError is returned for HTTP error responses of the models service.
+type APIError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	// Code is the error code of the body, such as "unknown_model", if any.
+	Code string
+	// Message is the error message of the body, if any.
+	Message string
+	// RequestID identifies the request for support, if the service sent one.
+	RequestID string
+	// Body holds the raw response body.
+	Body []byte
+
+	// innerCode is the code of the nested error, which carries the reason of
+	// content filter rejections.
+	innerCode string
+}
+
+func (e *APIError) Error() string {
+	var sb strings.Builder
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		sb.WriteString("unauthorized")
+	case http.StatusBadRequest:
+		sb.WriteString("bad request")
+	default:
+		fmt.Fprintf(&sb, "unexpected response from the server: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&sb, " (request ID %s)", e.RequestID)
+	}
+	if len(e.Body) > 0 {
+		sb.WriteString("\n")
+		sb.Write(e.Body)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Is reports whether the error matches one of the sentinel errors of the package.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrContentFiltered:
+		return containsFold(contentFilterCodes, e.Code) || containsFold(contentFilterCodes, e.innerCode)
+	}
+	return false
+}
+
+// Is makes rate limit errors match ErrRateLimited.
+func (e *RateLimitError) Is(target error) bool { return target == ErrRateLimited }
+
+// Is makes content filter errors match ErrContentFiltered.
+func (e *ContentFilterError) Is(target error) bool { return target == ErrContentFiltered }
+
+// newAPIError reads an error response into an *APIError. Bodies in the OpenAI
+// error shape fill its code and message; others are kept in Body only.
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamErrorBytes))
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  requestID(resp.Header),
+		Body:       body,
+	}
+
+	var envelope struct {
+		Error struct {
+			Code       json.RawMessage `json:"code"`
+			Message    string          `json:"message"`
+			InnerError struct {
+				Code string `json:"code"`
+			} `json:"innererror"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil {
+		e.Code = errorCode(envelope.Error.Code)
+		e.Message = envelope.Error.Message
+		e.innerCode = envelope.Error.InnerError.Code
+	}
+	return e
+}
+
+// requestID returns the ID the service assigned to a request, if it sent one.
+func requestID(header http.Header) string {
+	if id := header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+	return header.Get("x-ms-request-id")
+}
+
+// errorCode returns an error code sent as a string or, by some services, a number.
+func errorCode(raw json.RawMessage) string {
+	var code string
+	if json.Unmarshal(raw, &code) == nil {
+		return code
+	}
+	if len(raw) > 0 && string(raw) != "null" {
+		return string(raw)
+	}
+	return ""
+}
+
+// apiErrorHint suggests how to recover from err, or returns "" if there is nothing
+// to suggest.
+func apiErrorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return "Check that your token can use GitHub Models, for example with `gh auth refresh`."
+	case errors.Is(err, ErrNotFound):
+		return fmt.Sprintf("Run `%s models list` to see the available models.", os.Args[0])
+	case errors.Is(err, ErrContentFiltered):
+		return "The content filter blocked the prompt; rephrase it and try again."
+	case errors.Is(err, ErrRateLimited):
+		return fmt.Sprintf("Wait for the rate limit to reset, or run `%s quota` to see your limits.", os.Args[0])
+	}
+	return ""
+}
+
+// reportRequestError prints a failed request to stderr, with a hint on recovering.
+func reportRequestError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	if hint := apiErrorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+}
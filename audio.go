@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultTranscriptionsURL = "https://models.github.ai/inference/audio/transcriptions"
+	defaultSpeechURL         = "https://models.github.ai/inference/audio/speech"
+	defaultTranscribeModel   = "openai/whisper-1"
+	defaultSpeechModel       = "openai/tts-1"
+	defaultSpeechVoice       = "alloy"
+)
+
+// TranscriptionOptions represents the options for an audio transcription request.
+type TranscriptionOptions struct {
+	// File is the audio to transcribe and Filename its name, whose extension tells the
+	// service the audio format.
+	File     io.Reader
+	Filename string
+	Model    string
+	// Language is an optional ISO-639-1 hint for the spoken language.
+	Language string
+	// Prompt optionally guides the style or vocabulary of the transcript.
+	Prompt string
+	// ResponseFormat is one of json, text, srt, verbose_json or vtt.
+	ResponseFormat string
+	Temperature    *float64
+}
+
+// Transcription represents the result of a transcription request. For the text, srt
+// and vtt formats Text holds the raw response body.
+type Transcription struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// SpeechOptions represents the options for a text-to-speech request.
+type SpeechOptions struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"`
+	ResponseFormat string   `json:"response_format,omitempty"`
+	Speed          *float64 `json:"speed,omitempty"`
+}
+
+// GetTranscription uploads audio and returns its transcript.
+func (c *AzureClient) GetTranscription(ctx context.Context, req TranscriptionOptions) (*Transcription, error) {
+	// Stream the upload instead of buffering the whole file in memory
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeTranscriptionForm(form, req))
+	}()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TranscriptionsURL, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	c.setHeaders(httpReq)
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.handleHTTPError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcription Transcription
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		transcription.Text = string(body)
+		return &transcription, nil
+	}
+	if err := json.Unmarshal(body, &transcription); err != nil {
+		return nil, err
+	}
+	return &transcription, nil
+}
+
+func writeTranscriptionForm(form *multipart.Writer, req TranscriptionOptions) error {
+	fields := map[string]string{
+		"model":           req.Model,
+		"language":        req.Language,
+		"prompt":          req.Prompt,
+		"response_format": req.ResponseFormat,
+	}
+	if req.Temperature != nil {
+		fields["temperature"] = strconv.FormatFloat(*req.Temperature, 'f', -1, 64)
+	}
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", filepath.Base(req.Filename))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, req.File); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// GetSpeech synthesizes speech for the input text. The caller must close the returned
+// reader, which streams the encoded audio as it is generated.
+func (c *AzureClient) GetSpeech(ctx context.Context, req SpeechOptions) (io.ReadCloser, error) {
+	resp, err := c.postJSON(ctx, c.cfg.SpeechURL, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.handleHTTPError(resp)
+	}
+
+	return resp.Body, nil
+}
+
+// runAudio implements the `audio` subcommand.
+func runAudio(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s audio transcribe [flags] <file>\n       %s audio speak [flags] -o <file> <text | ->\n", os.Args[0], os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "transcribe":
+		fs := flag.NewFlagSet("audio transcribe", flag.ExitOnError)
+		model := modelFlag(fs, "model", defaultTranscribeModel, "Transcription model to use")
+		language := fs.String("language", "", "ISO-639-1 code of the spoken language")
+		format := fs.String("format", "text", "Response format: json, text, srt, verbose_json or vtt")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+
+		transcription, err := newCLIClient().GetTranscription(context.TODO(), TranscriptionOptions{
+			File:           f,
+			Filename:       f.Name(),
+			Model:          *model,
+			Language:       *language,
+			ResponseFormat: *format,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Print(transcription.Text)
+		if !strings.HasSuffix(transcription.Text, "\n") {
+			fmt.Println()
+		}
+		return 0
+
+	case "speak":
+		fs := flag.NewFlagSet("audio speak", flag.ExitOnError)
+		model := modelFlag(fs, "model", defaultSpeechModel, "Speech model to use")
+		voice := fs.String("voice", defaultSpeechVoice, "Voice to use")
+		format := fs.String("format", "", "Audio format: mp3, opus, aac, flac, wav or pcm. Defaults to the output file extension")
+		out := fs.String("o", "", "File to write the audio to, or - for stdout")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 || *out == "" {
+			usage()
+			return 2
+		}
+
+		input := fs.Arg(0)
+		if input == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			input = string(data)
+		}
+		if *format == "" && *out != "-" {
+			*format = strings.TrimPrefix(filepath.Ext(*out), ".")
+		}
+
+		audio, err := newCLIClient().GetSpeech(context.TODO(), SpeechOptions{
+			Model:          *model,
+			Input:          input,
+			Voice:          *voice,
+			ResponseFormat: *format,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer audio.Close()
+
+		var w io.Writer = os.Stdout
+		if *out != "-" {
+			f, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if _, err := io.Copy(w, audio); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+
+	default:
+		usage()
+		return 2
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newAudioTestClient returns a client sending audio requests to handler.
+func newAudioTestClient(t *testing.T, handler http.HandlerFunc) *AzureClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	cfg := NewDefaultAzureClientConfig()
+	cfg.TranscriptionsURL = srv.URL + "/audio/transcriptions"
+	cfg.SpeechURL = srv.URL + "/audio/speech"
+	return NewAzureClient(srv.Client(), "test-token", cfg)
+}
+
+func TestGetTranscription(t *testing.T) {
+	type upload struct{ fields, filename, audio string }
+	uploads := make(chan upload, 1)
+	client := newAudioTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audio, _ := io.ReadAll(file)
+		fields := []string{}
+		for _, name := range []string{"model", "language", "prompt", "response_format", "temperature"} {
+			fields = append(fields, name+"="+r.FormValue(name))
+		}
+		uploads <- upload{strings.Join(fields, " "), header.Filename, string(audio)}
+
+		if r.FormValue("response_format") == "srt" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("1\n00:00:00,000 --> 00:00:01,000\nHello\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"Hello","language":"english","duration":1.5}`))
+	})
+
+	temperature := 0.2
+	got, err := client.GetTranscription(context.Background(), TranscriptionOptions{
+		File:        strings.NewReader("RIFF audio"),
+		Filename:    "/tmp/clips/hello.wav",
+		Model:       defaultTranscribeModel,
+		Language:    "en",
+		Temperature: &temperature,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != (Transcription{Text: "Hello", Language: "english", Duration: 1.5}) {
+		t.Errorf("transcription = %+v", got)
+	}
+	// Unset options are left out of the form
+	if u := <-uploads; u.fields != "model=openai/whisper-1 language=en prompt= response_format= temperature=0.2" || u.filename != "hello.wav" || u.audio != "RIFF audio" {
+		t.Errorf("upload = %+v", u)
+	}
+
+	got, err = client.GetTranscription(context.Background(), TranscriptionOptions{File: strings.NewReader("x"), Filename: "a.mp3", Model: defaultTranscribeModel, ResponseFormat: "srt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-uploads
+	if got.Text != "1\n00:00:00,000 --> 00:00:01,000\nHello\n" {
+		t.Errorf("transcription in srt = %q, want the raw body", got.Text)
+	}
+}
+
+func TestGetSpeech(t *testing.T) {
+	requests := make(chan SpeechOptions, 1)
+	client := newAudioTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req SpeechOptions
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- req
+		if req.Voice == "nobody" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":"invalid_voice","message":"unknown voice"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3 audio"))
+	})
+
+	audio, err := client.GetSpeech(context.Background(), SpeechOptions{Model: defaultSpeechModel, Input: "Hello", Voice: defaultSpeechVoice, ResponseFormat: "mp3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audio.Close()
+	if data, err := io.ReadAll(audio); err != nil || string(data) != "ID3 audio" {
+		t.Errorf("audio = %q, %v", data, err)
+	}
+	if req := <-requests; req != (SpeechOptions{Model: defaultSpeechModel, Input: "Hello", Voice: defaultSpeechVoice, ResponseFormat: "mp3"}) {
+		t.Errorf("request = %+v", req)
+	}
+
+	if _, err := client.GetSpeech(context.Background(), SpeechOptions{Model: defaultSpeechModel, Input: "Hello", Voice: "nobody"}); err == nil || !strings.Contains(err.Error(), "unknown voice") {
+		t.Errorf("speech with an unknown voice = %v", err)
+	}
+}
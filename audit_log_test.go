@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLogChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key := []byte("secret")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("done")) })
+
+	// Reopening the log continues the chain
+	for i := 0; i < 2; i++ {
+		audit, closer, err := openAuditLog(path, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"openai/gpt-4.1"}`))
+			audit.serve(httptest.NewRecorder(), r, ok)
+		}
+		closer.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readAuditRecords(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0].Model != "openai/gpt-4.1" || records[0].ResponseBytes != 4 {
+		t.Fatalf("records = %+v", records)
+	}
+	if err := verifyAuditRecords(records, key); err != nil {
+		t.Fatalf("untouched log: %v", err)
+	}
+
+	tampered := append([]auditRecord{}, records...)
+	tampered[1].Status = http.StatusTeapot
+	if err := verifyAuditRecords(tampered, key); err == nil {
+		t.Error("an edited record was not detected")
+	}
+	if err := verifyAuditRecords(append(records[:1:1], records[2:]...), key); err == nil {
+		t.Error("a removed record was not detected")
+	}
+	if err := verifyAuditRecords(records, []byte("other")); err == nil {
+		t.Error("records verified with the wrong key")
+	}
+}
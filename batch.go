@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultFilesURL   = "https://models.github.ai/inference/files"
+	defaultBatchesURL = "https://models.github.ai/inference/batches"
+)
+
+// Batch statuses that will not change anymore.
+var terminalBatchStatuses = map[string]bool{
+	"completed": true,
+	"failed":    true,
+	"expired":   true,
+	"cancelled": true,
+}
+
+// File represents a file uploaded to the files endpoint.
+type File struct {
+	ID       string `json:"id"`
+	Bytes    int64  `json:"bytes"`
+	Filename string `json:"filename"`
+	Purpose  string `json:"purpose"`
+}
+
+// BatchOptions represents the options for creating a batch.
+type BatchOptions struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// BatchRequestCounts represents the progress of a batch.
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// Batch represents an offline batch job.
+type Batch struct {
+	ID            string             `json:"id"`
+	Status        string             `json:"status"`
+	Endpoint      string             `json:"endpoint"`
+	InputFileID   string             `json:"input_file_id"`
+	OutputFileID  string             `json:"output_file_id,omitempty"`
+	ErrorFileID   string             `json:"error_file_id,omitempty"`
+	CreatedAt     int64              `json:"created_at"`
+	CompletedAt   int64              `json:"completed_at,omitempty"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+}
+
+// Done reports whether the batch has reached a terminal status.
+func (b *Batch) Done() bool {
+	return terminalBatchStatuses[b.Status]
+}
+
+// batchLine represents a single request of a batch input file.
+type batchLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// UploadBatchFile uploads a JSONL batch input file.
+func (c *AzureClient) UploadBatchFile(ctx context.Context, r io.Reader, filename string) (*File, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(func() error {
+			if err := form.WriteField("purpose", "batch"); err != nil {
+				return err
+			}
+			part, err := form.CreateFormFile("file", filepath.Base(filename))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, r); err != nil {
+				return err
+			}
+			return form.Close()
+		}())
+	}()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.FilesURL, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+
+	c.setHeaders(httpReq)
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+
+	var file File
+	if err := c.doJSON(httpReq, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// CreateBatch submits a batch job for an uploaded input file.
+func (c *AzureClient) CreateBatch(ctx context.Context, req BatchOptions) (*Batch, error) {
+	// A failed submission may still have created the batch, so it is not retried
+	resp, err := c.postJSON(ctx, c.cfg.BatchesURL, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch Batch
+	if err := c.decodeJSON(resp, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBatch returns the current state of a batch job.
+func (c *AzureClient) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.BatchesURL+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setHeaders(httpReq)
+
+	var batch Batch
+	if err := c.doJSON(httpReq, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetFileContent returns the contents of an uploaded or generated file. The caller
+// must close the returned reader.
+func (c *AzureClient) GetFileContent(ctx context.Context, id string) (io.ReadCloser, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.FilesURL+"/"+url.PathEscape(id)+"/content", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setHeaders(httpReq)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.handleHTTPError(resp)
+	}
+
+	return resp.Body, nil
+}
+
+// doJSON sends httpReq and decodes a successful JSON response into v.
+func (c *AzureClient) doJSON(httpReq *http.Request, v any) error {
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	return c.decodeJSON(resp, v)
+}
+
+// decodeJSON decodes a successful JSON response into v and closes its body.
+func (c *AzureClient) decodeJSON(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return c.handleHTTPError(resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// validateBatchFile checks that every line of a batch input file is a well-formed request.
+func validateBatchFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	seen := map[string]bool{}
+	count := 0
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line batchLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return 0, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		switch {
+		case line.CustomID == "":
+			return 0, fmt.Errorf("%s:%d: custom_id is required", path, lineNumber)
+		case seen[line.CustomID]:
+			return 0, fmt.Errorf("%s:%d: duplicate custom_id %q", path, lineNumber, line.CustomID)
+		case line.Method != http.MethodPost:
+			return 0, fmt.Errorf("%s:%d: method must be POST", path, lineNumber)
+		case line.URL == "" || len(line.Body) == 0:
+			return 0, fmt.Errorf("%s:%d: url and body are required", path, lineNumber)
+		}
+		seen[line.CustomID] = true
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, errors.New("batch file has no requests")
+	}
+	return count, nil
+}
+
+// runBatch implements the `batch` subcommand.
+func runBatch(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %[1]s batch submit [flags] <file.jsonl>\n       %[1]s batch status [flags] <batch id>\n       %[1]s batch results [flags] <batch id>\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	ctx := context.TODO()
+	client := newCLIClient()
+
+	switch args[0] {
+	case "submit":
+		fs := flag.NewFlagSet("batch submit", flag.ExitOnError)
+		endpoint := fs.String("endpoint", "/v1/chat/completions", "Endpoint the requests in the file target")
+		window := fs.String("window", "24h", "Completion window for the batch")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+
+		count, err := validateBatchFile(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+
+		file, err := client.UploadBatchFile(ctx, f, f.Name())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		batch, err := client.CreateBatch(ctx, BatchOptions{InputFileID: file.ID, Endpoint: *endpoint, CompletionWindow: *window})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Fprintf(os.Stderr, "Submitted %d requests\n", count)
+		fmt.Println(batch.ID)
+		return 0
+
+	case "status":
+		fs := flag.NewFlagSet("batch status", flag.ExitOnError)
+		wait := fs.Bool("wait", false, "Poll until the batch finishes")
+		interval := fs.Duration("interval", 30*time.Second, "Polling interval with -wait")
+		notify := notifyFlag(fs, "With -wait, ring the bell or show a desktop notification (-notify=desktop) when the batch finishes")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+
+		for {
+			batch, err := client.GetBatch(ctx, fs.Arg(0))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+
+			counts := batch.RequestCounts
+			fmt.Printf("%s: %s (%d/%d completed, %d failed)\n", batch.ID, batch.Status, counts.Completed, counts.Total, counts.Failed)
+
+			if !*wait || batch.Done() {
+				if *wait {
+					notify.notify("Batch "+batch.Status, fmt.Sprintf("%s: %d/%d completed, %d failed", batch.ID, counts.Completed, counts.Total, counts.Failed))
+				}
+				if batch.Status != "completed" && batch.Done() {
+					return 1
+				}
+				return 0
+			}
+			time.Sleep(*interval)
+		}
+
+	case "results":
+		fs := flag.NewFlagSet("batch results", flag.ExitOnError)
+		out := fs.String("o", "-", "File to write the results to, or - for stdout")
+		errorsFile := fs.Bool("errors", false, "Download the error file instead of the output file")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+
+		batch, err := client.GetBatch(ctx, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fileID := batch.OutputFileID
+		if *errorsFile {
+			fileID = batch.ErrorFileID
+		}
+		if fileID == "" {
+			fmt.Fprintf(os.Stderr, "batch %s has no results yet (status %s)\n", batch.ID, batch.Status)
+			return 1
+		}
+
+		content, err := client.GetFileContent(ctx, fileID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer content.Close()
+
+		var w io.Writer = os.Stdout
+		if *out != "-" {
+			f, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if _, err := io.Copy(w, content); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+
+	default:
+		usage()
+		return 2
+	}
+}
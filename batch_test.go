@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateBatchFile(t *testing.T) {
+	const line1 = `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"openai/gpt-4o-mini"}}`
+	const line2 = `{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"openai/gpt-4o-mini"}}`
+	for _, tt := range []struct {
+		name    string
+		content string
+		count   int
+		errText string
+	}{
+		{"valid", line1 + "\n\n" + line2 + "\n", 2, ""},
+		{"empty", "\n", 0, "no requests"},
+		{"invalid JSON", line1 + "\n{", 0, ":2:"},
+		{"no custom_id", `{"method":"POST","url":"/v1/chat/completions","body":{}}`, 0, "custom_id is required"},
+		{"duplicate custom_id", line1 + "\n" + line1, 0, `duplicate custom_id "a"`},
+		{"GET", strings.Replace(line1, "POST", "GET", 1), 0, "method must be POST"},
+		{"no body", `{"custom_id":"a","method":"POST","url":"/v1/chat/completions"}`, 0, "url and body are required"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "batch.jsonl")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			count, err := validateBatchFile(path)
+			if tt.errText == "" && (err != nil || count != tt.count) {
+				t.Errorf("validateBatchFile = %d, %v, want %d", count, err, tt.count)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Errorf("validateBatchFile error = %v, want one containing %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+func TestBatchClient(t *testing.T) {
+	var uploaded, created string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /files", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil || r.FormValue("purpose") != "batch" {
+			http.Error(w, "bad upload", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		uploaded = header.Filename + ":" + string(data)
+		json.NewEncoder(w).Encode(File{ID: "file-in", Bytes: int64(len(data)), Filename: header.Filename, Purpose: "batch"})
+	})
+	mux.HandleFunc("POST /batches", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		created = string(body)
+		json.NewEncoder(w).Encode(Batch{ID: "batch_1", Status: "validating", InputFileID: "file-in"})
+	})
+	mux.HandleFunc("GET /batches/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "batch_1" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"not_found","message":"no such batch"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(Batch{ID: "batch_1", Status: "completed", OutputFileID: "file-out", RequestCounts: BatchRequestCounts{Total: 2, Completed: 2}})
+	})
+	mux.HandleFunc("GET /files/{id}/content", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"custom_id":"a"}` + "\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	cfg := NewDefaultAzureClientConfig()
+	cfg.FilesURL = srv.URL + "/files"
+	cfg.BatchesURL = srv.URL + "/batches"
+	client := NewAzureClient(srv.Client(), "test-token", cfg)
+	ctx := context.Background()
+
+	file, err := client.UploadBatchFile(ctx, strings.NewReader("{}\n"), "/jobs/nightly.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ID != "file-in" || uploaded != "nightly.jsonl:{}\n" {
+		t.Errorf("upload = %+v of %q", file, uploaded)
+	}
+
+	batch, err := client.CreateBatch(ctx, BatchOptions{InputFileID: file.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.ID != "batch_1" || batch.Done() || created != `{"input_file_id":"file-in","endpoint":"/v1/chat/completions","completion_window":"24h"}` {
+		t.Errorf("created batch %+v from %s", batch, created)
+	}
+
+	batch, err = client.GetBatch(ctx, "batch_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !batch.Done() || batch.OutputFileID != "file-out" || batch.RequestCounts.Completed != 2 {
+		t.Errorf("batch = %+v", batch)
+	}
+	if _, err := client.GetBatch(ctx, "batch_2"); err == nil || !strings.Contains(err.Error(), "no such batch") {
+		t.Errorf("getting a missing batch = %v", err)
+	}
+
+	content, err := client.GetFileContent(ctx, batch.OutputFileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != `{"custom_id":"a"}`+"\n" {
+		t.Errorf("results = %q", data)
+	}
+}
+
+func TestCreateBatchNotRetried(t *testing.T) {
+	var submitted atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		submitted.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":{"code":"bad_gateway","message":"upstream failed"}}`))
+	}))
+	defer srv.Close()
+	cfg := NewDefaultAzureClientConfig()
+	cfg.BatchesURL = srv.URL
+	client := NewAzureClient(srv.Client(), "test-token", cfg).WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	// The batch may have been created before the gateway failed, so it is not resubmitted
+	if _, err := client.CreateBatch(context.Background(), BatchOptions{InputFileID: "file-in", Endpoint: "/v1/chat/completions", CompletionWindow: "24h"}); err == nil {
+		t.Fatal("CreateBatch succeeded on a 502")
+	}
+	if got := submitted.Load(); got != 1 {
+		t.Errorf("submitted the batch %d times, want once", got)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/abatilo/ghmodelsproxy/aisdk"
+	"github.com/abatilo/ghmodelsproxy/tools"
+)
+
+// builtinTools builds a registry holding the named built-in tools.
+func builtinTools(names, allowCommands, searchURL string) (*tools.Registry, error) {
+	registry := tools.NewRegistry()
+	for _, name := range splitList(names) {
+		var tool tools.Tool
+		switch name {
+		case "shell":
+			opts := tools.ShellOptions{Allowlist: splitList(allowCommands)}
+			// An allowlist means we are running unattended, so never prompt
+			if len(opts.Allowlist) == 0 {
+				opts.Confirm = tools.PromptConfirm(os.Stdin, os.Stderr)
+			}
+			tool = tools.Shell(opts)
+		case "fetch":
+			tool = tools.Fetch(tools.FetchOptions{})
+		case "search":
+			if searchURL == "" {
+				return nil, fmt.Errorf("the search tool requires -search-url")
+			}
+			tool = tools.Search(&tools.SearXNG{BaseURL: searchURL})
+		default:
+			return nil, fmt.Errorf("unknown tool: %s", name)
+		}
+		if err := registry.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runTools runs the tool-call loop for the CLI, streaming the answer to stdout. In
+// text mode tool calls are written to log; in aisdk mode they are emitted as tool call
+// and tool result parts.
+func runTools(ctx context.Context, client *AzureClient, req ChatCompletionOptions, registry *tools.Registry, output string, stdout, log io.Writer) error {
+	opts := ToolRunOptions{
+		Out: stdout,
+		OnToolCall: func(call ToolCall) {
+			fmt.Fprintf(log, "\n[tool] %s %s\n", call.Function.Name, call.Function.Arguments)
+		},
+	}
+
+	var dataStream *aisdk.Writer
+	var finishReason string
+	var usage *aisdk.Usage
+	if output == "aisdk" {
+		dataStream = aisdk.NewWriter(stdout)
+		// The finish parts report the last turn's reason and the usage of all turns
+		opts.OnTurn = func(reason string, turn *Usage) {
+			finishReason = reason
+			if turn != nil {
+				if usage == nil {
+					usage = &aisdk.Usage{}
+				}
+				usage.PromptTokens += turn.PromptTokens
+				usage.CompletionTokens += turn.CompletionTokens
+			}
+		}
+		opts.Out = dataStream
+		opts.OnToolCall = func(call ToolCall) {
+			_ = dataStream.ToolCall(call.ID, call.Function.Name, json.RawMessage(call.Function.Arguments))
+		}
+		opts.OnToolResult = func(call ToolCall, result string) {
+			_ = dataStream.ToolResult(call.ID, result)
+		}
+	}
+
+	messages, err := client.RunWithTools(ctx, req, registry, opts)
+	if dataStream != nil {
+		if err != nil {
+			_ = dataStream.Error(err.Error())
+			return err
+		}
+		return dataStream.Finish(aisdk.FinishReasonFromOpenAI(finishReason), usage)
+	}
+	if err != nil {
+		return err
+	}
+
+	if last := messages[len(messages)-1]; last.Content == nil || !strings.HasSuffix(*last.Content, "\n") {
+		fmt.Fprintln(stdout)
+	}
+	return nil
+}
+
+// aisdkUsage converts usage into the form reported in AI SDK finish parts.
+func aisdkUsage(usage *Usage) *aisdk.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &aisdk.Usage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCatalogURL = "https://models.github.ai/catalog/models"
+	catalogCacheTTL   = 24 * time.Hour
+)
+
+// Model capabilities reported by the catalog.
+const (
+	ModelCapabilityStreaming   = "streaming"
+	ModelCapabilityToolCalling = "tool-calling"
+)
+
+// ModelLimits represents the token limits of a model.
+type ModelLimits struct {
+	MaxInputTokens  int `json:"max_input_tokens"`
+	MaxOutputTokens int `json:"max_output_tokens"`
+}
+
+// ModelSummary represents a model in the GitHub Models catalog.
+type ModelSummary struct {
+	ID                        string      `json:"id"`
+	Name                      string      `json:"name"`
+	Publisher                 string      `json:"publisher"`
+	Summary                   string      `json:"summary"`
+	RateLimitTier             string      `json:"rate_limit_tier"`
+	SupportedInputModalities  []string    `json:"supported_input_modalities"`
+	SupportedOutputModalities []string    `json:"supported_output_modalities"`
+	Capabilities              []string    `json:"capabilities"`
+	Tags                      []string    `json:"tags"`
+	Limits                    ModelLimits `json:"limits"`
+	HTMLURL                   string      `json:"html_url,omitempty"`
+	Version                   string      `json:"version,omitempty"`
+}
+
+// HasCapability reports whether the model advertises capability.
+func (m *ModelSummary) HasCapability(capability string) bool {
+	return containsFold(m.Capabilities, capability)
+}
+
+// SupportsInput reports whether the model accepts the given input modality.
+func (m *ModelSummary) SupportsInput(modality string) bool {
+	return containsFold(m.SupportedInputModalities, modality)
+}
+
+// ListModels returns the models in the catalog.
+func (c *AzureClient) ListModels(ctx context.Context) ([]*ModelSummary, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.CatalogURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setHeaders(httpReq)
+
+	var models []*ModelSummary
+	if err := c.doJSON(httpReq, &models); err != nil {
+		return nil, err
+	}
+	return models, nil
+}
+
+// cachedCatalog returns the catalog from the local cache when it is fresh, fetching and
+// caching it otherwise. A stale cache is used if the catalog cannot be fetched.
+func (c *AzureClient) cachedCatalog(ctx context.Context) ([]*ModelSummary, error) {
+	path, pathErr := catalogCachePath()
+	var cached []*ModelSummary
+	fresh := false
+	if pathErr == nil {
+		if info, err := os.Stat(path); err == nil {
+			if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil {
+				fresh = time.Since(info.ModTime()) < catalogCacheTTL
+			}
+		}
+	}
+	if fresh && len(cached) > 0 {
+		return cached, nil
+	}
+
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		if len(cached) > 0 {
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if pathErr == nil {
+		if data, err := json.Marshal(models); err == nil {
+			_ = os.MkdirAll(filepath.Dir(path), 0o755)
+			_ = os.WriteFile(path, data, 0o644)
+		}
+	}
+	return models, nil
+}
+
+// catalogCachePath returns where the catalog is cached.
+func catalogCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ghmodelsproxy", "catalog.json"), nil
+}
+
+// findModel returns the catalog entry for id, ignoring case.
+func findModel(models []*ModelSummary, id string) *ModelSummary {
+	for _, m := range models {
+		if strings.EqualFold(m.ID, id) {
+			return m
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
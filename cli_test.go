@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the CLI instead of the tests when re-executed by runCLI.
+func TestMain(m *testing.M) {
+	if os.Getenv("GHMODELS_TEST_CLI") == "1" {
+		os.Args = append([]string{"ghmodels"}, strings.Fields(os.Getenv("GHMODELS_TEST_ARGS"))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the CLI with args against the echo provider and returns its stdout
+// and stderr.
+func runCLI(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	return runCLIWithEnv(t, nil, args...)
+}
+
+// runCLIWithEnv is runCLI with additional environment variables, which override the
+// defaults.
+func runCLIWithEnv(t *testing.T, env []string, args ...string) (string, string) {
+	t.Helper()
+	return runCLIInDir(t, "", env, args...)
+}
+
+// runCLIInDir is runCLIWithEnv in the working directory dir, or the test's if dir is
+// empty.
+func runCLIInDir(t *testing.T, dir string, env []string, args ...string) (string, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GHMODELS_TEST_CLI=1",
+		"GHMODELS_TEST_ARGS="+strings.Join(args, " "),
+		"GHMODELS_PROVIDER=echo",
+		"XDG_CONFIG_HOME="+t.TempDir(),
+		"NO_COLOR=1",
+	)
+	cmd.Env = append(cmd.Env, env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, stderr.String())
+	}
+	return stdout.String(), stderr.String()
+}
+
+func TestCLIStdoutHoldsOnlyTheResponse(t *testing.T) {
+	stdout, stderr := runCLI(t, "-headers", "pipeline")
+	if stdout != "pipeline" {
+		t.Errorf("stdout = %q, want only the response", stdout)
+	}
+	for _, want := range []string{"=== HTTP Response ===", "Execution Summary:"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr does not contain %q:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestCLILogFile(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "ghmodels.log")
+	stdout, stderr := runCLI(t, "-headers", "-log-file", logPath, "pipeline")
+	if stdout != "pipeline" {
+		t.Errorf("stdout = %q, want only the response", stdout)
+	}
+	if stderr != "" {
+		t.Errorf("stderr = %q, want the diagnostics in the log file", stderr)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"=== HTTP Response ===", "Execution Summary:"} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("log file does not contain %q:\n%s", want, log)
+		}
+	}
+}
+
+func TestCLISystemPrompt(t *testing.T) {
+	if stdout, _ := runCLI(t, "-echo-template={{.System}}", "hi"); stdout != "You are a coding assistant" {
+		t.Errorf("default system prompt = %q", stdout)
+	}
+	if stdout, _ := runCLI(t, "-echo-template={{.System}}", "-system=terse", "hi"); stdout != "terse" {
+		t.Errorf("-system prompt = %q", stdout)
+	}
+
+	path := filepath.Join(t.TempDir(), "system.txt")
+	if err := os.WriteFile(path, []byte("from a file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _ := runCLI(t, "-echo-template={{.System}}", "-system-file", path, "hi"); stdout != "from a file" {
+		t.Errorf("-system-file prompt = %q", stdout)
+	}
+}
+
+func TestCLIConfigFile(t *testing.T) {
+	configHome := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(configHome, "ghmodelsproxy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := "model: openai/gpt-4o-mini\nsystem: from-file\nretry:\n  max_attempts: 2\n"
+	if err := os.WriteFile(filepath.Join(configHome, "ghmodelsproxy", "config.yml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"XDG_CONFIG_HOME=" + configHome}
+
+	if stdout, _ := runCLIWithEnv(t, env, "-echo-template={{.Model}}:{{.System}}", "hi"); stdout != "openai/gpt-4o-mini:from-file" {
+		t.Errorf("with the config file: %q", stdout)
+	}
+	env = append(env, "GHMODELS_SYSTEM=from-env")
+	if stdout, _ := runCLIWithEnv(t, env, "-echo-template={{.Model}}:{{.System}}", "hi"); stdout != "openai/gpt-4o-mini:from-env" {
+		t.Errorf("with the environment: %q", stdout)
+	}
+	if stdout, _ := runCLIWithEnv(t, env, "-echo-template={{.Model}}:{{.System}}", "-system=from-flag", "hi"); stdout != "openai/gpt-4o-mini:from-flag" {
+		t.Errorf("with a flag: %q", stdout)
+	}
+}
+
+func TestCLILangAndStyle(t *testing.T) {
+	stdout, _ := runCLI(t, "-echo-template={{.System}}", "-system=Help.", "-lang=German", "-style=no-comments", "hi")
+	if want := "Help.\n\nAnswer in German. " + builtinStyles["no-comments"]; stdout != want {
+		t.Errorf("system prompt = %q, want %q", stdout, want)
+	}
+}
+
+func TestCLIMetricsJSON(t *testing.T) {
+	configHome := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(configHome, "ghmodelsproxy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := "prices:\n  openai/gpt-4.1: {input: 2, output: 1000000}\n"
+	if err := os.WriteFile(filepath.Join(configHome, "ghmodelsproxy", "config.yml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	metricsPath := filepath.Join(t.TempDir(), "metrics.jsonl")
+	env := []string{"XDG_CONFIG_HOME=" + configHome}
+	for range 2 {
+		runCLIWithEnv(t, env, "-model=openai/gpt-4.1", "-metrics-json", metricsPath, "hi")
+	}
+
+	data, err := os.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d metrics lines, want one per run:\n%s", len(lines), data)
+	}
+	var metrics summaryMetrics
+	if err := json.Unmarshal([]byte(lines[1]), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Model != "openai/gpt-4.1" || metrics.Usage == nil || metrics.Usage.CompletionTokens != 1 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+	if metrics.CostUSD == nil {
+		t.Error("no cost for a model with a price")
+	} else if *metrics.CostUSD != 1 {
+		t.Errorf("cost = %g, want 1", *metrics.CostUSD)
+	}
+}
+
+func TestCLIProjectFile(t *testing.T) {
+	root := t.TempDir()
+	project := "model: openai/gpt-4o-mini\nsystem: from-project\ntemplates:\n  greet:\n    prompt: Say hello\n    model: openai/gpt-4.1-nano\n"
+	if err := os.WriteFile(filepath.Join(root, projectFileName), []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "sub", "dir")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout, _ := runCLIInDir(t, dir, nil, "-echo-template={{.Model}}:{{.System}}", "hi"); stdout != "openai/gpt-4o-mini:from-project" {
+		t.Errorf("in a subdirectory of the project: %q", stdout)
+	}
+	if stdout, _ := runCLIInDir(t, dir, []string{"GHMODELS_MODEL=openai/gpt-4.1"}, "-echo-template={{.Model}}", "hi"); stdout != "openai/gpt-4.1" {
+		t.Errorf("the environment does not override the project file: %q", stdout)
+	}
+	if stdout, _ := runCLIInDir(t, dir, nil, "-echo-template={{.Model}}:{{.Prompt}}", "-use=greet"); stdout != "openai/gpt-4.1-nano:Say hello" {
+		t.Errorf("with a project template: %q", stdout)
+	}
+}
+
+func TestCLIEmbed(t *testing.T) {
+	stdout, _ := runCLI(t, "embed", "-format", "floats", "-dimensions", "4", "hello")
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 4 {
+		t.Errorf("floats output has %d lines, want 4:\n%s", len(lines), stdout)
+	}
+
+	stdout, _ = runCLI(t, "embed", "hello")
+	var resp EmbeddingsResponse
+	if err := json.Unmarshal([]byte(stdout), &resp); err != nil {
+		t.Fatalf("json output: %v\n%s", err, stdout)
+	}
+	if resp.Model != defaultEmbeddingModel || len(resp.Data) != 1 || len(resp.Data[0].Embedding) != echoEmbeddingDimensions {
+		t.Errorf("json output = %+v", resp)
+	}
+}
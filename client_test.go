@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+	"github.com/abatilo/ghmodelsproxy/stream"
+	"github.com/abatilo/ghmodelsproxy/tools"
+)
+
+func newTestClient(srv *modelstest.Server) *AzureClient {
+	return newTestClientWithTransport(srv, http.DefaultTransport)
+}
+
+func newTestClientWithTransport(srv *modelstest.Server, transport http.RoundTripper) *AzureClient {
+	cfg := NewDefaultAzureClientConfig()
+	cfg.InferenceURL = srv.InferenceURL()
+	cfg.CatalogURL = srv.CatalogURL()
+	return NewAzureClient(&http.Client{Transport: transport}, "test-token", cfg)
+}
+
+func testRequest(prompt string) ChatCompletionOptions {
+	return ChatCompletionOptions{
+		Model:    "openai/gpt-4o-mini",
+		Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: &prompt}},
+	}
+}
+
+func TestStreamCompletion(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{
+		Chunks: []string{"Hello", ", ", "world"},
+		Usage:  &modelstest.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+	})
+
+	var out strings.Builder
+	msg, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("hi"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Hello, world" {
+		t.Errorf("streamed %q, want %q", out.String(), "Hello, world")
+	}
+	if msg.Content == nil || *msg.Content != "Hello, world" {
+		t.Errorf("message content = %v", msg.Content)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	if got := requests[0].Header.Get("Authorization"); got != "Bearer test-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if !strings.Contains(string(requests[0].Body), `"stream_options":{"include_usage":true}`) {
+		t.Errorf("request does not ask for usage: %s", requests[0].Body)
+	}
+}
+
+func TestStreamCompletionToolCalls(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{
+		ToolCalls: []modelstest.ToolCall{{ID: "call_1", Name: "search", Arguments: `{"q":"go"}`}},
+	})
+
+	msg, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("search"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "search" {
+		t.Errorf("tool calls = %+v", msg.ToolCalls)
+	}
+}
+
+func TestStreamCompletionIncomplete(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"partial"}, OmitDone: true})
+
+	msg, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("hi"), nil)
+	if !errors.Is(err, stream.ErrIncompleteStream) {
+		t.Fatalf("err = %v, want ErrIncompleteStream", err)
+	}
+	if msg.Content == nil || *msg.Content != "partial" {
+		t.Errorf("partial content = %v", msg.Content)
+	}
+	var partial *PartialCompletion
+	if !errors.As(err, &partial) {
+		t.Fatalf("err = %v, want a *PartialCompletion", err)
+	}
+	if partial.Content() != "partial" || partial.Tokens != 2 || !partial.Estimated {
+		t.Errorf("partial = %+v", partial)
+	}
+}
+
+func TestStreamCompletionDeadlinePartial(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.ChunkDelay = time.Second
+	srv.Enqueue(modelstest.Response{Chunks: []string{"Hello", " world"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := newTestClient(srv).streamCompletion(ctx, testRequest("hi"), nil)
+	var partial *PartialCompletion
+	if !errors.As(err, &partial) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a *PartialCompletion caused by the deadline", err)
+	}
+
+	var out strings.Builder
+	if err := (executionSummary{Model: "openai/gpt-4.1", TotalDuration: time.Second}).writeJSON(&out, err); err != nil {
+		t.Fatal(err)
+	}
+	var metrics summaryMetrics
+	if err := json.Unmarshal([]byte(out.String()), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Partial == nil || !strings.Contains(metrics.Partial.Cause, "deadline exceeded") {
+		t.Errorf("metrics = %s", out.String())
+	}
+}
+
+func TestStreamCompletionSplitCharacters(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Events: []string{
+		"{\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hi \xf0\x9f\"}}]}",
+		"{\"choices\":[{\"index\":0,\"delta\":{\"content\":\"\x91\x8b \\ud83c\"}}]}",
+		`{"choices":[{"index":0,"delta":{"content":"\udf89"},"finish_reason":"stop"}]}`,
+	}})
+	var out strings.Builder
+	msg, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("hi"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hi 👋 🎉"; out.String() != want || *msg.Content != want {
+		t.Errorf("output %q, message %q, want %q", out.String(), *msg.Content, want)
+	}
+}
+
+func TestStreamCompletionHTTPError(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Status: http.StatusBadRequest, Body: `{"error":{"message":"bad model"}}`})
+
+	_, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("hi"), nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "bad model" {
+		t.Errorf("err = %+v", apiErr)
+	}
+	if !errors.Is(err, ErrBadRequest) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("err = %v, want only ErrBadRequest", err)
+	}
+}
+
+func TestAPIErrorContentFilter(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{
+		Status: http.StatusBadRequest,
+		Body:   `{"error":{"code":"content_filter","message":"filtered","innererror":{"code":"ResponsibleAIPolicyViolation"}}}`,
+	})
+
+	_, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("hi"), nil)
+	if !errors.Is(err, ErrContentFiltered) {
+		t.Fatalf("err = %v, want ErrContentFiltered", err)
+	}
+	if !errors.Is(&RateLimitError{}, ErrRateLimited) {
+		t.Error("*RateLimitError does not match ErrRateLimited")
+	}
+}
+
+func TestStreamCompletionRateLimitBurst(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"ok"}})
+	chaos := modelstest.NewChaosTransport(nil, modelstest.ChaosOptions{
+		Schedule: []modelstest.Fault{modelstest.FaultRateLimit, modelstest.FaultRateLimit},
+	})
+
+	var waits int
+	client := newTestClientWithTransport(srv, chaos).WithRateLimitWait(func(time.Duration) { waits++ })
+	msg, err := client.streamCompletion(context.Background(), testRequest("hi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content == nil || *msg.Content != "ok" {
+		t.Errorf("content = %v", msg.Content)
+	}
+	if got := len(chaos.Injected()); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+	if waits == 0 {
+		t.Error("the client never waited for the rate limit to reset")
+	}
+}
+
+func TestStreamCompletionDisconnect(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"Hello", " world"}})
+	chaos := modelstest.NewChaosTransport(nil, modelstest.ChaosOptions{
+		Schedule:        []modelstest.Fault{modelstest.FaultDisconnect},
+		DisconnectAfter: 300,
+	})
+
+	_, err := newTestClientWithTransport(srv, chaos).streamCompletion(context.Background(), testRequest("hi"), nil)
+	var readErr *stream.ReadError
+	if !errors.As(err, &readErr) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("err = %v, want a *stream.ReadError wrapping io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestStreamCompletionTimeout(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	chaos := modelstest.NewChaosTransport(nil, modelstest.ChaosOptions{
+		Schedule: []modelstest.Fault{modelstest.FaultTimeout},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newTestClientWithTransport(srv, chaos).streamCompletion(ctx, testRequest("hi"), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestStreamCompletionSlowDrip(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"slow"}})
+	chaos := modelstest.NewChaosTransport(nil, modelstest.ChaosOptions{
+		Schedule:  []modelstest.Fault{modelstest.FaultSlowDrip},
+		DripSize:  16,
+		DripDelay: time.Microsecond,
+	})
+
+	msg, err := newTestClientWithTransport(srv, chaos).streamCompletion(context.Background(), testRequest("hi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content == nil || *msg.Content != "slow" {
+		t.Errorf("content = %v", msg.Content)
+	}
+}
+
+func TestGetChatCompletion(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{
+		Chunks: []string{"Hello", ", ", "world"},
+		Usage:  &modelstest.Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+	})
+
+	completion, err := newTestClient(srv).WithStrictDecoding(true).GetChatCompletion(context.Background(), testRequest("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(completion.Choices) != 1 {
+		t.Fatalf("got %d choices, want 1", len(completion.Choices))
+	}
+	choice := completion.Choices[0]
+	if choice.Content() != "Hello, world" {
+		t.Errorf("content = %q", choice.Content())
+	}
+	if choice.FinishReason == nil || *choice.FinishReason != "stop" {
+		t.Errorf("finish reason = %v", choice.FinishReason)
+	}
+	if completion.Usage == nil || completion.Usage.TotalTokens != 8 {
+		t.Errorf("usage = %+v", completion.Usage)
+	}
+	if body := string(srv.Requests()[0].Body); strings.Contains(body, `"stream":true`) {
+		t.Errorf("request asked for a stream: %s", body)
+	}
+}
+
+func TestSamplingParameters(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"ok"}}, modelstest.Response{Chunks: []string{"ok"}})
+	client := newTestClient(srv)
+
+	temperature, maxTokens := 0.5, 100
+	req := testRequest("hi")
+	req.Temperature = &temperature
+	req.MaxTokens = &maxTokens
+	req.Stop = []string{"\n\n", "END"}
+	req.User = "user-1"
+	if _, err := client.streamCompletion(context.Background(), req, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	req.Model = "openai/o4-mini"
+	if _, err := client.streamCompletion(context.Background(), req, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := srv.Requests()
+	for _, want := range []string{`"temperature":0.5`, `"max_tokens":100`, `"stop":["\n\n","END"]`, `"user":"user-1"`} {
+		if body := string(requests[0].Body); !strings.Contains(body, want) {
+			t.Errorf("request %s lacks %s", body, want)
+		}
+	}
+	if body := string(requests[1].Body); !strings.Contains(body, `"max_completion_tokens":100`) || strings.Contains(body, `"max_tokens"`) {
+		t.Errorf("reasoning model request %s should use max_completion_tokens", body)
+	}
+	if strings.Contains(string(requests[0].Body), `"top_p"`) {
+		t.Error("top_p was sent without being set")
+	}
+}
+
+func TestRunWithToolsForcedChoice(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(
+		modelstest.Response{ToolCalls: []modelstest.ToolCall{{ID: "call_1", Name: "now", Arguments: `{}`}}},
+		modelstest.Response{Chunks: []string{"It is noon."}},
+	)
+	registry := tools.NewRegistry()
+	if err := registry.Register(tools.Tool{Name: "now", Handler: func(context.Context, json.RawMessage) (string, error) {
+		return "12:00", nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := testRequest("what time is it?")
+	req.ToolChoice = &ToolChoice{Function: "now"}
+	messages, err := newTestClient(srv).RunWithTools(context.Background(), req, registry, ToolRunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages[len(messages)-1]; got.Content == nil || *got.Content != "It is noon." {
+		t.Errorf("final message = %+v", got)
+	}
+
+	requests := srv.Requests()
+	if body := string(requests[0].Body); !strings.Contains(body, `"tool_choice":{"function":{"name":"now"},"type":"function"}`) {
+		t.Errorf("first request lacks the forced tool choice: %s", body)
+	}
+	if body := string(requests[1].Body); strings.Contains(body, "tool_choice") || !strings.Contains(body, `"content":"12:00"`) {
+		t.Errorf("second request should carry the result without a tool choice: %s", body)
+	}
+}
+
+func TestStreamCompletionRetriesServerErrors(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(
+		modelstest.Response{Status: http.StatusServiceUnavailable, Body: `{"error":{"message":"overloaded"}}`},
+		modelstest.Response{Status: http.StatusBadGateway, Body: `{"error":{"message":"bad gateway"}}`},
+		modelstest.Response{Chunks: []string{"ok"}},
+	)
+
+	client := newTestClient(srv).WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	msg, err := client.streamCompletion(context.Background(), testRequest("hi"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content == nil || *msg.Content != "ok" {
+		t.Errorf("content = %v", msg.Content)
+	}
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("sent %d requests, want 3", got)
+	}
+}
+
+func TestStreamCompletionRetriesExhausted(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(
+		modelstest.Response{Status: http.StatusInternalServerError, Body: `{"error":{"message":"boom"}}`},
+		modelstest.Response{Status: http.StatusInternalServerError, Body: `{"error":{"message":"boom"}}`},
+	)
+
+	client := newTestClient(srv).WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	if _, err := client.streamCompletion(context.Background(), testRequest("hi"), nil); err == nil {
+		t.Fatal("expected an error once the attempts ran out")
+	}
+	if got := len(srv.Requests()); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestEmbedInBatches(t *testing.T) {
+	httpClient, err := providerHTTPClient(providerEcho, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewAzureClient(httpClient, "", NewDefaultAzureClientConfig())
+	inputs := []string{"a", "b c", "a", "d", "e"}
+	resp, err := embedInBatches(context.Background(), client, EmbeddingsOptions{Model: defaultEmbeddingModel}, inputs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != len(inputs) {
+		t.Fatalf("got %d embeddings, want %d", len(resp.Data), len(inputs))
+	}
+	for i, e := range resp.Data {
+		if e.Index != i {
+			t.Errorf("embedding %d has index %d", i, e.Index)
+		}
+	}
+	// The echo provider embeds equal inputs alike, so this checks the order across batches
+	if fmt.Sprint(resp.Data[0].Embedding) != fmt.Sprint(resp.Data[2].Embedding) || fmt.Sprint(resp.Data[0].Embedding) == fmt.Sprint(resp.Data[1].Embedding) {
+		t.Error("embeddings are not in input order")
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 6 {
+		t.Errorf("usage = %+v, want the sum over batches", resp.Usage)
+	}
+}
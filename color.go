@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Color modes accepted by -color.
+const (
+	colorAuto   = "auto"
+	colorNever  = "never"
+	colorAlways = "always"
+)
+
+// theme holds the SGR parameters used for each kind of output, such as "2" for dim or
+// "1;31" for bold red. An empty style leaves the text as is.
+type theme struct {
+	Code      string
+	Reasoning string
+	Summary   string
+	Error     string
+	Warning   string
+	Success   string
+	Added     string
+	Removed   string
+	// User is the color of the prompt in interactive mode.
+	User string
+}
+
+var themes = map[string]theme{
+	"dark": {
+		Code: "36", Reasoning: "2;3", Summary: "2", Error: "31", Warning: "33", Success: "32", Added: "32", Removed: "31", User: "1;32",
+	},
+	"light": {
+		Code: "34", Reasoning: "3", Summary: "90", Error: "31", Warning: "35", Success: "32", Added: "32", Removed: "31", User: "1;34",
+	},
+	"high-contrast": {
+		Code: "1;96", Reasoning: "3", Summary: "97", Error: "1;91", Warning: "1;93", Success: "1;92", Added: "1;92", Removed: "1;91", User: "1;97",
+	},
+}
+
+// palette paints text with a theme when color is enabled for the output.
+type palette struct {
+	enabled bool
+	theme   theme
+}
+
+// paint wraps s in the escape sequences for style.
+func (p palette) paint(style, s string) string {
+	if !p.enabled || style == "" || s == "" {
+		return s
+	}
+	return "\x1b[" + style + "m" + s + "\x1b[0m"
+}
+
+// colorOptions holds the -color and -theme flags of a command.
+type colorOptions struct {
+	mode  *string
+	theme *string
+}
+
+// addColorFlags registers -color and -theme on fs.
+func addColorFlags(fs *flag.FlagSet) colorOptions {
+	themeDefault := os.Getenv("GHMODELS_THEME")
+	if themeDefault == "" {
+		themeDefault = "dark"
+	}
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return colorOptions{
+		mode:  fs.String("color", colorAuto, "Color output: auto (when writing to a terminal and NO_COLOR is unset), never or always"),
+		theme: fs.String("theme", themeDefault, "Color theme: "+strings.Join(names, ", ")),
+	}
+}
+
+// palette returns the palette for output written to f.
+func (o colorOptions) palette(f *os.File) (palette, error) {
+	t, ok := themes[*o.theme]
+	if !ok {
+		return palette{}, fmt.Errorf("unknown theme: %s", *o.theme)
+	}
+	switch *o.mode {
+	case colorAlways:
+		return palette{enabled: true, theme: t}, nil
+	case colorNever:
+		return palette{theme: t}, nil
+	case colorAuto:
+		return palette{enabled: isColorTerminal(f), theme: t}, nil
+	default:
+		return palette{}, fmt.Errorf("unknown color mode: %s", *o.mode)
+	}
+}
+
+// isColorTerminal reports whether f is a terminal that should get color, following
+// https://no-color.org.
+func isColorTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && enableANSI(f)
+}
+
+// codeFence starts and ends fenced code blocks in Markdown.
+const codeFence = "```"
+
+// codeHighlighter paints fenced code blocks in streamed Markdown. Only the start of
+// each line is held back, until it is known whether the line is a fence.
+type codeHighlighter struct {
+	w     io.Writer
+	style string
+
+	lineStart bool
+	pending   []byte
+	inCode    bool
+	closing   bool
+	// cr holds back a carriage return until it is known whether it ends a CRLF line,
+	// so that colors are reset before the line ending rather than inside it.
+	cr bool
+}
+
+func newCodeHighlighter(w io.Writer, style string) *codeHighlighter {
+	return &codeHighlighter{w: w, style: style, lineStart: true}
+}
+
+// Write implements io.Writer.
+func (h *codeHighlighter) Write(p []byte) (int, error) {
+	var out []byte
+	for _, b := range p {
+		if h.lineStart {
+			h.pending = append(h.pending, b)
+			if b != '\n' && len(h.pending) < len(codeFence) && strings.HasPrefix(codeFence, string(h.pending)) {
+				continue
+			}
+			out = h.startLine(out)
+			continue
+		}
+		out = h.writeByte(out, b)
+	}
+	if _, err := h.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// startLine decides whether the pending line start opens or closes a code block, then
+// writes it.
+func (h *codeHighlighter) startLine(out []byte) []byte {
+	if string(h.pending) == codeFence {
+		if h.inCode {
+			h.closing = true
+		} else {
+			h.inCode = true
+		}
+	}
+	if h.inCode {
+		out = append(out, "\x1b["+h.style+"m"...)
+	}
+	h.lineStart = false
+	pending := h.pending
+	h.pending = h.pending[:0]
+	for _, b := range pending {
+		out = h.writeByte(out, b)
+	}
+	return out
+}
+
+func (h *codeHighlighter) writeByte(out []byte, b byte) []byte {
+	if h.cr && b != '\n' {
+		out = append(out, '\r')
+	}
+	if b == '\r' {
+		h.cr = true
+		return out
+	}
+	if b != '\n' {
+		h.cr = false
+		return append(out, b)
+	}
+	if h.inCode {
+		out = append(out, "\x1b[0m"...)
+	}
+	if h.closing {
+		h.inCode, h.closing = false, false
+	}
+	h.lineStart = true
+	if h.cr {
+		h.cr = false
+		out = append(out, '\r')
+	}
+	return append(out, '\n')
+}
+
+// Flush writes any held back line start and resets the color.
+func (h *codeHighlighter) Flush() error {
+	var out []byte
+	if len(h.pending) > 0 {
+		out = h.startLine(out)
+	}
+	if h.cr {
+		h.cr = false
+		out = append(out, '\r')
+	}
+	if h.inCode && !h.lineStart {
+		out = append(out, "\x1b[0m"...)
+	}
+	_, err := h.w.Write(out)
+	return err
+}
+
+// writer returns a writer painting everything written to w with style.
+func (p palette) writer(w io.Writer, style string) io.Writer {
+	if !p.enabled || style == "" {
+		return w
+	}
+	return paintWriter{w: w, style: style}
+}
+
+// paintWriter paints each write with style.
+type paintWriter struct {
+	w     io.Writer
+	style string
+}
+
+func (pw paintWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Each line is painted separately so that colors never span a newline, including
+	// the carriage return of CRLF line endings
+	lines := strings.Split(string(p), "\n")
+	for i, line := range lines {
+		text, cr := strings.CutSuffix(line, "\r")
+		if text != "" {
+			lines[i] = "\x1b[" + pw.style + "m" + text + "\x1b[0m"
+			if cr {
+				lines[i] += "\r"
+			}
+		}
+	}
+	if _, err := io.WriteString(pw.w, strings.Join(lines, "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
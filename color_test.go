@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeHighlighter(t *testing.T) {
+	input := "Run:\n```sh\ngo test\n```\n`inline` done"
+	want := "Run:\n\x1b[36m```sh\x1b[0m\n\x1b[36mgo test\x1b[0m\n\x1b[36m```\x1b[0m\n`inline` done"
+
+	// Fences split across writes must be detected like whole ones
+	for _, size := range []int{1, 2, 5, len(input)} {
+		var out strings.Builder
+		h := newCodeHighlighter(&out, "36")
+		for i := 0; i < len(input); i += size {
+			if _, err := h.Write([]byte(input[i:min(i+size, len(input))])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("writes of %d bytes: got %q, want %q", size, out.String(), want)
+		}
+	}
+}
+
+func TestCodeHighlighterCRLF(t *testing.T) {
+	input := "Run:\r\n```sh\r\ngo test\r\n```\r\ndone\r"
+	want := "Run:\r\n\x1b[36m```sh\x1b[0m\r\n\x1b[36mgo test\x1b[0m\r\n\x1b[36m```\x1b[0m\r\ndone\r"
+
+	for _, size := range []int{1, 3, len(input)} {
+		var out strings.Builder
+		h := newCodeHighlighter(&out, "36")
+		for i := 0; i < len(input); i += size {
+			if _, err := h.Write([]byte(input[i:min(i+size, len(input))])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("writes of %d bytes: got %q, want %q", size, out.String(), want)
+		}
+	}
+
+	var out strings.Builder
+	_, _ = palette{enabled: true}.writer(&out, "2").Write([]byte("a\r\nb"))
+	if want := "\x1b[2ma\x1b[0m\r\n\x1b[2mb\x1b[0m"; out.String() != want {
+		t.Errorf("painted %q, want %q", out.String(), want)
+	}
+}
+
+func TestPaletteDisabled(t *testing.T) {
+	p := palette{theme: themes["dark"]}
+	if got := p.paint(p.theme.Error, "boom"); got != "boom" {
+		t.Errorf("paint = %q, want plain text", got)
+	}
+}
+
+func TestCodeHighlighterEdges(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"unterminated block", "```\ncode", "\x1b[36m```\x1b[0m\n\x1b[36mcode\x1b[0m"},
+		{"too few backticks", "``x\n", "``x\n"},
+		{"fence inside a line", "a ```\nb", "a ```\nb"},
+		{"held back line start", "hi\n``", "hi\n``"},
+		{"empty lines in a block", "```\n\n```\n", "\x1b[36m```\x1b[0m\n\x1b[36m\x1b[0m\n\x1b[36m```\x1b[0m\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			h := newCodeHighlighter(&out, "36")
+			if _, err := h.Write([]byte(tt.input)); err != nil {
+				t.Fatal(err)
+			}
+			if err := h.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestColorOptionsPalette(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		mode, theme string
+		wantEnabled bool
+		wantErr     string
+	}{
+		{mode: colorAlways, theme: "dark", wantEnabled: true},
+		{mode: colorNever, theme: "light"},
+		{mode: colorAuto, theme: "high-contrast"}, // f is not a terminal
+		{mode: colorAlways, theme: "solarized", wantErr: "unknown theme: solarized"},
+		{mode: "sometimes", theme: "dark", wantErr: "unknown color mode: sometimes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.theme, func(t *testing.T) {
+			p, err := colorOptions{mode: &tt.mode, theme: &tt.theme}.palette(f)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.enabled != tt.wantEnabled || p.theme != themes[tt.theme] {
+				t.Errorf("palette = %+v, want enabled %v with the %s theme", p, tt.wantEnabled, tt.theme)
+			}
+		})
+	}
+}
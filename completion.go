@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+// completionAccumulator assembles streamed chunks into a complete assistant message.
+type completionAccumulator struct {
+	content      strings.Builder
+	toolCalls    map[int]*ToolCall
+	toolCallIDs  map[string]int
+	finishReason string
+	usage        *Usage
+	filter       contentFilterTracker
+}
+
+func newCompletionAccumulator() *completionAccumulator {
+	return &completionAccumulator{toolCalls: map[int]*ToolCall{}, toolCallIDs: map[string]int{}}
+}
+
+// add merges a chunk into the accumulated message and returns any new content.
+func (a *completionAccumulator) add(completion ChatCompletion) string {
+	var content string
+	if completion.Usage != nil {
+		a.usage = completion.Usage
+	}
+	a.filter.add(completion)
+	for _, choice := range completion.Choices {
+		if choice.FinishReason != nil {
+			a.finishReason = *choice.FinishReason
+		}
+		content += choice.Content()
+		for _, delta := range choice.ToolCalls() {
+			index := a.toolCallIndex(delta)
+			call, ok := a.toolCalls[index]
+			if !ok {
+				call = &ToolCall{Type: "function"}
+				a.toolCalls[index] = call
+			}
+			if delta.ID != "" {
+				call.ID = delta.ID
+				a.toolCallIDs[delta.ID] = index
+			}
+			if delta.Type != "" {
+				call.Type = delta.Type
+			}
+			// Names are sent whole, but some backends repeat them on every delta
+			if call.Function.Name == "" {
+				call.Function.Name = delta.Function.Name
+			}
+			call.Function.Arguments += delta.Function.Arguments
+		}
+	}
+	a.content.WriteString(content)
+	return content
+}
+
+// toolCallIndex returns which tool call a delta belongs to. Parallel calls may be
+// interleaved, so deltas are matched by index, falling back to the call id for
+// backends that omit the index.
+func (a *completionAccumulator) toolCallIndex(delta ToolCall) int {
+	if delta.Index != nil {
+		return *delta.Index
+	}
+	if delta.ID != "" {
+		if index, ok := a.toolCallIDs[delta.ID]; ok {
+			return index
+		}
+		return len(a.toolCalls)
+	}
+	// An index-less continuation belongs to the most recent call
+	return max(len(a.toolCalls)-1, 0)
+}
+
+// message returns the accumulated assistant message.
+func (a *completionAccumulator) message() ChatMessage {
+	msg := ChatMessage{Role: ChatMessageRoleAssistant}
+	if a.content.Len() > 0 {
+		content := a.content.String()
+		msg.Content = &content
+	}
+
+	indices := make([]int, 0, len(a.toolCalls))
+	for i := range a.toolCalls {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	for _, i := range indices {
+		call := *a.toolCalls[i]
+		msg.ToolCalls = append(msg.ToolCalls, call)
+	}
+	return msg
+}
+
+// partial returns what was accumulated as a *PartialCompletion cut short by cause.
+func (a *completionAccumulator) partial(cause error) *PartialCompletion {
+	return newPartialCompletion(a.message(), a.usage, cause)
+}
+
+// PartialCompletion is returned when a stream is cut short by a deadline,
+// cancellation or an upstream error, with what was received before it ended.
+type PartialCompletion struct {
+	// Message holds the content and tool calls received.
+	Message ChatMessage
+	// Tokens is the number of completion tokens received, as reported by the service
+	// or, if it reported none, estimated from the content.
+	Tokens int
+	// Estimated reports whether Tokens is an estimate.
+	Estimated bool
+	// Cause is the error that ended the stream, such as context.DeadlineExceeded.
+	Cause error
+}
+
+func newPartialCompletion(msg ChatMessage, usage *Usage, cause error) *PartialCompletion {
+	p := &PartialCompletion{Message: msg, Cause: cause}
+	if usage != nil {
+		p.Tokens = usage.CompletionTokens
+	} else {
+		p.Tokens, p.Estimated = estimateTokens(p.Content()), true
+	}
+	return p
+}
+
+func (e *PartialCompletion) Error() string {
+	tokens := fmt.Sprint(e.Tokens)
+	if e.Estimated {
+		tokens = "~" + tokens
+	}
+	return fmt.Sprintf("the response is incomplete after %s tokens: %v", tokens, e.Cause)
+}
+
+func (e *PartialCompletion) Unwrap() error {
+	return e.Cause
+}
+
+// Content returns the content received.
+func (e *PartialCompletion) Content() string {
+	if e.Message.Content == nil {
+		return ""
+	}
+	return *e.Message.Content
+}
+
+// readCompletions calls fn for each completion in the stream until it ends.
+func readCompletions(reader stream.Reader[ChatCompletion], fn func(ChatCompletion) error) error {
+	for {
+		completion, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(completion); err != nil {
+			return err
+		}
+	}
+}
+
+// streamCompletion sends req, writes streamed content to out if it is non-nil and
+// returns the complete assistant message. If the content filter stopped the response,
+// the partial message is returned with a *ContentFilterError; if the stream was cut
+// short, it is returned with a *PartialCompletion.
+func (c *AzureClient) streamCompletion(ctx context.Context, req ChatCompletionOptions, out io.Writer) (ChatMessage, error) {
+	acc, err := c.streamAccumulated(ctx, req, out)
+	return acc.message(), err
+}
+
+// streamAccumulated is streamCompletion returning the accumulated completion, for
+// callers that also need its finish reason and usage.
+func (c *AzureClient) streamAccumulated(ctx context.Context, req ChatCompletionOptions, out io.Writer) (*completionAccumulator, error) {
+	if out == nil {
+		out = io.Discard
+	}
+
+	acc := newCompletionAccumulator()
+	resp, err := c.GetChatCompletionStream(ctx, req)
+	if err != nil {
+		return acc, err
+	}
+	defer resp.Reader.Close()
+
+	var writeErr error
+	err = readCompletions(resp.Reader, func(completion ChatCompletion) error {
+		_, writeErr = io.WriteString(out, acc.add(completion))
+		return writeErr
+	})
+	if err != nil && err != writeErr {
+		err = acc.partial(err)
+	}
+	if err == nil {
+		err = acc.filter.err()
+	}
+	return acc, err
+}
+
+// completionReader presents a non-streamed completion as a stream of one event, so
+// that it can be handled like a streamed one.
+type completionReader struct {
+	completion *ChatCompletion
+}
+
+func (r *completionReader) Read() (ChatCompletion, error) {
+	if r.completion == nil {
+		return ChatCompletion{}, io.EOF
+	}
+	completion := *r.completion
+	r.completion = nil
+	return completion, nil
+}
+
+func (r *completionReader) Close() error {
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Chunk shapes as streamed by GitHub Models.
+const (
+	promptFilterChunk = `{"choices":[],"created":0,"id":"","model":"","object":"","prompt_filter_results":[{"prompt_index":0,"content_filter_results":{"hate":{"filtered":false,"severity":"safe"},"jailbreak":{"filtered":false,"detected":false}}}]}`
+	roleChunk         = `{"choices":[{"content_filter_results":{},"delta":{"content":"","role":"assistant","refusal":null},"finish_reason":null,"index":0,"logprobs":null}],"created":1730000000,"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","object":"chat.completion.chunk"}`
+	contentChunk      = `{"choices":[{"content_filter_results":{"hate":{"filtered":false,"severity":"safe"}},"delta":{"content":"Hello"},"finish_reason":null,"index":0,"logprobs":null}],"created":1730000000,"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","object":"chat.completion.chunk"}`
+	emptyDeltaChunk   = `{"choices":[{"content_filter_results":{},"delta":{},"finish_reason":"stop","index":0,"logprobs":null}],"created":1730000000,"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","object":"chat.completion.chunk"}`
+	noDeltaChunk      = `{"choices":[{"finish_reason":"stop","index":0}],"created":1730000000,"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","object":"chat.completion.chunk"}`
+	usageChunk        = `{"choices":[],"created":1730000000,"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","object":"chat.completion.chunk","usage":{"completion_tokens":1,"prompt_tokens":9,"total_tokens":10}}`
+	toolCallChunk     = `{"choices":[{"delta":{"content":null,"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"search","arguments":""}}]},"finish_reason":null,"index":0}]}`
+	toolArgsChunk     = `{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"q\":\"go\"}"}}]},"finish_reason":null,"index":0}]}`
+)
+
+func decodeChunk(t *testing.T, data string) ChatCompletion {
+	t.Helper()
+	var completion ChatCompletion
+	if err := json.Unmarshal([]byte(data), &completion); err != nil {
+		t.Fatalf("decoding chunk: %v", err)
+	}
+	return completion
+}
+
+func TestChatChoiceAccessors(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunk   string
+		content string
+	}{
+		{"prompt filter", promptFilterChunk, ""},
+		{"role only", roleChunk, ""},
+		{"content", contentChunk, "Hello"},
+		{"empty delta", emptyDeltaChunk, ""},
+		{"no delta", noDeltaChunk, ""},
+		{"usage", usageChunk, ""},
+		{"tool call", toolCallChunk, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content string
+			for _, choice := range decodeChunk(t, tt.chunk).Choices {
+				content += choice.Content()
+				if reasoning := choice.ReasoningContent(); reasoning != "" {
+					t.Errorf("ReasoningContent() = %q, want empty", reasoning)
+				}
+			}
+			if content != tt.content {
+				t.Errorf("Content() = %q, want %q", content, tt.content)
+			}
+		})
+	}
+}
+
+func TestChatChoiceNilDelta(t *testing.T) {
+	var choice ChatChoice
+	if choice.Content() != "" || choice.ReasoningContent() != "" || choice.ToolCalls() != nil {
+		t.Errorf("zero ChatChoice returned non-empty values")
+	}
+}
+
+func TestCompletionAccumulator(t *testing.T) {
+	acc := newCompletionAccumulator()
+	for _, chunk := range []string{promptFilterChunk, roleChunk, contentChunk, emptyDeltaChunk, usageChunk} {
+		acc.add(decodeChunk(t, chunk))
+	}
+
+	msg := acc.message()
+	if msg.Content == nil || *msg.Content != "Hello" {
+		t.Errorf("content = %v, want Hello", msg.Content)
+	}
+	if len(msg.ToolCalls) != 0 {
+		t.Errorf("got %d tool calls, want none", len(msg.ToolCalls))
+	}
+	if acc.finishReason != "stop" {
+		t.Errorf("finish reason = %q, want stop", acc.finishReason)
+	}
+	if acc.usage == nil || acc.usage.TotalTokens != 10 {
+		t.Errorf("usage = %+v, want 10 total tokens", acc.usage)
+	}
+	if err := acc.filter.err(); err != nil {
+		t.Errorf("filter error = %v, want nil", err)
+	}
+}
+
+func TestCompletionAccumulatorRoleOnly(t *testing.T) {
+	acc := newCompletionAccumulator()
+	for _, chunk := range []string{roleChunk, noDeltaChunk} {
+		if content := acc.add(decodeChunk(t, chunk)); content != "" {
+			t.Errorf("add() = %q, want empty", content)
+		}
+	}
+	if msg := acc.message(); msg.Content != nil {
+		t.Errorf("content = %q, want nil", *msg.Content)
+	}
+}
+
+func TestCompletionAccumulatorToolCalls(t *testing.T) {
+	acc := newCompletionAccumulator()
+	for _, chunk := range []string{toolCallChunk, toolArgsChunk, noDeltaChunk} {
+		acc.add(decodeChunk(t, chunk))
+	}
+
+	msg := acc.message()
+	if msg.Content != nil {
+		t.Errorf("content = %q, want nil", *msg.Content)
+	}
+	if len(msg.ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(msg.ToolCalls))
+	}
+	call := msg.ToolCalls[0]
+	if call.ID != "call_1" || call.Function.Name != "search" || call.Function.Arguments != `{"q":"go"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+}
+
+func TestCompletionAccumulatorToolCallDeltas(t *testing.T) {
+	// delta wraps tool call deltas in a chunk
+	delta := func(calls string) string {
+		return `{"choices":[{"index":0,"delta":{"tool_calls":[` + calls + `]}}]}`
+	}
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string // id, name and arguments of each call
+	}{
+		{
+			name: "interleaved parallel calls",
+			chunks: []string{
+				delta(`{"index":0,"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"q\":"}}`),
+				delta(`{"index":1,"id":"call_2","type":"function","function":{"name":"fetch","arguments":"{\"url\":"}}`),
+				delta(`{"index":0,"function":{"arguments":"\"go\"}"}},{"index":1,"function":{"arguments":"\"a\"}"}}`),
+			},
+			want: []string{`call_1 search {"q":"go"}`, `call_2 fetch {"url":"a"}`},
+		},
+		{
+			name: "deltas matched by id without an index",
+			chunks: []string{
+				delta(`{"id":"call_1","type":"function","function":{"name":"search","arguments":"{"}}`),
+				delta(`{"id":"call_2","type":"function","function":{"name":"fetch","arguments":"{"}}`),
+				delta(`{"id":"call_1","function":{"arguments":"}"}}`),
+				delta(`{"id":"call_2","function":{"arguments":"}"}}`),
+			},
+			want: []string{"call_1 search {}", "call_2 fetch {}"},
+		},
+		{
+			name: "continuation without an index or id",
+			chunks: []string{
+				delta(`{"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"q\""}}`),
+				delta(`{"function":{"arguments":":\"go\"}"}}`),
+			},
+			want: []string{`call_1 search {"q":"go"}`},
+		},
+		{
+			name: "function name repeated on every delta",
+			chunks: []string{
+				delta(`{"index":0,"id":"call_1","type":"function","function":{"name":"search","arguments":"{"}}`),
+				delta(`{"index":0,"function":{"name":"search","arguments":"}"}}`),
+			},
+			want: []string{"call_1 search {}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := newCompletionAccumulator()
+			for _, chunk := range tt.chunks {
+				acc.add(decodeChunk(t, chunk))
+			}
+			var got []string
+			for _, call := range acc.message().ToolCalls {
+				got = append(got, call.ID+" "+call.Function.Name+" "+call.Function.Arguments)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("tool calls = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
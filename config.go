@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configDir returns the directory holding user configuration such as saved prompts.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ghmodelsproxy"), nil
+}
+
+// userConfig holds defaults for the chat command's flags, read from config.yml:
+//
+//	model: openai/gpt-4.1
+//	inference_url: https://models.github.ai/inference/chat/completions
+//	temperature: 0.2
+//	system: You are a terse assistant
+//	retry:
+//	  max_attempts: 3
+//	  delay: 1s
+//	output: text
+//	lang: German
+//	style: terse,no-comments
+//	styles:
+//	  pirate: Talk like a pirate.
+//	prices:
+//	  openai/gpt-4.1: {input: 2.00, output: 8.00}
+type userConfig struct {
+	Model        string   `yaml:"model"`
+	InferenceURL string   `yaml:"inference_url"`
+	Temperature  *float64 `yaml:"temperature"`
+	System       string   `yaml:"system"`
+	Retry        struct {
+		MaxAttempts int    `yaml:"max_attempts"`
+		Delay       string `yaml:"delay"`
+	} `yaml:"retry"`
+	Output string `yaml:"output"`
+	Lang   string `yaml:"lang"`
+	Style  string `yaml:"style"`
+	// Styles adds snippets usable with -style, or replaces the built-in ones.
+	Styles map[string]string `yaml:"styles"`
+	// Prices holds the prices of models, for estimating the cost of requests.
+	Prices map[string]modelPrice `yaml:"prices"`
+}
+
+// modelPrice is the price of a model in USD per million tokens.
+type modelPrice struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// price returns the configured price of model, if any.
+func (c *userConfig) price(model string) *modelPrice {
+	for name, price := range c.Prices {
+		if strings.EqualFold(resolveModel(name), model) {
+			return &price
+		}
+	}
+	return nil
+}
+
+// configPath returns the path of the config file.
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yml"), nil
+}
+
+// loadUserConfig reads the config file, returning an empty configuration if there
+// is none. Unknown keys are rejected so that typos do not go unnoticed.
+func loadUserConfig() (*userConfig, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &userConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := &userConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// configSetting is a flag whose default can come from the environment or the config
+// file.
+type configSetting struct {
+	flag string
+	env  string
+	file string
+}
+
+// settings returns the configurable flags with their values from the file.
+func (c *userConfig) settings() []configSetting {
+	s := []configSetting{
+		{flag: "model", env: "GHMODELS_MODEL", file: c.Model},
+		{flag: "inference-url", env: "GHMODELS_INFERENCE_URL", file: c.InferenceURL},
+		{flag: "temperature", env: "GHMODELS_TEMPERATURE"},
+		{flag: "system", env: "GHMODELS_SYSTEM", file: c.System},
+		{flag: "max-attempts", env: "GHMODELS_MAX_ATTEMPTS"},
+		{flag: "retry-delay", env: "GHMODELS_RETRY_DELAY", file: c.Retry.Delay},
+		{flag: "output", env: "GHMODELS_OUTPUT", file: c.Output},
+		{flag: "lang", env: "GHMODELS_LANG", file: c.Lang},
+		{flag: "style", env: "GHMODELS_STYLE", file: c.Style},
+	}
+	if c.Temperature != nil {
+		s[2].file = strconv.FormatFloat(*c.Temperature, 'g', -1, 64)
+	}
+	if c.Retry.MaxAttempts != 0 {
+		s[4].file = strconv.Itoa(c.Retry.MaxAttempts)
+	}
+	return s
+}
+
+// applyConfigDefaults replaces the defaults of the configurable flags of fs with the
+// values of their environment variables or, if unset, of the project file, if any,
+// and then of the config file, so that flags given on the command line take
+// precedence over all of them. It returns the names of the flags whose defaults were
+// replaced.
+func applyConfigDefaults(fs *flag.FlagSet, cfg *userConfig, project *projectConfig) (map[string]bool, error) {
+	configured := map[string]bool{}
+	for _, setting := range cfg.settings() {
+		value, source := os.Getenv(setting.env), setting.env
+		if value == "" && project != nil {
+			value, source = project.setting(setting.flag), project.path
+		}
+		if value == "" {
+			value, source = setting.file, "the config file"
+		}
+		if value == "" {
+			continue
+		}
+		f := fs.Lookup(setting.flag)
+		if err := f.Value.Set(value); err != nil {
+			return nil, fmt.Errorf("invalid -%s default %q from %s: %w", setting.flag, value, source, err)
+		}
+		f.DefValue = value
+		configured[setting.flag] = true
+	}
+	return configured, nil
+}
+
+// projectFileName is the name of the project file, looked up from the working
+// directory upwards.
+const projectFileName = ".ghmodels.yaml"
+
+// projectConfig holds the defaults of a project, read from its .ghmodels.yaml:
+//
+//	model: openai/gpt-4.1-mini
+//	system: You review the Go code of this repository.
+//	templates:
+//	  commit:
+//	    description: Write a commit message
+//	    prompt: "Write a commit message for this diff:\n{{.diff}}"
+//	    model: openai/gpt-4o-mini
+//
+// Its values override those of the config file, but not the environment or flags.
+// Settings that could send requests and the token elsewhere, such as inference_url,
+// are not read from project files, since those come with the repositories they are
+// in.
+type projectConfig struct {
+	Model  string `yaml:"model"`
+	System string `yaml:"system"`
+	// Templates are prompts usable with -use, taking precedence over saved prompts
+	// of the same name.
+	Templates map[string]projectTemplate `yaml:"templates"`
+
+	// path is the file the project was read from.
+	path string
+}
+
+// projectTemplate is a prompt template of a project file.
+type projectTemplate struct {
+	Description     string `yaml:"description"`
+	Prompt          string `yaml:"prompt"`
+	System          string `yaml:"system"`
+	Model           string `yaml:"model"`
+	ReasoningEffort string `yaml:"reasoning_effort"`
+}
+
+// setting returns the project's value for the flag called name, or "" if it sets
+// none.
+func (p *projectConfig) setting(name string) string {
+	switch name {
+	case "model":
+		return p.Model
+	case "system":
+		return p.System
+	}
+	return ""
+}
+
+// template returns the template called name as a saved prompt, if the project has
+// one.
+func (p *projectConfig) template(name string) (*SavedPrompt, bool) {
+	if p == nil {
+		return nil, false
+	}
+	t, ok := p.Templates[name]
+	if !ok {
+		return nil, false
+	}
+	return &SavedPrompt{
+		Name:            name,
+		Description:     t.Description,
+		Prompt:          t.Prompt,
+		System:          t.System,
+		Model:           t.Model,
+		ReasoningEffort: t.ReasoningEffort,
+	}, true
+}
+
+// findProjectFile returns the project file in dir or the closest of its parents, if
+// there is one.
+func findProjectFile(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, projectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// loadProjectConfig reads the project file of the working directory, returning nil
+// if there is none. As in the config file, unknown keys are rejected.
+func loadProjectConfig() (*projectConfig, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	path, ok := findProjectFile(wd)
+	if !ok {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	project := &projectConfig{path: path}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(project); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return project, nil
+}
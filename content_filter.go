@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// finishReasonContentFilter is the finish_reason of a completion stopped by the content filter.
+const finishReasonContentFilter = "content_filter"
+
+// ContentFilterCategory represents the verdict of one content filter category. Harm
+// categories report a Severity, while detection categories such as jailbreak report Detected.
+type ContentFilterCategory struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity,omitempty"`
+	Detected *bool  `json:"detected,omitempty"`
+	// Citation identifies the source of detected protected material, when known.
+	Citation json.RawMessage `json:"citation,omitempty"`
+}
+
+// ContentFilterResults maps content filter category names to their verdicts.
+type ContentFilterResults map[string]ContentFilterCategory
+
+// Triggered returns the sorted names of categories that filtered content or detected a problem.
+func (r ContentFilterResults) Triggered() []string {
+	var categories []string
+	for name, category := range r {
+		if category.Filtered || (category.Detected != nil && *category.Detected) {
+			categories = append(categories, name)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// PromptFilterResult represents the content filter verdict for one prompt.
+type PromptFilterResult struct {
+	PromptIndex          int                  `json:"prompt_index"`
+	ContentFilterResults ContentFilterResults `json:"content_filter_results"`
+}
+
+// ContentFilterError is returned when the content filter stopped a completion.
+type ContentFilterError struct {
+	// Categories holds the categories that triggered the filter, when reported.
+	Categories []string
+}
+
+func (e *ContentFilterError) Error() string {
+	if len(e.Categories) == 0 {
+		return "the response was stopped by the content filter"
+	}
+	return "the response was stopped by the content filter: " + strings.Join(e.Categories, ", ")
+}
+
+// contentFilterTracker collects the categories triggered across a stream of completions.
+type contentFilterTracker struct {
+	categories map[string]bool
+	filtered   bool
+}
+
+func (t *contentFilterTracker) add(completion ChatCompletion) {
+	for _, result := range completion.PromptFilterResults {
+		t.record(result.ContentFilterResults)
+	}
+	for _, choice := range completion.Choices {
+		t.record(choice.ContentFilterResults)
+		if choice.FinishReason != nil && *choice.FinishReason == finishReasonContentFilter {
+			t.filtered = true
+		}
+	}
+}
+
+func (t *contentFilterTracker) record(results ContentFilterResults) {
+	for _, name := range results.Triggered() {
+		if t.categories == nil {
+			t.categories = map[string]bool{}
+		}
+		t.categories[name] = true
+	}
+}
+
+// err returns a *ContentFilterError if the stream was stopped by the content filter.
+func (t *contentFilterTracker) err() error {
+	if !t.filtered {
+		return nil
+	}
+	e := &ContentFilterError{}
+	for name := range t.categories {
+		e.Categories = append(e.Categories, name)
+	}
+	sort.Strings(e.Categories)
+	return e
+}
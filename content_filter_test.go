@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestContentFilterResultsTriggered(t *testing.T) {
+	detected, notDetected := true, false
+	tests := []struct {
+		name    string
+		results ContentFilterResults
+		want    []string
+	}{
+		{"none", nil, nil},
+		{"safe", ContentFilterResults{"hate": {Severity: "safe"}, "jailbreak": {Detected: &notDetected}}, nil},
+		{"filtered", ContentFilterResults{"violence": {Filtered: true, Severity: "high"}, "hate": {Severity: "safe"}}, []string{"violence"}},
+		{"detected but not filtered", ContentFilterResults{"protected_material_code": {Detected: &detected}}, []string{"protected_material_code"}},
+		{"sorted", ContentFilterResults{"violence": {Filtered: true}, "hate": {Filtered: true}, "jailbreak": {Detected: &detected}}, []string{"hate", "jailbreak", "violence"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.results.Triggered(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Triggered() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentFilterTracker(t *testing.T) {
+	const (
+		promptJailbreak = `{"choices":[],"prompt_filter_results":[{"prompt_index":0,"content_filter_results":{"jailbreak":{"filtered":true,"detected":true}}}]}`
+		choiceViolence  = `{"choices":[{"index":0,"delta":{"content":"x"},"content_filter_results":{"violence":{"filtered":true,"severity":"medium"}}}]}`
+		choiceSafe      = `{"choices":[{"index":0,"delta":{"content":"x"},"content_filter_results":{"hate":{"filtered":false,"severity":"safe"}}}]}`
+		stopped         = `{"choices":[{"index":0,"delta":{},"finish_reason":"content_filter"}]}`
+		finished        = `{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`
+	)
+	tests := []struct {
+		name    string
+		chunks  []string
+		wantErr string
+	}{
+		{"finished", []string{choiceSafe, finished}, ""},
+		{"triggered but not stopped", []string{choiceViolence, finished}, ""},
+		{"stopped without categories", []string{choiceSafe, stopped}, "the response was stopped by the content filter"},
+		{"stopped", []string{choiceViolence, stopped}, "the response was stopped by the content filter: violence"},
+		{"prompt and choice categories", []string{promptJailbreak, choiceViolence, choiceViolence, stopped}, "the response was stopped by the content filter: jailbreak, violence"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracker contentFilterTracker
+			for _, chunk := range tt.chunks {
+				tracker.add(decodeChunk(t, chunk))
+			}
+			err := tracker.err()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			var filterErr *ContentFilterError
+			if !errors.As(err, &filterErr) {
+				t.Fatalf("err = %v, want a *ContentFilterError", err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("err = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamCompletionContentFilter(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"partial"}, FinishReason: finishReasonContentFilter})
+
+	_, err := newTestClient(srv).streamCompletion(context.Background(), testRequest("hi"), io.Discard)
+	var filterErr *ContentFilterError
+	if !errors.As(err, &filterErr) {
+		t.Errorf("err = %v, want a *ContentFilterError", err)
+	}
+}
@@ -1,21 +1,62 @@
 package conversation
 
+// ChatMessageRole represents the role of a chat message.
 type ChatMessageRole string
 
 const (
+	// ChatMessageRoleAssistant represents a message from the model.
 	ChatMessageRoleAssistant ChatMessageRole = "assistant"
-	ChatMessageRoleSystem    ChatMessageRole = "system"
-	ChatMessageRoleUser      ChatMessageRole = "user"
+	// ChatMessageRoleDeveloper represents developer instructions, which replace system
+	// messages for reasoning models.
+	ChatMessageRoleDeveloper ChatMessageRole = "developer"
+	// ChatMessageRoleSystem represents a system message.
+	ChatMessageRoleSystem ChatMessageRole = "system"
+	// ChatMessageRoleTool represents the result of a tool call.
+	ChatMessageRoleTool ChatMessageRole = "tool"
+	// ChatMessageRoleUser represents a message from the user.
+	ChatMessageRoleUser ChatMessageRole = "user"
 )
 
+// ChatMessage represents a message from a chat thread with a model.
 type ChatMessage struct {
-	Content *string         `json:"content,omitempty"`
-	Role    ChatMessageRole `json:"role"`
+	Content      *string         `json:"content,omitempty"`
+	Role         ChatMessageRole `json:"role"`
+	ToolCalls    []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID   string          `json:"tool_call_id,omitempty"`
+	CacheControl *CacheControl   `json:"cache_control,omitempty"`
+	// Prefix marks a trailing assistant message the model must continue, where supported.
+	Prefix bool `json:"prefix,omitempty"`
 }
 
+// CacheControl is a prompt caching hint marking the end of a prefix the provider should cache.
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// FunctionCall represents the function name and arguments of a tool call.
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolCall represents a tool call requested by the model. When streamed, Index
+// identifies which call a partial delta belongs to.
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// Conversation is a chat thread. It can be saved to disk and loaded to continue it
+// later; the prefill is not saved.
 type Conversation struct {
-	Messages     []ChatMessage
-	SystemPrompt string
+	// Model is the model the conversation is held with.
+	Model        string        `json:"model,omitempty"`
+	SystemPrompt string        `json:"system_prompt,omitempty"`
+	Messages     []ChatMessage `json:"messages"`
+	// Prefill is the beginning of the next assistant response, which the model continues.
+	Prefill string `json:"-"`
 }
 
 // Ptr returns a pointer to the given value.
@@ -31,12 +72,27 @@ func (c *Conversation) AddMessage(role ChatMessageRole, content string) {
 	})
 }
 
+// SetPrefill seeds the next assistant response with content for the model to continue.
+func (c *Conversation) SetPrefill(content string) {
+	c.Prefill = content
+}
+
+// CompletePrefill records the assistant response made of the prefill and the model's
+// continuation, and clears the prefill.
+func (c *Conversation) CompletePrefill(continuation string) {
+	c.AddMessage(ChatMessageRoleAssistant, c.Prefill+continuation)
+	c.Prefill = ""
+}
+
 // GetMessages returns the messages in the conversation.
 func (c *Conversation) GetMessages() []ChatMessage {
 	length := len(c.Messages)
 	if c.SystemPrompt != "" {
 		length++
 	}
+	if c.Prefill != "" {
+		length++
+	}
 
 	messages := make([]ChatMessage, length)
 	startIndex := 0
@@ -53,5 +109,13 @@ func (c *Conversation) GetMessages() []ChatMessage {
 		messages[startIndex+i] = message
 	}
 
+	if c.Prefill != "" {
+		messages[length-1] = ChatMessage{
+			Content: Ptr(c.Prefill),
+			Role:    ChatMessageRoleAssistant,
+			Prefix:  true,
+		}
+	}
+
 	return messages
 }
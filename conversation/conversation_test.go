@@ -0,0 +1,108 @@
+package conversation
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGetMessagesPrefill(t *testing.T) {
+	tests := []struct {
+		name         string
+		systemPrompt string
+		prefill      string
+		want         []ChatMessage
+	}{
+		{
+			name: "no prefill",
+			want: []ChatMessage{{Role: ChatMessageRoleUser, Content: Ptr("hi")}},
+		},
+		{
+			name:    "prefill",
+			prefill: "{",
+			want: []ChatMessage{
+				{Role: ChatMessageRoleUser, Content: Ptr("hi")},
+				{Role: ChatMessageRoleAssistant, Content: Ptr("{"), Prefix: true},
+			},
+		},
+		{
+			name:         "prefill and system prompt",
+			systemPrompt: "be brief",
+			prefill:      "Sure,",
+			want: []ChatMessage{
+				{Role: ChatMessageRoleSystem, Content: Ptr("be brief")},
+				{Role: ChatMessageRoleUser, Content: Ptr("hi")},
+				{Role: ChatMessageRoleAssistant, Content: Ptr("Sure,"), Prefix: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Conversation{SystemPrompt: tt.systemPrompt}
+			c.AddMessage(ChatMessageRoleUser, "hi")
+			c.SetPrefill(tt.prefill)
+			if got := c.GetMessages(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMessages() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletePrefill(t *testing.T) {
+	c := &Conversation{}
+	c.AddMessage(ChatMessageRoleUser, "list three colors as JSON")
+	c.SetPrefill(`{"colors":`)
+	c.CompletePrefill(` ["red", "green", "blue"]}`)
+
+	if c.Prefill != "" {
+		t.Errorf("prefill = %q after completing it", c.Prefill)
+	}
+	want := []ChatMessage{
+		{Role: ChatMessageRoleUser, Content: Ptr("list three colors as JSON")},
+		{Role: ChatMessageRoleAssistant, Content: Ptr(`{"colors": ["red", "green", "blue"]}`)},
+	}
+	if got := c.GetMessages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMessages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestChatMessageJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		message ChatMessage
+		want    string
+	}{
+		{"user", ChatMessage{Role: ChatMessageRoleUser, Content: Ptr("hi")}, `{"content":"hi","role":"user"}`},
+		{"empty content", ChatMessage{Role: ChatMessageRoleAssistant, Content: Ptr("")}, `{"content":"","role":"assistant"}`},
+		{
+			"tool call",
+			ChatMessage{Role: ChatMessageRoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "now", Arguments: "{}"}}}},
+			`{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"now","arguments":"{}"}}]}`,
+		},
+		{
+			"streamed tool call",
+			ChatMessage{Role: ChatMessageRoleAssistant, ToolCalls: []ToolCall{{Index: Ptr(1), Function: FunctionCall{Arguments: `"a"`}}}},
+			`{"role":"assistant","tool_calls":[{"index":1,"function":{"arguments":"\"a\""}}]}`,
+		},
+		{"tool result", ChatMessage{Role: ChatMessageRoleTool, Content: Ptr("noon"), ToolCallID: "call_1"}, `{"content":"noon","role":"tool","tool_call_id":"call_1"}`},
+		{"cached", ChatMessage{Role: ChatMessageRoleSystem, Content: Ptr("rules"), CacheControl: &CacheControl{Type: "ephemeral"}}, `{"content":"rules","role":"system","cache_control":{"type":"ephemeral"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("marshaled %s, want %s", data, tt.want)
+			}
+			var got ChatMessage
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.message) {
+				t.Errorf("unmarshaled %+v, want %+v", got, tt.message)
+			}
+		})
+	}
+}
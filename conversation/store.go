@@ -0,0 +1,109 @@
+package conversation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jsonlHeader is the first line of a conversation saved as JSONL; each following
+// line holds a message.
+type jsonlHeader struct {
+	Model        string `json:"model,omitempty"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+}
+
+// isJSONL reports whether path is saved as JSONL rather than a JSON document.
+func isJSONL(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".jsonl")
+}
+
+// Save writes the conversation to path, as JSONL if the path ends in .jsonl and as
+// JSON otherwise. The file is replaced atomically, so an interrupted save keeps the
+// previous version.
+func (c *Conversation) Save(path string) error {
+	var buf bytes.Buffer
+	if isJSONL(path) {
+		enc := json.NewEncoder(&buf)
+		if err := enc.Encode(jsonlHeader{Model: c.Model, SystemPrompt: c.SystemPrompt}); err != nil {
+			return err
+		}
+		for _, m := range c.Messages {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+	} else {
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a conversation saved with Save. An error satisfying
+// errors.Is(err, fs.ErrNotExist) means there is no conversation at path.
+func Load(path string) (*Conversation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Conversation
+	if !isJSONL(path) {
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("reading conversation %s: %w", path, err)
+		}
+		return &c, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	// The header is the first line that is not blank; line only numbers errors
+	headerRead := false
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if !headerRead {
+			var header jsonlHeader
+			if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+				return nil, fmt.Errorf("reading conversation %s: line %d: %w", path, line, err)
+			}
+			c.Model, c.SystemPrompt = header.Model, header.SystemPrompt
+			headerRead = true
+			continue
+		}
+		var m ChatMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("reading conversation %s: line %d: %w", path, line, err)
+		}
+		c.Messages = append(c.Messages, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading conversation %s: %w", path, err)
+	}
+	return &c, nil
+}
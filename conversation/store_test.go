@@ -0,0 +1,95 @@
+package conversation
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	c := &Conversation{Model: "openai/gpt-4.1", SystemPrompt: "be brief", Prefill: "not saved"}
+	c.AddMessage(ChatMessageRoleUser, "hi")
+	c.AddMessage(ChatMessageRoleAssistant, "hello\nthere")
+
+	for _, name := range []string{"session.json", "session.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nested", name)
+			if err := c.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := *c
+			want.Prefill = ""
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("loaded %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestLoadJSONL(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Conversation
+		wantErr string
+	}{
+		{
+			name: "header and messages",
+			data: `{"model":"openai/gpt-4.1","system_prompt":"be brief"}` + "\n" + `{"role":"user","content":"hi"}` + "\n",
+			want: Conversation{Model: "openai/gpt-4.1", SystemPrompt: "be brief", Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: ptr("hi")}}},
+		},
+		{
+			name: "leading blank lines",
+			data: "\n  \n" + `{"model":"openai/gpt-4.1"}` + "\n\n" + `{"role":"user","content":"hi"}` + "\n",
+			want: Conversation{Model: "openai/gpt-4.1", Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: ptr("hi")}}},
+		},
+		{
+			name:    "malformed header after a blank line",
+			data:    "\n{not json\n",
+			wantErr: "line 2:",
+		},
+		{
+			name:    "malformed message",
+			data:    `{"model":"openai/gpt-4.1"}` + "\n\n" + `{"role":` + "\n",
+			wantErr: "line 3:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.jsonl")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("loaded %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// diffOp is one step of an edit script.
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// diffTokens returns the edit script turning a into b, computed from their longest
+// common subsequence.
+func diffTokens(a, b []string) []diffOp {
+	// Common prefixes and suffixes are unchanged, and trimming them keeps the table small
+	var prefix, suffix []diffOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]diffOp{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := prefix
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return append(ops, suffix...)
+}
+
+// writeUnifiedDiff writes a line diff of a and b with the given number of context lines.
+func writeUnifiedDiff(w io.Writer, p palette, nameA, nameB, a, b string, context int) {
+	ops := diffTokens(strings.Split(a, "\n"), strings.Split(b, "\n"))
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB)
+
+	// Each change is shown with context lines around it; overlapping windows merge into one hunk
+	type hunk struct{ from, to int }
+	var hunks []hunk
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		from, to := max(i-context, 0), min(i+context+1, len(ops))
+		if n := len(hunks); n > 0 && from <= hunks[n-1].to {
+			hunks[n-1].to = to
+		} else {
+			hunks = append(hunks, hunk{from, to})
+		}
+	}
+
+	lineA, lineB, next := 1, 1, 0
+	for _, h := range hunks {
+		for ; next < h.from; next++ {
+			lineA++
+			lineB++
+		}
+		var countA, countB int
+		for _, op := range ops[h.from:h.to] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		// As in diff -u, an empty side is numbered by the line it follows
+		startA, startB := lineA, lineB
+		if countA == 0 {
+			startA--
+		}
+		if countB == 0 {
+			startB--
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+		for _, op := range ops[h.from:h.to] {
+			line := string(op.kind) + op.text
+			switch op.kind {
+			case '-':
+				line = p.paint(p.theme.Removed, line)
+			case '+':
+				line = p.paint(p.theme.Added, line)
+			}
+			fmt.Fprintln(w, line)
+		}
+		lineA += countA
+		lineB += countB
+		next = h.to
+	}
+}
+
+// wordPattern splits text into words and the whitespace between them.
+var wordPattern = regexp.MustCompile(`\s+|[^\s]+`)
+
+// writeWordDiff writes a and b as one text with removed words in [-...-] and added
+// words in {+...+}, like git diff --word-diff.
+func writeWordDiff(w io.Writer, p palette, a, b string) {
+	for _, op := range diffTokens(wordPattern.FindAllString(a, -1), wordPattern.FindAllString(b, -1)) {
+		switch op.kind {
+		case '-':
+			fmt.Fprint(w, p.paint(p.theme.Removed, "[-"+op.text+"-]"))
+		case '+':
+			fmt.Fprint(w, p.paint(p.theme.Added, "{+"+op.text+"+}"))
+		default:
+			fmt.Fprint(w, op.text)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// runDiff implements the `diff` subcommand.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	models := fs.String("models", "", "Two comma-separated models to compare on the prompt")
+	words := fs.Bool("word", false, "Show a word-level diff instead of a unified line diff")
+	contextLines := fs.Int("context", 3, "Lines of context in the unified diff")
+	colors := addColorFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff -models <a>,<b> [flags] <prompt>\n       %s diff [flags] <file a> <file b>\n", os.Args[0], os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	p, err := colors.palette(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var names, outputs [2]string
+	if *models != "" {
+		parts := splitList(*models)
+		if len(parts) != 2 || fs.NArg() != 1 {
+			fs.Usage()
+			return 2
+		}
+		for i, part := range parts {
+			names[i] = resolveModel(part)
+		}
+		outputs, err = compareModels(context.TODO(), newCLIClient(), names, fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		for i := range names {
+			names[i] = fs.Arg(i)
+			data, err := os.ReadFile(names[i])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			outputs[i] = string(data)
+		}
+	}
+
+	a, b := strings.TrimSuffix(outputs[0], "\n"), strings.TrimSuffix(outputs[1], "\n")
+	if *words {
+		writeWordDiff(os.Stdout, p, a, b)
+	} else {
+		writeUnifiedDiff(os.Stdout, p, names[0], names[1], a, b, *contextLines)
+	}
+	return 0
+}
+
+// compareModels sends prompt to both models concurrently and returns their responses.
+func compareModels(ctx context.Context, client *AzureClient, models [2]string, prompt string) ([2]string, error) {
+	var outputs [2]string
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := ChatCompletionOptions{
+				Model:    model,
+				Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: &prompt}},
+			}
+			msg, err := client.streamCompletion(ctx, req, nil)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", model, err)
+				return
+			}
+			if msg.Content != nil {
+				outputs[i] = *msg.Content
+			}
+		}()
+	}
+	wg.Wait()
+	return outputs, errors.Join(errs[:]...)
+}
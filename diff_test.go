@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{"identical", []string{"a", "b"}, []string{"a", "b"}, []string{" a", " b"}},
+		{"both empty", nil, nil, nil},
+		{"added", nil, []string{"x"}, []string{"+x"}},
+		{"removed", []string{"a", "b"}, nil, []string{"-a", "-b"}},
+		{"changed", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{" a", "-b", "+x", " c"}},
+		{"moved ends", []string{"x", "a", "b"}, []string{"a", "b", "y"}, []string{"-x", " a", " b", "+y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, op := range diffTokens(tt.a, tt.b) {
+				got = append(got, string(op.kind)+op.text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffTokens(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	const lines = "1\n2\n3\n4\n5\n6\n7"
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"identical", lines, lines, 3, ""},
+		{"one hunk", lines, "1\n2\nthree\n4\n5\n6\n7", 1, "@@ -2,3 +2,3 @@\n 2\n-3\n+three\n 4\n"},
+		{"two hunks", lines, "one\n2\n3\n4\n5\n6\nseven", 1, "@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+seven\n"},
+		{"merged hunks", lines, "one\n2\n3\n4\n5\n6\nseven", 3, "@@ -1,7 +1,7 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n-7\n+seven\n"},
+		{"insertion without context", "a\nc", "a\nb\nc", 0, "@@ -1,0 +2,1 @@\n+b\n"},
+		{"deletion without context", "a\nb\nc", "a\nc", 0, "@@ -2,1 +1,0 @@\n-b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			writeUnifiedDiff(&out, palette{theme: themes["dark"]}, "a", "b", tt.a, tt.b, tt.context)
+			if want := "--- a\n+++ b\n" + tt.want; out.String() != want {
+				t.Errorf("diff =\n%s\nwant\n%s", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestWriteWordDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		enabled bool
+		want    string
+	}{
+		{"identical", "the quick fox", "the quick fox", false, "the quick fox\n"},
+		{"changed word", "the quick fox", "the slow fox", false, "the [-quick-]{+slow+} fox\n"},
+		{"changed space", "a b", "a  b", false, "a[- -]{+  +}b\n"},
+		{"added words", "the fox", "the quick brown fox", false, "the {+quick+}{+ +}{+brown+}{+ +}fox\n"},
+		{"colored", "the quick fox", "the slow fox", true, "the \x1b[31m[-quick-]\x1b[0m\x1b[32m{+slow+}\x1b[0m fox\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			writeWordDiff(&out, palette{enabled: tt.enabled, theme: themes["dark"]}, tt.a, tt.b)
+			if out.String() != tt.want {
+				t.Errorf("diff = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
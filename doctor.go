@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/auth"
+)
+
+// maxClockSkew is the clock difference beyond which doctor warns.
+const maxClockSkew = time.Minute
+
+// checkStatus is the outcome of a doctor check.
+type checkStatus string
+
+const (
+	checkPass checkStatus = "PASS"
+	checkWarn checkStatus = "WARN"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "SKIP"
+)
+
+// checkResult reports one doctor check, with a hint on how to fix a problem.
+type checkResult struct {
+	Name   string
+	Status checkStatus
+	Detail string
+	Hint   string
+}
+
+// doctor runs the checks, sharing what earlier checks learned with later ones.
+type doctor struct {
+	client      *http.Client
+	cfg         *AzureClientConfig
+	token       string
+	tokenSource string
+	// serverDate is the Date header of the inference endpoint, for the clock check.
+	serverDate time.Time
+}
+
+func (d *doctor) checkToken() checkResult {
+	d.token, d.tokenSource = auth.TokenForHost("github.com")
+	if d.token == "" {
+		return checkResult{
+			Name:   "GitHub token",
+			Status: checkFail,
+			Detail: "no token found for github.com",
+			Hint:   "run `gh auth login`, or set GITHUB_TOKEN or GH_TOKEN",
+		}
+	}
+	return checkResult{Name: "GitHub token", Status: checkPass, Detail: "found in " + d.tokenSource}
+}
+
+func (d *doctor) checkConfig() checkResult {
+	path, err := configPath()
+	if err != nil {
+		return checkResult{Name: "Config file", Status: checkSkip, Detail: err.Error()}
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return checkResult{Name: "Config file", Status: checkSkip, Detail: "no config file at " + path}
+	}
+	if _, err := loadUserConfig(); err != nil {
+		return checkResult{Name: "Config file", Status: checkFail, Detail: err.Error(), Hint: "fix or remove " + path}
+	}
+	return checkResult{Name: "Config file", Status: checkPass, Detail: path}
+}
+
+func (d *doctor) checkProject() checkResult {
+	project, err := loadProjectConfig()
+	if err != nil {
+		return checkResult{Name: "Project file", Status: checkFail, Detail: err.Error(), Hint: "fix or remove the project's " + projectFileName}
+	}
+	if project == nil {
+		return checkResult{Name: "Project file", Status: checkSkip, Detail: "no " + projectFileName + " in the working directory or its parents"}
+	}
+	return checkResult{Name: "Project file", Status: checkPass, Detail: project.path}
+}
+
+func (d *doctor) checkProxyEnv() checkResult {
+	var set []string
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "NO_PROXY", "no_proxy"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		set = append(set, name)
+		if strings.HasPrefix(strings.ToUpper(name), "NO_PROXY") {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			if !strings.Contains(value, "://") {
+				if u2, err2 := url.Parse("http://" + value); err2 == nil && u2.Host != "" {
+					continue // Go accepts proxies without a scheme
+				}
+			}
+			return checkResult{
+				Name:   "Proxy environment",
+				Status: checkFail,
+				Detail: fmt.Sprintf("%s=%q is not a valid proxy URL", name, value),
+				Hint:   "set it to a URL such as http://proxy.example.com:8080, or unset it",
+			}
+		}
+	}
+	if len(set) == 0 {
+		return checkResult{Name: "Proxy environment", Status: checkPass, Detail: "no proxy configured"}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, d.cfg.InferenceURL, nil)
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return checkResult{Name: "Proxy environment", Status: checkFail, Detail: err.Error(), Hint: "fix or unset " + strings.Join(set, ", ")}
+	}
+	detail := "inference requests bypass the proxy"
+	if proxy != nil {
+		detail = "inference requests use " + proxy.Redacted()
+	}
+	return checkResult{Name: "Proxy environment", Status: checkPass, Detail: detail + " (" + strings.Join(set, ", ") + " set)"}
+}
+
+func (d *doctor) checkInference(ctx context.Context) checkResult {
+	name := "Inference endpoint"
+	// An empty request is rejected after authentication, which checks reachability and
+	// the token without spending quota
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.InferenceURL, strings.NewReader(`{"model":"","messages":[]}`))
+	if err != nil {
+		return checkResult{Name: name, Status: checkFail, Detail: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		hint := "check your network connection, firewall and proxy settings"
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && urlErr.Timeout() {
+			hint = "the request timed out; " + hint
+		}
+		return checkResult{Name: name, Status: checkFail, Detail: err.Error(), Hint: hint}
+	}
+	resp.Body.Close()
+	latency := time.Since(start).Round(time.Millisecond)
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		d.serverDate = date.Add(latency / 2)
+	}
+
+	switch {
+	case d.token == "":
+		return checkResult{Name: name, Status: checkPass, Detail: fmt.Sprintf("reachable in %v", latency)}
+	case resp.StatusCode == http.StatusUnauthorized:
+		return checkResult{
+			Name:   name,
+			Status: checkFail,
+			Detail: "the token was rejected (401)",
+			Hint:   "the token may be expired or revoked; run `gh auth refresh` or create a new token",
+		}
+	case resp.StatusCode == http.StatusForbidden:
+		return checkResult{
+			Name:   name,
+			Status: checkFail,
+			Detail: "the token is not allowed to use GitHub Models (403)",
+			Hint:   "fine-grained tokens need the models:read permission; check your organization's Copilot and Models policies",
+		}
+	case resp.StatusCode >= 500:
+		return checkResult{Name: name, Status: checkWarn, Detail: "the service returned " + resp.Status, Hint: "check https://www.githubstatus.com"}
+	default:
+		return checkResult{Name: name, Status: checkPass, Detail: fmt.Sprintf("reachable in %v and the token was accepted", latency)}
+	}
+}
+
+func (d *doctor) checkCatalog(ctx context.Context) checkResult {
+	client := NewAzureClient(d.client, d.token, d.cfg)
+	models, err := client.ListModels(ctx)
+	if err != nil {
+		return checkResult{Name: "Model catalog", Status: checkFail, Detail: err.Error(), Hint: "check access to " + d.cfg.CatalogURL + "; without the catalog, requests are sent unvalidated"}
+	}
+	return checkResult{Name: "Model catalog", Status: checkPass, Detail: fmt.Sprintf("%d models available", len(models))}
+}
+
+func (d *doctor) checkClock() checkResult {
+	if d.serverDate.IsZero() {
+		return checkResult{Name: "Clock skew", Status: checkSkip, Detail: "the server did not report its time"}
+	}
+	skew := time.Since(d.serverDate).Round(time.Second)
+	if skew.Abs() > maxClockSkew {
+		return checkResult{
+			Name:   "Clock skew",
+			Status: checkWarn,
+			Detail: fmt.Sprintf("the local clock is off by %v", skew),
+			Hint:   "enable time synchronization (NTP); a skewed clock breaks rate limit waits and token expiry",
+		}
+	}
+	return checkResult{Name: "Clock skew", Status: checkPass, Detail: fmt.Sprintf("within %v", maxClockSkew)}
+}
+
+// runDoctor implements the `doctor` subcommand.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each network check")
+	colors := addColorFlags(fs)
+	_ = fs.Parse(args)
+	p, err := colors.palette(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	styles := map[checkStatus]string{checkPass: p.theme.Success, checkWarn: p.theme.Warning, checkFail: p.theme.Error, checkSkip: p.theme.Summary}
+
+	d := &doctor{client: &http.Client{Timeout: *timeout}, cfg: NewDefaultAzureClientConfig()}
+	ctx := context.TODO()
+	results := []checkResult{d.checkToken(), d.checkConfig(), d.checkProject(), d.checkProxyEnv(), d.checkInference(ctx), d.checkCatalog(ctx), d.checkClock()}
+
+	failed := false
+	for _, r := range results {
+		fmt.Printf("%s %s: %s\n", p.paint(styles[r.Status], "["+string(r.Status)+"]"), r.Name, r.Detail)
+		if r.Hint != "" && r.Status != checkPass {
+			fmt.Printf("       %s\n", r.Hint)
+		}
+		failed = failed || r.Status == checkFail
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctorCheckInference(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		status     int
+		want       checkStatus
+		wantDetail string
+	}{
+		{"accepted", "token", http.StatusBadRequest, checkPass, "the token was accepted"},
+		{"no token", "", http.StatusUnauthorized, checkPass, "reachable"},
+		{"rejected", "token", http.StatusUnauthorized, checkFail, "the token was rejected (401)"},
+		{"forbidden", "token", http.StatusForbidden, checkFail, "not allowed to use GitHub Models (403)"},
+		{"outage", "token", http.StatusServiceUnavailable, checkWarn, "503 Service Unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			d := &doctor{client: srv.Client(), cfg: &AzureClientConfig{InferenceURL: srv.URL}, token: tt.token}
+			got := d.checkInference(context.Background())
+			if got.Status != tt.want || !strings.Contains(got.Detail, tt.wantDetail) {
+				t.Errorf("checkInference() = %+v, want %s with %q", got, tt.want, tt.wantDetail)
+			}
+			if tt.token != "" && auth != "Bearer "+tt.token {
+				t.Errorf("Authorization = %q, want the token", auth)
+			}
+			if d.serverDate.IsZero() {
+				t.Error("the server's Date was not recorded")
+			}
+		})
+	}
+}
+
+func TestDoctorCheckInferenceUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	d := &doctor{client: &http.Client{}, cfg: &AzureClientConfig{InferenceURL: srv.URL}, token: "token"}
+	if got := d.checkInference(context.Background()); got.Status != checkFail || !strings.Contains(got.Hint, "network connection") {
+		t.Errorf("checkInference() = %+v, want a failure with a network hint", got)
+	}
+	if got := d.checkClock(); got.Status != checkSkip {
+		t.Errorf("checkClock() = %+v, want it skipped without a server time", got)
+	}
+}
+
+func TestDoctorCheckClock(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverDate time.Time
+		want       checkStatus
+	}{
+		{"unknown", time.Time{}, checkSkip},
+		{"in sync", time.Now().Add(-5 * time.Second), checkPass},
+		{"behind", time.Now().Add(2 * time.Minute), checkWarn},
+		{"ahead", time.Now().Add(-2 * time.Minute), checkWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &doctor{serverDate: tt.serverDate}
+			if got := d.checkClock(); got.Status != tt.want {
+				t.Errorf("checkClock() = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoctorCheckProxyEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want checkStatus
+	}{
+		{"none", nil, checkPass},
+		{"proxy URL", map[string]string{"HTTPS_PROXY": "http://proxy.example.com:8080"}, checkPass},
+		{"without a scheme", map[string]string{"https_proxy": "proxy.example.com:8080"}, checkPass},
+		{"no proxy only", map[string]string{"NO_PROXY": "*.internal, 10.0.0.0/8"}, checkPass},
+		{"invalid", map[string]string{"HTTP_PROXY": "http://[::1"}, checkFail},
+		{"invalid without a scheme", map[string]string{"ALL_PROXY": "proxy.example.com:port"}, checkFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "NO_PROXY", "no_proxy"} {
+				t.Setenv(name, tt.env[name])
+			}
+			d := &doctor{cfg: &AzureClientConfig{InferenceURL: "https://models.github.ai/inference/chat/completions"}}
+			if got := d.checkProxyEnv(); got.Status != tt.want {
+				t.Errorf("checkProxyEnv() = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
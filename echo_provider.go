@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const (
+	// providerGitHub sends requests to GitHub Models.
+	providerGitHub = "github"
+	// providerEcho answers requests locally without credentials or network access.
+	providerEcho = "echo"
+)
+
+// defaultEchoTemplate repeats the last user message.
+const defaultEchoTemplate = "{{.Prompt}}"
+
+// echoTemplateData is the data available to echo templates.
+type echoTemplateData struct {
+	// Prompt is the content of the last user message.
+	Prompt string
+	// System is the content of the first system or developer message.
+	System   string
+	Model    string
+	Messages []ChatMessage
+}
+
+// echoTransport is an http.RoundTripper that answers chat completion requests by
+// streaming back the prompt rendered through a template, so the whole client and CLI
+// pipeline can run offline. Embeddings requests get vectors derived from a hash of
+// each input. Other endpoints respond with 404.
+type echoTransport struct {
+	tmpl *template.Template
+}
+
+func newEchoTransport(text string) (*echoTransport, error) {
+	if text == "" {
+		text = defaultEchoTemplate
+	}
+	tmpl, err := template.New("echo").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing echo template: %w", err)
+	}
+	return &echoTransport{tmpl: tmpl}, nil
+}
+
+func (t *echoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/embeddings") {
+		return echoEmbeddings(req)
+	}
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return echoResponse(req, http.StatusNotFound, "application/json", `{"error":{"code":"not_found","message":"not supported by the echo provider"}}`), nil
+	}
+
+	var opts ChatCompletionOptions
+	if err := json.NewDecoder(req.Body).Decode(&opts); err != nil {
+		return echoResponse(req, http.StatusBadRequest, "application/json", fmt.Sprintf(`{"error":{"code":"invalid_request","message":%q}}`, err.Error())), nil
+	}
+
+	data := echoTemplateData{Model: opts.Model, Messages: opts.Messages}
+	for _, m := range opts.Messages {
+		if m.Content == nil {
+			continue
+		}
+		switch m.Role {
+		case ChatMessageRoleUser:
+			data.Prompt = *m.Content
+		case ChatMessageRoleSystem, ChatMessageRoleDeveloper:
+			if data.System == "" {
+				data.System = *m.Content
+			}
+		}
+	}
+	var content strings.Builder
+	if err := t.tmpl.Execute(&content, data); err != nil {
+		return echoResponse(req, http.StatusBadRequest, "application/json", fmt.Sprintf(`{"error":{"code":"invalid_request","message":%q}}`, err.Error())), nil
+	}
+
+	fake := NewFakeStream(FakeStreamOptions{Content: content.String()})
+	if !opts.Stream {
+		return echoCompletion(req, fake, opts.Model)
+	}
+
+	var body bytes.Buffer
+	err := readCompletions(fake, func(completion ChatCompletion) error {
+		completion.Model = opts.Model
+		chunk, err := json.Marshal(completion)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "data: %s\n\n", chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	body.WriteString("data: [DONE]\n\n")
+	return echoResponse(req, http.StatusOK, "text/event-stream", body.String()), nil
+}
+
+func echoResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// providerHTTPClient returns the HTTP client that sends requests to provider.
+func providerHTTPClient(provider, echoTemplate string) (*http.Client, error) {
+	switch provider {
+	case "", providerGitHub:
+		return http.DefaultClient, nil
+	case providerEcho:
+		transport, err := newEchoTransport(echoTemplate)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: transport}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider: %s", provider)
+	}
+}
+
+// defaultProvider returns the provider selected by GHMODELS_PROVIDER.
+func defaultProvider() string {
+	if provider := os.Getenv("GHMODELS_PROVIDER"); provider != "" {
+		return provider
+	}
+	return providerGitHub
+}
+
+// echoEmbeddingDimensions is the length of echo embeddings unless the request asks
+// for fewer.
+const echoEmbeddingDimensions = 16
+
+// echoEmbeddings answers an embeddings request with a unit vector per input, taken
+// from its SHA-256, so that equal inputs get equal vectors.
+func echoEmbeddings(req *http.Request) (*http.Response, error) {
+	var opts EmbeddingsOptions
+	if err := json.NewDecoder(req.Body).Decode(&opts); err != nil {
+		return echoResponse(req, http.StatusBadRequest, "application/json", fmt.Sprintf(`{"error":{"code":"invalid_request","message":%q}}`, err.Error())), nil
+	}
+	dimensions := echoEmbeddingDimensions
+	if opts.Dimensions != nil && *opts.Dimensions > 0 && *opts.Dimensions < dimensions {
+		dimensions = *opts.Dimensions
+	}
+	resp := EmbeddingsResponse{Model: opts.Model, Usage: &EmbeddingsUsage{}}
+	for i, input := range opts.Input {
+		sum := sha256.Sum256([]byte(input))
+		vector := make([]float32, dimensions)
+		var norm float64
+		for j := range vector {
+			v := float64(sum[j%len(sum)]) - 127.5
+			vector[j] = float32(v)
+			norm += v * v
+		}
+		for j := range vector {
+			vector[j] /= float32(math.Sqrt(norm))
+		}
+		resp.Data = append(resp.Data, Embedding{Embedding: vector, Index: i})
+		tokens := len(strings.Fields(input))
+		resp.Usage.PromptTokens += tokens
+		resp.Usage.TotalTokens += tokens
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return echoResponse(req, http.StatusOK, "application/json", string(body)), nil
+}
+
+// echoCompletion folds the chunks of fake into a single non-streamed completion.
+func echoCompletion(req *http.Request, fake *FakeStream, model string) (*http.Response, error) {
+	completion := ChatCompletion{Object: "chat.completion", Model: model}
+	choice := ChatChoice{Message: &chatChoiceDelta{Role: string(ChatMessageRoleAssistant)}}
+	var content strings.Builder
+	err := readCompletions(fake, func(chunk ChatCompletion) error {
+		if chunk.Usage != nil {
+			completion.Usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			content.WriteString(c.Content())
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, c.ToolCalls()...)
+			if c.FinishReason != nil {
+				choice.FinishReason = c.FinishReason
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	text := content.String()
+	choice.Message.Content = &text
+	completion.Choices = []ChatChoice{choice}
+
+	body, err := json.Marshal(completion)
+	if err != nil {
+		return nil, err
+	}
+	return echoResponse(req, http.StatusOK, "application/json", string(body)), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+const (
+	embedFormatJSON   = "json"
+	embedFormatFloats = "floats"
+)
+
+// runEmbed implements the `embed` subcommand.
+func runEmbed(args []string) int {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	model := modelFlag(fs, "model", defaultEmbeddingModel, "Embedding model to use")
+	dimensions := fs.Int("dimensions", 0, "Number of dimensions of the vectors, for models that support shortening them; 0 for the model's default")
+	format := fs.String("format", embedFormatJSON, "Output format: json (the embeddings response) or floats (one number per line, a blank line between vectors)")
+	batch := fs.Int("batch", defaultEmbeddingsBatch, "Largest number of inputs per request")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s embed [flags] [text]\n\nEmbeds text, or each non-empty line of stdin if no text is given.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if *format != embedFormatJSON && *format != embedFormatFloats {
+		fmt.Fprintf(os.Stderr, "unknown -format %q: want json or floats\n", *format)
+		return 2
+	}
+	if *dimensions < 0 || *batch < 1 {
+		fmt.Fprintln(os.Stderr, "-dimensions must not be negative and -batch must be at least 1")
+		return 2
+	}
+
+	var inputs []string
+	if fs.NArg() > 0 {
+		inputs = []string{strings.Join(fs.Args(), " ")}
+	} else {
+		var err error
+		if inputs, err = readEmbedInputs(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if len(inputs) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := EmbeddingsOptions{Model: *model}
+	if *dimensions > 0 {
+		opts.Dimensions = dimensions
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	resp, err := embedInBatches(ctx, newCLIClient(), opts, inputs, *batch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if *format == embedFormatJSON {
+		if err := json.NewEncoder(out).Encode(resp); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	for i, e := range resp.Data {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		for _, f := range e.Embedding {
+			out.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+			out.WriteString("\n")
+		}
+	}
+	return 0
+}
+
+// readEmbedInputs returns the non-empty lines of r.
+func readEmbedInputs(r io.Reader) ([]string, error) {
+	var inputs []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs, scanner.Err()
+}
+
+// embedInBatches embeds inputs with client, batch inputs per request, and returns
+// the embeddings of all of them in input order with the usage summed over requests.
+func embedInBatches(ctx context.Context, client Client, opts EmbeddingsOptions, inputs []string, batch int) (*EmbeddingsResponse, error) {
+	merged := &EmbeddingsResponse{Model: opts.Model, Data: make([]Embedding, 0, len(inputs))}
+	for start := 0; start < len(inputs); start += batch {
+		end := min(start+batch, len(inputs))
+		opts.Input = inputs[start:end]
+		resp, err := client.GetEmbeddings(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != end-start {
+			return nil, fmt.Errorf("embeddings response has %d vectors for %d inputs", len(resp.Data), end-start)
+		}
+		vectors := make([]Embedding, end-start)
+		for _, e := range resp.Data {
+			if e.Index < 0 || e.Index >= len(vectors) {
+				return nil, fmt.Errorf("embeddings response has a vector for input %d of %d", e.Index, len(vectors))
+			}
+			vectors[e.Index] = Embedding{Embedding: e.Embedding, Index: start + e.Index}
+		}
+		merged.Data = append(merged.Data, vectors...)
+		if resp.Model != "" {
+			merged.Model = resp.Model
+		}
+		if resp.Usage != nil {
+			if merged.Usage == nil {
+				merged.Usage = &EmbeddingsUsage{}
+			}
+			merged.Usage.PromptTokens += resp.Usage.PromptTokens
+			merged.Usage.TotalTokens += resp.Usage.TotalTokens
+		}
+	}
+	return merged, nil
+}
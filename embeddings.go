@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+const defaultEmbeddingModel = "openai/text-embedding-3-small"
+
+// EmbeddingsOptions represents the options for an embeddings request.
+type EmbeddingsOptions struct {
+	Input      []string `json:"input"`
+	Model      string   `json:"model"`
+	Dimensions *int     `json:"dimensions,omitempty"`
+}
+
+// Embedding represents the embedding of a single input.
+type Embedding struct {
+	Embedding []float32 `json:"embedding"`
+	Index     int       `json:"index"`
+}
+
+// EmbeddingsUsage represents the token usage of an embeddings request.
+type EmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// EmbeddingsResponse represents a response to an embeddings request.
+type EmbeddingsResponse struct {
+	Data  []Embedding      `json:"data"`
+	Model string           `json:"model"`
+	Usage *EmbeddingsUsage `json:"usage,omitempty"`
+}
+
+// GetEmbeddings returns embeddings for the given inputs.
+func (c *AzureClient) GetEmbeddings(ctx context.Context, req EmbeddingsOptions) (*EmbeddingsResponse, error) {
+	resp, err := c.postJSON(ctx, c.cfg.EmbeddingsURL, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.handleHTTPError(resp)
+	}
+
+	var embeddingsResponse EmbeddingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingsResponse); err != nil {
+		return nil, err
+	}
+
+	return &embeddingsResponse, nil
+}
+
+// embedFunc adapts GetEmbeddings to return vectors in input order.
+func (c *AzureClient) embedFunc(model string) func(context.Context, []string) ([][]float32, error) {
+	return func(ctx context.Context, inputs []string) ([][]float32, error) {
+		resp, err := c.GetEmbeddings(ctx, EmbeddingsOptions{Input: inputs, Model: model})
+		if err != nil {
+			return nil, err
+		}
+		vectors := make([][]float32, len(inputs))
+		for _, e := range resp.Data {
+			if e.Index >= 0 && e.Index < len(vectors) {
+				vectors[e.Index] = e.Embedding
+			}
+		}
+		return vectors, nil
+	}
+}
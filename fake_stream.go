@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/conversation"
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+// fakeWords is the vocabulary FakeStream draws generated content from.
+var fakeWords = strings.Fields(`the model streams tokens one chunk at a time while the client
+renders them as they arrive and reports usage when the response finishes with a stop reason
+so that tests demos and load runs behave like the real service without any network access`)
+
+// FakeStreamOptions configures a synthetic completion stream.
+type FakeStreamOptions struct {
+	// Content is streamed verbatim. If empty, Words words are generated from Seed.
+	Content string
+	// Words is the number of generated words when Content is empty. Defaults to 50.
+	Words int
+	// Seed makes generated content and chunk boundaries reproducible.
+	Seed int64
+	// ChunkSize is the number of runes per chunk. Defaults to 4. Negative sizes pick a
+	// random size between 1 and -ChunkSize for each chunk.
+	ChunkSize int
+	// Delay is slept before each chunk.
+	Delay time.Duration
+	// ToolCalls are streamed after the content.
+	ToolCalls []ToolCall
+	// FailAfter injects Err after that many chunks. Zero never fails.
+	FailAfter int
+	// Err is the injected error. Defaults to stream.ErrIncompleteStream.
+	Err error
+}
+
+// FakeStream is a deterministic stream.Reader of synthetic chat completions for load
+// tests, UI development and demos.
+type FakeStream struct {
+	opts   FakeStreamOptions
+	chunks []ChatCompletion
+	next   int
+}
+
+var _ stream.Reader[ChatCompletion] = (*FakeStream)(nil)
+
+// NewFakeStream returns a FakeStream generated from opts.
+func NewFakeStream(opts FakeStreamOptions) *FakeStream {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	content := opts.Content
+	if content == "" {
+		words := opts.Words
+		if words <= 0 {
+			words = 50
+		}
+		generated := make([]string, words)
+		for i := range generated {
+			generated[i] = fakeWords[rng.Intn(len(fakeWords))]
+		}
+		content = strings.Join(generated, " ")
+	}
+	size := opts.ChunkSize
+	if size == 0 {
+		size = 4
+	}
+	if opts.Err == nil {
+		opts.Err = stream.ErrIncompleteStream
+	}
+
+	s := &FakeStream{opts: opts}
+	s.chunks = append(s.chunks, fakeChunk(chatChoiceDelta{Role: string(ChatMessageRoleAssistant), Content: conversation.Ptr("")}, nil))
+
+	runes := []rune(content)
+	for len(runes) > 0 {
+		n := size
+		if n < 0 {
+			n = 1 + rng.Intn(-size)
+		}
+		n = min(n, len(runes))
+		s.chunks = append(s.chunks, fakeChunk(chatChoiceDelta{Content: conversation.Ptr(string(runes[:n]))}, nil))
+		runes = runes[n:]
+	}
+
+	for i, call := range opts.ToolCalls {
+		call.Index = conversation.Ptr(i)
+		if call.Type == "" {
+			call.Type = "function"
+		}
+		s.chunks = append(s.chunks, fakeChunk(chatChoiceDelta{ToolCalls: []ToolCall{call}}, nil))
+	}
+
+	finishReason := "stop"
+	if len(opts.ToolCalls) > 0 {
+		finishReason = "tool_calls"
+	}
+	s.chunks = append(s.chunks, fakeChunk(chatChoiceDelta{}, &finishReason))
+
+	completionTokens := len(strings.Fields(content))
+	s.chunks = append(s.chunks, ChatCompletion{
+		Object:  "chat.completion.chunk",
+		Model:   "fake",
+		Choices: []ChatChoice{},
+		Usage:   &Usage{CompletionTokens: completionTokens, TotalTokens: completionTokens},
+	})
+	return s
+}
+
+func fakeChunk(delta chatChoiceDelta, finishReason *string) ChatCompletion {
+	return ChatCompletion{
+		Object:  "chat.completion.chunk",
+		Model:   "fake",
+		Choices: []ChatChoice{{Delta: &delta, FinishReason: finishReason}},
+	}
+}
+
+// Read returns the next chunk, io.EOF at the end of the stream or the injected error.
+func (s *FakeStream) Read() (ChatCompletion, error) {
+	if s.opts.FailAfter > 0 && s.next >= s.opts.FailAfter {
+		return ChatCompletion{}, s.opts.Err
+	}
+	if s.next >= len(s.chunks) {
+		return ChatCompletion{}, io.EOF
+	}
+	if s.opts.Delay > 0 {
+		time.Sleep(s.opts.Delay)
+	}
+	chunk := s.chunks[s.next]
+	s.next++
+	return chunk, nil
+}
+
+// Close implements stream.Reader.
+func (s *FakeStream) Close() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+func accumulate(t *testing.T, s *FakeStream) (ChatMessage, error) {
+	t.Helper()
+	acc := newCompletionAccumulator()
+	err := readCompletions(s, func(completion ChatCompletion) error {
+		acc.add(completion)
+		return nil
+	})
+	return acc.message(), err
+}
+
+func TestFakeStreamDeterministic(t *testing.T) {
+	a, err := accumulate(t, NewFakeStream(FakeStreamOptions{Seed: 7, ChunkSize: -5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := accumulate(t, NewFakeStream(FakeStreamOptions{Seed: 7, ChunkSize: -5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Content == nil || b.Content == nil || *a.Content != *b.Content {
+		t.Errorf("streams with the same seed differ")
+	}
+}
+
+func TestFakeStreamContentAndToolCalls(t *testing.T) {
+	msg, err := accumulate(t, NewFakeStream(FakeStreamOptions{
+		Content:   "héllo wörld 😀",
+		ChunkSize: 3,
+		ToolCalls: []ToolCall{{ID: "call_1", Function: FunctionCall{Name: "search", Arguments: "{}"}}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content == nil || *msg.Content != "héllo wörld 😀" {
+		t.Errorf("content = %v", msg.Content)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "search" {
+		t.Errorf("tool calls = %+v", msg.ToolCalls)
+	}
+}
+
+func TestFakeStreamFailAfter(t *testing.T) {
+	msg, err := accumulate(t, NewFakeStream(FakeStreamOptions{Content: "abcdefgh", ChunkSize: 2, FailAfter: 3}))
+	if !errors.Is(err, stream.ErrIncompleteStream) {
+		t.Fatalf("err = %v, want ErrIncompleteStream", err)
+	}
+	// The role chunk plus two content chunks arrive before the failure
+	if msg.Content == nil || *msg.Content != "abcd" {
+		t.Errorf("partial content = %v", msg.Content)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+const filterPrompt = `You are a text transformation filter in a UNIX pipeline. The user message is a document.
+Apply the following instruction to it and respond with only the transformed document: no
+introduction, no explanation, no closing remarks and no surrounding code fences unless the
+instruction asks for them. Preserve everything the instruction does not ask you to change.
+
+Instruction: `
+
+// filterRequest turns req into a request applying instruction to the document read
+// from stdin, keeping its model and sampling options.
+func filterRequest(req ChatCompletionOptions, instruction string, stdin io.Reader) (ChatCompletionOptions, error) {
+	if strings.TrimSpace(instruction) == "" {
+		return req, errors.New("-filter requires an instruction prompt")
+	}
+
+	document, err := io.ReadAll(stdin)
+	if err != nil {
+		return req, err
+	}
+	if len(document) == 0 {
+		return req, errors.New("-filter reads the document from stdin, but stdin was empty")
+	}
+
+	systemPrompt := filterPrompt + instruction
+	content := string(document)
+	req.Messages = []ChatMessage{
+		{Role: ChatMessageRoleSystem, Content: &systemPrompt},
+		{Role: ChatMessageRoleUser, Content: &content},
+	}
+	return req, nil
+}
+
+// runFilter sends a request built by filterRequest and writes only the transformed
+// document to out.
+func runFilter(ctx context.Context, client *AzureClient, req ChatCompletionOptions, out io.Writer) error {
+	msg, err := client.streamCompletion(ctx, req, out)
+	if err != nil {
+		return err
+	}
+
+	// Keep line-oriented tools downstream happy when the input ended with a newline
+	document := req.Messages[len(req.Messages)-1].Content
+	if msg.Content != nil && strings.HasSuffix(*document, "\n") && !strings.HasSuffix(*msg.Content, "\n") {
+		_, err = io.WriteString(out, "\n")
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestFilterRequest(t *testing.T) {
+	temperature := 0.2
+	base := testRequest("ignored")
+	base.Temperature = &temperature
+
+	tests := []struct {
+		name        string
+		instruction string
+		stdin       string
+		wantErr     string
+	}{
+		{name: "document", instruction: "uppercase it", stdin: "hello\n"},
+		{name: "no instruction", instruction: " \n", stdin: "hello\n", wantErr: "requires an instruction"},
+		{name: "empty stdin", instruction: "uppercase it", wantErr: "stdin was empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := filterRequest(base, tt.instruction, strings.NewReader(tt.stdin))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Model != base.Model || req.Temperature != &temperature {
+				t.Errorf("request lost its options: %+v", req)
+			}
+			if len(req.Messages) != 2 || *req.Messages[0].Content != filterPrompt+tt.instruction || *req.Messages[1].Content != tt.stdin {
+				t.Errorf("messages = %+v", req.Messages)
+			}
+		})
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		chunks   []string
+		want     string
+	}{
+		{name: "adds the document's trailing newline", document: "hello\n", chunks: []string{"HEL", "LO"}, want: "HELLO\n"},
+		{name: "keeps the model's trailing newline", document: "hello\n", chunks: []string{"HELLO\n"}, want: "HELLO\n"},
+		{name: "no trailing newline", document: "hello", chunks: []string{"HELLO"}, want: "HELLO"},
+		{name: "empty answer", document: "hello\n", chunks: []string{""}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := modelstest.NewServer(t)
+			srv.Enqueue(modelstest.Response{Chunks: tt.chunks})
+			req, err := filterRequest(testRequest(""), "uppercase it", strings.NewReader(tt.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out strings.Builder
+			if err := runFilter(context.Background(), newTestClient(srv), req, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDiffChars bounds how much of a diff is sent to the model.
+const maxDiffChars = 60000
+
+const commitMessagePrompt = `You write git commit messages following the Conventional Commits specification.
+Given a staged diff, respond with only the commit message and nothing else:
+- a subject line of the form "<type>(<optional scope>): <summary>" where type is one of
+  feat, fix, docs, style, refactor, perf, test, build, ci, chore or revert
+- the summary is imperative, lower case, without a trailing period and at most 72 characters
+- if the change is not trivial, a blank line followed by a body wrapped at 72 characters
+  explaining what changed and why
+- a "BREAKING CHANGE:" footer only if the diff breaks a public interface
+Do not wrap the message in code fences.`
+
+const summarizePrompt = `You write changelog entries for software releases.
+Given commit subjects and a diff, respond with only a Markdown changelog grouped under the
+headings "Features", "Fixes" and "Other changes", omitting empty groups. Each entry is a
+single concise bullet written for users of the software, not its developers. Do not describe
+internal refactoring unless it changes behavior.`
+
+// runGit implements the `git` subcommand.
+func runGit(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s git commit-msg [flags]\n       %s git summarize [flags] [<revision range>]\n", os.Args[0], os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("git "+args[0], flag.ExitOnError)
+	model := modelFlag(fs, "model", "OpenAI/gpt-4.1", "Model to use for chat completion")
+	_ = fs.Parse(args[1:])
+
+	req, err := gitRequest(args[0], *model, fs.Arg(0))
+	if errors.Is(err, errUnknownGitCommand) {
+		usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if _, err := newCLIClient().streamCompletion(context.TODO(), req, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println()
+	return 0
+}
+
+// errUnknownGitCommand is returned by gitRequest for commands other than commit-msg
+// and summarize.
+var errUnknownGitCommand = errors.New("unknown git command")
+
+// gitRequest builds the request of a git subcommand from the repository in the
+// working directory. revisionRange is the range summarized, if any.
+func gitRequest(command, model, revisionRange string) (ChatCompletionOptions, error) {
+	var systemPrompt, input string
+	var err error
+	switch command {
+	case "commit-msg":
+		systemPrompt = commitMessagePrompt
+		input, err = gitOutput("diff", "--cached", "--no-color")
+		if err == nil && strings.TrimSpace(input) == "" {
+			err = errors.New("no staged changes; stage files with `git add` first")
+		}
+	case "summarize":
+		systemPrompt = summarizePrompt
+		input, err = summarizeInput(revisionRange)
+	default:
+		return ChatCompletionOptions{}, errUnknownGitCommand
+	}
+	if err != nil {
+		return ChatCompletionOptions{}, err
+	}
+
+	if len(input) > maxDiffChars {
+		input = truncateUTF8(input, maxDiffChars) + "\n[diff truncated]"
+	}
+
+	return ChatCompletionOptions{
+		Model: model,
+		Messages: []ChatMessage{
+			{Role: ChatMessageRoleSystem, Content: &systemPrompt},
+			{Role: ChatMessageRoleUser, Content: &input},
+		},
+	}, nil
+}
+
+// summarizeInput collects commit subjects and the diff for a revision range, or the
+// staged diff when no range is given.
+func summarizeInput(revisionRange string) (string, error) {
+	if revisionRange == "" {
+		diff, err := gitOutput("diff", "--cached", "--no-color")
+		if err == nil && strings.TrimSpace(diff) == "" {
+			err = errors.New("no staged changes; pass a revision range such as v1.0.0..HEAD")
+		}
+		return diff, err
+	}
+
+	log, err := gitOutput("log", "--no-color", "--format=- %s", revisionRange)
+	if err != nil {
+		return "", err
+	}
+	diff, err := gitOutput("diff", "--no-color", "--stat", "--patch", revisionRange)
+	if err != nil {
+		return "", err
+	}
+	return "Commits:\n" + log + "\nDiff:\n" + diff, nil
+}
+
+// gitOutput runs git with args and returns its stdout.
+func gitOutput(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// truncateUTF8 cuts s to at most n bytes, backing off to the start of a rune so that
+// no character is split.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// newTestRepo creates a repository in a temporary directory, made the working
+// directory, holding a commit tagged v1 and a second commit after it.
+func newTestRepo(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "--quiet")
+	writeTestFile(t, "README", "hello\n")
+	git("add", "README")
+	git("commit", "--quiet", "-m", "first commit")
+	git("tag", "v1")
+	writeTestFile(t, "README", "hello\nworld\n")
+	git("commit", "--quiet", "-am", "add world")
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGitRequest(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tests := []struct {
+		name          string
+		command       string
+		revisionRange string
+		staged        string // content staged for README, if any
+		wantPrompt    string
+		wantInput     []string
+		wantErr       string
+	}{
+		{name: "commit message", command: "commit-msg", staged: "hello\nstaged\n", wantPrompt: commitMessagePrompt, wantInput: []string{"diff --git a/README b/README", "-world", "+staged"}},
+		{name: "commit message without staged changes", command: "commit-msg", wantErr: "no staged changes"},
+		{name: "summarize a range", command: "summarize", revisionRange: "v1..HEAD", wantPrompt: summarizePrompt, wantInput: []string{"Commits:\n- add world\n\nDiff:\n", "README | 1 +", "+world"}},
+		{name: "summarize staged changes", command: "summarize", staged: "hello\nstaged\n", wantPrompt: summarizePrompt, wantInput: []string{"diff --git a/README b/README", "+staged"}},
+		{name: "summarize without staged changes", command: "summarize", wantErr: "pass a revision range"},
+		{name: "unknown command", command: "push", wantErr: errUnknownGitCommand.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestRepo(t)
+			if tt.staged != "" {
+				writeTestFile(t, "README", tt.staged)
+				if out, err := exec.Command("git", "add", "README").CombinedOutput(); err != nil {
+					t.Fatalf("git add: %v: %s", err, out)
+				}
+			}
+
+			req, err := gitRequest(tt.command, "openai/gpt-4.1", tt.revisionRange)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if tt.command == "push" && !errors.Is(err, errUnknownGitCommand) {
+					t.Errorf("err = %v, want errUnknownGitCommand", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Model != "openai/gpt-4.1" || len(req.Messages) != 2 || req.Messages[0].Role != ChatMessageRoleSystem || req.Messages[1].Role != ChatMessageRoleUser {
+				t.Fatalf("request = %+v", req)
+			}
+			if *req.Messages[0].Content != tt.wantPrompt {
+				t.Errorf("system prompt = %q, want %q", *req.Messages[0].Content, tt.wantPrompt)
+			}
+			input := *req.Messages[1].Content
+			for _, want := range tt.wantInput {
+				if !strings.Contains(input, want) {
+					t.Errorf("input = %q, want it to contain %q", input, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{name: "short", s: "diff", n: 10, want: "diff"},
+		{name: "ascii", s: "diff --git", n: 4, want: "diff"},
+		{name: "at a rune start", s: "añb", n: 3, want: "añ"},
+		{name: "inside a rune", s: "añb", n: 2, want: "a"},
+		{name: "inside a four-byte rune", s: "a😀", n: 4, want: "a"},
+		{name: "inside the first rune", s: "😀", n: 2, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateUTF8(tt.s, tt.n)
+			if got != tt.want || !utf8.ValidString(got) {
+				t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+		})
+	}
+
+	// A diff cut at maxDiffChars keeps valid UTF-8
+	diff := strings.Repeat("é", maxDiffChars)
+	if got := truncateUTF8(diff, maxDiffChars); !utf8.ValidString(got) || len(got) != maxDiffChars {
+		t.Errorf("truncated diff is %d bytes, valid %v", len(got), utf8.ValidString(got))
+	}
+}
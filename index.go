@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/abatilo/ghmodelsproxy/rag"
+)
+
+// runIndex implements the `index` subcommand.
+func runIndex(args []string) int {
+	if len(args) == 0 || args[0] != "build" {
+		fmt.Fprintf(os.Stderr, "Usage: %s index build [flags] <dir>\n", os.Args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("index build", flag.ExitOnError)
+	out := fs.String("o", "ghmodels-index.json", "Path to write the index to")
+	model := modelFlag(fs, "embedding-model", defaultEmbeddingModel, "Embedding model to use")
+	chunkLines := fs.Int("chunk-lines", 60, "Lines per chunk")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s index build [flags] <dir>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args[1:])
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	index, err := rag.Build(context.TODO(), fs.Arg(0), newCLIClient().embedFunc(*model), rag.BuildOptions{
+		Model:      *model,
+		ChunkLines: *chunkLines,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := index.Save(*out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Indexed %d chunks into %s\n", len(index.Chunks), *out)
+	return 0
+}
+
+// retrieveContext augments prompt with the k chunks of the index most relevant to it.
+func retrieveContext(ctx context.Context, client *AzureClient, indexPath string, k int, prompt string) (string, error) {
+	index, err := rag.Load(indexPath)
+	if err != nil {
+		return "", err
+	}
+
+	vectors, err := client.embedFunc(index.Model)(ctx, []string{prompt})
+	if err != nil {
+		return "", err
+	}
+
+	return rag.Augment(prompt, index.Search(vectors[0], k)), nil
+}
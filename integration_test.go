@@ -0,0 +1,151 @@
+//go:build integration
+
+// The integration tests run against the live GitHub Models API:
+//
+//	GHMODELS_INTEGRATION_TOKEN=$(gh auth token) go test -tags integration -run Integration ./...
+//
+// GHMODELS_INTEGRATION_MODEL overrides the model, which defaults to a low-tier one.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func integrationClient(t *testing.T, transport http.RoundTripper) *AzureClient {
+	t.Helper()
+	token := os.Getenv("GHMODELS_INTEGRATION_TOKEN")
+	if token == "" {
+		t.Skip("GHMODELS_INTEGRATION_TOKEN is not set")
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return NewAzureClient(&http.Client{Transport: transport}, token, NewDefaultAzureClientConfig())
+}
+
+func integrationModel() string {
+	if model := os.Getenv("GHMODELS_INTEGRATION_MODEL"); model != "" {
+		return model
+	}
+	return "openai/gpt-4.1-mini"
+}
+
+func integrationContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestIntegrationStreaming(t *testing.T) {
+	client := integrationClient(t, nil).WithStrictDecoding(true)
+	req := testRequest("Reply with exactly the word: pong")
+	req.Model = integrationModel()
+
+	var out strings.Builder
+	msg, err := client.streamCompletion(integrationContext(t), req, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content == nil || !strings.Contains(strings.ToLower(*msg.Content), "pong") {
+		t.Errorf("content = %v, want it to contain pong", msg.Content)
+	}
+	if out.String() != *msg.Content {
+		t.Errorf("streamed output %q differs from the message %q", out.String(), *msg.Content)
+	}
+}
+
+func TestIntegrationValidation(t *testing.T) {
+	client := integrationClient(t, nil)
+	req := testRequest("hi")
+	req.Model = "openai/not-a-real-model"
+
+	var validationErr *ValidationError
+	if err := client.ValidateRequest(integrationContext(t), req); !errors.As(err, &validationErr) {
+		t.Fatalf("ValidateRequest() = %v, want a *ValidationError", err)
+	}
+}
+
+func TestIntegrationUnknownModel(t *testing.T) {
+	client := integrationClient(t, nil)
+	req := testRequest("hi")
+	req.Model = "openai/not-a-real-model"
+
+	if _, err := client.streamCompletion(integrationContext(t), req, nil); err == nil {
+		t.Fatal("expected an error for an unknown model")
+	}
+}
+
+func TestIntegrationUnauthorized(t *testing.T) {
+	integrationClient(t, nil)
+	client := NewAzureClient(http.DefaultClient, "invalid-token", NewDefaultAzureClientConfig())
+	req := testRequest("hi")
+	req.Model = integrationModel()
+
+	_, err := client.streamCompletion(integrationContext(t), req, nil)
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("err = %v, want unauthorized", err)
+	}
+}
+
+// rateLimitObserver counts responses and records whether any carried rate limit headers.
+type rateLimitObserver struct {
+	next        http.RoundTripper
+	responses   atomic.Int32
+	limited     atomic.Int32
+	withHeaders atomic.Int32
+}
+
+func (o *rateLimitObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := o.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	o.responses.Add(1)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		o.limited.Add(1)
+	}
+	for name := range resp.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ratelimit-") {
+			o.withHeaders.Add(1)
+			break
+		}
+	}
+	return resp, nil
+}
+
+func TestIntegrationRateLimit(t *testing.T) {
+	observer := &rateLimitObserver{next: http.DefaultTransport}
+	var waits atomic.Int32
+	client := integrationClient(t, observer).WithRateLimitWait(func(time.Duration) { waits.Add(1) })
+	req := testRequest("Reply with one word.")
+	req.Model = integrationModel()
+
+	// A short burst stays within the free tier but exercises the rate limit path whenever
+	// the account is already close to its limit
+	ctx := integrationContext(t)
+	for range 3 {
+		if _, err := client.streamCompletion(ctx, req, nil); err != nil {
+			var rateLimitErr *RateLimitError
+			if errors.As(err, &rateLimitErr) {
+				t.Logf("rate limited beyond the deadline: %v", err)
+				continue
+			}
+			t.Fatal(err)
+		}
+	}
+
+	if observer.withHeaders.Load() == 0 {
+		t.Log("no x-ratelimit headers were returned")
+	}
+	if observer.limited.Load() > 0 && waits.Load() == 0 {
+		t.Errorf("got %d 429 responses but the client never waited", observer.limited.Load())
+	}
+}
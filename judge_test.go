@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestJudge(t *testing.T) {
+	const answer = `{"scores":[{"criterion":"correctness","score":4,"reason":"Mostly right."}],"overall":4.5,"summary":"Good."}`
+	tests := []struct {
+		name       string
+		rubric     string
+		answer     string
+		wantRubric string
+		want       *Judgement
+		wantErr    string
+	}{
+		{
+			name:       "default rubric",
+			answer:     answer,
+			wantRubric: defaultJudgeRubric,
+			want: &Judgement{
+				Model:   "openai/gpt-4.1",
+				Scores:  []CriterionScore{{Criterion: "correctness", Score: 4, Reason: "Mostly right."}},
+				Overall: 4.5,
+				Summary: "Good.",
+			},
+		},
+		{
+			name:       "custom rubric",
+			rubric:     "- brevity: the response is short",
+			answer:     `{"scores":[],"overall":1,"summary":"Too long."}`,
+			wantRubric: "- brevity: the response is short",
+			want:       &Judgement{Model: "openai/gpt-4.1", Scores: []CriterionScore{}, Overall: 1, Summary: "Too long."},
+		},
+		{
+			name:       "blank rubric",
+			rubric:     " \n",
+			answer:     answer,
+			wantRubric: defaultJudgeRubric,
+		},
+		{
+			name:       "not a judgement",
+			answer:     "I'd give it a 4.",
+			wantRubric: defaultJudgeRubric,
+			wantErr:    "decoding judgement",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := modelstest.NewServer(t)
+			srv.Enqueue(modelstest.Response{Chunks: []string{tt.answer}})
+
+			got, err := newTestClient(srv).Judge(context.Background(), JudgeOptions{
+				Model:    "openai/gpt-4.1",
+				Rubric:   tt.rubric,
+				Prompt:   "What is 2+2?",
+				Response: "4",
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Judge() = %+v, want %+v", got, tt.want)
+			}
+
+			var req ChatCompletionOptions
+			if err := json.Unmarshal(srv.Requests()[0].Body, &req); err != nil {
+				t.Fatal(err)
+			}
+			if system := *req.Messages[0].Content; system != judgePrompt+tt.wantRubric {
+				t.Errorf("system prompt = %q, want the judge prompt with rubric %q", system, tt.wantRubric)
+			}
+			if user := *req.Messages[1].Content; user != "<prompt>\nWhat is 2+2?\n</prompt>\n\n<response>\n4\n</response>" {
+				t.Errorf("user message = %q", user)
+			}
+			if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_schema" || req.ResponseFormat.JSONSchema == nil || !req.ResponseFormat.JSONSchema.Strict {
+				t.Errorf("response format = %+v, want a strict JSON schema", req.ResponseFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	minLogitBias = -100
+	maxLogitBias = 100
+)
+
+// ParseLogitBias parses comma-separated token_id:bias pairs into a logit_bias map.
+func ParseLogitBias(value string) (map[string]int, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	bias := map[string]int{}
+	for _, pair := range splitList(value) {
+		token, weight, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid logit bias %q: expected token_id:bias", pair)
+		}
+
+		id, err := strconv.Atoi(strings.TrimSpace(token))
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid logit bias %q: token id must be a non-negative integer", pair)
+		}
+
+		b, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || b < minLogitBias || b > maxLogitBias {
+			return nil, fmt.Errorf("invalid logit bias %q: bias must be an integer between %d and %d", pair, minLogitBias, maxLogitBias)
+		}
+
+		bias[strconv.Itoa(id)] = b
+	}
+	return bias, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseLogitBias(t *testing.T) {
+	got, err := ParseLogitBias(" 1734:-100, 5765 : 10 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "map[1734:-100 5765:10]" {
+		t.Errorf("ParseLogitBias = %v", got)
+	}
+	if got, err := ParseLogitBias(""); got != nil || err != nil {
+		t.Errorf("ParseLogitBias of nothing = %v, %v", got, err)
+	}
+	for _, value := range []string{"1734", "word:10", "-1:10", "1734:101", "1734:-101", "1734:x"} {
+		if _, err := ParseLogitBias(value); err == nil {
+			t.Errorf("ParseLogitBias(%q) succeeded", value)
+		}
+	}
+}
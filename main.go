@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
 	"time" // Added for timing metrics
@@ -17,68 +18,284 @@ import (
 	"github.com/cli/go-gh/v2/pkg/api"
 	"github.com/cli/go-gh/v2/pkg/auth"
 
+	"github.com/abatilo/ghmodelsproxy/aisdk"
 	"github.com/abatilo/ghmodelsproxy/conversation"
 	"github.com/abatilo/ghmodelsproxy/stream"
 )
 
 const (
-	defaultInferenceURL = "https://models.github.ai/inference/chat/completions"
+	defaultInferenceURL  = "https://models.github.ai/inference/chat/completions"
+	defaultEmbeddingsURL = "https://models.github.ai/inference/embeddings"
 )
 
 // AzureClientConfig represents configurable settings for the Azure client.
 type AzureClientConfig struct {
-	InferenceURL string
+	InferenceURL  string
+	EmbeddingsURL string
+	ResponsesURL  string
+
+	TranscriptionsURL string
+	SpeechURL         string
+
+	FilesURL   string
+	BatchesURL string
+
+	ModerationsURL string
+
+	CatalogURL string
 }
 
-// ChatMessageRole represents the role of a chat message.
-type ChatMessageRole string
+// The message types are shared with the conversation package so conversations can be
+// sent without copying.
+type (
+	ChatMessageRole = conversation.ChatMessageRole
+	ChatMessage     = conversation.ChatMessage
+	CacheControl    = conversation.CacheControl
+	FunctionCall    = conversation.FunctionCall
+	ToolCall        = conversation.ToolCall
+)
 
 const (
-	// ChatMessageRoleUser represents a message from the user.
-	ChatMessageRoleUser ChatMessageRole = "user"
+	ChatMessageRoleAssistant = conversation.ChatMessageRoleAssistant
+	ChatMessageRoleDeveloper = conversation.ChatMessageRoleDeveloper
+	ChatMessageRoleSystem    = conversation.ChatMessageRoleSystem
+	ChatMessageRoleTool      = conversation.ChatMessageRoleTool
+	ChatMessageRoleUser      = conversation.ChatMessageRoleUser
 )
 
-// ChatMessage represents a message from a chat thread with a model.
-type ChatMessage struct {
-	Content *string         `json:"content,omitempty"`
-	Role    ChatMessageRole `json:"role"`
+// FunctionDefinition describes a function the model may call.
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// Tool choice modes; see ToolChoice.
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// ToolChoice is either a mode, such as ToolChoiceRequired, or the name of the one
+// function the model must call.
+type ToolChoice struct {
+	Mode     string
+	Function string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c ToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Function != "" {
+		return json.Marshal(map[string]any{"type": "function", "function": map[string]string{"name": c.Function}})
+	}
+	return json.Marshal(c.Mode)
+}
+
+// ToolDefinition represents a tool offered to the model.
+type ToolDefinition struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
 }
 
 type ChatCompletionOptions struct {
-	Messages []ChatMessage `json:"messages"`
-	Model    string        `json:"model"`
-	Stream   bool          `json:"stream,omitempty"`
+	Messages []ChatMessage    `json:"messages"`
+	Model    string           `json:"model"`
+	Stream   bool             `json:"stream,omitempty"`
+	Tools    []ToolDefinition `json:"tools,omitempty"`
+	// StreamOptions asks streamed responses for a final chunk with the usage.
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// ToolChoice controls whether the model must, may or must not call a tool.
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty"`
+	// PromptCacheKey groups requests sharing a prefix so providers route them to the same cache.
+	PromptCacheKey string `json:"prompt_cache_key,omitempty"`
+	// ReasoningEffort is low, medium or high for models that support it.
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// LogitBias maps token ids to a bias between -100 and 100 added to their logits.
+	LogitBias map[string]int `json:"logit_bias,omitempty"`
+	// User is a stable identifier for the end user, used by providers for abuse detection.
+	User string `json:"user,omitempty"`
+	// ResponseFormat constrains the output to JSON, optionally matching a schema.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// Seed asks for deterministic sampling, so repeated requests return the same output.
+	Seed *int `json:"seed,omitempty"`
+	// Temperature controls sampling randomness, from 0 (focused) to 2 (random).
+	Temperature *float64 `json:"temperature,omitempty"`
+	// TopP samples only from the most likely tokens making up this probability mass.
+	TopP *float64 `json:"top_p,omitempty"`
+	// MaxTokens limits the number of generated tokens.
+	MaxTokens *int `json:"max_tokens,omitempty"`
+	// MaxCompletionTokens replaces MaxTokens for reasoning models; it is set from
+	// MaxTokens when the request is sent.
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
+	// Stop lists up to four sequences at which generation stops.
+	Stop []string `json:"stop,omitempty"`
+	// PresencePenalty, from -2 to 2, penalizes tokens that already appeared.
+	PresencePenalty *float64 `json:"presence_penalty,omitempty"`
+	// FrequencyPenalty, from -2 to 2, penalizes tokens by how often they appeared.
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+}
+
+// StreamOptions configures streamed chat completions.
+type StreamOptions struct {
+	// IncludeUsage adds a final chunk, without choices, holding the usage of the
+	// whole request.
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ResponseFormat selects JSON mode: "json_object" for any JSON object or "json_schema"
+// for output matching JSONSchema.
+type ResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *JSONSchemaSpec `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaSpec names a JSON schema the response must follow.
+type JSONSchemaSpec struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
 }
 
 type chatChoiceDelta struct {
-	Content *string `json:"content,omitempty"`
+	Role             string     `json:"role,omitempty"`
+	Refusal          *string    `json:"refusal,omitempty"`
+	Content          *string    `json:"content,omitempty"`
+	ReasoningContent *string    `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 }
 
 // ChatChoice represents a choice in a chat completion.
 type ChatChoice struct {
-	Delta *chatChoiceDelta `json:"delta,omitempty"`
+	Index                int                  `json:"index"`
+	Logprobs             json.RawMessage      `json:"logprobs,omitempty"`
+	Delta                *chatChoiceDelta     `json:"delta,omitempty"`
+	FinishReason         *string              `json:"finish_reason,omitempty"`
+	ContentFilterResults ContentFilterResults `json:"content_filter_results,omitempty"`
+	// Message holds the complete response in a non-streamed completion.
+	Message *chatChoiceDelta `json:"message,omitempty"`
+}
+
+// body returns the delta of a streamed choice or the message of a non-streamed one.
+func (c ChatChoice) body() *chatChoiceDelta {
+	if c.Delta != nil {
+		return c.Delta
+	}
+	return c.Message
+}
+
+// Content returns the content of the choice, or "" for chunks that carry none, such
+// as the role-only first chunk or a finish chunk without a delta.
+func (c ChatChoice) Content() string {
+	if b := c.body(); b != nil && b.Content != nil {
+		return *b.Content
+	}
+	return ""
+}
+
+// ReasoningContent returns the reasoning of the choice, or "" if there is none.
+func (c ChatChoice) ReasoningContent() string {
+	if b := c.body(); b != nil && b.ReasoningContent != nil {
+		return *b.ReasoningContent
+	}
+	return ""
+}
+
+// ToolCalls returns the tool calls of the choice, which are deltas when streamed.
+func (c ChatChoice) ToolCalls() []ToolCall {
+	if b := c.body(); b != nil {
+		return b.ToolCalls
+	}
+	return nil
+}
+
+// PromptTokensDetails breaks down the prompt tokens of a request.
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	AudioTokens  int `json:"audio_tokens,omitempty"`
+}
+
+// CompletionTokensDetails breaks down the completion tokens of a request.
+type CompletionTokensDetails struct {
+	ReasoningTokens          int `json:"reasoning_tokens"`
+	AudioTokens              int `json:"audio_tokens,omitempty"`
+	AcceptedPredictionTokens int `json:"accepted_prediction_tokens,omitempty"`
+	RejectedPredictionTokens int `json:"rejected_prediction_tokens,omitempty"`
+}
+
+// Usage represents the token usage of a chat completion.
+type Usage struct {
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// CachedTokens returns the number of prompt tokens served from the provider's prompt cache.
+func (u *Usage) CachedTokens() int {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// ReasoningTokens returns the number of completion tokens spent on hidden reasoning.
+func (u *Usage) ReasoningTokens() int {
+	if u == nil || u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
 }
 
 // ChatCompletion represents a chat completion.
 type ChatCompletion struct {
-	Choices []ChatChoice `json:"choices"`
+	ID                  string               `json:"id,omitempty"`
+	Object              string               `json:"object,omitempty"`
+	Created             int64                `json:"created,omitempty"`
+	Model               string               `json:"model,omitempty"`
+	SystemFingerprint   string               `json:"system_fingerprint,omitempty"`
+	ServiceTier         string               `json:"service_tier,omitempty"`
+	Choices             []ChatChoice         `json:"choices"`
+	Usage               *Usage               `json:"usage,omitempty"`
+	PromptFilterResults []PromptFilterResult `json:"prompt_filter_results,omitempty"`
 }
 
 // ChatCompletionResponse represents a response to a chat completion request.
 type ChatCompletionResponse struct {
 	Reader stream.Reader[ChatCompletion]
+	// RequestID identifies the request for support, if the service sent one.
+	RequestID string
 }
 
 // Client represents a client for interacting with an API about models.
 type Client interface {
 	// GetChatCompletionStream returns a stream of chat completions using the given options.
 	GetChatCompletionStream(context.Context, ChatCompletionOptions) (*ChatCompletionResponse, error)
+	// GetChatCompletion returns a complete chat completion using the given options.
+	GetChatCompletion(context.Context, ChatCompletionOptions) (*ChatCompletion, error)
+	// ListModels returns the models in the catalog.
+	ListModels(context.Context) ([]*ModelSummary, error)
+	// GetEmbeddings returns embeddings for the given inputs.
+	GetEmbeddings(context.Context, EmbeddingsOptions) (*EmbeddingsResponse, error)
 }
 
 // NewDefaultAzureClientConfig returns a new AzureClientConfig with default values for API URLs.
 func NewDefaultAzureClientConfig() *AzureClientConfig {
 	return &AzureClientConfig{
-		InferenceURL: defaultInferenceURL,
+		InferenceURL:  defaultInferenceURL,
+		EmbeddingsURL: defaultEmbeddingsURL,
+		ResponsesURL:  defaultResponsesURL,
+
+		TranscriptionsURL: defaultTranscriptionsURL,
+		SpeechURL:         defaultSpeechURL,
+
+		FilesURL:   defaultFilesURL,
+		BatchesURL: defaultBatchesURL,
+
+		ModerationsURL: defaultModerationsURL,
+
+		CatalogURL: defaultCatalogURL,
 	}
 }
 
@@ -88,6 +305,15 @@ type AzureClient struct {
 	token       string
 	cfg         *AzureClientConfig
 	showHeaders bool
+	// logOut receives the printed headers; nil means stderr.
+	logOut io.Writer
+
+	// strictDecoding rejects stream events with fields the client does not know about.
+	strictDecoding bool
+
+	onRateLimitWait func(remaining time.Duration)
+	// retry is the retry policy; the zero value means DefaultRetryPolicy.
+	retry RetryPolicy
 }
 
 // NewDefaultAzureClient returns a new Azure client using the given auth token using default API URLs.
@@ -111,39 +337,93 @@ func (c *AzureClient) WithHeaders(show bool) *AzureClient {
 	return c
 }
 
+// WithLogOutput sets where headers are printed instead of stderr.
+func (c *AzureClient) WithLogOutput(w io.Writer) *AzureClient {
+	c.logOut = w
+	return c
+}
+
+// WithStrictDecoding enables or disables rejecting chat completion events that carry
+// unknown fields, which helps notice backend schema changes early.
+func (c *AzureClient) WithStrictDecoding(strict bool) *AzureClient {
+	c.strictDecoding = strict
+	return c
+}
+
 // GetChatCompletionStream returns a stream of chat completions using the given options.
 func (c *AzureClient) GetChatCompletionStream(ctx context.Context, req ChatCompletionOptions) (*ChatCompletionResponse, error) {
 	req.Stream = true
+	if req.StreamOptions == nil {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	req.Messages = mapDeveloperRole(req.Model, req.Messages)
+	req = mapMaxTokens(req)
 
-	bodyBytes, err := json.Marshal(req)
+	resp, err := c.postJSON(ctx, c.cfg.InferenceURL, req, true)
 	if err != nil {
 		return nil, err
 	}
 
-	body := bytes.NewReader(bodyBytes)
+	c.printHeaders(resp)
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.InferenceURL, body)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusOK {
+		// If we aren't going to return an SSE stream, then ensure the response body is closed.
+		defer resp.Body.Close()
+		return nil, c.handleHTTPError(resp)
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+c.token)
-	httpReq.Header.Set("Content-Type", "application/json")
+	chatCompletionResponse := ChatCompletionResponse{RequestID: requestID(resp.Header)}
 
-	// Azure would like us to send specific user agents to help distinguish
-	// traffic from known sources and other web requests
-	httpReq.Header.Set("x-ms-useragent", "github-cli-models")
-	httpReq.Header.Set("x-ms-user-agent", "github-cli-models") // send both to accommodate various Azure consumers
+	if req.Stream {
+		// Handle streamed response
+		reader := stream.NewEventReader[ChatCompletion](resp.Body)
+		if c.strictDecoding {
+			reader.DisallowUnknownFields()
+		}
+		chatCompletionResponse.Reader = reader
+	}
+
+	return &chatCompletionResponse, nil
+}
 
-	resp, err := c.client.Do(httpReq)
+// GetChatCompletion returns a complete chat completion using the given options.
+func (c *AzureClient) GetChatCompletion(ctx context.Context, req ChatCompletionOptions) (*ChatCompletion, error) {
+	req.Stream = false
+	req.Messages = mapDeveloperRole(req.Model, req.Messages)
+	req = mapMaxTokens(req)
+
+	resp, err := c.postJSON(ctx, c.cfg.InferenceURL, req, true)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	c.printHeaders(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.handleHTTPError(resp)
+	}
+
+	var completion ChatCompletion
+	decoder := json.NewDecoder(resp.Body)
+	if c.strictDecoding {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&completion); err != nil {
+		return nil, fmt.Errorf("decoding chat completion: %w", err)
+	}
+	return &completion, nil
+}
 
-	// Print headers if enabled
+// printHeaders prints the response status and headers when enabled.
+func (c *AzureClient) printHeaders(resp *http.Response) {
 	if c.showHeaders {
-		fmt.Fprintf(os.Stderr, "\n=== HTTP Response ===\n")
-		fmt.Fprintf(os.Stderr, "Status: %d %s\n", resp.StatusCode, resp.Status)
+		w := c.logOut
+		if w == nil {
+			w = os.Stderr
+		}
+		fmt.Fprintf(w, "\n=== HTTP Response ===\n")
+		fmt.Fprintf(w, "Status: %d %s\n", resp.StatusCode, resp.Status)
 
 		// Sort all header keys for consistent output
 		var headerKeys []string
@@ -152,148 +432,638 @@ func (c *AzureClient) GetChatCompletionStream(ctx context.Context, req ChatCompl
 		}
 		sort.Strings(headerKeys)
 
-		fmt.Fprintf(os.Stderr, "Headers:\n")
+		fmt.Fprintf(w, "Headers:\n")
 		for _, k := range headerKeys {
-			fmt.Fprintf(os.Stderr, "  %s: %s\n", k, strings.Join(resp.Header[k], ", "))
+			fmt.Fprintf(w, "  %s: %s\n", k, strings.Join(resp.Header[k], ", "))
 		}
-		fmt.Fprintf(os.Stderr, "===================\n\n")
+		fmt.Fprintf(w, "===================\n\n")
 	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		// If we aren't going to return an SSE stream, then ensure the response body is closed.
-		defer resp.Body.Close()
-		return nil, c.handleHTTPError(resp)
-	}
+func (c *AzureClient) setHeaders(httpReq *http.Request) {
+	httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
 
-	var chatCompletionResponse ChatCompletionResponse
+	// Azure would like us to send specific user agents to help distinguish
+	// traffic from known sources and other web requests
+	httpReq.Header.Set("x-ms-useragent", "github-cli-models")
+	httpReq.Header.Set("x-ms-user-agent", "github-cli-models") // send both to accommodate various Azure consumers
+}
 
-	if req.Stream {
-		// Handle streamed response
-		chatCompletionResponse.Reader = stream.NewEventReader[ChatCompletion](resp.Body)
+// handleHTTPError returns an *APIError for an error response.
+func (c *AzureClient) handleHTTPError(resp *http.Response) error {
+	return newAPIError(resp)
+}
+
+const usageText = `Usage: %[1]s [flags] [prompt]
+       %[1]s index build [flags] <dir>
+       %[1]s git commit-msg|summarize [flags]
+       %[1]s review [flags] <number | url>
+       %[1]s rpc [flags]
+       %[1]s audio transcribe|speak [flags]
+       %[1]s audit verify [-key-file <file>] <audit log>
+       %[1]s batch submit|status|results [flags]
+       %[1]s diff -models <a>,<b> [flags] <prompt> | <file a> <file b>
+       %[1]s embed [-model <model>] [-format json|floats] [text]
+       %[1]s judge [flags] -prompt <prompt> [response file]
+       %[1]s prompt save|list|show|delete|export|import
+       %[1]s alias set|list|delete
+       %[1]s doctor [flags]
+       %[1]s models list [-json]
+       %[1]s quota [-models <a>,<b>]
+       %[1]s rerun [flags] [prompt]
+       %[1]s serve [-addr host:port]
+       %[1]s sweep -seeds 1..10 [flags] <prompt>
+`
+
+// newCLIClient returns a client authenticated with the gh token for github.com, using
+// the provider selected by GHMODELS_PROVIDER.
+func newCLIClient() *AzureClient {
+	httpClient, err := providerHTTPClient(defaultProvider(), os.Getenv("GHMODELS_ECHO_TEMPLATE"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	token, _ := auth.TokenForHost("github.com")
+	return NewAzureClient(httpClient, token, NewDefaultAzureClientConfig()).WithRateLimitWait(printRateLimitWait)
+}
 
-	return &chatCompletionResponse, nil
+// printRateLimitWait shows a countdown on stderr while waiting for a rate limit to reset.
+func printRateLimitWait(remaining time.Duration) {
+	rateLimitPrinter(os.Stderr)(remaining)
 }
 
-func (c *AzureClient) handleHTTPError(resp *http.Response) error {
-	sb := strings.Builder{}
-	var err error
+// rateLimitPrinter returns a rate limit wait callback showing the remaining time on w.
+func rateLimitPrinter(w io.Writer) func(remaining time.Duration) {
+	return func(remaining time.Duration) {
+		fmt.Fprintf(w, "\rRate limited, retrying in %v...   ", remaining.Round(time.Second))
+		if remaining <= time.Second {
+			fmt.Fprintln(w)
+		}
+	}
+}
 
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		_, err = sb.WriteString("unauthorized")
-		if err != nil {
-			return err
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "index":
+			os.Exit(runIndex(os.Args[2:]))
+		case "git":
+			os.Exit(runGit(os.Args[2:]))
+		case "review":
+			os.Exit(runReview(os.Args[2:]))
+		case "rpc":
+			os.Exit(runRPC(os.Args[2:]))
+		case "audit":
+			os.Exit(runAudit(os.Args[2:]))
+		case "audio":
+			os.Exit(runAudio(os.Args[2:]))
+		case "batch":
+			os.Exit(runBatch(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "embed":
+			os.Exit(runEmbed(os.Args[2:]))
+		case "judge":
+			os.Exit(runJudge(os.Args[2:]))
+		case "prompt":
+			os.Exit(runPrompt(os.Args[2:]))
+		case "alias":
+			os.Exit(runAlias(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "models":
+			os.Exit(runModels(os.Args[2:]))
+		case "quota":
+			os.Exit(runQuota(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "sweep":
+			os.Exit(runSweep(os.Args[2:]))
 		}
+	}
+
+	var model = modelFlag(flag.CommandLine, "model", "OpenAI/gpt-4.1", "Model to use for chat completion")
+	var showHeaders = flag.Bool("headers", false, "Show HTTP response headers")
+	var output = flag.String("output", "text", "Output format: text or aisdk (Vercel AI SDK data stream protocol)")
+	var enabledTools = flag.String("tools", "", "Comma-separated built-in tools the model may call (shell, fetch, search)")
+	var toolChoice = flag.String("tool-choice", "", "With -tools, whether the model must call a tool: auto, none, required or the name of a tool to call first")
+	var allowCommands = flag.String("allow-commands", "", "Comma-separated programs the shell tool may run without confirmation; all other commands are refused")
+	var promptCacheKey = flag.String("prompt-cache-key", "", "Key grouping requests that share a prompt prefix for provider prompt caching")
+	var cachePrefix = flag.Bool("cache-prefix", false, "Mark large stable prompt prefixes with cache-control hints")
+	var moderate = flag.String("moderate", moderationOff, "Moderation pre-check of the prompt: off, flag (warn and continue) or block")
+	var reasoningEffort = flag.String("reasoning-effort", "", "Reasoning effort for reasoning models: low, medium or high")
+	var showReasoning = flag.Bool("show-reasoning", false, "Print streamed reasoning content to stderr")
+	var logitBias = flag.String("logit-bias", "", "Comma-separated token_id:bias pairs, e.g. 1734:-100,5765:10")
+	var user = flag.String("user", os.Getenv("GHMODELS_USER"), "End-user identifier sent with requests for abuse-detection attribution")
+	var prefill = flag.String("prefill", "", "Beginning of the assistant response for the model to continue, where supported")
+	var skipValidation = flag.Bool("no-validate", false, "Skip checking the model and parameters against the model catalog")
+	var systemFlag = flag.String("system", "", "System prompt setting the assistant's behavior, instead of \"You are a coding assistant\"")
+	var systemFile = flag.String("system-file", "", "File to read the system prompt from, or - for stdin")
+	var lang = flag.String("lang", "", "Language to answer in, such as German, added to the system prompt")
+	var style = flag.String("style", "", "Comma-separated styles added to the system prompt: "+strings.Join(styleNames(nil), ", ")+", or ones defined in the config file")
+	var usePrompt = flag.String("use", "", "Run a prompt saved with the prompt command, or a template of the project's .ghmodels.yaml; a prompt argument is appended to it")
+	var provider = flag.String("provider", defaultProvider(), "Backend to send requests to: github or echo (answers locally with the prompt, for offline use)")
+	var echoTemplate = flag.String("echo-template", os.Getenv("GHMODELS_ECHO_TEMPLATE"), "Go template rendered by the echo provider, with .Prompt, .System, .Model and .Messages")
+	var noStream = flag.Bool("no-stream", false, "Request the complete response at once instead of streaming it")
+	var timeout = flag.Duration("timeout", 0, "Give up on the response after this long, keeping what was received; 0 for no limit")
+	var interactive = flag.Bool("i", false, "Chat interactively, keeping the conversation across turns; a prompt argument starts it")
+	var session = flag.String("session", "", "Name of a conversation to continue and save, so that context is kept across invocations")
+	var teePath = flag.String("tee", "", "Also write the prompt and streamed response to this Markdown transcript file")
+	var metricsPath = flag.String("metrics-json", "", "Append the run's metrics (duration, time to first token, usage, cost, model, request ID) as a line of JSON to this file, or - for stderr")
+	var logPath = flag.String("log-file", "", "Append diagnostics (headers, rate limit waits, tool calls, warnings and the execution summary) to this file instead of stderr; errors still go to stderr")
+	var vars templateVars
+	flag.Var(&vars, "var", "Template variable for the prompt as name=value, name=@file or name=- (stdin), used as {{.name}}; repeatable")
+	var varMaxBytes = flag.Int("var-max-bytes", 1<<20, "Maximum size of a template variable in bytes, or 0 for no limit")
+	var varMaxTokens = flag.Int("var-max-tokens", 100000, "Maximum estimated tokens of a template variable, or 0 for no limit")
+	sampling := addSamplingFlags(flag.CommandLine)
+	colors := addColorFlags(flag.CommandLine)
+	notify := notifyFlag(flag.CommandLine, "Ring the bell or show a desktop notification (-notify=desktop) when the response finishes")
+	var maxAttempts = flag.Int("max-attempts", DefaultRetryPolicy.MaxAttempts, "Attempts per request when rate limited or the server fails transiently (429, 5xx); 1 disables retries")
+	var retryDelay = flag.Duration("retry-delay", DefaultRetryPolicy.BaseDelay, "Backoff before the first retry when the server advertises no delay, doubling with each retry")
+	var strictDecoding = flag.Bool("strict", false, "Fail on unknown fields in streamed chat completions to detect API schema changes")
+	var apiFlavor = flag.String("api", "chat", "Inference API to use: chat (chat completions) or responses (Responses API)")
+	var filter = flag.Bool("filter", false, "Transform the document on stdin with the prompt as the instruction, printing only the result")
+	var ragIndex = flag.String("rag", "", "Path to an index built with `index build` to retrieve context from")
+	var ragK = flag.Int("rag-k", 5, "Number of chunks to retrieve with -rag")
+	var searchURL = flag.String("search-url", os.Getenv("GHMODELS_SEARXNG_URL"), "Base URL of a SearXNG instance used by the search tool")
+	var inferenceURL = flag.String("inference-url", defaultInferenceURL, "Chat completions endpoint to send requests to")
 
-	case http.StatusBadRequest:
-		_, err = sb.WriteString("bad request")
+	// Defaults come from the environment, then the project file, then the config
+	// file; flags override all of them
+	userCfg, err := loadUserConfig()
+	var project *projectConfig
+	if err == nil {
+		project, err = loadProjectConfig()
+	}
+	if err == nil {
+		sampling.configured, err = applyConfigDefaults(flag.CommandLine, userCfg, project)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usageText, os.Args[0])
+		flag.PrintDefaults()
+	}
+	invocation, explicit, err := parseInvocation(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	systemPrompt := "You are a coding assistant"
+	var savedPrompt *SavedPrompt
+	if *usePrompt != "" {
+		var ok bool
+		if savedPrompt, ok = project.template(*usePrompt); !ok {
+			library, err := defaultPromptLibrary()
+			if err == nil {
+				savedPrompt, err = library.Get(*usePrompt)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		// The saved defaults apply only where the flags were not given explicitly
+		if savedPrompt.Model != "" && !explicit["model"] {
+			*model = resolveModel(savedPrompt.Model)
+		}
+		if savedPrompt.ReasoningEffort != "" && !explicit["reasoning-effort"] {
+			*reasoningEffort = savedPrompt.ReasoningEffort
+		}
+		if savedPrompt.System != "" {
+			systemPrompt = savedPrompt.System
+		}
+	}
+	// An explicit system prompt takes precedence over saved prompts and sessions, and
+	// those over a configured one
+	explicitSystem := explicit["system"] || explicit["system-file"]
+	if explicit["system"] && explicit["system-file"] {
+		fmt.Fprintln(os.Stderr, "-system and -system-file cannot be combined")
+		os.Exit(2)
+	}
+	if (explicitSystem || explicit["lang"] || explicit["style"]) && *filter {
+		fmt.Fprintln(os.Stderr, "-system, -lang and -style cannot be combined with -filter, which sets its own system prompt")
+		os.Exit(2)
+	}
+	styles, err := styleSnippets(*style, userCfg.Styles)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *systemFlag != "" && (explicit["system"] || savedPrompt == nil || savedPrompt.System == "") {
+		systemPrompt = *systemFlag
+	}
+	if *systemFile != "" {
+		if *systemFile == "-" && vars.readsStdin() {
+			fmt.Fprintln(os.Stderr, "-system-file and -var cannot both read stdin")
+			os.Exit(2)
+		}
+		var data []byte
+		var err error
+		if *systemFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*systemFile)
+		}
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		systemPrompt = strings.TrimSpace(string(data))
+	}
 
+	if *output != "text" && *output != "aisdk" {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *output)
+		os.Exit(2)
+	}
+	if *moderate != moderationOff && *moderate != moderationFlag && *moderate != moderationBlock {
+		fmt.Fprintf(os.Stderr, "unknown moderation mode: %s\n", *moderate)
+		os.Exit(2)
+	}
+	if *reasoningEffort != "" && !validReasoningEffort(*reasoningEffort) {
+		fmt.Fprintf(os.Stderr, "unknown reasoning effort: %s\n", *reasoningEffort)
+		os.Exit(2)
+	}
+	parsedLogitBias, err := ParseLogitBias(*logitBias)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := sampling.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *maxAttempts < 1 || *retryDelay < 0 {
+		fmt.Fprintln(os.Stderr, "-max-attempts must be at least 1 and -retry-delay must not be negative")
+		os.Exit(2)
+	}
+	retryPolicy := DefaultRetryPolicy
+	retryPolicy.MaxAttempts, retryPolicy.BaseDelay = *maxAttempts, *retryDelay
+	if *apiFlavor != "chat" && *apiFlavor != "responses" {
+		fmt.Fprintf(os.Stderr, "unknown API: %s\n", *apiFlavor)
+		os.Exit(2)
+	}
+	stdoutColors, err := colors.palette(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	stderrColors, _ := colors.palette(os.Stderr)
+	// Only the response goes to stdout, so that it can be piped; diagnostics go to
+	// stderr or the log file
+	logOut, logColors := os.Stderr, stderrColors
+	if *logPath != "" {
+		if logOut, err = os.OpenFile(*logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer logOut.Close()
+		logColors, _ = colors.palette(logOut)
+	}
+	var metricsOut io.Writer
+	switch *metricsPath {
+	case "":
+	case "-":
+		metricsOut = os.Stderr
 	default:
-		_, err = sb.WriteString("unexpected response from the server: " + resp.Status)
+		f, err := os.OpenFile(*metricsPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		defer f.Close()
+		metricsOut = f
 	}
-
-	body, _ := io.ReadAll(resp.Body)
-	if len(body) > 0 {
-		_, err = sb.WriteString("\n")
+	var sessionFile string
+	var resumed *conversation.Conversation
+	if *session != "" {
+		if *filter || *enabledTools != "" || *apiFlavor != "chat" {
+			fmt.Fprintln(os.Stderr, "-session cannot be combined with -filter, -tools or -api")
+			os.Exit(2)
+		}
+		if sessionFile, err = sessionPath(*session); err == nil {
+			resumed, err = loadSession(sessionFile)
+		}
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// A resumed session keeps its model unless another is given explicitly
+		if resumed != nil && resumed.Model != "" && !explicit["model"] {
+			*model = resumed.Model
 		}
+	}
+	if *toolChoice != "" && *enabledTools == "" {
+		fmt.Fprintln(os.Stderr, "-tool-choice requires -tools")
+		os.Exit(2)
+	}
+	if *teePath != "" && (*filter || *enabledTools != "") {
+		fmt.Fprintln(os.Stderr, "-tee cannot be combined with -filter or -tools")
+		os.Exit(2)
+	}
+	if *filter && (*enabledTools != "" || *apiFlavor != "chat" || *ragIndex != "" || *prefill != "" || *output != "text") {
+		fmt.Fprintln(os.Stderr, "-filter cannot be combined with -tools, -api, -rag, -prefill or -output")
+		os.Exit(2)
+	}
+	if *interactive && (*filter || *enabledTools != "" || *teePath != "" || *apiFlavor != "chat" || *output != "text") {
+		fmt.Fprintln(os.Stderr, "-i cannot be combined with -filter, -tools, -tee, -api or -output")
+		os.Exit(2)
+	}
+	httpClient, err := providerHTTPClient(*provider, *echoTemplate)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *provider == providerEcho {
+		// The echo provider accepts any model, so the catalog does not apply
+		*skipValidation = true
+	}
 
-		_, err = sb.Write(body)
+	if *filter && vars.readsStdin() {
+		fmt.Fprintln(os.Stderr, "-var cannot read stdin with -filter, which reads the document from stdin")
+		os.Exit(2)
+	}
+	var varValues map[string]string
+	if len(vars) > 0 {
+		varValues, err = vars.resolve(*varMaxBytes, *varMaxTokens)
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
-
-		_, err = sb.WriteString("\n")
+	}
+	// Prompts are only treated as templates when variables are given, so that prompts
+	// containing {{ are sent as written
+	render := func(text string) string {
+		if varValues == nil {
+			return text
+		}
+		rendered, err := renderPrompt(text, varValues)
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
+		return rendered
 	}
 
-	return errors.New(sb.String())
-}
-
-func main() {
-	var model = flag.String("model", "OpenAI/gpt-4.1", "Model to use for chat completion")
-	var showHeaders = flag.Bool("headers", false, "Show HTTP response headers")
-
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [prompt]\n", os.Args[0])
-		flag.PrintDefaults()
-	}
-	flag.Parse()
+	saveLastInvocation(invocation.Flags, invocation.Args)
 
 	var userPrompt string
-	if flag.NArg() > 0 {
+	if savedPrompt != nil {
+		userPrompt = savedPrompt.Prompt
+		if flag.NArg() > 0 {
+			userPrompt += "\n\n" + flag.Arg(0)
+		}
+	} else if flag.NArg() > 0 {
 		userPrompt = flag.Arg(0)
-	} else {
+	} else if !*interactive && !*filter {
 		userPrompt = "write a python program that asks for the user's name. If the name has na odd number of letters, return the name in reverse. Else, return the name in all caps. Return the python code only with nothing else"
 	}
 
+	userPrompt = render(userPrompt)
+	systemPrompt = render(systemPrompt)
+
 	token, _ := auth.TokenForHost("github.com")
 	clientConfig := NewDefaultAzureClientConfig()
-	client := NewAzureClient(http.DefaultClient, token, clientConfig).WithHeaders(*showHeaders)
+	clientConfig.InferenceURL = *inferenceURL
+	client := NewAzureClient(httpClient, token, clientConfig).WithHeaders(*showHeaders).WithLogOutput(logOut).WithStrictDecoding(*strictDecoding).WithRateLimitWait(rateLimitPrinter(logOut)).WithRetryPolicy(retryPolicy)
+
+	// The transcript records the prompt as written, without retrieved context
+	transcriptPrompt := userPrompt
+
+	if *ragIndex != "" {
+		augmented, err := retrieveContext(context.TODO(), client, *ragIndex, *ragK, userPrompt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		userPrompt = augmented
+	}
 
-	conv := conversation.Conversation{
-		SystemPrompt: "You are a coding assistant",
-		Messages: []conversation.ChatMessage{
-			{
-				Role:    conversation.ChatMessageRoleUser,
-				Content: conversation.Ptr(userPrompt),
-			},
-		},
+	conv := conversation.Conversation{SystemPrompt: systemPrompt}
+	if resumed != nil {
+		conv = *resumed
+		if explicitSystem {
+			conv.SystemPrompt = systemPrompt
+		}
+	}
+	conv.SystemPrompt = composeSystemPrompt(conv.SystemPrompt, *lang, styles)
+	conv.Model = *model
+	if userPrompt != "" || !*interactive {
+		conv.AddMessage(conversation.ChatMessageRoleUser, userPrompt)
 	}
 
+	conv.SetPrefill(*prefill)
+
 	req := ChatCompletionOptions{
-		Messages: []ChatMessage{}, // workaround for type, will copy below
+		Messages: conv.GetMessages(),
 		Model:    *model,
 	}
-	// Convert []conversation.ChatMessage to []ChatMessage
-	req.Messages = make([]ChatMessage, len(conv.GetMessages()))
-	for i, m := range conv.GetMessages() {
-		req.Messages[i] = ChatMessage{
-			Content: m.Content,
-			Role:    ChatMessageRole(m.Role),
+	if *filter {
+		// The prompt is the instruction, applied to the document on stdin
+		if req, err = filterRequest(req, userPrompt, os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
 	}
 
-	startTime := time.Now() // Start timing before making the request
+	req.PromptCacheKey = *promptCacheKey
+	req.ReasoningEffort = *reasoningEffort
+	req.LogitBias = parsedLogitBias
+	req.User = *user
+	sampling.apply(&req)
+	if *cachePrefix {
+		markCacheablePrefix(req.Messages, minCacheablePrefixChars)
+	}
 
-	resp, err := client.GetChatCompletionStream(context.TODO(), req)
+	if !*skipValidation {
+		validationReq := req
+		if *enabledTools != "" {
+			// Tools are added by the tool loop, but the model must support them
+			validationReq.Tools = []ToolDefinition{{Type: "function"}}
+		}
+		if err := client.ValidateRequest(context.TODO(), validationReq); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	err = client.precheckModeration(context.TODO(), req, *moderate, func(msg string) {
+		fmt.Fprintln(logOut, logColors.paint(logColors.theme.Warning, "warning: "+msg))
+	})
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *interactive {
+		in := bufio.NewScanner(os.Stdin)
+		in.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		chat := &repl{client: client, req: req, conv: &conv, session: sessionFile, colors: stdoutColors, in: in, out: os.Stdout}
+		if err := chat.run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var tee *transcript
+	if *teePath != "" {
+		tee, err = createTranscript(*teePath, *model, transcriptPrompt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *apiFlavor == "responses" {
+		var out io.Writer = os.Stdout
+		if tee != nil {
+			out = io.MultiWriter(os.Stdout, tee)
+		}
+		err := runResponses(context.TODO(), client, req, out)
+		if tee != nil {
+			if err := tee.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *enabledTools != "" {
+		registry, err := builtinTools(*enabledTools, *allowCommands, *searchURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if req.ToolChoice, err = parseToolChoice(*toolChoice, registry); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if err := runTools(context.TODO(), client, req, registry, *output, os.Stdout, logOut); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
-	defer resp.Reader.Close()
 
-	var totalTokens int
+	// Interrupting or timing out ends the stream, so that what was received is kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if *filter {
+		if err := runFilter(ctx, client, req, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	startTime := time.Now() // Start timing before making the request
+
+	var reader stream.Reader[ChatCompletion]
+	var reqID string
+	if *noStream {
+		completion, err := client.GetChatCompletion(ctx, req)
+		if err != nil {
+			reportRequestError(err)
+			os.Exit(1)
+		}
+		reader = &completionReader{completion: completion}
+	} else {
+		resp, err := client.GetChatCompletionStream(ctx, req)
+		if err != nil {
+			reportRequestError(err)
+			os.Exit(1)
+		}
+		reader = resp.Reader
+		reqID = resp.RequestID
+	}
+	defer reader.Close()
+
+	var usage *Usage
+	var contentFilter contentFilterTracker
 	firstTokenTime := time.Time{} // To track when the first token is received
 
-	reader := resp.Reader // Get the reader from the response
+	summaryOut := logColors.writer(logOut, logColors.theme.Summary)
+	var dataStream *aisdk.Writer
+	var finishReason string
+	if *output == "aisdk" {
+		dataStream = aisdk.NewWriter(os.Stdout)
+	}
+
+	// The response is copied to the transcript as it streams, in both output formats
+	var display io.Writer = os.Stdout
+	var code *codeHighlighter
+	if stdoutColors.enabled {
+		code = newCodeHighlighter(os.Stdout, stdoutColors.theme.Code)
+		display = code
+	}
+	terminal := display
+	teeOut := io.Discard
+	if tee != nil {
+		terminal = io.MultiWriter(display, tee)
+		teeOut = tee
+	}
+
+	// The model only returns the continuation, so show the prefill it continues from
+	if conv.Prefill != "" {
+		if dataStream != nil {
+			_ = dataStream.Text(conv.Prefill)
+			_, _ = io.WriteString(teeOut, conv.Prefill)
+		} else {
+			_, _ = io.WriteString(terminal, conv.Prefill)
+		}
+	}
+
+	reasoningOut := stderrColors.writer(os.Stderr, stderrColors.theme.Reasoning)
+
+	var streamErr error
+	var response strings.Builder
 
 	for {
 		completion, err := reader.Read()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+			if !errors.Is(err, io.EOF) {
+				streamErr = err
 			}
+			break
+		}
+
+		if completion.Usage != nil {
+			usage = completion.Usage
 		}
+		contentFilter.add(completion)
 
 		for _, choice := range completion.Choices {
-			if choice.Delta.Content != nil {
-				content := *choice.Delta.Content
-				fmt.Print(content)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+			if reasoning := choice.ReasoningContent(); reasoning != "" && *showReasoning {
+				_, _ = io.WriteString(reasoningOut, reasoning)
+			}
+			if content := choice.Content(); content != "" {
+				if dataStream != nil {
+					_ = dataStream.Text(content)
+					_, _ = io.WriteString(teeOut, content)
+				} else {
+					_, _ = io.WriteString(terminal, content)
+				}
 
-				// Count tokens (simple word count for now)
-				tokens := strings.Split(content, " ")
-				totalTokens += len(tokens)
+				response.WriteString(content)
 
 				// Record time of first token if not already set
 				if firstTokenTime.IsZero() {
@@ -303,15 +1073,72 @@ func main() {
 		}
 	}
 
-	// Calculate metrics
-	totalDuration := time.Since(startTime)
-	timeToFirstToken := firstTokenTime.Sub(startTime)
-	tokensPerSecond := float64(totalTokens) / totalDuration.Seconds()
+	if code != nil {
+		_ = code.Flush()
+	}
+	if tee != nil {
+		if err := tee.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if streamErr != nil {
+		content := response.String()
+		streamErr = newPartialCompletion(ChatMessage{Role: ChatMessageRoleAssistant, Content: &content}, usage, streamErr)
+		if dataStream != nil {
+			_ = dataStream.Error(streamErr.Error())
+		}
+		fmt.Fprintf(os.Stderr, "\n%s\n", stderrColors.paint(stderrColors.theme.Error, "error: "+streamErr.Error()))
+	} else if sessionFile != "" {
+		if conv.Prefill != "" {
+			conv.CompletePrefill(response.String())
+		} else {
+			conv.AddMessage(ChatMessageRoleAssistant, response.String())
+		}
+		if err := conv.Save(sessionFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if err := contentFilter.err(); err != nil {
+		if dataStream != nil {
+			_ = dataStream.Error(err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "\n%s\n", stderrColors.paint(stderrColors.theme.Error, err.Error()))
+	}
+
+	if dataStream != nil {
+		_ = dataStream.Finish(aisdk.FinishReasonFromOpenAI(finishReason), aisdkUsage(usage))
+	}
 
 	// Report metrics
-	fmt.Printf("\nExecution Summary:\n")
-	fmt.Printf("Total duration:          %v\n", totalDuration)
-	fmt.Printf("Time to first token:     %v\n", timeToFirstToken)
-	fmt.Printf("Total tokens received:   %d\n", totalTokens)
-	fmt.Printf("Tokens per second:       %.2f\n", tokensPerSecond)
+	summary := executionSummary{
+		Model:            *model,
+		RequestID:        reqID,
+		TotalDuration:    time.Since(startTime),
+		TimeToFirstToken: firstTokenTime.Sub(startTime),
+		EstimatedTokens:  estimateTokens(response.String()),
+		Usage:            usage,
+		Price:            userCfg.price(*model),
+	}
+	summary.write(summaryOut)
+	if metricsOut != nil {
+		runErr := streamErr
+		if runErr == nil {
+			runErr = contentFilter.err()
+		}
+		if err := summary.writeJSON(metricsOut, runErr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if streamErr != nil {
+		notify.notify("Response incomplete", streamErr.Error())
+	} else {
+		notify.notify("Response finished", fmt.Sprintf("%s finished in %v", *model, time.Since(startTime).Round(time.Second)))
+	}
+
+	if streamErr != nil {
+		os.Exit(1)
+	}
 }
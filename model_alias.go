@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// aliasesPath returns the file storing model aliases.
+func aliasesPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aliases.json"), nil
+}
+
+// loadAliases returns the user's model aliases, which map short names to model ids.
+func loadAliases() (map[string]string, error) {
+	path, err := aliasesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	aliases := map[string]string{}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return aliases, nil
+}
+
+func saveAliases(aliases map[string]string) error {
+	path, err := aliasesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// resolveModel returns the model id an alias stands for, or name itself if it is not
+// an alias.
+func resolveModel(name string) string {
+	aliases, err := loadAliases()
+	if err != nil {
+		return name
+	}
+	if model, ok := aliases[name]; ok {
+		return model
+	}
+	return name
+}
+
+// modelValue is a flag.Value that resolves model aliases as the flag is parsed.
+type modelValue string
+
+func (v *modelValue) String() string { return string(*v) }
+
+func (v *modelValue) Set(s string) error {
+	*v = modelValue(resolveModel(s))
+	return nil
+}
+
+// modelFlag defines a model flag on fs whose value may be an alias.
+func modelFlag(fs *flag.FlagSet, name, value, usage string) *string {
+	v := modelValue(value)
+	fs.Var(&v, name, usage)
+	return (*string)(&v)
+}
+
+// runAlias implements the `alias` subcommand.
+func runAlias(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %[1]s alias set <name> <model>\n       %[1]s alias list\n       %[1]s alias delete <name>\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	aliases, err := loadAliases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "set" && len(args) == 3:
+		aliases[args[1]] = args[2]
+		err = saveAliases(aliases)
+	case args[0] == "delete" && len(args) == 2:
+		if _, ok := aliases[args[1]]; !ok {
+			fmt.Fprintf(os.Stderr, "no alias named %s\n", args[1])
+			return 1
+		}
+		delete(aliases, args[1])
+		err = saveAliases(aliases)
+	case args[0] == "list" && len(args) == 1:
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%s\n", name, aliases[name])
+		}
+		err = tw.Flush()
+	default:
+		usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setTestAliases points the configuration directory at a temporary one holding
+// aliases.
+func setTestAliases(t *testing.T, aliases map[string]string) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if aliases != nil {
+		if err := saveAliases(aliases); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	setTestAliases(t, map[string]string{
+		"fast":  "openai/gpt-4.1-mini",
+		"smart": "fast",
+		"phi":   "microsoft/phi-4",
+	})
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"fast", "openai/gpt-4.1-mini"},
+		{"phi", "microsoft/phi-4"},
+		{"openai/gpt-4.1", "openai/gpt-4.1"},
+		{"FAST", "FAST"},
+		{"smart", "fast"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveModel(tt.name); got != tt.want {
+				t.Errorf("resolveModel(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveModelWithoutAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // of the aliases file, which is missing if empty
+	}{
+		{"missing file", ""},
+		{"malformed file", "fast: openai/gpt-4.1-mini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestAliases(t, nil)
+			if tt.content != "" {
+				path, _ := aliasesPath()
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := resolveModel("fast"); got != "fast" {
+				t.Errorf("resolveModel(%q) = %q, want it unchanged", "fast", got)
+			}
+		})
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	setTestAliases(t, nil)
+	if aliases, err := loadAliases(); err != nil || len(aliases) != 0 {
+		t.Fatalf("loadAliases() without a file = %v, %v, want no aliases", aliases, err)
+	}
+
+	want := map[string]string{"fast": "openai/gpt-4.1-mini"}
+	if err := saveAliases(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadAliases() = %v, want %v", got, want)
+	}
+
+	path, _ := aliasesPath()
+	if err := os.WriteFile(path, []byte("["), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadAliases(); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("loadAliases() of a malformed file err = %v, want it to name %s", err, path)
+	}
+}
+
+func TestModelFlag(t *testing.T) {
+	setTestAliases(t, map[string]string{"fast": "openai/gpt-4.1-mini"})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "fast"}, // defaults are not resolved
+		{[]string{"-model", "fast"}, "openai/gpt-4.1-mini"},
+		{[]string{"-model", "openai/gpt-4.1"}, "openai/gpt-4.1"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			model := modelFlag(fs, "model", "fast", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if *model != tt.want {
+				t.Errorf("model = %q, want %q", *model, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLIAlias(t *testing.T) {
+	env := []string{"XDG_CONFIG_HOME=" + t.TempDir()}
+	runCLIWithEnv(t, env, "alias", "set", "fast", "openai/gpt-4.1-mini")
+	runCLIWithEnv(t, env, "alias", "set", "phi", "microsoft/phi-4")
+	runCLIWithEnv(t, env, "alias", "delete", "phi")
+	if stdout, _ := runCLIWithEnv(t, env, "alias", "list"); stdout != "fast  openai/gpt-4.1-mini\n" {
+		t.Errorf("alias list = %q", stdout)
+	}
+}
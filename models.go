@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runModels implements the `models` subcommand.
+func runModels(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s models list [-json] [-publisher <name>]\n", os.Args[0])
+	}
+	if len(args) == 0 || args[0] != "list" {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("models list", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the catalog entries as JSON")
+	publisher := fs.String("publisher", "", "Only list models from this publisher")
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 0 {
+		usage()
+		return 2
+	}
+
+	if err := listModels(context.TODO(), newCLIClient(), os.Stdout, *publisher, *asJSON); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listModels writes the catalog's models sorted by id, keeping only those of
+// publisher if it is not empty, as a table or as JSON.
+func listModels(ctx context.Context, client *AzureClient, w io.Writer, publisher string, asJSON bool) error {
+	models, err := client.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	if publisher != "" {
+		var matched []*ModelSummary
+		for _, m := range models {
+			if strings.EqualFold(m.Publisher, publisher) {
+				matched = append(matched, m)
+			}
+		}
+		models = matched
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+
+	if asJSON {
+		if models == nil {
+			models = []*ModelSummary{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(models)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPUBLISHER\tCONTEXT\tOUTPUT\tTIER\t")
+	for _, m := range models {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", m.ID, m.Publisher,
+			formatTokenLimit(m.Limits.MaxInputTokens), formatTokenLimit(m.Limits.MaxOutputTokens), m.RateLimitTier)
+	}
+	return tw.Flush()
+}
+
+// formatTokenLimit returns "-" for limits the catalog does not report.
+func formatTokenLimit(tokens int) string {
+	if tokens == 0 {
+		return "-"
+	}
+	return strconv.Itoa(tokens)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestListModels(t *testing.T) {
+	catalog := []map[string]any{
+		{"id": "openai/gpt-4.1", "publisher": "OpenAI", "rate_limit_tier": "high", "limits": map[string]int{"max_input_tokens": 1048576, "max_output_tokens": 32768}},
+		{"id": "microsoft/phi-4", "publisher": "Microsoft", "rate_limit_tier": "low", "limits": map[string]int{"max_input_tokens": 16384}},
+		{"id": "openai/gpt-4.1-mini", "publisher": "OpenAI", "rate_limit_tier": "low"},
+	}
+	tests := []struct {
+		name      string
+		publisher string
+		asJSON    bool
+		want      string
+		wantIDs   []string
+	}{
+		{
+			name: "table",
+			want: "MODEL                PUBLISHER  CONTEXT  OUTPUT  TIER  \n" +
+				"microsoft/phi-4      Microsoft  16384    -       low   \n" +
+				"openai/gpt-4.1       OpenAI     1048576  32768   high  \n" +
+				"openai/gpt-4.1-mini  OpenAI     -        -       low   \n",
+		},
+		{
+			name:      "publisher",
+			publisher: "openai",
+			want: "MODEL                PUBLISHER  CONTEXT  OUTPUT  TIER  \n" +
+				"openai/gpt-4.1       OpenAI     1048576  32768   high  \n" +
+				"openai/gpt-4.1-mini  OpenAI     -        -       low   \n",
+		},
+		{name: "json", asJSON: true, wantIDs: []string{"microsoft/phi-4", "openai/gpt-4.1", "openai/gpt-4.1-mini"}},
+		{name: "json without matches", publisher: "Meta", asJSON: true, wantIDs: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := modelstest.NewServer(t)
+			srv.Models = catalog
+
+			var out strings.Builder
+			if err := listModels(context.Background(), newTestClient(srv), &out, tt.publisher, tt.asJSON); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.asJSON {
+				if out.String() != tt.want {
+					t.Errorf("listed\n%s\nwant\n%s", out.String(), tt.want)
+				}
+				return
+			}
+			var models []ModelSummary
+			if err := json.Unmarshal([]byte(out.String()), &models); err != nil {
+				t.Fatalf("decoding %s: %v", out.String(), err)
+			}
+			ids := []string{}
+			for _, m := range models {
+				ids = append(ids, m.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") || models == nil {
+				t.Errorf("listed %s, want %v", out.String(), tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestFormatTokenLimit(t *testing.T) {
+	tests := []struct {
+		tokens int
+		want   string
+	}{
+		{0, "-"},
+		{4096, "4096"},
+		{1048576, "1048576"},
+	}
+	for _, tt := range tests {
+		if got := formatTokenLimit(tt.tokens); got != tt.want {
+			t.Errorf("formatTokenLimit(%d) = %q, want %q", tt.tokens, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package modelstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// Mode selects whether a Recorder talks to the real backend or a cassette.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette and never touches the network.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to the real transport and records the interactions.
+	ModeRecord
+)
+
+// RecordEnv is the environment variable that switches ModeFromEnv to ModeRecord.
+const RecordEnv = "MODELSTEST_RECORD"
+
+// ModeFromEnv returns ModeRecord if RecordEnv is set to a non-empty value and
+// ModeReplay otherwise.
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// ErrNoInteraction is returned in replay mode when the cassette has no matching interaction.
+var ErrNoInteraction = errors.New("modelstest: no recorded interaction matches the request")
+
+// scrubbedHeaders are never written to a cassette.
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// tokenPattern matches GitHub tokens that may appear in bodies.
+var tokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body"`
+	} `json:"response"`
+}
+
+// Recorder is an http.RoundTripper that records interactions to a cassette file and
+// replays them deterministically. Streamed bodies are recorded as they are read, so
+// streaming behaves normally while recording.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder returns a Recorder for the cassette at path. In replay mode the cassette
+// is loaded now. transport is used in record mode and defaults to http.DefaultTransport.
+func NewRecorder(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{path: path, mode: mode, transport: transport}
+	if mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("decoding cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+// Client returns an http.Client that uses the Recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, scrub(body))
+	}
+	return r.record(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body string) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Interactions are matched in recorded order so repeated identical requests
+	// replay their own responses
+	for i, interaction := range r.interactions {
+		if r.used[i] || interaction.Request.Method != req.Method || interaction.Request.URL != req.URL.String() || interaction.Request.Body != body {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			StatusCode: interaction.Response.Status,
+			Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			Header:     interaction.Response.Header.Clone(),
+			Body:       io.NopCloser(bytes.NewReader([]byte(interaction.Response.Body))),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{}
+	interaction.Request.Method = req.Method
+	interaction.Request.URL = req.URL.String()
+	interaction.Request.Header = scrubHeader(req.Header)
+	interaction.Request.Body = scrub(body)
+	interaction.Response.Status = resp.StatusCode
+	interaction.Response.Header = scrubHeader(resp.Header)
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+
+	resp.Body = &recordingBody{ReadCloser: resp.Body, recorder: r, interaction: interaction}
+	return resp, nil
+}
+
+// Save writes the recorded interactions to the cassette. It does nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+// recordingBody copies a response body into its interaction as it is read.
+type recordingBody struct {
+	io.ReadCloser
+	recorder    *Recorder
+	interaction *Interaction
+	buf         bytes.Buffer
+	done        bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish() {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.recorder.mu.Lock()
+	b.interaction.Response.Body = scrub(b.buf.Bytes())
+	b.recorder.mu.Unlock()
+}
+
+func scrubHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range scrubbedHeaders {
+		header.Del(name)
+	}
+	return header
+}
+
+func scrub(body []byte) string {
+	return tokenPattern.ReplaceAllString(string(body), "REDACTED")
+}
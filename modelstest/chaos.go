@@ -0,0 +1,238 @@
+package modelstest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault is a failure injected by ChaosTransport.
+type Fault int
+
+const (
+	// FaultNone passes the request through untouched.
+	FaultNone Fault = iota
+	// FaultTimeout blocks until the request's context is done, or TimeoutAfter elapses.
+	FaultTimeout
+	// FaultDisconnect cuts the response body off with io.ErrUnexpectedEOF.
+	FaultDisconnect
+	// FaultRateLimit answers 429 without forwarding the request.
+	FaultRateLimit
+	// FaultSlowDrip delivers the response body a few bytes at a time.
+	FaultSlowDrip
+)
+
+func (f Fault) String() string {
+	switch f {
+	case FaultNone:
+		return "none"
+	case FaultTimeout:
+		return "timeout"
+	case FaultDisconnect:
+		return "disconnect"
+	case FaultRateLimit:
+		return "rate limit"
+	case FaultSlowDrip:
+		return "slow drip"
+	default:
+		return "fault(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// ChaosOptions configures ChaosTransport. Unless Schedule is set, each request draws
+// a fault at random using the rates, which are probabilities between 0 and 1.
+type ChaosOptions struct {
+	// Seed makes the random schedule reproducible.
+	Seed int64
+	// Schedule fixes the fault of the i-th request. Requests beyond it draw at random.
+	Schedule []Fault
+
+	TimeoutRate    float64
+	DisconnectRate float64
+	RateLimitRate  float64
+	SlowDripRate   float64
+
+	// TimeoutAfter bounds a timeout when the request has no deadline. Defaults to 30s.
+	TimeoutAfter time.Duration
+	// RateLimitBurst is how many consecutive requests a drawn rate limit fault rejects.
+	// Defaults to 1.
+	RateLimitBurst int
+	// RetryAfter is advertised on rate limited responses. Defaults to 10ms.
+	RetryAfter time.Duration
+	// DisconnectAfter is the number of body bytes delivered before a disconnect. If
+	// zero, a random point within the first 512 bytes is used.
+	DisconnectAfter int
+	// DripSize and DripDelay pace slow drip bodies. They default to 1 byte and 5ms.
+	DripSize  int
+	DripDelay time.Duration
+}
+
+// ChaosTransport is an http.RoundTripper decorator that injects faults according to a
+// seedable schedule, for exercising retry and reconnection logic.
+type ChaosTransport struct {
+	next http.RoundTripper
+	opts ChaosOptions
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	requests int
+	burst    int
+	injected []Fault
+}
+
+// NewChaosTransport wraps next, which defaults to http.DefaultTransport.
+func NewChaosTransport(next http.RoundTripper, opts ChaosOptions) *ChaosTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if opts.TimeoutAfter == 0 {
+		opts.TimeoutAfter = 30 * time.Second
+	}
+	if opts.RateLimitBurst == 0 {
+		opts.RateLimitBurst = 1
+	}
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 10 * time.Millisecond
+	}
+	if opts.DripSize == 0 {
+		opts.DripSize = 1
+	}
+	if opts.DripDelay == 0 {
+		opts.DripDelay = 5 * time.Millisecond
+	}
+	return &ChaosTransport{next: next, opts: opts, rng: rand.New(rand.NewSource(opts.Seed))}
+}
+
+// Injected returns the fault applied to each request so far, in order.
+func (t *ChaosTransport) Injected() []Fault {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Fault(nil), t.injected...)
+}
+
+func (t *ChaosTransport) draw() (Fault, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := t.requests
+	t.requests++
+	fault := FaultNone
+	switch {
+	case i < len(t.opts.Schedule):
+		fault = t.opts.Schedule[i]
+	case t.burst > 0:
+		t.burst--
+		fault = FaultRateLimit
+	default:
+		r := t.rng.Float64()
+		for _, candidate := range []struct {
+			fault Fault
+			rate  float64
+		}{
+			{FaultTimeout, t.opts.TimeoutRate},
+			{FaultDisconnect, t.opts.DisconnectRate},
+			{FaultRateLimit, t.opts.RateLimitRate},
+			{FaultSlowDrip, t.opts.SlowDripRate},
+		} {
+			if r < candidate.rate {
+				fault = candidate.fault
+				break
+			}
+			r -= candidate.rate
+		}
+		if fault == FaultRateLimit {
+			t.burst = t.opts.RateLimitBurst - 1
+		}
+	}
+
+	cut := t.opts.DisconnectAfter
+	if cut == 0 {
+		cut = t.rng.Intn(512)
+	}
+	t.injected = append(t.injected, fault)
+	return fault, cut
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, cut := t.draw()
+
+	switch fault {
+	case FaultTimeout:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(t.opts.TimeoutAfter):
+			return nil, fmt.Errorf("modelstest: injected timeout: %w", context.DeadlineExceeded)
+		}
+	case FaultRateLimit:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		ms := strconv.FormatInt(t.opts.RetryAfter.Milliseconds(), 10)
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "429 Too Many Requests",
+			Header: http.Header{
+				"Content-Type":   {"application/json"},
+				"Retry-After-Ms": {ms},
+			},
+			Body:    io.NopCloser(strings.NewReader(`{"error":{"code":"RateLimitReached","message":"injected rate limit"}}`)),
+			Request: req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch fault {
+	case FaultDisconnect:
+		resp.Body = &disconnectingBody{ReadCloser: resp.Body, remaining: cut}
+	case FaultSlowDrip:
+		resp.Body = &drippingBody{ReadCloser: resp.Body, size: t.opts.DripSize, delay: t.opts.DripDelay}
+	}
+	return resp, nil
+}
+
+// disconnectingBody fails with io.ErrUnexpectedEOF after remaining bytes.
+type disconnectingBody struct {
+	io.ReadCloser
+	remaining int
+}
+
+func (b *disconnectingBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
+
+// drippingBody returns at most size bytes per Read, sleeping delay before each.
+type drippingBody struct {
+	io.ReadCloser
+	size  int
+	delay time.Duration
+}
+
+func (b *drippingBody) Read(p []byte) (int, error) {
+	time.Sleep(b.delay)
+	if len(p) > b.size {
+		p = p[:b.size]
+	}
+	return b.ReadCloser.Read(p)
+}
@@ -0,0 +1,60 @@
+package modelstest
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden rewrite golden
+// files with the current output instead of comparing against them.
+const UpdateGoldenEnv = "MODELSTEST_UPDATE_GOLDEN"
+
+// Replacement rewrites every match of Pattern with With when normalizing output.
+type Replacement struct {
+	Pattern *regexp.Regexp
+	With    string
+}
+
+// DefaultReplacements mask values that vary between runs: timestamps, durations and
+// throughput figures.
+var DefaultReplacements = []Replacement{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`), "<TIME>"},
+	{regexp.MustCompile(`\b(\d+h)?(\d+m)?\d+(\.\d+)?(ns|µs|us|ms|s)\b`), "<DURATION>"},
+	{regexp.MustCompile(`(Tokens per second:\s+)\d+(\.\d+)?`), "${1}<RATE>"},
+}
+
+// Normalize applies DefaultReplacements followed by extra to s.
+func Normalize(s string, extra ...Replacement) string {
+	for _, r := range append(append([]Replacement{}, DefaultReplacements...), extra...) {
+		s = r.Pattern.ReplaceAllString(s, r.With)
+	}
+	return s
+}
+
+// AssertGolden normalizes got and compares it against the golden file at path, which
+// is conventionally under testdata. When UpdateGoldenEnv is set the file is written
+// instead.
+func AssertGolden(t testing.TB, path string, got string, extra ...Replacement) {
+	t.Helper()
+	got = Normalize(got, extra...)
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (set %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match %s (set %s=1 to update)\n--- got\n%s\n--- want\n%s", path, UpdateGoldenEnv, got, want)
+	}
+}
@@ -0,0 +1,318 @@
+// Package modelstest provides an in-process fake of the GitHub Models inference and
+// catalog APIs for tests that must run offline.
+package modelstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+const (
+	// InferencePath is the path of the chat completions endpoint.
+	InferencePath = "/inference/chat/completions"
+	// CatalogPath is the path of the model catalog endpoint.
+	CatalogPath = "/catalog/models"
+)
+
+// ToolCall represents a tool call the scripted response asks the client to make.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Usage represents the token usage reported at the end of a scripted response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Response scripts the server's reply to one chat completion request.
+type Response struct {
+	// Status is the HTTP status code. Defaults to 200.
+	Status int
+	// Header holds extra response headers, such as rate limit headers.
+	Header http.Header
+	// Body is sent verbatim instead of a completion, typically with an error Status.
+	Body string
+
+	// Chunks are the content deltas streamed in order.
+	Chunks []string
+	// ToolCalls are streamed after the content, one delta per call.
+	ToolCalls []ToolCall
+	// FinishReason defaults to "stop", or "tool_calls" when ToolCalls are set.
+	FinishReason string
+	// Usage is sent in a final chunk when set.
+	Usage *Usage
+
+	// Events are raw SSE data payloads sent instead of the generated chunks, for
+	// scripting malformed or unusual streams.
+	Events []string
+	// OmitDone leaves out the [DONE] sentinel, simulating a dropped connection.
+	OmitDone bool
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Server is a fake GitHub Models API backed by an httptest.Server. Responses are
+// consumed in the order they were enqueued.
+type Server struct {
+	*httptest.Server
+
+	// Latency delays every response before its headers are written.
+	Latency time.Duration
+	// ChunkDelay paces streamed chunks.
+	ChunkDelay time.Duration
+	// Models is served by the catalog endpoint.
+	Models []map[string]any
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+// NewServer starts a Server. It is closed when the test ends if t is non-nil.
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(InferencePath, s.handleChatCompletion)
+	mux.HandleFunc(CatalogPath, s.handleCatalog)
+	s.Server = httptest.NewServer(s.record(mux))
+	if t != nil {
+		t.Cleanup(s.Close)
+	}
+	return s
+}
+
+// InferenceURL returns the URL of the chat completions endpoint.
+func (s *Server) InferenceURL() string {
+	return s.URL + InferencePath
+}
+
+// CatalogURL returns the URL of the model catalog endpoint.
+func (s *Server) CatalogURL() string {
+	return s.URL + CatalogPath
+}
+
+// Enqueue adds responses to be returned to subsequent chat completion requests.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		s.mu.Unlock()
+
+		if s.Latency > 0 {
+			select {
+			case <-time.After(s.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) next() (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.responses) == 0 {
+		return Response{}, false
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, true
+}
+
+func (s *Server) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	resp, ok := s.next()
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "modelstest: no scripted response")
+		return
+	}
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if resp.Body != "" || status != http.StatusOK {
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, resp.Body)
+		return
+	}
+
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(completion(req.Model, resp))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	events := resp.Events
+	if events == nil {
+		events = chunks(req.Model, resp)
+	}
+	for i, event := range events {
+		if i > 0 && s.ChunkDelay > 0 {
+			select {
+			case <-time.After(s.ChunkDelay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		fmt.Fprintf(w, "data: %s\n\n", event)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if !resp.OmitDone {
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	models := s.Models
+	if models == nil {
+		models = []map[string]any{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"message": message}})
+}
+
+func finishReason(resp Response) string {
+	if resp.FinishReason != "" {
+		return resp.FinishReason
+	}
+	if len(resp.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// chunks renders resp as chat.completion.chunk payloads shaped like GitHub Models'.
+func chunks(model string, resp Response) []string {
+	var events []map[string]any
+	chunk := func(delta map[string]any, finish any) map[string]any {
+		return map[string]any{
+			"id":      "chatcmpl-modelstest",
+			"object":  "chat.completion.chunk",
+			"created": 0,
+			"model":   model,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	events = append(events, chunk(map[string]any{"role": "assistant", "content": ""}, nil))
+	for _, content := range resp.Chunks {
+		events = append(events, chunk(map[string]any{"content": content}, nil))
+	}
+	for i, call := range resp.ToolCalls {
+		events = append(events, chunk(map[string]any{"tool_calls": []map[string]any{{
+			"index":    i,
+			"id":       call.ID,
+			"type":     "function",
+			"function": map[string]string{"name": call.Name, "arguments": call.Arguments},
+		}}}, nil))
+	}
+	events = append(events, chunk(map[string]any{}, finishReason(resp)))
+	if resp.Usage != nil {
+		events = append(events, map[string]any{
+			"id":      "chatcmpl-modelstest",
+			"object":  "chat.completion.chunk",
+			"created": 0,
+			"model":   model,
+			"choices": []any{},
+			"usage":   resp.Usage,
+		})
+	}
+
+	payloads := make([]string, len(events))
+	for i, event := range events {
+		data, _ := json.Marshal(event)
+		payloads[i] = string(data)
+	}
+	return payloads
+}
+
+// completion renders resp as a non-streamed chat.completion.
+func completion(model string, resp Response) map[string]any {
+	var content string
+	for _, chunk := range resp.Chunks {
+		content += chunk
+	}
+	message := map[string]any{"role": "assistant", "content": content}
+	if len(resp.ToolCalls) > 0 {
+		var calls []map[string]any
+		for _, call := range resp.ToolCalls {
+			calls = append(calls, map[string]any{
+				"id":       call.ID,
+				"type":     "function",
+				"function": map[string]string{"name": call.Name, "arguments": call.Arguments},
+			})
+		}
+		message["tool_calls"] = calls
+	}
+	result := map[string]any{
+		"id":      "chatcmpl-modelstest",
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   model,
+		"choices": []map[string]any{{"index": 0, "message": message, "finish_reason": finishReason(resp)}},
+	}
+	if resp.Usage != nil {
+		result["usage"] = resp.Usage
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultModerationsURL  = "https://models.github.ai/inference/moderations"
+	defaultModerationModel = "omni-moderation-latest"
+)
+
+// Moderation pre-check modes.
+const (
+	moderationOff   = "off"
+	moderationFlag  = "flag"
+	moderationBlock = "block"
+)
+
+// ModerationOptions represents the options for a moderation request.
+type ModerationOptions struct {
+	Input []string `json:"input"`
+	Model string   `json:"model,omitempty"`
+}
+
+// ModerationResult represents the moderation verdict for a single input.
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// FlaggedCategories returns the sorted names of the categories that were flagged.
+func (r ModerationResult) FlaggedCategories() []string {
+	var categories []string
+	for name, flagged := range r.Categories {
+		if flagged {
+			categories = append(categories, name)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// ModerationResponse represents a response to a moderation request.
+type ModerationResponse struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
+// Flagged reports whether any input was flagged.
+func (r *ModerationResponse) Flagged() bool {
+	for _, result := range r.Results {
+		if result.Flagged {
+			return true
+		}
+	}
+	return false
+}
+
+// FlaggedCategories returns the sorted names of the categories flagged for any input.
+func (r *ModerationResponse) FlaggedCategories() []string {
+	seen := map[string]bool{}
+	var categories []string
+	for _, result := range r.Results {
+		for _, name := range result.FlaggedCategories() {
+			if !seen[name] {
+				seen[name] = true
+				categories = append(categories, name)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// GetModeration classifies the inputs against the provider's content policy.
+func (c *AzureClient) GetModeration(ctx context.Context, req ModerationOptions) (*ModerationResponse, error) {
+	resp, err := c.postJSON(ctx, c.cfg.ModerationsURL, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var moderation ModerationResponse
+	if err := c.decodeJSON(resp, &moderation); err != nil {
+		return nil, err
+	}
+	return &moderation, nil
+}
+
+// ModerationError is returned when a pre-check blocks a prompt.
+type ModerationError struct {
+	Categories []string
+}
+
+func (e *ModerationError) Error() string {
+	return "prompt blocked by moderation: " + strings.Join(e.Categories, ", ")
+}
+
+// precheckModeration moderates the user messages of req. In block mode a flagged prompt
+// returns a *ModerationError; in flag mode warn is called and the request may proceed.
+func (c *AzureClient) precheckModeration(ctx context.Context, req ChatCompletionOptions, mode string, warn func(string)) error {
+	if mode == moderationOff || mode == "" {
+		return nil
+	}
+
+	var inputs []string
+	for _, m := range req.Messages {
+		if m.Role == ChatMessageRoleUser && m.Content != nil {
+			inputs = append(inputs, *m.Content)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	moderation, err := c.GetModeration(ctx, ModerationOptions{Input: inputs, Model: defaultModerationModel})
+	if err != nil {
+		return fmt.Errorf("moderation pre-check failed: %w", err)
+	}
+	if !moderation.Flagged() {
+		return nil
+	}
+
+	categories := moderation.FlaggedCategories()
+	if mode == moderationBlock {
+		return &ModerationError{Categories: categories}
+	}
+	warn("prompt flagged by moderation: " + strings.Join(categories, ", "))
+	return nil
+}
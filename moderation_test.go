@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrecheckModeration(t *testing.T) {
+	var requests []ModerationOptions
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ModerationOptions
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+		if strings.Contains(strings.Join(req.Input, " "), "fail") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":"bad","message":"moderation unavailable"}}`))
+			return
+		}
+		resp := ModerationResponse{ID: "modr-1", Model: req.Model}
+		for _, input := range req.Input {
+			result := ModerationResult{Categories: map[string]bool{"violence": false, "harassment": false, "hate": false}}
+			for name := range result.Categories {
+				if strings.Contains(input, name) {
+					result.Categories[name], result.Flagged = true, true
+				}
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+	cfg := NewDefaultAzureClientConfig()
+	cfg.ModerationsURL = srv.URL
+	client := NewAzureClient(srv.Client(), "test-token", cfg)
+
+	// Only user messages are moderated
+	system, safe, flagged := "violence is fine here", "hello", "harassment and violence"
+	req := ChatCompletionOptions{Messages: []ChatMessage{
+		{Role: ChatMessageRoleSystem, Content: &system},
+		{Role: ChatMessageRoleUser, Content: &safe},
+		{Role: ChatMessageRoleUser, Content: &flagged},
+	}}
+	ctx := context.Background()
+	noWarn := func(msg string) { t.Errorf("warned %q", msg) }
+
+	var moderationErr *ModerationError
+	if err := client.precheckModeration(ctx, req, moderationBlock, noWarn); !errors.As(err, &moderationErr) || strings.Join(moderationErr.Categories, ",") != "harassment,violence" {
+		t.Errorf("block mode = %v, want a ModerationError for harassment and violence", err)
+	}
+	if len(requests) != 1 || strings.Join(requests[0].Input, "|") != "hello|harassment and violence" || requests[0].Model != defaultModerationModel {
+		t.Errorf("moderation requests = %+v", requests)
+	}
+
+	var warnings []string
+	if err := client.precheckModeration(ctx, req, moderationFlag, func(msg string) { warnings = append(warnings, msg) }); err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "harassment, violence") {
+		t.Errorf("flag mode = %v with warnings %q, want one warning and no error", err, warnings)
+	}
+
+	req.Messages = req.Messages[:2]
+	if err := client.precheckModeration(ctx, req, moderationBlock, noWarn); err != nil {
+		t.Errorf("block mode for a safe prompt = %v", err)
+	}
+
+	requests = nil
+	if err := client.precheckModeration(ctx, req, moderationOff, noWarn); err != nil || len(requests) != 0 {
+		t.Errorf("off mode = %v after %d requests, want no requests", err, len(requests))
+	}
+	if err := client.precheckModeration(ctx, ChatCompletionOptions{Messages: req.Messages[:1]}, moderationBlock, noWarn); err != nil || len(requests) != 0 {
+		t.Errorf("a prompt without user messages = %v after %d requests, want no requests", err, len(requests))
+	}
+
+	failing := "fail"
+	if err := client.precheckModeration(ctx, ChatCompletionOptions{Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: &failing}}}, moderationFlag, noWarn); err == nil || !strings.Contains(err.Error(), "moderation pre-check failed") {
+		t.Errorf("a failed moderation = %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Notification methods accepted by -notify.
+const (
+	notifyOff     = ""
+	notifyBell    = "bell"
+	notifyDesktop = "desktop"
+)
+
+// notifyValue is the -notify flag. Given without a value it rings the bell.
+type notifyValue string
+
+func (v *notifyValue) String() string { return string(*v) }
+
+func (v *notifyValue) Set(s string) error {
+	switch s {
+	case "true", notifyBell:
+		*v = notifyBell
+	case "false":
+		*v = notifyOff
+	case notifyDesktop:
+		*v = notifyDesktop
+	default:
+		return fmt.Errorf("unknown notification: %s (want bell or desktop)", s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets -notify be given without a value.
+func (v *notifyValue) IsBoolFlag() bool { return true }
+
+// notifyFlag registers -notify on fs.
+func notifyFlag(fs *flag.FlagSet, usage string) *notifyValue {
+	v := new(notifyValue)
+	fs.Var(v, "notify", usage)
+	return v
+}
+
+// notify announces that a long-running command finished. Desktop notifications fall
+// back to the terminal bell where no notifier is available.
+func (v *notifyValue) notify(title, message string) {
+	if *v == notifyDesktop && desktopNotify(title, message) == nil {
+		return
+	}
+	if *v != notifyOff {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+}
+
+// desktopNotify shows a desktop notification with the platform's notifier.
+func desktopNotify(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", "display notification "+strconv.Quote(message)+" with title "+strconv.Quote(title))
+	case "windows":
+		script := `[void][Reflection.Assembly]::LoadWithPartialName('System.Windows.Forms');` +
+			`$n = New-Object System.Windows.Forms.NotifyIcon; $n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true;` +
+			`$n.ShowBalloonTip(5000, $env:GHMODELS_NOTIFY_TITLE, $env:GHMODELS_NOTIFY_MESSAGE, 'Info'); Start-Sleep -Seconds 5`
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+		cmd.Env = append(os.Environ(), "GHMODELS_NOTIFY_TITLE="+title, "GHMODELS_NOTIFY_MESSAGE="+message)
+	default:
+		cmd = exec.Command("notify-send", title, message)
+	}
+	return cmd.Run()
+}
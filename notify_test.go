@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNotifyFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    notifyValue
+		wantErr string
+	}{
+		{args: nil, want: notifyOff},
+		{args: []string{"-notify"}, want: notifyBell},
+		{args: []string{"-notify=bell"}, want: notifyBell},
+		{args: []string{"-notify=desktop"}, want: notifyDesktop},
+		{args: []string{"-notify=desktop", "-notify=false"}, want: notifyOff},
+		{args: []string{"-notify=chime"}, wantErr: "unknown notification: chime (want bell or desktop)"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			notify := notifyFlag(fs, "")
+			err := fs.Parse(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *notify != tt.want {
+				t.Errorf("notify = %q, want %q", *notify, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLINotify(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantBell bool
+	}{
+		{[]string{"pipeline"}, false},
+		{[]string{"-notify", "pipeline"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			stdout, stderr := runCLI(t, tt.args...)
+			if stdout != "pipeline" {
+				t.Errorf("stdout = %q, want only the response", stdout)
+			}
+			if strings.Contains(stderr, "\a") != tt.wantBell {
+				t.Errorf("stderr = %q, want bell %v", stderr, tt.wantBell)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+// minCacheablePrefixChars approximates the 1024 token minimum most providers require
+// before a prompt prefix is cached.
+const minCacheablePrefixChars = 4096
+
+// cacheControlEphemeral is the cache-control type providers accept for prompt caching.
+const cacheControlEphemeral = "ephemeral"
+
+// markCacheablePrefix adds a cache-control hint to the last message of the stable
+// prefix of messages, which is everything before the final user turn. The hint is
+// only added when the prefix is at least minChars long, since shorter prefixes are
+// not cached by providers.
+func markCacheablePrefix(messages []ChatMessage, minChars int) {
+	end := len(messages)
+	if end > 0 && messages[end-1].Role == ChatMessageRoleUser {
+		end--
+	}
+	if end == 0 {
+		return
+	}
+
+	size := 0
+	for _, m := range messages[:end] {
+		if m.Content != nil {
+			size += len(*m.Content)
+		}
+	}
+
+	if size >= minChars {
+		messages[end-1].CacheControl = &CacheControl{Type: cacheControlEphemeral}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// promptNamePattern restricts prompt names to ones that are safe as file names.
+var promptNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ErrPromptNotFound is returned when no saved prompt has the requested name.
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// SavedPrompt is a named, reusable prompt with default request parameters.
+type SavedPrompt struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Prompt      string `json:"prompt"`
+	System      string `json:"system,omitempty"`
+	// Model is used unless a model is given explicitly.
+	Model string `json:"model,omitempty"`
+	// ReasoningEffort is used unless an effort is given explicitly.
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+}
+
+// promptLibrary stores saved prompts as one JSON file each, so they can be shared and
+// versioned individually.
+type promptLibrary struct {
+	dir string
+}
+
+// defaultPromptLibrary returns the library in the user's configuration directory.
+func defaultPromptLibrary() (*promptLibrary, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	return &promptLibrary{dir: filepath.Join(dir, "prompts")}, nil
+}
+
+func (l *promptLibrary) path(name string) (string, error) {
+	if !promptNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid prompt name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(l.dir, name+".json"), nil
+}
+
+// Save stores p, replacing any prompt with the same name.
+func (l *promptLibrary) Save(p SavedPrompt) error {
+	path, err := l.path(p.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Get returns the prompt called name.
+func (l *promptLibrary) Get(name string) (*SavedPrompt, error) {
+	path, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p SavedPrompt
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("reading prompt %s: %w", name, err)
+	}
+	return &p, nil
+}
+
+// List returns all saved prompts sorted by name.
+func (l *promptLibrary) List() ([]*SavedPrompt, error) {
+	entries, err := os.ReadDir(l.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var prompts []*SavedPrompt
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		p, err := l.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, p)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts, nil
+}
+
+// Delete removes the prompt called name.
+func (l *promptLibrary) Delete(name string) error {
+	path, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrPromptNotFound, name)
+	}
+	return err
+}
+
+// readPromptText returns text, the contents of the file for @file, or stdin for "-".
+func readPromptText(text string) (string, error) {
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	if path, ok := strings.CutPrefix(text, "@"); ok {
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+	return text, nil
+}
+
+// runPrompt implements the `prompt` subcommand.
+func runPrompt(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, `Usage: %[1]s prompt save [flags] <name> <text | @file | ->
+       %[1]s prompt list
+       %[1]s prompt show <name>
+       %[1]s prompt delete <name>
+       %[1]s prompt export [-o file] [name...]
+       %[1]s prompt import [-force] <file>
+
+Run a saved prompt with %[1]s -use <name>.
+`, os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	library, err := defaultPromptLibrary()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fs := flag.NewFlagSet("prompt "+args[0], flag.ExitOnError)
+	switch args[0] {
+	case "save":
+		model := fs.String("model", "", "Default model for the prompt")
+		system := fs.String("system", "", "System prompt, or @file")
+		description := fs.String("description", "", "Short description shown by list")
+		reasoningEffort := fs.String("reasoning-effort", "", "Default reasoning effort: low, medium or high")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 2 {
+			usage()
+			return 2
+		}
+		if *reasoningEffort != "" && !validReasoningEffort(*reasoningEffort) {
+			fmt.Fprintf(os.Stderr, "unknown reasoning effort: %s\n", *reasoningEffort)
+			return 2
+		}
+		text, err := readPromptText(fs.Arg(1))
+		if err == nil && *system != "" {
+			*system, err = readPromptText(*system)
+		}
+		if err == nil {
+			err = library.Save(SavedPrompt{
+				Name:            fs.Arg(0),
+				Description:     *description,
+				Prompt:          text,
+				System:          *system,
+				Model:           *model,
+				ReasoningEffort: *reasoningEffort,
+			})
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "list":
+		_ = fs.Parse(args[1:])
+		prompts, err := library.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, p := range prompts {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Name, p.Model, p.Description)
+		}
+		_ = tw.Flush()
+
+	case "show":
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+		p, err := library.Get(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(p)
+
+	case "delete":
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+		if err := library.Delete(fs.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "export":
+		output := fs.String("o", "", "File to write instead of stdout")
+		_ = fs.Parse(args[1:])
+		var prompts []*SavedPrompt
+		if fs.NArg() == 0 {
+			prompts, err = library.List()
+		}
+		for _, name := range fs.Args() {
+			var p *SavedPrompt
+			if p, err = library.Get(name); err != nil {
+				break
+			}
+			prompts = append(prompts, p)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		data, err := json.MarshalIndent(prompts, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		data = append(data, '\n')
+		if *output != "" {
+			err = os.WriteFile(*output, data, 0o644)
+		} else {
+			_, err = os.Stdout.Write(data)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "import":
+		force := fs.Bool("force", false, "Overwrite prompts that already exist")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+			return 2
+		}
+		data, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		var prompts []SavedPrompt
+		if err := json.Unmarshal(data, &prompts); err != nil {
+			fmt.Fprintf(os.Stderr, "reading %s: %v\n", fs.Arg(0), err)
+			return 1
+		}
+		for _, p := range prompts {
+			if _, err := library.Get(p.Name); err == nil && !*force {
+				fmt.Fprintf(os.Stderr, "skipping %s: it already exists (use -force to overwrite)\n", p.Name)
+				continue
+			}
+			if err := library.Save(p); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Fprintf(os.Stderr, "imported %s\n", p.Name)
+		}
+
+	default:
+		usage()
+		return 2
+	}
+	return 0
+}
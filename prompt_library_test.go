@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPromptLibrary(t *testing.T) {
+	library := &promptLibrary{dir: filepath.Join(t.TempDir(), "prompts")}
+	if prompts, err := library.List(); err != nil || len(prompts) != 0 {
+		t.Fatalf("List() of a new library = %v, %v, want no prompts", prompts, err)
+	}
+
+	review := SavedPrompt{Name: "review", Prompt: "Review this", System: "be strict", Model: "openai/gpt-4.1", ReasoningEffort: "high"}
+	summarize := SavedPrompt{Name: "summarize", Description: "short summary", Prompt: "Summarize this"}
+	for _, p := range []SavedPrompt{summarize, {Name: "review", Prompt: "replaced"}, review} {
+		if err := library.Save(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := library.Get("review")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, review) {
+		t.Errorf("Get() = %+v, want %+v", *got, review)
+	}
+	// Files other than prompts are ignored
+	if err := os.WriteFile(filepath.Join(library.dir, "README.md"), []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := library.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 2 || !reflect.DeepEqual(*prompts[0], review) || !reflect.DeepEqual(*prompts[1], summarize) {
+		t.Errorf("List() = %+v, want review and summarize", prompts)
+	}
+
+	if err := library.Delete("review"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := library.Get("review"); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("Get() after Delete() err = %v, want ErrPromptNotFound", err)
+	}
+	if err := library.Delete("review"); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("Delete() of a missing prompt err = %v, want ErrPromptNotFound", err)
+	}
+}
+
+func TestPromptLibraryNames(t *testing.T) {
+	library := &promptLibrary{dir: t.TempDir()}
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"review", true},
+		{"code-review_v2.1", true},
+		{"", false},
+		{".hidden", false},
+		{"-flag", false},
+		{"../escape", false},
+		{"nested/name", false},
+		{"with space", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := library.Save(SavedPrompt{Name: tt.name, Prompt: "hi"})
+			if (err == nil) != tt.valid {
+				t.Errorf("Save(%q) err = %v, want valid %v", tt.name, err, tt.valid)
+			}
+			if _, err := library.Get(tt.name); !tt.valid && (err == nil || errors.Is(err, ErrPromptNotFound)) {
+				t.Errorf("Get(%q) err = %v, want an invalid name error", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestReadPromptText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.txt")
+	if err := os.WriteFile(path, []byte("from a file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"plain text", "plain text", false},
+		{"email me@example.com", "email me@example.com", false},
+		{"@" + path, "from a file\n", false},
+		{"@" + path + ".missing", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := readPromptText(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readPromptText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLISavedPrompt(t *testing.T) {
+	env := []string{"XDG_CONFIG_HOME=" + t.TempDir()}
+	if _, stderr := runCLIWithEnv(t, env, "prompt", "save", "-model", "openai/gpt-4.1", "greet", "hello"); stderr != "" {
+		t.Fatalf("prompt save: %s", stderr)
+	}
+	if stdout, _ := runCLIWithEnv(t, env, "prompt", "list"); stdout != "greet  openai/gpt-4.1  \n" {
+		t.Errorf("prompt list = %q", stdout)
+	}
+	if stdout, _ := runCLIWithEnv(t, env, "-use", "greet"); stdout != "hello" {
+		t.Errorf("-use greet = %q, want the saved prompt echoed", stdout)
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxProxyRequestBytes bounds the size of a request body accepted by the proxy.
+const maxProxyRequestBytes = 32 << 20
+
+// forwardedHeaders are the upstream response headers passed on to proxy clients.
+var forwardedHeaders = []string{"Content-Type", "Retry-After", "Retry-After-Ms", "X-Request-Id"}
+
+// proxyServer exposes an OpenAI-compatible API that forwards requests to GitHub
+// Models with the locally configured token.
+type proxyServer struct {
+	client *AzureClient
+	mux    *http.ServeMux
+	// maxTokens caps the output tokens of each request.
+	maxTokens modelLimits
+	// requestsPerMinute and requestsPerDay limit the requests for each model, on top
+	// of the limits of each client.
+	requestsPerMinute modelLimits
+	requestsPerDay    modelLimits
+	limiter           *rateLimiter
+	// embeddingsBatch is the largest number of inputs sent upstream in one call.
+	embeddingsBatch int
+	// queue, if set, limits the inference requests forwarded at once.
+	queue *requestQueue
+	// latency slows responses down for testing clients.
+	latency injectedLatency
+	// auth, if set, authenticates every request.
+	auth Authenticator
+	// audit, if set, records every authenticated request.
+	audit *auditLog
+	// rawResponses forwards chat completions as GitHub Models sends them instead of
+	// translating them into the OpenAI schema.
+	rawResponses bool
+	// cache, if set, answers repeated chat completions without calling upstream.
+	cache    ResponseCache
+	cacheTTL time.Duration
+	// cacheShared lets clients share cache entries, which are otherwise kept per
+	// principal.
+	cacheShared bool
+	// moderate checks chat completions and embeddings with the moderation endpoint
+	// first: off, flag or block.
+	moderate string
+	// userFromKey sends a hash of the client's API key as the user of requests that
+	// name none.
+	userFromKey bool
+}
+
+func newProxyServer(client *AzureClient) *proxyServer {
+	p := &proxyServer{client: client, mux: http.NewServeMux(), embeddingsBatch: defaultEmbeddingsBatch, limiter: newRateLimiter()}
+	p.mux.HandleFunc("POST /v1/chat/completions", p.queued(p.moderated(p.handleChatCompletions)))
+	p.mux.HandleFunc("POST /v1/embeddings", p.queued(p.moderated(p.handleEmbeddings)))
+	p.mux.HandleFunc("POST /v1/responses", p.queued(p.handleResponses))
+	p.mux.HandleFunc("POST /v1/audio/transcriptions", p.queued(p.handleTranscriptions))
+	p.mux.HandleFunc("POST /v1/audio/speech", p.queued(p.handleSpeech))
+	p.mux.HandleFunc("GET /v1/models", p.handleModels)
+	p.mux.HandleFunc("GET /metrics", p.handleMetrics)
+	p.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeProxyError(w, http.StatusNotFound, "unknown_url", "unknown request URL: "+r.Method+" "+r.URL.Path)
+	})
+	return p
+}
+
+// queued returns next behind the request queue, when queueing is enabled.
+func (p *proxyServer) queued(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.queue == nil {
+			next(w, r)
+			return
+		}
+		p.queue.serve(w, r, next)
+	}
+}
+
+func (p *proxyServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if p.queue == nil {
+		writeProxyError(w, http.StatusNotFound, "not_found", "metrics are available when queueing is enabled with -max-concurrent")
+		return
+	}
+	p.queue.writeMetrics(w)
+}
+
+// ServeHTTP implements http.Handler.
+func (p *proxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, ok := p.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if p.audit != nil {
+		p.audit.serve(w, r, p.mux)
+		return
+	}
+	p.mux.ServeHTTP(w, r)
+}
+
+// tokenLimit returns the output token cap of a request for model, the lower of the
+// server's and the principal's.
+func (p *proxyServer) tokenLimit(r *http.Request, model string) int {
+	limit := p.maxTokens.limit(model)
+	if principal := principalFrom(r.Context()); principal != nil && principal.MaxTokens > 0 && (limit == 0 || principal.MaxTokens < limit) {
+		limit = principal.MaxTokens
+	}
+	return limit
+}
+
+func (p *proxyServer) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyRequestBytes))
+	if err != nil {
+		writeRequestBodyError(w, err)
+		return
+	}
+
+	// Only the model is interpreted, so that parameters pass through untouched
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid_json", "request body is not a JSON object: "+err.Error())
+		return
+	}
+	var model string
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		writeProxyError(w, http.StatusBadRequest, "missing_required_parameter", "model is required")
+		return
+	}
+	changed := false
+	if resolved := resolveModel(model); resolved != model {
+		fields["model"], _ = json.Marshal(resolved)
+		model, changed = resolved, true
+	}
+	if !checkModel(w, r, model) {
+		return
+	}
+	if limit := p.tokenLimit(r, model); limit > 0 {
+		clamped, err := clampMaxTokens(fields, model, limit)
+		if err != nil {
+			writeProxyError(w, http.StatusBadRequest, "invalid_value", err.Error())
+			return
+		}
+		changed = changed || clamped
+	}
+	if _, ok := fields["user"]; !ok && p.userFromKey {
+		if user := keyUser(r); user != "" {
+			fields["user"], _ = json.Marshal(user)
+			changed = true
+		}
+	}
+	if changed {
+		if body, err = json.Marshal(fields); err != nil {
+			writeProxyError(w, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+	}
+
+	// Cached answers count against the rate limits too, as they would otherwise be
+	// free for clients to repeat
+	if !p.allowRequest(w, r, model) {
+		return
+	}
+	var cacheKey string
+	lookup, store := cacheDirectives(r)
+	if p.cache != nil {
+		cacheKey = responseCacheKey(p.cacheScope(r), body)
+		if lookup && p.serveCached(w, r, cacheKey) {
+			return
+		}
+	}
+
+	if !sleep(r.Context(), p.latency.response) {
+		return // the client went away
+	}
+	resp, err := p.client.forward(r.Context(), p.client.cfg.InferenceURL, body)
+	if err != nil {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return // the client went away
+		}
+		writeForwardError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		writeUpstreamError(w, resp.StatusCode, resp.Header, readUpstreamError(resp))
+		return
+	}
+	copyResponseHeaders(w.Header(), resp.Header)
+	var recorder *cacheRecorder
+	if p.cache != nil && store && resp.StatusCode == http.StatusOK {
+		w.Header().Set("X-Cache", "MISS")
+		recorder = &cacheRecorder{ResponseWriter: w}
+		w = recorder
+	}
+	w.WriteHeader(resp.StatusCode)
+	if !p.latency.delayBody(r.Context(), w) {
+		return
+	}
+	if p.rawResponses {
+		err = copyFlushing(w, resp.Body)
+	} else {
+		err = newOpenAITranslator(model).writeOpenAIResponse(w, resp)
+	}
+	if err != nil {
+		if r.Context().Err() == nil {
+			log.Printf("proxy: streaming %s: %v", model, err)
+		}
+		return
+	}
+	if recorder != nil && !recorder.truncated {
+		p.storeCached(r.Context(), cacheKey, resp.Header.Get("Content-Type"), recorder.body.Bytes())
+	}
+}
+
+func (p *proxyServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	models, err := p.client.cachedCatalog(r.Context())
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, "upstream_unavailable", err.Error())
+		return
+	}
+
+	type openAIModel struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	list := struct {
+		Object string        `json:"object"`
+		Data   []openAIModel `json:"data"`
+	}{Object: "list", Data: []openAIModel{}}
+	principal := principalFrom(r.Context())
+	for _, m := range models {
+		if principal != nil && !principal.allowsModel(m.ID) {
+			continue
+		}
+		list.Data = append(list.Data, openAIModel{ID: m.ID, Object: "model", OwnedBy: m.Publisher})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// forward posts body to url as is, without waiting out rate limits, so that callers
+// see the upstream response.
+func (c *AzureClient) forward(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(httpReq)
+	return c.client.Do(httpReq)
+}
+
+// copyResponseHeaders copies the headers clients rely on, including rate limits.
+func copyResponseHeaders(dst, src http.Header) {
+	for _, name := range forwardedHeaders {
+		if v := src.Values(name); len(v) > 0 {
+			dst[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	for name, v := range src {
+		if strings.HasPrefix(strings.ToLower(name), "x-ratelimit-") {
+			dst[name] = v
+		}
+	}
+}
+
+// copyFlushing copies src to w, flushing after every read so that streamed events
+// reach the client as they arrive.
+func copyFlushing(w http.ResponseWriter, src io.Reader) error {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if ferr := rc.Flush(); ferr != nil && !errors.Is(ferr, http.ErrNotSupported) {
+				return ferr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// runServe implements the `serve` subcommand.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on; anyone who can reach it uses your GitHub token")
+	accessLogPath := fs.String("access-log", "-", "File to append the access log to, - for stdout, or empty to disable it")
+	accessLogFormat := fs.String("access-log-format", accessLogCommon, "Access log format: common or combined")
+	maxTokens := fs.Int("max-tokens", 0, "Cap on the output tokens of each request, clamping larger client values; 0 for no cap")
+	modelMaxTokens := fs.String("model-max-tokens", "", "Comma-separated model=tokens caps overriding -max-tokens per model")
+	rpm := fs.Int("rpm", 0, "Requests per minute allowed for each model, answering others with 429 locally; 0 for no limit")
+	modelRPM := fs.String("model-rpm", "", "Comma-separated model=requests limits overriding -rpm per model")
+	rpd := fs.Int("rpd", 0, "Requests per day allowed for each model; 0 for no limit")
+	modelRPD := fs.String("model-rpd", "", "Comma-separated model=requests limits overriding -rpd per model")
+	embeddingsBatch := fs.Int("embeddings-batch", defaultEmbeddingsBatch, "Largest number of embeddings inputs per upstream call; larger requests are split")
+	maxConcurrent := fs.Int("max-concurrent", 0, "Requests forwarded at once, queueing the rest and serving queue metrics at /metrics; 0 for no limit")
+	maxQueue := fs.Int("max-queue", 100, "Requests that may wait with -max-concurrent before new ones are rejected")
+	queueTimeout := fs.Duration("queue-timeout", time.Minute, "Longest a request waits in the queue before it is rejected; 0 for no limit")
+	apiKeys := fs.String("api-keys", "", "JSON file of API keys clients must send as bearer tokens, with per-key token caps, rate limits and models; no authentication if empty")
+	jwtIssuer := fs.String("jwt-issuer", "", "Authenticate clients with JWTs from this OIDC issuer instead of API keys")
+	jwtAudience := fs.String("jwt-audience", "", "Audience JWTs must be intended for; required with -jwt-issuer")
+	jwtJWKS := fs.String("jwt-jwks-url", "", "URL of the issuer's signing keys; discovered from the issuer if empty")
+	jwtTenantClaim := fs.String("jwt-tenant-claim", "sub", "JWT claim naming the tenant, as shown in the access log")
+	jwtMaxTokensClaim := fs.String("jwt-max-tokens-claim", "", "JWT claim holding the tenant's output token cap")
+	jwtModelsClaim := fs.String("jwt-models-claim", "", "JWT claim listing the models the tenant may use")
+	auditLogPath := fs.String("audit-log", "", "File to append a hash-chained JSONL record of every request to; check it with `audit verify`")
+	auditKeyFile := fs.String("audit-key-file", "", "File holding a key to sign audit log records with (HMAC-SHA256)")
+	cacheSpec := fs.String("cache", "", "Cache chat completions, answering identical requests without calling upstream: memory, disk:<directory> or redis://host:port[/db]; clients skip it with Cache-Control: no-cache")
+	cacheShared := fs.Bool("cache-shared", false, "Share cached responses between clients instead of keeping an entry per API key or JWT tenant")
+	cacheTTL := fs.Duration("cache-ttl", time.Hour, "How long cached responses are served")
+	cacheSize := fs.Int("cache-size", 1000, "Responses kept by the memory cache, evicting the least recently used")
+	tokensFile := fs.String("tokens-file", "", "File of upstream GitHub tokens, one per line, to take turns with and rotate among when one is rate limited; GHMODELS_TOKENS adds comma-separated tokens")
+	moderate := fs.String("moderate", moderationOff, "Moderate chat completions and embeddings first: off, flag (forward with an "+moderationHeader+" header) or block (answer with a 400)")
+	userFromKey := fs.Bool("user-from-key", false, "Send a hash of each client's API key as the user of requests that name none, for providers' abuse attribution")
+	rawResponses := fs.Bool("raw-responses", false, "Forward chat completions as GitHub Models sends them, with its content filter results, instead of in the strict OpenAI schema")
+	injectLatency := fs.Duration("inject-latency", 0, "For testing clients: delay every inference response by this long before forwarding it")
+	injectFirstToken := fs.Duration("inject-first-token-latency", 0, "For testing clients: delay the body of chat completions by this long after the headers")
+	_ = fs.Parse(args)
+	if *embeddingsBatch < 1 {
+		fmt.Fprintln(os.Stderr, "-embeddings-batch must be at least 1")
+		return 2
+	}
+	if *maxConcurrent < 0 || *maxQueue < 0 || *queueTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "-max-concurrent, -max-queue and -queue-timeout must not be negative")
+		return 2
+	}
+	if *jwtIssuer != "" && *jwtAudience == "" {
+		fmt.Fprintln(os.Stderr, "-jwt-issuer requires -jwt-audience")
+		return 2
+	}
+	if *moderate != moderationOff && *moderate != moderationFlag && *moderate != moderationBlock {
+		fmt.Fprintf(os.Stderr, "unknown moderation mode: %s\n", *moderate)
+		return 2
+	}
+	if *injectLatency < 0 || *injectFirstToken < 0 {
+		fmt.Fprintln(os.Stderr, "-inject-latency and -inject-first-token-latency must not be negative")
+		return 2
+	}
+	caps, err := parseTokenCaps(*maxTokens, *modelMaxTokens)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	perMinute, err := parseModelLimits(*rpm, *modelRPM, "requests per minute", "requests")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	perDay, err := parseModelLimits(*rpd, *modelRPD, "requests per day", "requests")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// Waits for rate limits are not shown, as they would interleave across requests
+	client := newCLIClient().WithRateLimitWait(nil)
+	tokens, err := loadUpstreamTokens(*tokensFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(tokens) > 0 {
+		client.client = newTokenPool(nil, tokens).wrap(client.client)
+		fmt.Fprintf(os.Stderr, "Rotating requests across %d upstream tokens\n", len(tokens))
+	} else if client.token == "" && defaultProvider() != providerEcho {
+		fmt.Fprintln(os.Stderr, "no GitHub token found; run `gh auth login`, set GITHUB_TOKEN or use -tokens-file")
+		return 1
+	}
+
+	proxy := newProxyServer(client)
+	if *jwtIssuer != "" {
+		if *apiKeys != "" {
+			fmt.Fprintln(os.Stderr, "-api-keys and -jwt-issuer cannot be combined")
+			return 2
+		}
+		auth := newJWTAuthenticator(&http.Client{Timeout: 10 * time.Second}, *jwtIssuer, *jwtAudience, *jwtJWKS)
+		auth.tenantClaim, auth.maxTokensClaim, auth.modelsClaim = *jwtTenantClaim, *jwtMaxTokensClaim, *jwtModelsClaim
+		proxy.auth = auth
+	}
+	if *apiKeys != "" {
+		keys, err := loadStaticKeys(*apiKeys)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		proxy.auth = keys
+	}
+	proxy.maxTokens = caps
+	proxy.requestsPerMinute, proxy.requestsPerDay = perMinute, perDay
+	proxy.embeddingsBatch = *embeddingsBatch
+	proxy.rawResponses = *rawResponses
+	proxy.moderate = *moderate
+	proxy.userFromKey = *userFromKey
+	if *cacheSpec != "" {
+		if *cacheTTL <= 0 || *cacheSize < 1 {
+			fmt.Fprintln(os.Stderr, "-cache-ttl and -cache-size must be positive")
+			return 2
+		}
+		if proxy.cache, err = newResponseCache(*cacheSpec, *cacheSize); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		proxy.cacheTTL, proxy.cacheShared = *cacheTTL, *cacheShared
+	}
+	proxy.latency = injectedLatency{response: *injectLatency, firstToken: *injectFirstToken}
+	if *injectLatency > 0 || *injectFirstToken > 0 {
+		fmt.Fprintf(os.Stderr, "Injecting latency: %s before responses, %s before the first token\n", *injectLatency, *injectFirstToken)
+	}
+	if *maxConcurrent > 0 {
+		proxy.queue = newRequestQueue(*maxConcurrent, *maxQueue, *queueTimeout)
+	}
+	if *auditLogPath != "" {
+		var key []byte
+		if *auditKeyFile != "" {
+			if key, err = readAuditKey(*auditKeyFile); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		audit, closer, err := openAuditLog(*auditLogPath, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer closer.Close()
+		proxy.audit = audit
+	} else if *auditKeyFile != "" {
+		fmt.Fprintln(os.Stderr, "-audit-key-file requires -audit-log")
+		return 2
+	}
+	var handler http.Handler = proxy
+	if *accessLogPath != "" {
+		var out io.Writer = os.Stdout
+		if *accessLogPath != "-" {
+			f, err := os.OpenFile(*accessLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			out = f
+		}
+		logger, err := newAccessLogger(handler, out, *accessLogFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		handler = logger
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintf(os.Stderr, "Serving the OpenAI-compatible API at http://%s/v1\n", *addr)
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
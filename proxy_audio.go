@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+)
+
+// errUploadRejected aborts an upload the proxy refused part way through.
+var errUploadRejected = errors.New("upload rejected by the proxy")
+
+// handleTranscriptions streams a multipart audio upload through to upstream. The
+// form is rewritten part by part so the model can be resolved and checked without
+// buffering the audio; a model sent after the file is checked when it arrives, and
+// a rejected upload is abandoned before upstream answers.
+func (p *proxyServer) handleTranscriptions(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxProxyRequestBytes)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid_request_body", "request body is not a multipart form: "+err.Error())
+		return
+	}
+	if !sleep(r.Context(), p.latency.response) {
+		return // the client went away
+	}
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	httpReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.client.cfg.TranscriptionsURL, pr)
+	if err != nil {
+		writeProxyError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	p.client.setHeaders(httpReq)
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := p.client.client.Do(httpReq)
+		// Unblock the copy below if upstream answered before reading the whole upload
+		pr.Close()
+		done <- result{resp, err}
+	}()
+	// abandon stops the upload and discards whatever upstream made of it.
+	abandon := func() {
+		pw.CloseWithError(errUploadRejected)
+		if res := <-done; res.resp != nil {
+			res.resp.Body.Close()
+		}
+	}
+
+	model := ""
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			abandon()
+			writeRequestBodyError(w, err)
+			return
+		}
+		if part.FormName() == "model" && part.FileName() == "" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				abandon()
+				writeRequestBodyError(w, err)
+				return
+			}
+			model = resolveModel(string(value))
+			if model == "" {
+				abandon()
+				writeProxyError(w, http.StatusBadRequest, "missing_required_parameter", "model is required")
+				return
+			}
+			if !checkModel(w, r, model) || !p.allowRequest(w, r, model) {
+				abandon()
+				return
+			}
+			if err := form.WriteField("model", model); err != nil {
+				break // upstream stopped reading; its answer is reported below
+			}
+			continue
+		}
+		dst, err := form.CreatePart(part.Header)
+		if err == nil {
+			_, err = io.Copy(dst, part)
+		}
+		if err != nil {
+			if errors.Is(err, io.ErrClosedPipe) {
+				break // upstream stopped reading; its answer is reported below
+			}
+			abandon()
+			writeRequestBodyError(w, err)
+			return
+		}
+	}
+	if model == "" {
+		abandon()
+		writeProxyError(w, http.StatusBadRequest, "missing_required_parameter", "model is required")
+		return
+	}
+	pw.CloseWithError(form.Close())
+
+	res := <-done
+	if res.err != nil {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return // the client went away
+		}
+		writeForwardError(w, res.err)
+		return
+	}
+	defer res.resp.Body.Close()
+	if res.resp.StatusCode >= http.StatusBadRequest {
+		writeUpstreamError(w, res.resp.StatusCode, res.resp.Header, readUpstreamError(res.resp))
+		return
+	}
+	copyResponseHeaders(w.Header(), res.resp.Header)
+	w.WriteHeader(res.resp.StatusCode)
+	_, _ = io.Copy(w, res.resp.Body)
+}
+
+// handleSpeech forwards a speech request and streams the audio back as upstream
+// generates it.
+func (p *proxyServer) handleSpeech(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyRequestBytes))
+	if err != nil {
+		writeRequestBodyError(w, err)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid_json", "request body is not a JSON object: "+err.Error())
+		return
+	}
+	var model string
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		writeProxyError(w, http.StatusBadRequest, "missing_required_parameter", "model is required")
+		return
+	}
+	model = resolveModel(model)
+	if !checkModel(w, r, model) || !p.allowRequest(w, r, model) {
+		return
+	}
+	fields["model"], _ = json.Marshal(model)
+	if body, err = json.Marshal(fields); err != nil {
+		writeProxyError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	if !sleep(r.Context(), p.latency.response) {
+		return // the client went away
+	}
+	resp, err := p.client.forward(r.Context(), p.client.cfg.SpeechURL, body)
+	if err != nil {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return // the client went away
+		}
+		writeForwardError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		writeUpstreamError(w, resp.StatusCode, resp.Header, readUpstreamError(resp))
+		return
+	}
+	copyResponseHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	if err := copyFlushing(w, resp.Body); err != nil && r.Context().Err() == nil {
+		log.Printf("proxy: streaming speech from %s: %v", model, err)
+	}
+}
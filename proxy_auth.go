@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Principal is an authenticated proxy client and the limits that apply to it.
+type Principal struct {
+	// Name identifies the client in the access log.
+	Name string `json:"name"`
+	// MaxTokens caps the output tokens of the client's requests, lowering the
+	// server-wide caps. Zero leaves them unchanged.
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// Models, if not empty, lists the only models the client may use.
+	Models []string `json:"models,omitempty"`
+	// RequestsPerMinute and RequestsPerDay limit the client's requests across all
+	// models. Zero means no limit.
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	RequestsPerDay    int `json:"requests_per_day,omitempty"`
+}
+
+// allowsModel reports whether the principal may use model.
+func (p *Principal) allowsModel(model string) bool {
+	return len(p.Models) == 0 || containsFold(p.Models, model)
+}
+
+// Authenticator validates the credentials of proxy requests. Implementations other
+// than the static keys, such as token validators, can be set on the proxy server.
+type Authenticator interface {
+	// Authenticate returns the principal making r, or an error wrapping
+	// ErrUnauthenticated if its credentials are missing or invalid.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// ErrUnauthenticated is returned by authenticators for requests without valid
+// credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// ErrAuthUnavailable is returned by authenticators that cannot check credentials for
+// now, as when the identity provider cannot be reached.
+var ErrAuthUnavailable = errors.New("authentication unavailable")
+
+// bearerToken returns the token of an "Authorization: Bearer" header, as OpenAI
+// clients send API keys.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// keyUser returns the user identifier for a request's API key: a hash of it, so
+// abuse reports can be attributed to a client without revealing its key. It is empty
+// for requests without one.
+func keyUser(r *http.Request) string {
+	token, ok := bearerToken(r)
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// staticKey is an entry of the API keys file.
+type staticKey struct {
+	Key string `json:"key"`
+	Principal
+}
+
+// staticKeys authenticates requests with API keys from a file. Keys are held as
+// hashes, so that looking them up takes the same time whatever the key.
+type staticKeys map[[sha256.Size]byte]*Principal
+
+// loadStaticKeys reads a JSON array of keys such as
+// [{"key": "...", "name": "ci", "max_tokens": 1024, "models": ["openai/gpt-4.1"],
+// "requests_per_minute": 10}].
+func loadStaticKeys(path string) (staticKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []staticKey
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("reading API keys %s: %w", path, err)
+	}
+
+	keys := staticKeys{}
+	for i, entry := range entries {
+		if entry.Key == "" || entry.Name == "" {
+			return nil, fmt.Errorf("reading API keys %s: entry %d needs a key and a name", path, i+1)
+		}
+		hash := sha256.Sum256([]byte(entry.Key))
+		if _, ok := keys[hash]; ok {
+			return nil, fmt.Errorf("reading API keys %s: the key of %s is used twice", path, entry.Name)
+		}
+		principal := entry.Principal
+		for j, model := range principal.Models {
+			principal.Models[j] = resolveModel(model)
+		}
+		keys[hash] = &principal
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("reading API keys %s: no keys", path)
+	}
+	return keys, nil
+}
+
+// Authenticate implements Authenticator.
+func (k staticKeys) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing API key; send it as Authorization: Bearer <key>", ErrUnauthenticated)
+	}
+	principal, ok := k[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid API key", ErrUnauthenticated)
+	}
+	return principal, nil
+}
+
+type principalKey struct{}
+
+// principalFrom returns the principal of an authenticated request, or nil when the
+// proxy does not authenticate requests.
+func principalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// authenticate runs the authenticator, if any, and adds the principal to the
+// request context.
+func (p *proxyServer) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if p.auth == nil {
+		return r, true
+	}
+	principal, err := p.auth.Authenticate(r)
+	if err != nil {
+		if errors.Is(err, ErrUnauthenticated) {
+			writeProxyError(w, http.StatusUnauthorized, "invalid_api_key", err.Error())
+		} else if errors.Is(err, ErrAuthUnavailable) {
+			writeProxyError(w, http.StatusServiceUnavailable, "authentication_unavailable", err.Error())
+		} else {
+			writeProxyError(w, http.StatusInternalServerError, "authentication_failed", err.Error())
+		}
+		return r, false
+	}
+	setAccessLogUser(r.Context(), principal.Name)
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)), true
+}
+
+// checkModel rejects models the principal of r may not use.
+func checkModel(w http.ResponseWriter, r *http.Request, model string) bool {
+	if principal := principalFrom(r.Context()); principal != nil && !principal.allowsModel(model) {
+		writeProxyError(w, http.StatusForbidden, "model_not_allowed", fmt.Sprintf("%s may not use model %s", principal.Name, model))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedResponseBytes bounds the size of a response stored in the cache; larger
+// ones are served but not cached.
+const maxCachedResponseBytes = 8 << 20
+
+// ResponseCache stores proxied responses, so that identical requests are answered
+// without calling upstream. Backends other than the built-in memory, disk and Redis
+// ones can be set on the proxy server.
+type ResponseCache interface {
+	// Get returns the value stored under key, or false if there is none or it expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key until ttl has passed.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// newResponseCache returns the cache described by spec: memory, disk:<directory> or
+// a redis:// URL. size bounds the entries of the memory cache.
+func newResponseCache(spec string, size int) (ResponseCache, error) {
+	switch {
+	case spec == "memory":
+		return newMemoryCache(size), nil
+	case strings.HasPrefix(spec, "disk:"):
+		dir := strings.TrimPrefix(spec, "disk:")
+		if dir == "" {
+			return nil, errors.New("disk cache needs a directory, as in disk:/var/cache/ghmodels")
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		return &diskCache{dir: dir, now: time.Now}, nil
+	case strings.HasPrefix(spec, "redis://"):
+		return newRedisCache(spec)
+	}
+	return nil, fmt.Errorf("unknown cache %q: use memory, disk:<directory> or redis://host:port", spec)
+}
+
+// memoryCache is an in-memory ResponseCache evicting the least recently used entries
+// beyond its size.
+type memoryCache struct {
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryCache(size int) *memoryCache {
+	return &memoryCache{size: size, now: time.Now, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &memoryEntry{key: key, value: value, expires: c.now().Add(ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// diskCache is a ResponseCache keeping an entry per file in a directory, so that it
+// survives restarts and can be shared by proxies on the same machine.
+type diskCache struct {
+	dir string
+	now func() time.Time
+}
+
+type diskEntry struct {
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+// path returns the file of key, which is hashed since keys need not be file names.
+func (c *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *diskCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil || !c.now().Before(entry.Expires) {
+		_ = os.Remove(c.path(key))
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+func (c *diskCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(diskEntry{Expires: c.now().Add(ttl), Value: value})
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file first so that readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// redisCache is a ResponseCache backed by Redis, for proxies sharing a cache across
+// machines. It speaks just enough of the Redis protocol for GET and SET over a
+// single connection, which is reopened after errors.
+type redisCache struct {
+	addr     string
+	username string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedisCache parses a URL of the form redis://[user:password@]host[:port][/db].
+func newRedisCache(rawURL string) (*redisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisCache{addr: u.Host}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	return reply, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// do sends a command and returns its reply, which is nil for a nil reply.
+func (c *redisCache) do(ctx context.Context, args ...string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	} else {
+		_ = c.conn.SetDeadline(time.Time{})
+	}
+	reply, err := c.command(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (c *redisCache) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := c.command(args...); err != nil {
+			conn.Close()
+			c.conn = nil
+			return fmt.Errorf("redis: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.command("SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			c.conn = nil
+			return fmt.Errorf("redis: %w", err)
+		}
+	}
+	return nil
+}
+
+// command writes args as a RESP array of bulk strings and reads the reply.
+func (c *redisCache) command(args ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// redisError is an error reply of the server, after which the connection is still
+// usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// cachedResponse is a proxied response as stored in the cache.
+type cachedResponse struct {
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// responseCacheKey returns the cache key of a request body within scope, which
+// covers the model, messages and all parameters. The body is canonicalized first so
+// that requests differing only in formatting or field order share an entry.
+func responseCacheKey(scope string, body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			body = canonical
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(scope))
+	h.Write([]byte{0})
+	h.Write(body)
+	return "ghmodels:chat:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheScope returns the scope of r's cache entries: its principal, so that clients
+// never see each other's responses, unless the cache is shared.
+func (p *proxyServer) cacheScope(r *http.Request) string {
+	if principal := principalFrom(r.Context()); principal != nil && !p.cacheShared {
+		return "client:" + principal.Name
+	}
+	return ""
+}
+
+// cacheDirectives reports whether r may be answered from the cache and whether its
+// response may be stored, following its Cache-Control header: no-cache skips the
+// lookup, and no-store also skips storing the response.
+func cacheDirectives(r *http.Request) (lookup, store bool) {
+	lookup, store = true, true
+	for _, value := range r.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-cache":
+				lookup = false
+			case "no-store":
+				lookup, store = false, false
+			}
+		}
+	}
+	return lookup, store
+}
+
+// serveCached writes the cached response under key to w, returning false if there
+// is none. Cache failures are logged and treated as misses.
+func (p *proxyServer) serveCached(w http.ResponseWriter, r *http.Request, key string) bool {
+	data, ok, err := p.cache.Get(r.Context(), key)
+	if err != nil {
+		log.Printf("proxy: cache: %v", err)
+		return false
+	}
+	var cached cachedResponse
+	if !ok || json.Unmarshal(data, &cached) != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", cached.ContentType)
+	w.Header().Set("X-Cache", "HIT")
+	_, _ = w.Write(cached.Body)
+	return true
+}
+
+// storeCached stores a response under key for the cache TTL.
+func (p *proxyServer) storeCached(ctx context.Context, key, contentType string, body []byte) {
+	data, err := json.Marshal(cachedResponse{ContentType: contentType, Body: body})
+	if err == nil {
+		err = p.cache.Set(ctx, key, data, p.cacheTTL)
+	}
+	if err != nil {
+		log.Printf("proxy: cache: %v", err)
+	}
+}
+
+// cacheRecorder keeps a copy of the body written to a response, up to
+// maxCachedResponseBytes, for storing it in the cache.
+type cacheRecorder struct {
+	http.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *cacheRecorder) Write(p []byte) (int, error) {
+	if !r.truncated {
+		if r.body.Len()+len(p) > maxCachedResponseBytes {
+			r.truncated = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush streams.
+func (r *cacheRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestProxyCachesResponses(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{Chunks: []string{"first"}}, modelstest.Response{Chunks: []string{"second"}})
+	p := newProxyServer(newTestClient(upstream))
+	p.cache, p.cacheTTL = newMemoryCache(10), time.Minute
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	post := func(body string, header http.Header) (string, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/chat/completions", strings.NewReader(body))
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get("X-Cache"), string(data)
+	}
+
+	status, miss := post(`{"model":"openai/gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if status != "MISS" || !strings.Contains(miss, "first") {
+		t.Fatalf("first request: X-Cache %q, body %s", status, miss)
+	}
+	// The same request, formatted differently, is answered from the cache
+	status, hit := post(`{"messages": [{"content": "hi", "role": "user"}], "model": "openai/gpt-4o-mini"}`, nil)
+	if status != "HIT" || hit != miss {
+		t.Errorf("repeated request: X-Cache %q, body %s", status, hit)
+	}
+	status, fresh := post(`{"model":"openai/gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`, http.Header{"Cache-Control": {"no-cache"}})
+	if status != "MISS" || !strings.Contains(fresh, "second") {
+		t.Errorf("no-cache request: X-Cache %q, body %s", status, fresh)
+	}
+	if got := len(upstream.Requests()); got != 2 {
+		t.Errorf("sent %d upstream requests, want 2", got)
+	}
+}
+
+func TestMemoryCacheEvictsAndExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	cache := newMemoryCache(2)
+	cache.now = func() time.Time { return now }
+
+	_ = cache.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = cache.Set(ctx, "b", []byte("2"), time.Minute)
+	_, _, _ = cache.Get(ctx, "a")
+	_ = cache.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("the least recently used entry was not evicted")
+	}
+	if v, ok, _ := cache.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("a = %q, %v", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Error("an expired entry was served")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	cache, err := newResponseCache("disk:"+t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := cache.Get(ctx, "key"); err != nil || !ok || string(v) != "value" {
+		t.Errorf("Get = %q, %v, %v", v, ok, err)
+	}
+	if _, ok, err := cache.Get(ctx, "other"); err != nil || ok {
+		t.Errorf("Get of a missing key = %v, %v", ok, err)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go serveFakeRedis(ln)
+
+	ctx := context.Background()
+	cache, err := newResponseCache("redis://"+ln.Addr().String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := cache.Get(ctx, "key"); err != nil || ok {
+		t.Fatalf("Get before Set = %v, %v", ok, err)
+	}
+	if err := cache.Set(ctx, "key", []byte("line one\r\nline two"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := cache.Get(ctx, "key"); err != nil || !ok || string(v) != "line one\r\nline two" {
+		t.Errorf("Get = %q, %v, %v", v, ok, err)
+	}
+}
+
+// serveFakeRedis answers GET and SET commands from an in-memory map.
+func serveFakeRedis(ln net.Listener) {
+	data := map[string]string{}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := make([]string, n)
+			for i := range args {
+				line, _ := r.ReadString('\n')
+				size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+				buf := make([]byte, size+2)
+				_, _ = io.ReadFull(r, buf)
+				args[i] = string(buf[:size])
+			}
+			switch strings.ToUpper(args[0]) {
+			case "SET":
+				data[args[1]] = args[2]
+				io.WriteString(conn, "+OK\r\n")
+			case "GET":
+				if v, ok := data[args[1]]; ok {
+					io.WriteString(conn, "$"+strconv.Itoa(len(v))+"\r\n"+v+"\r\n")
+				} else {
+					io.WriteString(conn, "$-1\r\n")
+				}
+			default:
+				io.WriteString(conn, "-ERR unknown command\r\n")
+			}
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultEmbeddingsBatch is the number of inputs the proxy sends per upstream call.
+const defaultEmbeddingsBatch = 64
+
+// proxyEmbedding is an embedding as returned upstream. The vector is kept raw so that
+// both float and base64 encodings pass through.
+type proxyEmbedding struct {
+	Object    string          `json:"object,omitempty"`
+	Embedding json.RawMessage `json:"embedding"`
+	Index     int             `json:"index"`
+}
+
+type proxyEmbeddingsResponse struct {
+	Object string           `json:"object"`
+	Data   []proxyEmbedding `json:"data"`
+	Model  string           `json:"model"`
+	Usage  EmbeddingsUsage  `json:"usage"`
+}
+
+// upstreamError is an error response from upstream, passed on to the client.
+type upstreamError struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (e *upstreamError) Error() string {
+	return fmt.Sprintf("upstream returned %d: %s", e.status, e.body)
+}
+
+func (p *proxyServer) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyRequestBytes))
+	if err != nil {
+		writeRequestBodyError(w, err)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid_json", "request body is not a JSON object: "+err.Error())
+		return
+	}
+	var model string
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		writeProxyError(w, http.StatusBadRequest, "missing_required_parameter", "model is required")
+		return
+	}
+	model = resolveModel(model)
+	if !checkModel(w, r, model) || !p.allowRequest(w, r, model) {
+		return
+	}
+	fields["model"], _ = json.Marshal(model)
+
+	if !sleep(r.Context(), p.latency.response) {
+		return // the client went away
+	}
+
+	// Inputs other than a list of strings, such as token arrays, are sent in one call
+	var inputs []string
+	if err := json.Unmarshal(fields["input"], &inputs); err != nil || len(inputs) <= p.embeddingsBatch {
+		if body, err = json.Marshal(fields); err != nil {
+			writeProxyError(w, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+		resp, err := p.client.forward(r.Context(), p.client.cfg.EmbeddingsURL, body)
+		if err != nil {
+			writeForwardError(w, err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			writeUpstreamError(w, resp.StatusCode, resp.Header, readUpstreamError(resp))
+			return
+		}
+		copyResponseHeaders(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	merged, err := p.embedInBatches(r, fields, inputs)
+	if err != nil {
+		var upstream *upstreamError
+		if errors.As(err, &upstream) {
+			writeUpstreamError(w, upstream.status, upstream.header, upstream.body)
+			return
+		}
+		writeForwardError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(merged)
+}
+
+// embedInBatches embeds inputs with one upstream call per batch, one batch at a time,
+// and merges the results with indices into the original input.
+func (p *proxyServer) embedInBatches(r *http.Request, fields map[string]json.RawMessage, inputs []string) (*proxyEmbeddingsResponse, error) {
+	merged := &proxyEmbeddingsResponse{Object: "list", Data: make([]proxyEmbedding, 0, len(inputs))}
+	for offset := 0; offset < len(inputs); offset += p.embeddingsBatch {
+		batch := inputs[offset:min(offset+p.embeddingsBatch, len(inputs))]
+		fields["input"], _ = json.Marshal(batch)
+
+		// postJSON waits out rate limits within the request deadline
+		resp, err := p.client.postJSON(r.Context(), p.client.cfg.EmbeddingsURL, fields, true)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &upstreamError{status: resp.StatusCode, header: resp.Header, body: data}
+		}
+
+		var part proxyEmbeddingsResponse
+		if err := json.Unmarshal(data, &part); err != nil {
+			return nil, fmt.Errorf("decoding embeddings: %w", err)
+		}
+		for _, e := range part.Data {
+			e.Index += offset
+			merged.Data = append(merged.Data, e)
+		}
+		merged.Model = part.Model
+		merged.Usage.PromptTokens += part.Usage.PromptTokens
+		merged.Usage.TotalTokens += part.Usage.TotalTokens
+
+		// Spread the remaining batches out rather than running into the rate limit
+		if offset+p.embeddingsBatch < len(inputs) && resp.Header.Get("x-ratelimit-remaining-requests") == "0" {
+			if wait, ok := rateLimitReset(resp.Header, time.Now()); ok {
+				if err := p.client.waitForReset(r.Context(), wait); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return merged, nil
+}
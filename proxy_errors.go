@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// maxUpstreamErrorBytes bounds the upstream error bodies read for normalizing.
+const maxUpstreamErrorBytes = 1 << 20
+
+// proxyErrorType returns the OpenAI error type for an HTTP status.
+func proxyErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status == http.StatusGatewayTimeout:
+		return "timeout_error"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// writeProxyError writes an error in the shape OpenAI clients expect, with a type
+// derived from status. An empty code is sent as null.
+func writeProxyError(w http.ResponseWriter, status int, code, message string) {
+	var codeValue *string
+	if code != "" {
+		codeValue = &code
+	}
+	writeErrorBody(w, status, map[string]any{
+		"message": message,
+		"type":    proxyErrorType(status),
+		"param":   nil,
+		"code":    codeValue,
+	})
+}
+
+func writeErrorBody(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": body})
+}
+
+// writeRequestBodyError reports a request body that could not be read.
+func writeRequestBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProxyError(w, http.StatusRequestEntityTooLarge, "request_too_large", err.Error())
+		return
+	}
+	writeProxyError(w, http.StatusBadRequest, "invalid_request_body", err.Error())
+}
+
+// writeForwardError reports a request that could not be sent upstream, telling
+// timeouts apart so clients can retry them.
+func writeForwardError(w http.ResponseWriter, err error) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		writeProxyError(w, http.StatusGatewayTimeout, "upstream_timeout", err.Error())
+		return
+	}
+	writeProxyError(w, http.StatusBadGateway, "upstream_unavailable", err.Error())
+}
+
+// writeUpstreamError passes an upstream error response on in the OpenAI shape,
+// keeping its status, code and headers.
+func writeUpstreamError(w http.ResponseWriter, status int, header http.Header, body []byte) {
+	copyResponseHeaders(w.Header(), header)
+	writeErrorBody(w, status, normalizeUpstreamError(status, body))
+}
+
+// normalizeUpstreamError returns the error object of an upstream error body with the
+// message, type, param and code fields OpenAI clients read. Bodies that are not JSON
+// errors become the message.
+func normalizeUpstreamError(status int, body []byte) map[string]json.RawMessage {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(body, &envelope) != nil || json.Unmarshal(envelope.Error, &fields) != nil {
+		fields = map[string]json.RawMessage{}
+		message := strings.TrimSpace(string(body))
+		// A string error, as in {"error":"..."}, is the message itself
+		var text string
+		if json.Unmarshal(envelope.Error, &text) == nil {
+			message = text
+		}
+		if message == "" {
+			message = http.StatusText(status)
+		}
+		fields["message"], _ = json.Marshal(message)
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{} // the error was null
+	}
+	if _, ok := fields["message"]; !ok {
+		fields["message"], _ = json.Marshal(http.StatusText(status))
+	}
+	if _, ok := fields["type"]; !ok {
+		fields["type"], _ = json.Marshal(proxyErrorType(status))
+	}
+	for _, name := range []string{"param", "code"} {
+		if _, ok := fields[name]; !ok {
+			fields[name] = json.RawMessage("null")
+		}
+	}
+	return fields
+}
+
+// readUpstreamError reads the body of an upstream error response.
+func readUpstreamError(resp *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamErrorBytes))
+	return body
+}
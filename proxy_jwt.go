@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksCacheTTL is how long fetched signing keys are trusted before refetching.
+	jwksCacheTTL = time.Hour
+	// jwksMinRefresh bounds how often tokens signed with unknown keys trigger a
+	// refetch, so that they cannot flood the identity provider.
+	jwksMinRefresh = time.Minute
+	// jwtLeeway tolerates clock skew when checking exp and nbf.
+	jwtLeeway = time.Minute
+)
+
+// jwtAuthenticator authenticates requests with JWTs signed by an OIDC identity
+// provider, such as the ID or access tokens of an SSO login.
+type jwtAuthenticator struct {
+	issuer   string
+	audience string
+	// tenantClaim names the claim used as the principal's name.
+	tenantClaim string
+	// maxTokensClaim and modelsClaim, if set, name claims holding the principal's
+	// token cap and allowed models.
+	maxTokensClaim string
+	modelsClaim    string
+
+	keys *jwksCache
+	now  func() time.Time
+}
+
+// newJWTAuthenticator returns an authenticator for tokens from issuer intended for
+// audience. The audience is always checked, so that tokens the issuer grants for
+// other services are refused. The signing keys are fetched from jwksURL, or from the
+// issuer's OIDC discovery document if it is empty.
+func newJWTAuthenticator(client *http.Client, issuer, audience, jwksURL string) *jwtAuthenticator {
+	return &jwtAuthenticator{
+		issuer:      issuer,
+		audience:    audience,
+		tenantClaim: "sub",
+		keys:        &jwksCache{client: client, issuer: issuer, url: jwksURL},
+		now:         time.Now,
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Authenticate implements Authenticator.
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing token; send it as Authorization: Bearer <token>", ErrUnauthenticated)
+	}
+	claims, err := a.verify(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return a.principal(claims)
+}
+
+// verify checks the signature and registered claims of token and returns its claims.
+func (a *jwtAuthenticator) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthenticated)
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed token header: %v", ErrUnauthenticated, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token signature", ErrUnauthenticated)
+	}
+
+	key, err := a.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims: %v", ErrUnauthenticated, err)
+	}
+	if iss, _ := claims["iss"].(string); iss != a.issuer {
+		return nil, fmt.Errorf("%w: token issued by %q, not %q", ErrUnauthenticated, iss, a.issuer)
+	}
+	if !hasAudience(claims["aud"], a.audience) {
+		return nil, fmt.Errorf("%w: token is not intended for audience %q", ErrUnauthenticated, a.audience)
+	}
+	now := a.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: token has no expiry", ErrUnauthenticated)
+	}
+	if now.Add(-jwtLeeway).After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("%w: token expired", ErrUnauthenticated)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrUnauthenticated)
+	}
+	return claims, nil
+}
+
+// principal maps the claims of a verified token to a principal.
+func (a *jwtAuthenticator) principal(claims map[string]any) (*Principal, error) {
+	name, _ := claims[a.tenantClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: token has no %s claim", ErrUnauthenticated, a.tenantClaim)
+	}
+	principal := &Principal{Name: name}
+	if a.maxTokensClaim != "" {
+		if n, ok := claims[a.maxTokensClaim].(float64); ok && n > 0 {
+			principal.MaxTokens = int(n)
+		}
+	}
+	if a.modelsClaim != "" {
+		switch models := claims[a.modelsClaim].(type) {
+		case string:
+			principal.Models = splitList(models)
+		case []any:
+			for _, m := range models {
+				if s, ok := m.(string); ok {
+					principal.Models = append(principal.Models, s)
+				}
+			}
+		}
+		// A claim that names no models must not grant them all
+		if len(principal.Models) == 0 {
+			return nil, fmt.Errorf("%w: token has no %s claim", ErrUnauthenticated, a.modelsClaim)
+		}
+		for i, m := range principal.Models {
+			principal.Models[i] = resolveModel(m)
+		}
+	}
+	return principal, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience reports whether the aud claim, a string or a list of them, holds want.
+func hasAudience(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyJWTSignature verifies signature over signed with key. Only asymmetric
+// algorithms are accepted, so that a public key can never be used as an HMAC secret.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s does not match an EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return errors.New("unsupported signing key")
+	}
+	return nil
+}
+
+// jwksCache fetches and caches the signing keys of an identity provider. Keys are
+// fetched in the background, so that a slow provider only holds up requests whose
+// keys are not cached yet.
+type jwksCache struct {
+	client *http.Client
+	issuer string
+
+	mu sync.Mutex
+	// url is the JWKS URL, discovered from the issuer when empty.
+	url     string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// attempted is when the last fetch started, and fetchErr how it failed.
+	attempted time.Time
+	fetchErr  error
+	// refreshing is closed when the fetch in progress, if any, completes.
+	refreshing chan struct{}
+}
+
+// key returns the signing key with the given id, refetching the key set when it is
+// stale or does not hold the key, as after the provider rotated its keys. Refetches
+// start at most every jwksMinRefresh, and stale keys are used while they run.
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.lookupLocked(kid)
+	if ok && time.Since(c.fetched) < jwksCacheTTL {
+		c.mu.Unlock()
+		return key, nil
+	}
+	done := c.refreshing
+	if done == nil && time.Since(c.attempted) >= jwksMinRefresh {
+		done = c.refreshLocked(ctx)
+	}
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.lookupLocked(kid); ok {
+		return key, nil
+	}
+	if c.fetchErr != nil {
+		return nil, fmt.Errorf("%w: fetching the signing keys: %v", ErrAuthUnavailable, c.fetchErr)
+	}
+	return nil, fmt.Errorf("%w: token signed with unknown key %q", ErrUnauthenticated, kid)
+}
+
+// lookupLocked returns the key with the given id. Tokens without a key id match the
+// only key of a set holding one.
+func (c *jwksCache) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// refreshLocked starts fetching the key set and returns a channel closed when the
+// fetch completes. The fetch outlives the request that started it, as others may be
+// waiting for it.
+func (c *jwksCache) refreshLocked(ctx context.Context) chan struct{} {
+	done := make(chan struct{})
+	c.refreshing, c.attempted = done, time.Now()
+	url := c.url
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer close(done)
+		keys, url, err := c.fetch(ctx, url)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err == nil {
+			c.keys, c.url, c.fetched = keys, url, time.Now()
+		}
+		c.fetchErr, c.refreshing = err, nil
+	}()
+	return done
+}
+
+// fetch returns the signing keys published at url, discovering it from the issuer
+// when empty, and the url.
+func (c *jwksCache) fetch(ctx context.Context, url string) (map[string]crypto.PublicKey, string, error) {
+	if url == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := c.getJSON(ctx, strings.TrimSuffix(c.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, "", err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, "", fmt.Errorf("the OIDC configuration of %s has no jwks_uri", c.issuer)
+		}
+		url = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := c.getJSON(ctx, url, &set); err != nil {
+		return nil, "", err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped, as providers may publish several
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, url, nil
+}
+
+func (c *jwksCache) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching signing keys: %s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("fetching signing keys: %s: %w", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public key in a JWKS.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key %s", k.Kid)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid key %s", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid key %s", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// injectedLatency holds artificial delays for testing how clients handle slow
+// responses. Zero durations add no delay.
+type injectedLatency struct {
+	// response delays the whole upstream response, before any headers are sent.
+	response time.Duration
+	// firstToken delays the body after the headers were sent, as a model slow to
+	// produce its first token would.
+	firstToken time.Duration
+}
+
+// sleep waits for d, returning false if ctx ends first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// delayBody flushes the headers written to w, so that clients see the response
+// start, then waits for the first token latency.
+func (l injectedLatency) delayBody(ctx context.Context, w http.ResponseWriter) bool {
+	if l.firstToken <= 0 {
+		return true
+	}
+	_ = http.NewResponseController(w).Flush()
+	return sleep(ctx, l.firstToken)
+}
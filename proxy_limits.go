@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// modelLimits holds a limit of proxied requests, such as a cap on their output
+// tokens, per model or by default.
+type modelLimits struct {
+	def    int
+	models map[string]int
+}
+
+// parseModelLimits parses limits given as comma-separated model=value pairs, with def
+// applying to other models. Zero means no limit. what names the limit in errors and
+// unit its values.
+func parseModelLimits(def int, perModel, what, unit string) (modelLimits, error) {
+	limits := modelLimits{def: def, models: map[string]int{}}
+	if def < 0 {
+		return limits, fmt.Errorf("invalid %s %d", what, def)
+	}
+	for _, pair := range splitList(perModel) {
+		model, value, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(value)
+		if !ok || model == "" || err != nil || n < 0 {
+			return limits, fmt.Errorf("invalid %s %q: want model=%s", what, pair, unit)
+		}
+		limits.models[strings.ToLower(resolveModel(model))] = n
+	}
+	return limits, nil
+}
+
+// parseTokenCaps parses caps on output tokens given as comma-separated model=tokens
+// pairs, with def applying to other models.
+func parseTokenCaps(def int, perModel string) (modelLimits, error) {
+	return parseModelLimits(def, perModel, "max tokens", "tokens")
+}
+
+// limit returns the limit for model, or 0 if it is not limited.
+func (c modelLimits) limit(model string) int {
+	if n, ok := c.models[strings.ToLower(model)]; ok {
+		return n
+	}
+	return c.def
+}
+
+// clampMaxTokens lowers the requested output tokens in fields to limit, setting them
+// when the client asked for none, and reports whether fields changed.
+func clampMaxTokens(fields map[string]json.RawMessage, model string, limit int) (bool, error) {
+	changed := false
+	found := false
+	for _, name := range []string{"max_tokens", "max_completion_tokens"} {
+		raw, ok := fields[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		found = true
+		var requested int
+		if err := json.Unmarshal(raw, &requested); err != nil {
+			return false, fmt.Errorf("%s must be an integer", name)
+		}
+		if requested > limit || requested <= 0 {
+			fields[name] = json.RawMessage(strconv.Itoa(limit))
+			changed = true
+		}
+	}
+	if !found {
+		name := "max_tokens"
+		if usesMaxCompletionTokens(model) {
+			name = "max_completion_tokens"
+		}
+		fields[name] = json.RawMessage(strconv.Itoa(limit))
+		changed = true
+	}
+	return changed, nil
+}
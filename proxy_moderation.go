@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// moderationHeader names the flagged categories of a request let through in flag mode.
+const moderationHeader = "X-Moderation-Flagged"
+
+// moderated returns next behind a moderation check of the request's text, when
+// moderation is enabled. In block mode a flagged request is answered with a 400; in
+// flag mode it is forwarded and the response names the flagged categories.
+func (p *proxyServer) moderated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.moderate == moderationOff || p.moderate == "" {
+			next(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyRequestBytes))
+		if err != nil {
+			writeRequestBodyError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		inputs := moderationInputs(body)
+		if len(inputs) == 0 {
+			next(w, r)
+			return
+		}
+		moderation, err := p.client.GetModeration(r.Context(), ModerationOptions{Input: inputs, Model: defaultModerationModel})
+		if err != nil {
+			writeProxyError(w, http.StatusBadGateway, "moderation_unavailable", "moderation check failed: "+err.Error())
+			return
+		}
+		if moderation.Flagged() {
+			categories := moderation.FlaggedCategories()
+			if p.moderate == moderationBlock {
+				writeProxyError(w, http.StatusBadRequest, "content_policy_violation", (&ModerationError{Categories: categories}).Error())
+				return
+			}
+			w.Header().Set(moderationHeader, strings.Join(categories, ","))
+		}
+		next(w, r)
+	}
+}
+
+// moderationInputs returns the text to moderate in a chat completions or embeddings
+// request: the user messages, or the string inputs. Anything else, such as images
+// or token arrays, is not moderated.
+func moderationInputs(body []byte) []string {
+	var req struct {
+		Messages []struct {
+			Role    ChatMessageRole `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Input json.RawMessage `json:"input"`
+	}
+	if json.Unmarshal(body, &req) != nil {
+		return nil // the handler reports the malformed request
+	}
+
+	var inputs []string
+	for _, m := range req.Messages {
+		if m.Role != ChatMessageRoleUser {
+			continue
+		}
+		var text string
+		if json.Unmarshal(m.Content, &text) == nil {
+			inputs = append(inputs, text)
+			continue
+		}
+		var parts []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(m.Content, &parts) == nil {
+			for _, part := range parts {
+				if part.Type == "text" {
+					inputs = append(inputs, part.Text)
+				}
+			}
+		}
+	}
+
+	var input string
+	var list []string
+	if json.Unmarshal(req.Input, &input) == nil {
+		inputs = append(inputs, input)
+	} else if json.Unmarshal(req.Input, &list) == nil {
+		inputs = append(inputs, list...)
+	}
+
+	n := 0
+	for _, s := range inputs {
+		if strings.TrimSpace(s) != "" {
+			inputs[n] = s
+			n++
+		}
+	}
+	return inputs[:n]
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+// maxProxyEventBytes bounds the size of a streamed event read from upstream.
+const maxProxyEventBytes = 4 << 20
+
+// The fields of the OpenAI chat completion schema kept by openAITranslator. GitHub
+// Models adds others, such as content filter results, which strict clients reject.
+var (
+	openAICompletionFields = []string{"id", "object", "created", "model", "system_fingerprint", "service_tier", "choices", "usage"}
+	openAIMessageFields    = []string{"role", "content", "refusal", "tool_calls", "function_call", "annotations", "audio"}
+)
+
+// openAITranslator rewrites GitHub Models chat completions into the OpenAI schema,
+// so that off-the-shelf clients can use the proxy. Azure-only fields are dropped,
+// as are the prompt filter chunks streamed before the completion, and missing
+// identifiers are filled in. The chunks of a stream share the first id, creation
+// time and model seen.
+type openAITranslator struct {
+	// requested is the requested model, used when upstream does not name one.
+	requested string
+	now       func() time.Time
+
+	id      string
+	created int64
+	model   string
+}
+
+func newOpenAITranslator(model string) *openAITranslator {
+	return &openAITranslator{requested: model, now: time.Now}
+}
+
+// translate rewrites one completion or chunk as an object of the given type. It
+// returns false for chunks with neither choices nor usage, which clients have no
+// use for.
+func (t *openAITranslator) translate(data []byte, object string) ([]byte, bool, error) {
+	var in map[string]json.RawMessage
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, false, err
+	}
+	var choices []map[string]json.RawMessage
+	if raw, ok := in["choices"]; ok && !isJSONNull(raw) {
+		if err := json.Unmarshal(raw, &choices); err != nil {
+			return nil, false, fmt.Errorf("choices: %w", err)
+		}
+	}
+	hasUsage := in["usage"] != nil && !isJSONNull(in["usage"])
+	if object == "chat.completion.chunk" && len(choices) == 0 && !hasUsage {
+		return nil, false, nil
+	}
+
+	out := pickFields(in, openAICompletionFields)
+	if !hasUsage {
+		delete(out, "usage")
+	}
+	var id, model string
+	var created int64
+	_ = json.Unmarshal(in["id"], &id)
+	_ = json.Unmarshal(in["model"], &model)
+	_ = json.Unmarshal(in["created"], &created)
+	if t.id == "" {
+		t.id = id
+		if t.id == "" {
+			t.id = newCompletionID()
+		}
+	}
+	if t.created == 0 {
+		t.created = created
+		if t.created == 0 {
+			t.created = t.now().Unix()
+		}
+	}
+	if t.model == "" {
+		t.model = model
+		if t.model == "" {
+			t.model = t.requested
+		}
+	}
+	out["id"], _ = json.Marshal(t.id)
+	out["object"], _ = json.Marshal(object)
+	out["created"], _ = json.Marshal(t.created)
+	out["model"], _ = json.Marshal(t.model)
+
+	messageField := "message"
+	if object == "chat.completion.chunk" {
+		messageField = "delta"
+	}
+	translated := make([]map[string]json.RawMessage, len(choices))
+	for i, choice := range choices {
+		c := pickFields(choice, []string{"index", messageField, "logprobs", "finish_reason"})
+		if _, ok := c["index"]; !ok {
+			c["index"], _ = json.Marshal(i)
+		}
+		if _, ok := c["finish_reason"]; !ok {
+			c["finish_reason"] = json.RawMessage("null")
+		}
+		if _, ok := c["logprobs"]; !ok {
+			c["logprobs"] = json.RawMessage("null")
+		}
+		var message map[string]json.RawMessage
+		if raw, ok := c[messageField]; ok && !isJSONNull(raw) {
+			if err := json.Unmarshal(raw, &message); err != nil {
+				return nil, false, fmt.Errorf("choice %d: %w", i, err)
+			}
+		}
+		message = pickFields(message, openAIMessageFields)
+		if messageField == "message" {
+			if _, ok := message["role"]; !ok {
+				message["role"] = json.RawMessage(`"assistant"`)
+			}
+			if _, ok := message["content"]; !ok {
+				message["content"] = json.RawMessage("null")
+			}
+		}
+		c[messageField], _ = json.Marshal(message)
+		translated[i] = c
+	}
+	out["choices"], _ = json.Marshal(translated)
+
+	result, err := json.Marshal(out)
+	return result, true, err
+}
+
+// pickFields returns the given fields of m, leaving out the others.
+func pickFields(m map[string]json.RawMessage, fields []string) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(fields))
+	for _, name := range fields {
+		if v, ok := m[name]; ok {
+			out[name] = v
+		}
+	}
+	return out
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return string(raw) == "null"
+}
+
+// newCompletionID returns an id in the format of OpenAI's, for completions upstream
+// left without one.
+func newCompletionID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+// writeOpenAIResponse writes the upstream chat completion in resp to w in the
+// OpenAI schema, translating streamed responses event by event. Bodies that are not
+// JSON are passed on unchanged.
+func (t *openAITranslator) writeOpenAIResponse(w http.ResponseWriter, resp *http.Response) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return t.copyStream(w, resp.Body)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if translated, _, err := t.translate(body, "chat.completion"); err == nil {
+		body = translated
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// copyStream translates the events of src to w, flushing after each. The [DONE]
+// sentinel is only forwarded once upstream sends it. A stream that ends early or
+// fails to read instead ends with an error event and no sentinel, so that clients
+// can tell a dropped stream from a complete one.
+func (t *openAITranslator) copyStream(w http.ResponseWriter, src io.Reader) error {
+	rc := http.NewResponseController(w)
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxProxyEventBytes)
+	write := func(data []byte) error {
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		field, value, ok := stream.ParseLine(scanner.Text())
+		if !ok || field != "data" {
+			continue
+		}
+		if value == "[DONE]" {
+			return write([]byte("[DONE]"))
+		}
+		chunk, keep, err := t.translate([]byte(value), "chat.completion.chunk")
+		if err != nil {
+			return &stream.MalformedEventError{Field: field, Data: value, Err: err}
+		}
+		if !keep {
+			continue
+		}
+		if err := write(chunk); err != nil {
+			return err
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = stream.ErrIncompleteStream
+	}
+	event, _ := json.Marshal(map[string]any{"error": map[string]any{
+		"message": "the upstream stream ended early: " + err.Error(),
+		"type":    proxyErrorType(http.StatusBadGateway),
+		"param":   nil,
+		"code":    "incomplete_stream",
+	}})
+	_ = write(event)
+	return err
+}
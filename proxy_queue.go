@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// requestQueue limits the requests forwarded at once. Requests beyond the limit wait
+// in the queue, and are rejected once it is full or they have waited too long.
+type requestQueue struct {
+	slots      chan struct{}
+	maxWaiting int
+	timeout    time.Duration
+
+	mu       sync.Mutex
+	waiting  int
+	rejected int64
+	admitted int64
+	waitSum  time.Duration
+	// served and serviceSum give the average request duration behind Retry-After.
+	served     int64
+	serviceSum time.Duration
+}
+
+func newRequestQueue(concurrency, maxWaiting int, timeout time.Duration) *requestQueue {
+	return &requestQueue{slots: make(chan struct{}, concurrency), maxWaiting: maxWaiting, timeout: timeout}
+}
+
+// serve runs next once a slot is free. Queued responses carry X-Queue-Position, the
+// number of requests that were ahead on arrival including this one; rejected ones
+// also carry Retry-After.
+func (q *requestQueue) serve(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		q.mu.Lock()
+		if q.waiting >= q.maxWaiting {
+			q.rejected++
+			retry := q.retryAfterLocked(q.waiting + 1)
+			q.mu.Unlock()
+			q.reject(w, q.maxWaiting+1, retry, "queue_full", "the proxy queue is full")
+			return
+		}
+		q.waiting++
+		position := q.waiting
+		q.mu.Unlock()
+		w.Header().Set("X-Queue-Position", strconv.Itoa(position))
+
+		var timeout <-chan time.Time
+		if q.timeout > 0 {
+			timer := time.NewTimer(q.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case q.slots <- struct{}{}:
+			q.mu.Lock()
+			q.waiting--
+			q.mu.Unlock()
+		case <-timeout:
+			q.mu.Lock()
+			q.waiting--
+			q.rejected++
+			retry := q.retryAfterLocked(q.waiting + 1)
+			q.mu.Unlock()
+			q.reject(w, position, retry, "queue_timeout", fmt.Sprintf("the request waited in the proxy queue for more than %s", q.timeout))
+			return
+		case <-r.Context().Done():
+			q.mu.Lock()
+			q.waiting--
+			q.mu.Unlock()
+			return // the client went away
+		}
+	}
+
+	admitted := time.Now()
+	defer func() {
+		<-q.slots
+		q.mu.Lock()
+		q.served++
+		q.serviceSum += time.Since(admitted)
+		q.mu.Unlock()
+	}()
+	q.mu.Lock()
+	q.admitted++
+	q.waitSum += admitted.Sub(start)
+	q.mu.Unlock()
+	next(w, r)
+}
+
+func (q *requestQueue) reject(w http.ResponseWriter, position int, retry time.Duration, code, message string) {
+	w.Header().Set("X-Queue-Position", strconv.Itoa(position))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	writeProxyError(w, http.StatusServiceUnavailable, code, message)
+}
+
+// retryAfterLocked estimates how long until a request at position would be
+// admitted, from the average request duration. It is at least a second.
+func (q *requestQueue) retryAfterLocked(position int) time.Duration {
+	if q.served == 0 {
+		return time.Second
+	}
+	average := q.serviceSum / time.Duration(q.served)
+	return max(time.Second, average*time.Duration(position)/time.Duration(cap(q.slots)))
+}
+
+// depth returns the number of waiting requests.
+func (q *requestQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting
+}
+
+// writeMetrics writes the queue metrics in the Prometheus text format.
+func (q *requestQueue) writeMetrics(w http.ResponseWriter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP ghmodels_proxy_queue_depth Requests waiting in the queue.\n")
+	fmt.Fprintf(w, "# TYPE ghmodels_proxy_queue_depth gauge\n")
+	fmt.Fprintf(w, "ghmodels_proxy_queue_depth %d\n", q.waiting)
+	fmt.Fprintf(w, "# HELP ghmodels_proxy_in_flight Requests being forwarded.\n")
+	fmt.Fprintf(w, "# TYPE ghmodels_proxy_in_flight gauge\n")
+	fmt.Fprintf(w, "ghmodels_proxy_in_flight %d\n", len(q.slots))
+	fmt.Fprintf(w, "# HELP ghmodels_proxy_queue_rejected_total Requests rejected because the queue was full or they waited too long.\n")
+	fmt.Fprintf(w, "# TYPE ghmodels_proxy_queue_rejected_total counter\n")
+	fmt.Fprintf(w, "ghmodels_proxy_queue_rejected_total %d\n", q.rejected)
+	fmt.Fprintf(w, "# HELP ghmodels_proxy_queue_wait_seconds Time admitted requests waited in the queue.\n")
+	fmt.Fprintf(w, "# TYPE ghmodels_proxy_queue_wait_seconds summary\n")
+	fmt.Fprintf(w, "ghmodels_proxy_queue_wait_seconds_sum %g\n", q.waitSum.Seconds())
+	fmt.Fprintf(w, "ghmodels_proxy_queue_wait_seconds_count %d\n", q.admitted)
+}
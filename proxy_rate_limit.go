@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimit is a limit of requests over a period, enforced with a token bucket.
+type rateLimit struct {
+	// key identifies the bucket, such as the client or model it limits.
+	key string
+	// overflow, if set, is the key of a bucket shared by all limits of its kind once
+	// the limiter holds maxRateLimitBuckets, so that clients cannot grow it without
+	// bound by sending made-up model names.
+	overflow string
+	// what describes the limited client or model in errors.
+	what   string
+	limit  int
+	period time.Duration
+}
+
+// maxRateLimitBuckets bounds the buckets of a rateLimiter before limits with an
+// overflow key share one.
+const maxRateLimitBuckets = 10000
+
+// rateLimitSweepInterval is how often a rateLimiter evicts idle buckets.
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket holds the requests a rate limit allows now, refilling continuously
+// up to the limit.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// limit and period are those of the bucket's rate limit, for evicting it once it
+	// has refilled.
+	limit  int
+	period time.Duration
+}
+
+// refill adds the requests allowed since the bucket was last updated.
+func (b *tokenBucket) refill(now time.Time) {
+	rate := float64(b.limit) / float64(b.period)
+	b.tokens = math.Min(float64(b.limit), b.tokens+rate*float64(now.Sub(b.updated)))
+	b.updated = now
+}
+
+// rateLimiter enforces rate limits locally, so that clients are turned away before
+// their requests use up the upstream limits of everyone sharing the proxy's token.
+type rateLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{now: time.Now, buckets: map[string]*tokenBucket{}}
+}
+
+// take admits a request under all of limits, or reports the first limit exceeded
+// and how long until it admits a request. Rejected requests use up none of the
+// limits.
+func (l *rateLimiter) take(limits []rateLimit) (bool, rateLimit, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	buckets := make([]*tokenBucket, len(limits))
+	for i, limit := range limits {
+		key := limit.key + "/" + limit.period.String()
+		b, ok := l.buckets[key]
+		if !ok && limit.overflow != "" && len(l.buckets) >= maxRateLimitBuckets {
+			key = limit.overflow + "/" + limit.period.String()
+			b, ok = l.buckets[key]
+		}
+		if !ok {
+			b = &tokenBucket{tokens: float64(limit.limit), updated: now, limit: limit.limit, period: limit.period}
+			l.buckets[key] = b
+		}
+		b.refill(now)
+		if b.tokens < 1 {
+			rate := float64(limit.limit) / float64(limit.period)
+			return false, limit, time.Duration((1 - b.tokens) / rate)
+		}
+		buckets[i] = b
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, rateLimit{}, 0
+}
+
+// sweep evicts the buckets that have refilled, which behave as new ones would.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now); b.tokens >= float64(b.limit) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimits returns the limits that apply to a request for model by principal,
+// which is nil for unauthenticated requests.
+func (p *proxyServer) rateLimits(principal *Principal, model string) []rateLimit {
+	var limits []rateLimit
+	add := func(key, overflow, what string, limit int, period time.Duration) {
+		if limit > 0 {
+			limits = append(limits, rateLimit{key: key, overflow: overflow, what: what, limit: limit, period: period})
+		}
+	}
+	if principal != nil {
+		add("client:"+principal.Name, "", principal.Name, principal.RequestsPerMinute, time.Minute)
+		add("client:"+principal.Name, "", principal.Name, principal.RequestsPerDay, 24*time.Hour)
+	}
+	model = strings.ToLower(model)
+	for _, l := range []struct {
+		limits modelLimits
+		period time.Duration
+	}{{p.requestsPerMinute, time.Minute}, {p.requestsPerDay, 24 * time.Hour}} {
+		// Models without a limit of their own may be made up, so they share a bucket
+		// once there are too many
+		overflow := "model:*"
+		if _, ok := l.limits.models[model]; ok {
+			overflow = ""
+		}
+		add("model:"+model, overflow, "model "+model, l.limits.limit(model), l.period)
+	}
+	return limits
+}
+
+// allowRequest admits a request for model under the rate limits of its client and
+// the model, or rejects it with 429 and a Retry-After header.
+func (p *proxyServer) allowRequest(w http.ResponseWriter, r *http.Request, model string) bool {
+	limits := p.rateLimits(principalFrom(r.Context()), model)
+	if len(limits) == 0 {
+		return true
+	}
+	ok, exceeded, retry := p.limiter.take(limits)
+	if ok {
+		return true
+	}
+	seconds := int(math.Ceil(retry.Seconds()))
+	per := "minute"
+	if exceeded.period > time.Minute {
+		per = "day"
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeProxyError(w, http.StatusTooManyRequests, "rate_limit_exceeded",
+		fmt.Sprintf("rate limit of %d requests per %s for %s exceeded; retry in %d seconds", exceeded.limit, per, exceeded.what, seconds))
+	return false
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+// handleResponses serves the OpenAI Responses API on top of upstream chat
+// completions. Requests are translated into chat completions, which are always
+// streamed from upstream, and the completion is translated back into a response
+// object or, for streamed requests, into response events.
+func (p *proxyServer) handleResponses(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyRequestBytes))
+	if err != nil {
+		writeRequestBodyError(w, err)
+		return
+	}
+	var opts ResponsesOptions
+	if err := json.Unmarshal(body, &opts); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid_json", "request body is not a valid response request: "+err.Error())
+		return
+	}
+	if opts.Model == "" {
+		writeProxyError(w, http.StatusBadRequest, "missing_required_parameter", "model is required")
+		return
+	}
+	req, err := ChatOptionsFromResponses(opts)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, "unsupported_parameter", err.Error())
+		return
+	}
+	model := resolveModel(req.Model)
+	if !checkModel(w, r, model) {
+		return
+	}
+	req.Model = model
+	if req.User == "" && p.userFromKey {
+		req.User = keyUser(r)
+	}
+	req.Stream = true
+	req.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	if body, err = json.Marshal(req); err != nil {
+		writeProxyError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	if limit := p.tokenLimit(r, model); limit > 0 {
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal(body, &fields)
+		if _, err := clampMaxTokens(fields, model, limit); err != nil {
+			writeProxyError(w, http.StatusBadRequest, "invalid_value", err.Error())
+			return
+		}
+		if body, err = json.Marshal(fields); err != nil {
+			writeProxyError(w, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+	}
+	if !p.allowRequest(w, r, model) {
+		return
+	}
+
+	if !sleep(r.Context(), p.latency.response) {
+		return // the client went away
+	}
+	resp, err := p.client.forward(r.Context(), p.client.cfg.InferenceURL, body)
+	if err != nil {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return // the client went away
+		}
+		writeForwardError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		writeUpstreamError(w, resp.StatusCode, resp.Header, readUpstreamError(resp))
+		return
+	}
+	copyResponseHeaders(w.Header(), resp.Header)
+
+	t := newResponsesTranslator(model)
+	reader := stream.NewEventReader[ChatCompletion](resp.Body)
+	if opts.Stream {
+		err = t.stream(w, reader)
+	} else {
+		err = t.complete(w, reader)
+	}
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("proxy: responses for %s: %v", model, err)
+	}
+}
+
+// responsesTranslator turns a streamed chat completion into a Responses API response.
+type responsesTranslator struct {
+	model     string
+	id        string
+	messageID string
+	created   int64
+	acc       *completionAccumulator
+
+	rc       *http.ResponseController
+	sequence int
+}
+
+func newResponsesTranslator(model string) *responsesTranslator {
+	return &responsesTranslator{
+		model:     model,
+		id:        newResponseObjectID("resp_"),
+		messageID: newResponseObjectID("msg_"),
+		created:   time.Now().Unix(),
+		acc:       newCompletionAccumulator(),
+	}
+}
+
+// newResponseObjectID returns an id for a response or output item, with the prefix
+// OpenAI uses for its type.
+func newResponseObjectID(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// response returns the response for what has been accumulated, with ids filled in.
+func (t *responsesTranslator) response() *Response {
+	finishReason := t.acc.finishReason
+	if t.acc.filter.err() != nil {
+		finishReason = "content_filter"
+	}
+	resp := ResponseFromChat(t.acc.message(), finishReason, t.acc.usage)
+	t.identify(resp)
+	for i := range resp.Output {
+		if resp.Output[i].Type == responseItemTypeMessage {
+			resp.Output[i].ID = t.messageID
+		} else {
+			resp.Output[i].ID = "fc_" + resp.Output[i].CallID
+		}
+	}
+	return resp
+}
+
+func (t *responsesTranslator) identify(resp *Response) {
+	resp.ID, resp.Object, resp.CreatedAt, resp.Model = t.id, "response", t.created, t.model
+}
+
+// complete reads the whole completion and writes it as one response object.
+func (t *responsesTranslator) complete(w http.ResponseWriter, reader stream.Reader[ChatCompletion]) error {
+	err := readCompletions(reader, func(completion ChatCompletion) error {
+		t.acc.add(completion)
+		return nil
+	})
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, "incomplete_stream", "the upstream stream ended early: "+err.Error())
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(t.response())
+}
+
+// stream writes response events as the completion streams in. Text is streamed as
+// it arrives; function calls, whose arguments arrive in pieces, are sent whole once
+// the completion ends. A stream cut short ends with an error event.
+func (t *responsesTranslator) stream(w http.ResponseWriter, reader stream.Reader[ChatCompletion]) error {
+	t.rc = http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	created := &Response{Status: responseStatusInProgress, Output: []ResponseItem{}}
+	t.identify(created)
+	if err := t.write(w, ResponseEvent{Type: ResponseEventCreated, Response: created}); err != nil {
+		return err
+	}
+
+	started := false
+	err := readCompletions(reader, func(completion ChatCompletion) error {
+		delta := t.acc.add(completion)
+		if delta == "" {
+			return nil
+		}
+		if !started {
+			started = true
+			item := &ResponseItem{Type: responseItemTypeMessage, ID: t.messageID, Status: responseStatusInProgress, Role: ChatMessageRoleAssistant, Content: []ResponseContent{}}
+			if err := t.write(w, ResponseEvent{Type: ResponseEventOutputItemAdded, Item: item}); err != nil {
+				return err
+			}
+		}
+		return t.write(w, ResponseEvent{Type: ResponseEventOutputTextDelta, ItemID: t.messageID, Delta: delta})
+	})
+	if err != nil {
+		_ = t.write(w, ResponseEvent{Type: ResponseEventError, Code: "incomplete_stream", Message: "the upstream stream ended early: " + err.Error()})
+		return err
+	}
+
+	resp := t.response()
+	for i := range resp.Output {
+		item := &resp.Output[i]
+		if item.Type != responseItemTypeMessage {
+			if err := t.write(w, ResponseEvent{Type: ResponseEventOutputItemAdded, OutputIndex: i, Item: item}); err != nil {
+				return err
+			}
+		}
+		if err := t.write(w, ResponseEvent{Type: ResponseEventOutputItemDone, OutputIndex: i, Item: item}); err != nil {
+			return err
+		}
+	}
+	final := ResponseEventCompleted
+	if resp.Status == responseStatusIncomplete {
+		final = ResponseEventIncomplete
+	}
+	return t.write(w, ResponseEvent{Type: final, Response: resp})
+}
+
+// write sends event and flushes it to the client.
+func (t *responsesTranslator) write(w io.Writer, event ResponseEvent) error {
+	event.SequenceNumber = t.sequence
+	t.sequence++
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	if err := t.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
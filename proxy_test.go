@@ -0,0 +1,1203 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+func newTestProxy(t *testing.T, upstream *modelstest.Server) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(newProxyServer(newTestClient(upstream)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProxyStreamsChatCompletions(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{
+		Chunks: []string{"Hello", " there"},
+		Header: http.Header{"X-Ratelimit-Remaining-Requests": {"9"}},
+	})
+	proxy := newTestProxy(t, upstream)
+
+	body := `{"model":"openai/gpt-4o-mini","stream":true,"temperature":0.2,"messages":[{"role":"user","content":"hi"}]}`
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, data)
+	}
+	if got := resp.Header.Get("X-Ratelimit-Remaining-Requests"); got != "9" {
+		t.Errorf("rate limit header = %q, want it forwarded", got)
+	}
+	if !strings.Contains(string(data), `"Hello"`) || !strings.Contains(string(data), "data: [DONE]") {
+		t.Errorf("response is not the upstream stream: %s", data)
+	}
+
+	requests := upstream.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d upstream requests, want 1", len(requests))
+	}
+	if got := requests[0].Header.Get("Authorization"); got != "Bearer test-token" {
+		t.Errorf("Authorization = %q, want the proxy's token", got)
+	}
+	if !strings.Contains(string(requests[0].Body), `"temperature":0.2`) {
+		t.Errorf("parameters were not passed through: %s", requests[0].Body)
+	}
+}
+
+func TestProxyTranslatesToOpenAISchema(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{Events: []string{
+		`{"choices":[],"created":0,"id":"","model":"","object":"","prompt_filter_results":[{"prompt_index":0,"content_filter_results":{}}]}`,
+		`{"choices":[{"content_filter_results":{},"delta":{"content":"Hi"},"index":0}],"created":1700000000,"id":"chatcmpl-1","model":"gpt-4o-mini-2024-07-18","object":"chat.completion.chunk"}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop","index":0}],"created":0,"id":"","model":"","object":"chat.completion.chunk"}`,
+	}})
+	upstream.Enqueue(modelstest.Response{Chunks: []string{"Hello"}, Usage: &modelstest.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}})
+	proxy := newTestProxy(t, upstream)
+
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"openai/gpt-4o-mini","stream":true,"messages":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := strings.Split(strings.TrimSuffix(string(data), "\n\n"), "\n\n")
+	if len(events) != 3 || events[2] != "data: [DONE]" {
+		t.Fatalf("want two chunks and [DONE], got:\n%s", data)
+	}
+	for _, event := range events[:2] {
+		var chunk map[string]any
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if chunk["id"] != "chatcmpl-1" || chunk["object"] != "chat.completion.chunk" || chunk["created"] != 1700000000.0 || chunk["model"] != "gpt-4o-mini-2024-07-18" {
+			t.Errorf("chunk does not carry the stream's identifiers: %s", event)
+		}
+	}
+	if strings.Contains(string(data), "content_filter_results") {
+		t.Errorf("Azure-only fields were not dropped:\n%s", data)
+	}
+
+	resp, err = http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"openai/gpt-4o-mini","messages":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var completion struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *modelstest.Usage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatal(err)
+	}
+	if completion.Object != "chat.completion" || len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Hello" || completion.Usage == nil || completion.Usage.TotalTokens != 2 {
+		t.Errorf("completion = %+v", completion)
+	}
+}
+
+func TestProxyForwardsIncompleteStreams(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{Chunks: []string{"partial"}, OmitDone: true})
+	proxy := httptest.NewServer(newProxyServer(newTestClient(upstream)))
+	defer proxy.Close()
+
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"openai/gpt-4o-mini","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+	if !strings.Contains(body, "partial") || !strings.Contains(body, `"code":"incomplete_stream"`) {
+		t.Errorf("body lacks the content or an error event:\n%s", body)
+	}
+	if strings.Contains(body, "[DONE]") {
+		t.Errorf("a truncated stream was forwarded as complete:\n%s", body)
+	}
+}
+
+func TestProxyForwardsUpstreamErrors(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{Status: http.StatusTooManyRequests, Body: `{"error":{"code":"RateLimitReached","message":"slow down"}}`})
+	proxy := newTestProxy(t, upstream)
+
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"openai/gpt-4o-mini","messages":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want the upstream 429", resp.StatusCode)
+	}
+	got := decodeProxyError(t, resp)
+	if got.Message != "slow down" || got.Type != "rate_limit_error" || got.Code == nil || *got.Code != "RateLimitReached" {
+		t.Errorf("error = %+v, want the upstream message and code with a type", got)
+	}
+}
+
+// proxyErrorResponse is the error shape OpenAI SDKs decode.
+type proxyErrorResponse struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+func decodeProxyError(t *testing.T, resp *http.Response) proxyErrorResponse {
+	t.Helper()
+	defer resp.Body.Close()
+	var body struct {
+		Error *proxyErrorResponse `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == nil {
+		t.Fatalf("response is not an OpenAI error: %v", err)
+	}
+	return *body.Error
+}
+
+func TestNormalizeUpstreamError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"openai shape", `{"error":{"message":"bad","type":"invalid_request_error","param":"model","code":"x"}}`, `{"code":"x","message":"bad","param":"model","type":"invalid_request_error"}`},
+		{"missing fields", `{"error":{"message":"bad"}}`, `{"code":null,"message":"bad","param":null,"type":"invalid_request_error"}`},
+		{"string error", `{"error":"bad"}`, `{"code":null,"message":"bad","param":null,"type":"invalid_request_error"}`},
+		{"null error", `{"error":null}`, `{"code":null,"message":"Bad Request","param":null,"type":"invalid_request_error"}`},
+		{"plain text", "bad gateway\n", `{"code":null,"message":"bad gateway","param":null,"type":"invalid_request_error"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := json.Marshal(normalizeUpstreamError(http.StatusBadRequest, []byte(tt.body)))
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyRejectsMissingModel(t *testing.T) {
+	proxy := newTestProxy(t, modelstest.NewServer(t))
+
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"messages":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+	if got := decodeProxyError(t, resp); got.Type != "invalid_request_error" || got.Code == nil {
+		t.Errorf("error = %+v, want an invalid_request_error with a code", got)
+	}
+}
+
+func TestProxyClampsMaxTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"above the cap", `{"model":"openai/gpt-4o-mini","max_tokens":100000,"messages":[]}`, `"max_tokens":256`},
+		{"below the cap", `{"model":"openai/gpt-4o-mini","max_tokens":10,"messages":[]}`, `"max_tokens":10`},
+		{"unset", `{"model":"openai/gpt-4o-mini","messages":[]}`, `"max_tokens":256`},
+		{"unset for a reasoning model", `{"model":"openai/o3-mini","messages":[]}`, `"max_completion_tokens":256`},
+		{"per model cap", `{"model":"openai/gpt-4.1","max_completion_tokens":5000,"messages":[]}`, `"max_completion_tokens":1024`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := modelstest.NewServer(t)
+			upstream.Enqueue(modelstest.Response{Chunks: []string{"ok"}})
+			p := newProxyServer(newTestClient(upstream))
+			var err error
+			if p.maxTokens, err = parseTokenCaps(256, "openai/gpt-4.1=1024"); err != nil {
+				t.Fatal(err)
+			}
+			proxy := httptest.NewServer(p)
+			defer proxy.Close()
+
+			resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := string(upstream.Requests()[0].Body); !strings.Contains(got, tt.want) {
+				t.Errorf("upstream request %s does not contain %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyUserFromKey(t *testing.T) {
+	sum := sha256.Sum256([]byte("client-key"))
+	hashed := `"user":"` + hex.EncodeToString(sum[:16]) + `"`
+	chat := `{"model":"openai/gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`
+	tests := []struct {
+		name        string
+		userFromKey bool
+		path        string
+		body        string
+		key         string
+		want        string // in the upstream request, or absent if empty
+	}{
+		{"chat completion", true, "/v1/chat/completions", chat, "client-key", hashed},
+		{"response", true, "/v1/responses", `{"model":"openai/gpt-4o-mini","input":"hi"}`, "client-key", hashed},
+		{"user sent by the client", true, "/v1/chat/completions", `{"model":"openai/gpt-4o-mini","user":"alice","messages":[]}`, "client-key", `"user":"alice"`},
+		{"no key", true, "/v1/chat/completions", chat, "", ""},
+		{"disabled", false, "/v1/chat/completions", chat, "client-key", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := modelstest.NewServer(t)
+			upstream.Enqueue(modelstest.Response{Chunks: []string{"ok"}})
+			p := newProxyServer(newTestClient(upstream))
+			p.userFromKey = tt.userFromKey
+			proxy := httptest.NewServer(p)
+			defer proxy.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, proxy.URL+tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			got := string(upstream.Requests()[0].Body)
+			if tt.want == "" && strings.Contains(got, `"user":`) {
+				t.Errorf("upstream request %s names a user", got)
+			} else if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("upstream request %s does not contain %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxySplitsEmbeddings(t *testing.T) {
+	var batches [][]string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbeddingsOptions
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		batches = append(batches, req.Input)
+		resp := EmbeddingsResponse{Model: req.Model, Usage: &EmbeddingsUsage{PromptTokens: len(req.Input), TotalTokens: len(req.Input)}}
+		for i, input := range req.Input {
+			resp.Data = append(resp.Data, Embedding{Embedding: []float32{float32(len(input))}, Index: i})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer upstream.Close()
+
+	cfg := NewDefaultAzureClientConfig()
+	cfg.EmbeddingsURL = upstream.URL
+	p := newProxyServer(NewAzureClient(upstream.Client(), "test-token", cfg))
+	p.embeddingsBatch = 2
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	body := `{"model":"openai/text-embedding-3-small","input":["a","bb","ccc","dddd","eeeee"]}`
+	resp, err := http.Post(proxy.URL+"/v1/embeddings", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var merged EmbeddingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&merged); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 3 {
+		t.Errorf("sent %d upstream calls, want 3", len(batches))
+	}
+	if len(merged.Data) != 5 {
+		t.Fatalf("got %d embeddings, want 5", len(merged.Data))
+	}
+	for i, e := range merged.Data {
+		// Each fake vector holds the length of its input, which identifies it
+		if e.Index != i || e.Embedding[0] != float32(i+1) {
+			t.Errorf("embedding %d = index %d, vector %v", i, e.Index, e.Embedding)
+		}
+	}
+	if merged.Usage == nil || merged.Usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v, want the sum over batches", merged.Usage)
+	}
+}
+
+func TestRequestQueueBackpressure(t *testing.T) {
+	q := newRequestQueue(1, 1, 0)
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		q.serve(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), next)
+		return w
+	}
+	first, queued := make(chan *httptest.ResponseRecorder), make(chan *httptest.ResponseRecorder)
+	go func() { first <- serve() }()
+	<-started
+	go func() { queued <- serve() }()
+	for q.depth() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rejected := serve()
+	if rejected.Code != http.StatusServiceUnavailable || rejected.Header().Get("Retry-After") == "" {
+		t.Errorf("full queue = %d with Retry-After %q, want 503 with a hint", rejected.Code, rejected.Header().Get("Retry-After"))
+	}
+
+	metrics := httptest.NewRecorder()
+	q.writeMetrics(metrics)
+	for _, want := range []string{"ghmodels_proxy_queue_depth 1", "ghmodels_proxy_in_flight 1", "ghmodels_proxy_queue_rejected_total 1"} {
+		if !strings.Contains(metrics.Body.String(), want) {
+			t.Errorf("metrics lack %q:\n%s", want, metrics.Body)
+		}
+	}
+
+	close(release)
+	<-first
+	if w := <-queued; w.Code != http.StatusOK || w.Header().Get("X-Queue-Position") != "1" {
+		t.Errorf("queued request = %d at position %q, want 200 at 1", w.Code, w.Header().Get("X-Queue-Position"))
+	}
+}
+
+func TestProxyInjectsFirstTokenLatency(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{Chunks: []string{"Hello"}})
+	p := newProxyServer(newTestClient(upstream))
+	p.latency = injectedLatency{firstToken: delay}
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	start := time.Now()
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"openai/gpt-4o-mini","messages":[],"stream":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	headers := time.Since(start)
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if body := time.Since(start); headers >= delay || body < delay {
+		t.Errorf("headers after %s and body after %s, want only the body delayed by %s", headers, body, delay)
+	}
+}
+
+func TestProxyStaticKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := `[{"key":"sk-ci","name":"ci","max_tokens":50,"models":["openai/gpt-4o-mini"]}]`
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := loadStaticKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(modelstest.Response{Chunks: []string{"ok"}})
+	p := newProxyServer(newTestClient(upstream))
+	p.auth = auth
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	tests := []struct {
+		name, key, model string
+		want             int
+	}{
+		{"missing key", "", "openai/gpt-4o-mini", http.StatusUnauthorized},
+		{"invalid key", "sk-other", "openai/gpt-4o-mini", http.StatusUnauthorized},
+		{"model not allowed", "sk-ci", "openai/gpt-4.1", http.StatusForbidden},
+		{"valid key", "sk-ci", "openai/gpt-4o-mini", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`","messages":[]}`))
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	if body := string(upstream.Requests()[0].Body); !strings.Contains(body, `"max_tokens":50`) {
+		t.Errorf("the key's token cap was not applied: %s", body)
+	}
+}
+
+// signTestJWT returns a token with claims signed by key, an *rsa.PrivateKey or an
+// *ecdsa.PrivateKey on P-256.
+func signTestJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	auth := newJWTAuthenticator(idp.Client(), issuer, "ghmodels", "")
+	auth.tenantClaim, auth.maxTokensClaim = "tenant", "max_tokens"
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"iss": issuer, "aud": []string{"ghmodels"}, "exp": time.Now().Add(time.Hour).Unix(), "tenant": "search-team", "max_tokens": 200}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"rsa", signTestJWT(t, rsaKey, "rsa", claims(nil)), true},
+		{"ec", signTestJWT(t, ecKey, "ec", claims(nil)), true},
+		{"expired", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), false},
+		{"wrong audience", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"aud": "other"})), false},
+		{"no audience", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"aud": nil})), false},
+		{"wrong issuer", signTestJWT(t, rsaKey, "rsa", claims(map[string]any{"iss": "https://evil.example"})), false},
+		{"key mismatch", signTestJWT(t, ecKey, "rsa", claims(nil)), false},
+		{"unknown key", signTestJWT(t, rsaKey, "rotated", claims(nil)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			principal, err := auth.Authenticate(r)
+			if !tt.ok {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("err = %v, want ErrUnauthenticated", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.Name != "search-team" || principal.MaxTokens != 200 {
+				t.Errorf("principal = %+v", principal)
+			}
+		})
+	}
+}
+
+func TestProxyJWKSUnavailable(t *testing.T) {
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusInternalServerError)
+	}))
+	defer idp.Close()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newProxyServer(newTestClient(modelstest.NewServer(t)))
+	p.auth = newJWTAuthenticator(idp.Client(), idp.URL, "ghmodels", idp.URL+"/keys")
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	token := signTestJWT(t, rsaKey, "rsa", map[string]any{"iss": idp.URL, "aud": "ghmodels", "exp": time.Now().Add(time.Hour).Unix(), "sub": "search-team"})
+	req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/chat/completions", strings.NewReader(`{"model":"openai/gpt-4o-mini","messages":[]}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	// Clients can retry, as the identity provider rather than their token failed
+	if resp.StatusCode != http.StatusServiceUnavailable || body.Error.Code != "authentication_unavailable" || !strings.Contains(body.Error.Message, "signing keys") {
+		t.Errorf("got %d %+v, want 503 authentication_unavailable", resp.StatusCode, body.Error)
+	}
+}
+
+func TestJWKSCacheFetchesWithoutBlocking(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var fetches atomic.Int32
+	gate := make(chan struct{})
+	var gateMu sync.Mutex
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		gateMu.Lock()
+		wait := gate
+		gateMu.Unlock()
+		<-wait
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		}})
+	}))
+	defer idp.Close()
+	cache := &jwksCache{client: idp.Client(), issuer: idp.URL, url: idp.URL + "/keys"}
+	ctx := context.Background()
+
+	// Requests waiting for the first fetch share it
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.key(ctx, "rsa")
+			errs <- err
+		}()
+	}
+	for fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unknown keys do not trigger a refetch within jwksMinRefresh
+	for range 10 {
+		if _, err := cache.key(ctx, "rotated"); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("unknown key: err = %v, want ErrUnauthenticated", err)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("fetched the keys %d times, want once", got)
+	}
+
+	// Stale keys are used while a slow refresh runs
+	cache.mu.Lock()
+	cache.fetched = cache.fetched.Add(-jwksCacheTTL)
+	cache.attempted = cache.attempted.Add(-jwksCacheTTL)
+	cache.mu.Unlock()
+	gateMu.Lock()
+	gate = make(chan struct{})
+	gateMu.Unlock()
+	defer close(gate)
+	start := time.Now()
+	if _, err := cache.key(ctx, "rsa"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("a stale key waited %v for the refresh", elapsed)
+	}
+}
+
+func TestProxyCacheIsPerClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`[{"key":"sk-a","name":"a"},{"key":"sk-b","name":"b"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := loadStaticKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(
+		modelstest.Response{Chunks: []string{"for a"}},
+		modelstest.Response{Chunks: []string{"for b"}},
+		modelstest.Response{Chunks: []string{"shared"}},
+	)
+	p := newProxyServer(newTestClient(upstream))
+	p.auth = auth
+	p.cache, p.cacheTTL = newMemoryCache(10), time.Minute
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	post := func(key, content string) (string, string) {
+		t.Helper()
+		body := `{"model":"openai/gpt-4o-mini","messages":[{"role":"user","content":"` + content + `"}]}`
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get("X-Cache"), string(data)
+	}
+
+	post("sk-a", "hi")
+	if status, body := post("sk-b", "hi"); status != "MISS" || !strings.Contains(body, "for b") {
+		t.Errorf("another client's identical request: X-Cache %q, body %s", status, body)
+	}
+	if status, body := post("sk-a", "hi"); status != "HIT" || !strings.Contains(body, "for a") {
+		t.Errorf("the same client's repeated request: X-Cache %q, body %s", status, body)
+	}
+
+	p.cacheShared = true
+	post("sk-a", "shared")
+	if status, body := post("sk-b", "shared"); status != "HIT" || !strings.Contains(body, "shared") {
+		t.Errorf("with a shared cache: X-Cache %q, body %s", status, body)
+	}
+}
+
+func TestProxyRateLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := `[{"key":"sk-ci","name":"ci","requests_per_minute":1},{"key":"sk-dev","name":"dev"}]`
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := loadStaticKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := modelstest.NewServer(t)
+	for range 4 {
+		upstream.Enqueue(modelstest.Response{Chunks: []string{"ok"}})
+	}
+	p := newProxyServer(newTestClient(upstream))
+	p.auth = auth
+	if p.requestsPerMinute, err = parseModelLimits(0, "openai/gpt-4.1=2", "requests per minute", "requests"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	p.limiter.now = func() time.Time { return now }
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	post := func(key, model string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := post("sk-ci", "openai/gpt-4o-mini"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first request of ci = %d", resp.StatusCode)
+	}
+	resp := post("sk-ci", "openai/gpt-4o-mini")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("second request of ci = %d with Retry-After %q, want 429 after 60 seconds", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if resp := post("sk-dev", "openai/gpt-4.1"); resp.StatusCode != want {
+			t.Errorf("request %d of dev for a model limited to 2 = %d, want %d", i+1, resp.StatusCode, want)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if resp := post("sk-ci", "openai/gpt-4o-mini"); resp.StatusCode != http.StatusOK {
+		t.Errorf("request of ci after a minute = %d", resp.StatusCode)
+	}
+	if got := len(upstream.Requests()); got != 4 {
+		t.Errorf("forwarded %d requests, want the 4 within the limits", got)
+	}
+}
+
+func TestRateLimiterBoundsBuckets(t *testing.T) {
+	l := newRateLimiter()
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	limit := func(model, overflow string) []rateLimit {
+		return []rateLimit{{key: "model:" + model, overflow: overflow, what: model, limit: 1, period: time.Minute}}
+	}
+
+	for i := range maxRateLimitBuckets {
+		if ok, _, _ := l.take(limit(fmt.Sprint("made-up-", i), "model:*")); !ok {
+			t.Fatalf("request %d for a new model was rejected", i)
+		}
+	}
+	// Once full, made-up models share a bucket but configured ones keep their own
+	if ok, _, _ := l.take(limit("another", "model:*")); !ok {
+		t.Error("the first request to the shared bucket was rejected")
+	}
+	if ok, _, _ := l.take(limit("yet-another", "model:*")); ok {
+		t.Error("the shared bucket admitted a second request")
+	}
+	if ok, _, _ := l.take(limit("configured", "")); !ok {
+		t.Error("a model with its own limit was rejected")
+	}
+	if got := len(l.buckets); got != maxRateLimitBuckets+2 {
+		t.Errorf("holding %d buckets, want %d", got, maxRateLimitBuckets+2)
+	}
+
+	// Refilled buckets are evicted
+	now = now.Add(time.Minute)
+	l.take(limit("configured", ""))
+	if got := len(l.buckets); got != 1 {
+		t.Errorf("holding %d buckets after they refilled, want 1", got)
+	}
+}
+
+func TestProxyRotatesUpstreamTokens(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(
+		modelstest.Response{Chunks: []string{"ok"}},
+		modelstest.Response{Status: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}, Body: `{"error":{"code":"RateLimitReached","message":"slow down"}}`},
+		modelstest.Response{Chunks: []string{"ok"}},
+		modelstest.Response{Chunks: []string{"ok"}},
+		modelstest.Response{Chunks: []string{"ok"}},
+		modelstest.Response{Chunks: []string{"ok"}},
+		modelstest.Response{Chunks: []string{"ok"}},
+	)
+	client := newTestClient(upstream)
+	pool := newTokenPool(nil, []string{"tok-a", "tok-b", "tok-c"})
+	now := time.Unix(0, 0)
+	pool.now = func() time.Time { return now }
+	client.client = pool.wrap(client.client)
+	proxy := httptest.NewServer(newProxyServer(client))
+	defer proxy.Close()
+
+	body := `{"model":"openai/gpt-4o-mini","messages":[{"role":"user","content":"hi"}]}`
+	for i := range 4 {
+		resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d = %d, want the rate limited token replaced", i+1, resp.StatusCode)
+		}
+	}
+	now = now.Add(30 * time.Second)
+	for range 2 {
+		resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	var got []string
+	for _, req := range upstream.Requests() {
+		got = append(got, strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+		if string(req.Body) != string(upstream.Requests()[0].Body) {
+			t.Errorf("a retried request sent %s, want %s", req.Body, upstream.Requests()[0].Body)
+		}
+	}
+	// tok-b is skipped while limited and back in turn once its limit resets
+	want := []string{"tok-a", "tok-b", "tok-c", "tok-a", "tok-c", "tok-a", "tok-b"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("upstream tokens = %v, want %v", got, want)
+	}
+}
+
+func TestProxyResponses(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(
+		modelstest.Response{Chunks: []string{"Hello", " there"}, Usage: &modelstest.Usage{PromptTokens: 4, CompletionTokens: 2, TotalTokens: 6}},
+		modelstest.Response{ToolCalls: []modelstest.ToolCall{{ID: "call_1", Name: "search", Arguments: `{"q":"go"}`}}},
+	)
+	proxy := newTestProxy(t, upstream)
+
+	post := func(body string) (int, []byte) {
+		t.Helper()
+		resp, err := http.Post(proxy.URL+"/v1/responses", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, data
+	}
+
+	status, data := post(`{"model":"openai/gpt-4o-mini","instructions":"Be brief.","input":"Hi"}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, data)
+	}
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "response" || !strings.HasPrefix(resp.ID, "resp_") || resp.Status != "completed" || resp.OutputText() != "Hello there" {
+		t.Errorf("response = %s", data)
+	}
+	if resp.Usage == nil || resp.Usage.InputTokens != 4 || resp.Usage.OutputTokens != 2 {
+		t.Errorf("usage = %+v, want the upstream usage", resp.Usage)
+	}
+	var sent ChatCompletionOptions
+	if err := json.Unmarshal(upstream.Requests()[0].Body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent.Messages) != 2 || sent.Messages[0].Role != ChatMessageRoleSystem || *sent.Messages[1].Content != "Hi" || !sent.Stream {
+		t.Errorf("upstream request = %s, want a streamed chat completion with the instructions and input", upstream.Requests()[0].Body)
+	}
+
+	status, data = post(`{"model":"openai/gpt-4o-mini","input":"Search","tools":[{"type":"function","name":"search"}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, data)
+	}
+	resp = Response{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Output) != 1 || resp.Output[0].Type != "function_call" || resp.Output[0].CallID != "call_1" || resp.Output[0].Arguments != `{"q":"go"}` {
+		t.Errorf("output = %+v, want the function call", resp.Output)
+	}
+
+	if status, data := post(`{"model":"openai/gpt-4o-mini","input":"Hi","previous_response_id":"resp_1"}`); status != http.StatusBadRequest || !strings.Contains(string(data), "previous_response_id") {
+		t.Errorf("a previous_response_id = %d: %s, want 400", status, data)
+	}
+	if got := len(upstream.Requests()); got != 2 {
+		t.Errorf("sent %d upstream requests, want 2", got)
+	}
+}
+
+func TestProxyStreamsResponses(t *testing.T) {
+	upstream := modelstest.NewServer(t)
+	upstream.Enqueue(
+		modelstest.Response{Chunks: []string{"Hel", "lo"}, Usage: &modelstest.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}},
+		modelstest.Response{Chunks: []string{"Partial"}, OmitDone: true},
+	)
+	proxy := newTestProxy(t, upstream)
+
+	events := func() []ResponseEvent {
+		t.Helper()
+		resp, err := http.Post(proxy.URL+"/v1/responses", "application/json", strings.NewReader(`{"model":"openai/gpt-4o-mini","input":"Hi","stream":true}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Errorf("Content-Type = %q, want an event stream", resp.Header.Get("Content-Type"))
+		}
+		reader := stream.NewEventReader[ResponseEvent](resp.Body)
+		defer reader.Close()
+		var events []ResponseEvent
+		for {
+			event, err := reader.Read()
+			if err != nil {
+				return events
+			}
+			events = append(events, event)
+		}
+	}
+
+	got := events()
+	var types []string
+	var text string
+	for i, event := range got {
+		types = append(types, event.Type)
+		text += event.Delta
+		if event.SequenceNumber != i {
+			t.Errorf("event %d has sequence number %d", i, event.SequenceNumber)
+		}
+	}
+	want := []string{"response.created", "response.output_item.added", "response.output_text.delta", "response.output_text.delta", "response.output_item.done", "response.completed"}
+	if strings.Join(types, " ") != strings.Join(want, " ") {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	completed := got[len(got)-1].Response
+	if text != "Hello" || completed.OutputText() != "Hello" || completed.Usage == nil || completed.Usage.OutputTokens != 2 {
+		t.Errorf("streamed %q and completed with %+v", text, completed)
+	}
+	if got[2].ItemID != completed.Output[0].ID || got[0].Response.ID != completed.ID {
+		t.Errorf("the events do not share the response and item ids: %+v", got)
+	}
+
+	// A stream cut short ends with an error event instead of response.completed
+	got = events()
+	if last := got[len(got)-1]; last.Type != "error" || last.Code != "incomplete_stream" {
+		t.Errorf("an incomplete stream ended with %+v, want an error event", last)
+	}
+}
+
+func TestProxyTranscriptions(t *testing.T) {
+	type upload struct{ auth, model, language, filename, audio string }
+	uploads := make(chan upload, 1)
+	client := newAudioTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audio, _ := io.ReadAll(file)
+		uploads <- upload{r.Header.Get("Authorization"), r.FormValue("model"), r.FormValue("language"), header.Filename, string(audio)}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"Hello"}`))
+	})
+	proxy := httptest.NewServer(newProxyServer(client))
+	t.Cleanup(proxy.Close)
+
+	tests := []struct {
+		name       string
+		fields     []string // name and value pairs, with "file" for the audio
+		wantStatus int
+		wantModel  string
+	}{
+		{name: "model first", fields: []string{"model", "openai/whisper-1", "language", "en", "file", ""}, wantStatus: http.StatusOK, wantModel: "openai/whisper-1"},
+		{name: "model after file", fields: []string{"file", "", "model", "openai/whisper-1"}, wantStatus: http.StatusOK, wantModel: "openai/whisper-1"},
+		{name: "no model", fields: []string{"file", ""}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body strings.Builder
+			form := multipart.NewWriter(&body)
+			for i := 0; i < len(tt.fields); i += 2 {
+				if tt.fields[i] == "file" {
+					part, _ := form.CreateFormFile("file", "hello.wav")
+					part.Write([]byte("RIFF audio"))
+					continue
+				}
+				form.WriteField(tt.fields[i], tt.fields[i+1])
+			}
+			form.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/audio/transcriptions", strings.NewReader(body.String()))
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			req.Header.Set("Authorization", "Bearer client-token")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, data)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(string(data), `"code":"missing_required_parameter"`) {
+					t.Errorf("body = %s, want an OpenAI-shaped error", data)
+				}
+				return
+			}
+			if string(data) != `{"text":"Hello"}` {
+				t.Errorf("body = %s", data)
+			}
+			got := <-uploads
+			want := upload{"Bearer test-token", tt.wantModel, "", "hello.wav", "RIFF audio"}
+			if tt.name == "model first" {
+				want.language = "en"
+			}
+			if got != want {
+				t.Errorf("upstream upload = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestProxyStreamsSpeech(t *testing.T) {
+	requests := make(chan string, 1)
+	next := make(chan struct{})
+	client := newAudioTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- string(body)
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte("ID3 first"))
+		w.(http.Flusher).Flush()
+		<-next
+		w.Write([]byte(" second"))
+	})
+	proxy := httptest.NewServer(newProxyServer(client))
+	t.Cleanup(proxy.Close)
+
+	resp, err := http.Post(proxy.URL+"/v1/audio/speech", "application/json",
+		strings.NewReader(`{"model":"openai/gpt-4o-mini-tts","input":"Hello","voice":"alloy"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "audio/mpeg" {
+		t.Fatalf("status = %d, content type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if got := <-requests; got != `{"input":"Hello","model":"openai/gpt-4o-mini-tts","voice":"alloy"}` {
+		t.Errorf("upstream request = %s", got)
+	}
+
+	// The first chunk arrives while upstream is still generating the rest
+	first := make([]byte, len("ID3 first"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil {
+		t.Fatal(err)
+	}
+	close(next)
+	rest, _ := io.ReadAll(resp.Body)
+	if got := string(first) + string(rest); got != "ID3 first second" {
+		t.Errorf("audio = %q", got)
+	}
+}
+
+func TestProxyModeration(t *testing.T) {
+	var forwarded atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/moderations" {
+			forwarded.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		var req ModerationOptions
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := ModerationResponse{Model: req.Model}
+		for _, input := range req.Input {
+			flagged := strings.Contains(input, "violence")
+			resp.Results = append(resp.Results, ModerationResult{Flagged: flagged, Categories: map[string]bool{"violence": flagged}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(upstream.Close)
+	cfg := NewDefaultAzureClientConfig()
+	cfg.InferenceURL = upstream.URL + "/chat"
+	cfg.EmbeddingsURL = upstream.URL + "/embeddings"
+	cfg.ModerationsURL = upstream.URL + "/moderations"
+
+	chat := func(content string) string {
+		return `{"model":"openai/gpt-4o-mini","messages":[{"role":"system","content":"violence is fine here"},{"role":"user","content":` + content + `}]}`
+	}
+	tests := []struct {
+		name          string
+		mode          string
+		path, body    string
+		wantStatus    int
+		wantHeader    string
+		wantForwarded bool
+	}{
+		{name: "off", mode: moderationOff, path: "/v1/chat/completions", body: chat(`"violence"`), wantStatus: http.StatusOK, wantForwarded: true},
+		{name: "block clean", mode: moderationBlock, path: "/v1/chat/completions", body: chat(`"hello"`), wantStatus: http.StatusOK, wantForwarded: true},
+		{name: "block flagged", mode: moderationBlock, path: "/v1/chat/completions", body: chat(`"violence"`), wantStatus: http.StatusBadRequest},
+		{name: "block flagged text part", mode: moderationBlock, path: "/v1/chat/completions", body: chat(`[{"type":"text","text":"violence"}]`), wantStatus: http.StatusBadRequest},
+		{name: "block flagged embeddings", mode: moderationBlock, path: "/v1/embeddings", body: `{"model":"openai/text-embedding-3-small","input":["hello","violence"]}`, wantStatus: http.StatusBadRequest},
+		{name: "flag flagged", mode: moderationFlag, path: "/v1/chat/completions", body: chat(`"violence"`), wantStatus: http.StatusOK, wantHeader: "violence", wantForwarded: true},
+		{name: "flag clean embeddings", mode: moderationFlag, path: "/v1/embeddings", body: `{"model":"openai/text-embedding-3-small","input":"hello"}`, wantStatus: http.StatusOK, wantForwarded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwarded.Store(0)
+			p := newProxyServer(NewAzureClient(upstream.Client(), "test-token", cfg))
+			p.moderate = tt.mode
+			proxy := httptest.NewServer(p)
+			defer proxy.Close()
+
+			resp, err := http.Post(proxy.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, data)
+			}
+			if got := resp.Header.Get(moderationHeader); got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", moderationHeader, got, tt.wantHeader)
+			}
+			if got := forwarded.Load() == 1; got != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v", got, tt.wantForwarded)
+			}
+			if tt.wantStatus == http.StatusBadRequest && !strings.Contains(string(data), `"code":"content_policy_violation"`) {
+				t.Errorf("body = %s, want an OpenAI-shaped error", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pooledToken is an upstream GitHub token and what its responses said about its
+// rate limits.
+type pooledToken struct {
+	// name identifies the token in logs without revealing it.
+	name  string
+	value string
+	// limitedUntil is when the token's rate limit resets, if it is limited.
+	limitedUntil time.Time
+}
+
+// tokenPool is an http.RoundTripper sending each request with one of several
+// upstream tokens, taking turns among those that are not rate limited. A request
+// rate limited upstream is sent again with the next available token, so clients
+// only see 429s once every token is limited.
+type tokenPool struct {
+	next http.RoundTripper
+	now  func() time.Time
+
+	mu     sync.Mutex
+	tokens []*pooledToken
+	turn   int
+}
+
+func newTokenPool(next http.RoundTripper, tokens []string) *tokenPool {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	p := &tokenPool{next: next, now: time.Now}
+	for i, value := range tokens {
+		p.tokens = append(p.tokens, &pooledToken{name: fmt.Sprintf("token %d", i+1), value: value})
+	}
+	return p
+}
+
+// wrap returns a copy of c sending its requests through the pool.
+func (p *tokenPool) wrap(c *http.Client) *http.Client {
+	wrapped := *c
+	if c.Transport != nil {
+		p.next = c.Transport
+	}
+	wrapped.Transport = p
+	return &wrapped
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *tokenPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	tried := map[*pooledToken]bool{}
+	for {
+		tok := p.pick(tried)
+		attempt := req.Clone(req.Context())
+		if len(tried) > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+		attempt.Header.Set("Authorization", "Bearer "+tok.value)
+		resp, err := p.next.RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+		p.observe(tok, resp)
+		tried[tok] = true
+		if resp.StatusCode != http.StatusTooManyRequests || !p.available(tried) ||
+			(req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// pick returns the next token not in tried that is not rate limited. When there is
+// none, it returns the token whose limit resets first, so that the request reaches
+// upstream and the client sees its rate limit headers.
+func (p *tokenPool) pick(tried map[*pooledToken]bool) *pooledToken {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for range p.tokens {
+		tok := p.tokens[p.turn]
+		p.turn = (p.turn + 1) % len(p.tokens)
+		if !tried[tok] && !tok.limitedUntil.After(now) {
+			return tok
+		}
+	}
+	soonest := p.tokens[0]
+	for _, tok := range p.tokens[1:] {
+		if tok.limitedUntil.Before(soonest.limitedUntil) {
+			soonest = tok
+		}
+	}
+	return soonest
+}
+
+// available reports whether a token not in tried is not rate limited.
+func (p *tokenPool) available(tried map[*pooledToken]bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for _, tok := range p.tokens {
+		if !tried[tok] && !tok.limitedUntil.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// observe records the rate limit state of tok from resp: limited until the reset
+// when upstream rejected the request or reports no requests remaining.
+func (p *tokenPool) observe(tok *pooledToken, resp *http.Response) {
+	exhausted := resp.Header.Get("x-ratelimit-remaining-requests") == "0" ||
+		resp.Header.Get("x-ratelimit-remaining-tokens") == "0"
+	if resp.StatusCode != http.StatusTooManyRequests && !exhausted {
+		return
+	}
+	now := p.now()
+	wait, ok := rateLimitReset(resp.Header, now)
+	if !ok {
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		wait = time.Minute
+	}
+	p.mu.Lock()
+	tok.limitedUntil = now.Add(wait)
+	p.mu.Unlock()
+	if len(p.tokens) > 1 {
+		log.Printf("proxy: upstream %s is rate limited for %s", tok.name, wait.Round(time.Second))
+	}
+}
+
+// loadUpstreamTokens returns the tokens listed in the file at path, one per line
+// with # comments, followed by those in GHMODELS_TOKENS, separated by commas or
+// whitespace. Duplicates are dropped.
+func loadUpstreamTokens(path string) ([]string, error) {
+	var tokens []string
+	seen := map[string]bool{}
+	add := func(tok string) {
+		if tok != "" && !seen[tok] {
+			seen[tok] = true
+			tokens = append(tokens, tok)
+		}
+	}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading upstream tokens: %w", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			add(strings.TrimSpace(line))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading upstream tokens: %w", err)
+		}
+	}
+	for _, tok := range strings.FieldsFunc(os.Getenv("GHMODELS_TOKENS"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}) {
+		add(tok)
+	}
+	return tokens, nil
+}
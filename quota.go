@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RateLimitStatus represents the rate limit state reported for a model.
+type RateLimitStatus struct {
+	Model string
+	// StatusCode is the status of the probe, 429 when the limit is already exhausted.
+	StatusCode int
+
+	LimitRequests     string
+	RemainingRequests string
+	LimitTokens       string
+	RemainingTokens   string
+	// ResetRequests and ResetTokens are zero when not advertised.
+	ResetRequests time.Duration
+	ResetTokens   time.Duration
+}
+
+// RateLimitStatus sends a one-token request for model and returns the rate limit
+// headers of the response. Unlike other requests, a rate limited probe is not retried.
+func (c *AzureClient) RateLimitStatus(ctx context.Context, model string) (*RateLimitStatus, error) {
+	prompt := "hi"
+	body, err := json.Marshal(struct {
+		ChatCompletionOptions
+		MaxTokens int `json:"max_tokens"`
+	}{
+		ChatCompletionOptions: ChatCompletionOptions{
+			Model:    model,
+			Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: &prompt}},
+		},
+		MaxTokens: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.InferenceURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(httpReq)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, c.handleHTTPError(resp)
+	}
+
+	h := resp.Header
+	status := &RateLimitStatus{
+		Model:             model,
+		StatusCode:        resp.StatusCode,
+		LimitRequests:     h.Get("x-ratelimit-limit-requests"),
+		RemainingRequests: h.Get("x-ratelimit-remaining-requests"),
+		LimitTokens:       h.Get("x-ratelimit-limit-tokens"),
+		RemainingTokens:   h.Get("x-ratelimit-remaining-tokens"),
+		ResetRequests:     parseResetHeader(h.Get("x-ratelimit-reset-requests")),
+		ResetTokens:       parseResetHeader(h.Get("x-ratelimit-reset-tokens")),
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := rateLimitReset(h, time.Now()); ok {
+			status.ResetRequests = max(status.ResetRequests, wait)
+		}
+	}
+	return status, nil
+}
+
+// parseResetHeader parses a reset header holding a duration such as "6m0s" or a number
+// of seconds.
+func parseResetHeader(v string) time.Duration {
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// quotaProbes picks one chat model per rate limit tier, since models of a tier share
+// their limits.
+func quotaProbes(models []*ModelSummary) []*ModelSummary {
+	byTier := map[string]*ModelSummary{}
+	for _, m := range models {
+		if m.RateLimitTier == "" || !containsFold(m.SupportedOutputModalities, "text") || strings.Contains(m.RateLimitTier, "embedding") {
+			continue
+		}
+		if _, ok := byTier[m.RateLimitTier]; !ok {
+			byTier[m.RateLimitTier] = m
+		}
+	}
+	probes := make([]*ModelSummary, 0, len(byTier))
+	for _, m := range byTier {
+		probes = append(probes, m)
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].RateLimitTier < probes[j].RateLimitTier })
+	return probes
+}
+
+// formatRemaining formats remaining out of limit, or "-" when neither is advertised.
+func formatRemaining(remaining, limit string) string {
+	switch {
+	case remaining == "" && limit == "":
+		return "-"
+	case limit == "":
+		return remaining
+	case remaining == "":
+		return "?/" + limit
+	}
+	return remaining + "/" + limit
+}
+
+// formatReset formats a reset duration, or "-" when it is not advertised.
+func formatReset(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
+
+// runQuota implements the `quota` subcommand.
+func runQuota(args []string) int {
+	fs := flag.NewFlagSet("quota", flag.ExitOnError)
+	models := fs.String("models", "", "Comma-separated models to check; defaults to one model per rate limit tier")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s quota [flags]\n\nEach checked model is sent a one-token request, which counts against its quota.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	ctx := context.TODO()
+	client := newCLIClient()
+	catalog, catalogErr := client.cachedCatalog(ctx)
+
+	var probes []*ModelSummary
+	if *models != "" {
+		for _, name := range splitList(*models) {
+			id := resolveModel(name)
+			m := findModel(catalog, id)
+			if m == nil {
+				m = &ModelSummary{ID: id}
+			}
+			probes = append(probes, m)
+		}
+	} else {
+		if catalogErr != nil {
+			fmt.Fprintf(os.Stderr, "listing models: %v\n", catalogErr)
+			return 1
+		}
+		probes = quotaProbes(catalog)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIER\tMODEL\tREQUESTS\tTOKENS\tREQUESTS RESET\tTOKENS RESET\t")
+	failed := false
+	for _, m := range probes {
+		status, err := client.RateLimitStatus(ctx, m.ID)
+		if err != nil {
+			tw.Flush()
+			fmt.Fprintf(os.Stderr, "%s: %v\n", m.ID, err)
+			failed = true
+			continue
+		}
+		tier := m.RateLimitTier
+		if tier == "" {
+			tier = "-"
+		}
+		requests := formatRemaining(status.RemainingRequests, status.LimitRequests)
+		if status.StatusCode == http.StatusTooManyRequests {
+			requests += " (limited)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\n", tier, m.ID, requests,
+			formatRemaining(status.RemainingTokens, status.LimitTokens),
+			formatReset(status.ResetRequests), formatReset(status.ResetTokens))
+	}
+	tw.Flush()
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestRateLimitStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		response modelstest.Response
+		want     RateLimitStatus
+		wantErr  bool
+	}{
+		{
+			name: "headers",
+			response: modelstest.Response{Chunks: []string{"h"}, Header: http.Header{
+				"X-Ratelimit-Limit-Requests":     {"150"},
+				"X-Ratelimit-Remaining-Requests": {"149"},
+				"X-Ratelimit-Limit-Tokens":       {"64000"},
+				"X-Ratelimit-Remaining-Tokens":   {"63990"},
+				"X-Ratelimit-Reset-Requests":     {"6m0s"},
+				"X-Ratelimit-Reset-Tokens":       {"1.5"},
+			}},
+			want: RateLimitStatus{
+				StatusCode:    http.StatusOK,
+				LimitRequests: "150", RemainingRequests: "149",
+				LimitTokens: "64000", RemainingTokens: "63990",
+				ResetRequests: 6 * time.Minute, ResetTokens: 1500 * time.Millisecond,
+			},
+		},
+		{
+			name:     "no headers",
+			response: modelstest.Response{Chunks: []string{"h"}},
+			want:     RateLimitStatus{StatusCode: http.StatusOK},
+		},
+		{
+			name: "exhausted",
+			response: modelstest.Response{Status: http.StatusTooManyRequests, Body: `{"error":{"code":"RateLimitReached"}}`, Header: http.Header{
+				"X-Ratelimit-Remaining-Requests": {"0"},
+				"Retry-After":                    {"120"},
+			}},
+			want: RateLimitStatus{StatusCode: http.StatusTooManyRequests, RemainingRequests: "0", ResetRequests: 2 * time.Minute},
+		},
+		{
+			name:     "unauthorized",
+			response: modelstest.Response{Status: http.StatusUnauthorized, Body: `{"error":{"code":"unauthorized","message":"bad token"}}`},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := modelstest.NewServer(t)
+			srv.Enqueue(tt.response)
+
+			got, err := newTestClient(srv).RateLimitStatus(context.Background(), "openai/gpt-4.1")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("RateLimitStatus() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Model = "openai/gpt-4.1"
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("RateLimitStatus() = %+v, want %+v", *got, tt.want)
+			}
+			requests := srv.Requests()
+			if len(requests) != 1 {
+				t.Errorf("sent %d requests, want one unretried probe", len(requests))
+			}
+			if body := string(requests[0].Body); !strings.Contains(body, `"max_tokens":1`) || strings.Contains(body, `"stream":true`) {
+				t.Errorf("probe %s is not a one-token request", body)
+			}
+		})
+	}
+}
+
+func TestParseResetHeader(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"6m0s", 6 * time.Minute},
+		{"1s", time.Second},
+		{"30", 30 * time.Second},
+		{"0.25", 250 * time.Millisecond},
+		{"", 0},
+		{"-5", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseResetHeader(tt.value); got != tt.want {
+				t.Errorf("parseResetHeader(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaProbes(t *testing.T) {
+	text := []string{"text"}
+	models := []*ModelSummary{
+		{ID: "openai/gpt-4.1", RateLimitTier: "high", SupportedOutputModalities: text},
+		{ID: "openai/gpt-4.1-mini", RateLimitTier: "low", SupportedOutputModalities: text},
+		{ID: "openai/gpt-4o", RateLimitTier: "high", SupportedOutputModalities: text},
+		{ID: "openai/text-embedding-3-small", RateLimitTier: "embeddings", SupportedOutputModalities: []string{"embeddings"}},
+		{ID: "cohere/embed-v3", RateLimitTier: "embedding-small", SupportedOutputModalities: text},
+		{ID: "openai/dall-e", RateLimitTier: "custom", SupportedOutputModalities: []string{"image"}},
+		{ID: "openai/o3", RateLimitTier: "custom", SupportedOutputModalities: text},
+		{ID: "untiered/model", SupportedOutputModalities: text},
+	}
+	var got []string
+	for _, m := range quotaProbes(models) {
+		got = append(got, m.ID)
+	}
+	if want := []string{"openai/o3", "openai/gpt-4.1", "openai/gpt-4.1-mini"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("quotaProbes() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatQuota(t *testing.T) {
+	remaining := []struct {
+		remaining, limit, want string
+	}{
+		{"", "", "-"},
+		{"9", "", "9"},
+		{"", "10", "?/10"},
+		{"9", "10", "9/10"},
+	}
+	for _, tt := range remaining {
+		if got := formatRemaining(tt.remaining, tt.limit); got != tt.want {
+			t.Errorf("formatRemaining(%q, %q) = %q, want %q", tt.remaining, tt.limit, got, tt.want)
+		}
+	}
+
+	resets := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "-"},
+		{-time.Second, "-"},
+		{1500 * time.Millisecond, "2s"},
+		{6 * time.Minute, "6m0s"},
+	}
+	for _, tt := range resets {
+		if got := formatReset(tt.d); got != tt.want {
+			t.Errorf("formatReset(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
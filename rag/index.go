@@ -0,0 +1,235 @@
+// Package rag builds local embedding indexes of documents and retrieves the chunks
+// most relevant to a query, for retrieval-augmented generation.
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultChunkLines   = 60
+	defaultChunkOverlap = 10
+	defaultBatchSize    = 64
+	defaultMaxFileBytes = 512 * 1024
+)
+
+// EmbedFunc returns one embedding per input, in order.
+type EmbedFunc func(ctx context.Context, inputs []string) ([][]float32, error)
+
+// Chunk represents a contiguous range of lines from an indexed file.
+type Chunk struct {
+	Path      string    `json:"path"`
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// Index represents a set of embedded chunks and the model that produced them.
+type Index struct {
+	Model  string  `json:"model"`
+	Root   string  `json:"root"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Result represents a chunk matched by a search with its cosine similarity.
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	// Model is the embedding model recorded in the index.
+	Model string
+	// ChunkLines is the number of lines per chunk. Defaults to 60.
+	ChunkLines int
+	// ChunkOverlap is the number of lines shared by consecutive chunks. Defaults to 10.
+	ChunkOverlap int
+	// BatchSize is the number of chunks embedded per call. Defaults to 64.
+	BatchSize int
+	// MaxFileBytes skips files larger than this. Defaults to 512KiB.
+	MaxFileBytes int64
+}
+
+// Build walks dir, splits each text file into chunks and embeds them. Hidden
+// directories and binary files are skipped.
+func Build(ctx context.Context, dir string, embed EmbedFunc, opts BuildOptions) (*Index, error) {
+	if opts.ChunkLines <= 0 {
+		opts.ChunkLines = defaultChunkLines
+	}
+	if opts.ChunkOverlap < 0 || opts.ChunkOverlap >= opts.ChunkLines {
+		opts.ChunkOverlap = defaultChunkOverlap
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = defaultMaxFileBytes
+	}
+
+	index := &Index{Model: opts.Model, Root: dir}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > opts.MaxFileBytes {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		index.Chunks = append(index.Chunks, chunkLines(rel, string(data), opts.ChunkLines, opts.ChunkOverlap)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(index.Chunks); start += opts.BatchSize {
+		end := min(start+opts.BatchSize, len(index.Chunks))
+
+		inputs := make([]string, 0, end-start)
+		for _, c := range index.Chunks[start:end] {
+			inputs = append(inputs, c.Path+"\n"+c.Text)
+		}
+
+		embeddings, err := embed(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+		if len(embeddings) != len(inputs) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(inputs), len(embeddings))
+		}
+		for i, e := range embeddings {
+			index.Chunks[start+i].Embedding = e
+		}
+	}
+
+	return index, nil
+}
+
+// chunkLines splits text into overlapping chunks of size lines.
+func chunkLines(path, text string, size, overlap int) []Chunk {
+	lines := strings.Split(text, "\n")
+	var chunks []Chunk
+	for start := 0; start < len(lines); start += size - overlap {
+		end := min(start+size, len(lines))
+		body := strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+		if body != "" {
+			chunks = append(chunks, Chunk{Path: path, StartLine: start + 1, EndLine: end, Text: body})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+// Save writes the index to path as JSON.
+func (idx *Index) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Load reads an index written by Save.
+func Load(path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", path, err)
+	}
+	if len(idx.Chunks) == 0 {
+		return nil, errors.New("index is empty")
+	}
+	return &idx, nil
+}
+
+// Search returns the k chunks most similar to the query embedding.
+func (idx *Index) Search(query []float32, k int) []Result {
+	results := make([]Result, 0, len(idx.Chunks))
+	for _, c := range idx.Chunks {
+		results = append(results, Result{Chunk: c, Score: cosine(query, c.Embedding)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if k < len(results) {
+		results = results[:k]
+	}
+	return results
+}
+
+// Augment prefixes a prompt with the retrieved chunks as context.
+func Augment(prompt string, results []Result) string {
+	if len(results) == 0 {
+		return prompt
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("Use the following context to answer the question. Cite file paths when relevant.\n\n")
+	for _, r := range results {
+		fmt.Fprintf(&sb, "--- %s:%d-%d ---\n%s\n\n", r.Path, r.StartLine, r.EndLine, r.Text)
+	}
+	sb.WriteString("Question: ")
+	sb.WriteString(prompt)
+	return sb.String()
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
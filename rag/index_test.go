@@ -0,0 +1,145 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChunkLines(t *testing.T) {
+	text := "1\n2\n3\n4\n5\n6\n7"
+	var got []string
+	for _, c := range chunkLines("f.txt", text, 3, 1) {
+		got = append(got, fmt.Sprintf("%d-%d:%s", c.StartLine, c.EndLine, strings.ReplaceAll(c.Text, "\n", ",")))
+	}
+	if want := "1-3:1,2,3 3-5:3,4,5 5-7:5,6,7"; strings.Join(got, " ") != want {
+		t.Errorf("chunks = %v, want %s", got, want)
+	}
+
+	if chunks := chunkLines("f.txt", "a\n\n\n\n\n\nb", 2, 0); len(chunks) != 2 || chunks[0].Text != "a" || chunks[1].StartLine != 7 {
+		t.Errorf("chunks of text with blank lines = %+v, want the two non-blank chunks", chunks)
+	}
+	if chunks := chunkLines("f.txt", "  \n", 60, 10); len(chunks) != 0 {
+		t.Errorf("chunks of blank text = %+v", chunks)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.go":          "package a\n\nfunc A() {}\n",
+		"docs/b.md":     "# B\nline 2\nline 3\nline 4\n",
+		".git/config":   "[core]\n",
+		"bin/tool":      "ELF\x00\x01",
+		"invalid.txt":   "\xff\xfe",
+		"big/large.txt": strings.Repeat("x", 100),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var batches [][]string
+	embed := func(_ context.Context, inputs []string) ([][]float32, error) {
+		batches = append(batches, inputs)
+		out := make([][]float32, len(inputs))
+		for i := range inputs {
+			out[i] = []float32{float32(len(inputs[i])), 1}
+		}
+		return out, nil
+	}
+	idx, err := Build(context.Background(), dir, embed, BuildOptions{Model: "m", ChunkLines: 2, ChunkOverlap: 0, BatchSize: 2, MaxFileBytes: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, c := range idx.Chunks {
+		paths = append(paths, fmt.Sprintf("%s:%d", c.Path, c.StartLine))
+		if len(c.Embedding) != 2 {
+			t.Errorf("chunk %s:%d has embedding %v", c.Path, c.StartLine, c.Embedding)
+		}
+	}
+	// Hidden directories, binary, invalid UTF-8 and oversized files are skipped
+	if want := "a.go:1 a.go:3 docs/b.md:1 docs/b.md:3"; strings.Join(paths, " ") != filepath.FromSlash(want) {
+		t.Errorf("chunks = %v, want %s", paths, want)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || batches[0][0] != "a.go\npackage a" {
+		t.Errorf("embedded batches = %q, want two of two inputs prefixed with the path", batches)
+	}
+
+	short := func(_ context.Context, inputs []string) ([][]float32, error) { return nil, nil }
+	if _, err := Build(context.Background(), dir, short, BuildOptions{}); err == nil {
+		t.Error("Build with too few embeddings succeeded")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := &Index{Chunks: []Chunk{
+		{Path: "orthogonal", Embedding: []float32{0, 1}},
+		{Path: "same", Embedding: []float32{2, 0}},
+		{Path: "close", Embedding: []float32{1, 1}},
+		{Path: "opposite", Embedding: []float32{-1, 0}},
+		{Path: "wrong dimensions", Embedding: []float32{1, 0, 0}},
+	}}
+
+	var got []string
+	for _, r := range idx.Search([]float32{1, 0}, 3) {
+		got = append(got, fmt.Sprintf("%s=%.2f", r.Path, r.Score))
+	}
+	if want := "same=1.00 close=0.71 orthogonal=0.00"; strings.Join(got, " ") != want {
+		t.Errorf("Search = %v, want %s", got, want)
+	}
+	if results := idx.Search([]float32{1, 0}, 10); len(results) != len(idx.Chunks) || results[len(results)-1].Path != "opposite" {
+		t.Errorf("Search of more than the index = %+v, want every chunk ending with the opposite one", results)
+	}
+	if score := cosine([]float32{0, 0}, []float32{1, 0}); score != 0 {
+		t.Errorf("cosine of a zero vector = %v", score)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	idx := &Index{Model: "m", Root: "src", Chunks: []Chunk{{Path: "a.go", StartLine: 1, EndLine: 2, Text: "x", Embedding: []float32{0.5}}}}
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(loaded) != fmt.Sprint(idx) {
+		t.Errorf("Load = %+v, want %+v", loaded, idx)
+	}
+
+	if err := (&Index{Model: "m"}).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("loading an empty index succeeded")
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "invalid index") {
+		t.Errorf("loading invalid JSON = %v", err)
+	}
+}
+
+func TestAugment(t *testing.T) {
+	if got := Augment("why?", nil); got != "why?" {
+		t.Errorf("Augment without results = %q", got)
+	}
+	got := Augment("why?", []Result{{Chunk: Chunk{Path: "a.go", StartLine: 3, EndLine: 4, Text: "func A() {}"}}})
+	want := "Use the following context to answer the question. Cite file paths when relevant.\n\n--- a.go:3-4 ---\nfunc A() {}\n\nQuestion: why?"
+	if got != want {
+		t.Errorf("Augment =\n%s\nwant\n%s", got, want)
+	}
+}
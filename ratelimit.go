@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitError is returned when a request is rate limited and waiting for the reset
+// would exceed the context deadline or the retry policy's MaxWait.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited: the limit resets in %v, later than the request may wait", e.RetryAfter.Round(time.Second))
+}
+
+// WithRateLimitWait sets a function called about once a second with the remaining time
+// while the client waits for a rate limit to reset.
+func (c *AzureClient) WithRateLimitWait(fn func(remaining time.Duration)) *AzureClient {
+	c.onRateLimitWait = fn
+	return c
+}
+
+// postJSON posts body as JSON to url. Rate limited requests are retried according to
+// the client's retry policy, as long as the wait falls within the context deadline.
+// Transient server errors are retried only for idempotent requests, as the server
+// may have acted on a request that failed.
+func (c *AzureClient) postJSON(ctx context.Context, url string, body any, idempotent bool) (*http.Response, error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := c.retryPolicy()
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		c.setHeaders(httpReq)
+
+		resp, err := c.client.Do(httpReq)
+		if err != nil {
+			return nil, err
+		}
+
+		rateLimited := resp.StatusCode == http.StatusTooManyRequests
+		if !(rateLimited || idempotent && isTransientStatus(resp.StatusCode)) || attempt >= policy.MaxAttempts {
+			return resp, nil
+		}
+
+		wait, ok := rateLimitReset(resp.Header, time.Now())
+		if !ok {
+			wait = policy.backoff(attempt - 1)
+		}
+		tooLong := policy.MaxWait > 0 && wait > policy.MaxWait
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			tooLong = true
+		}
+		if tooLong {
+			if !rateLimited {
+				return resp, nil
+			}
+			resp.Body.Close()
+			return nil, &RateLimitError{RetryAfter: wait}
+		}
+		resp.Body.Close()
+
+		if rateLimited {
+			err = c.waitForReset(ctx, wait)
+		} else if !sleep(ctx, wait) {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForReset sleeps for wait, reporting progress to the rate limit wait callback.
+func (c *AzureClient) waitForReset(ctx context.Context, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		if c.onRateLimitWait != nil {
+			c.onRateLimitWait(remaining)
+		}
+
+		timer := time.NewTimer(min(remaining, time.Second))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// rateLimitReset returns how long to wait for a rate limit to reset according to the
+// response headers. Retry-After takes precedence over the x-ratelimit-reset family.
+func rateLimitReset(h http.Header, now time.Time) (time.Duration, bool) {
+	if ms := h.Get("retry-after-ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n >= 0 {
+			return time.Duration(n * float64(time.Millisecond)), true
+		}
+	}
+
+	if v := h.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+
+	// OpenAI-style headers hold durations such as "1s" or "6m0s" for each limit
+	var wait time.Duration
+	found := false
+	for _, name := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		if d, err := time.ParseDuration(h.Get(name)); err == nil {
+			wait = max(wait, d)
+			found = true
+		}
+	}
+	if found {
+		return wait, true
+	}
+
+	// GitHub-style header holds the reset time as Unix seconds
+	if v := h.Get("x-ratelimit-reset"); v != "" {
+		if epoch, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return max(time.Unix(epoch, 0).Sub(now), 0), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{"none", http.Header{}, 0, false},
+		{"retry-after-ms", http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"9"}}, 1500 * time.Millisecond, true},
+		{"retry-after seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second, true},
+		{"retry-after date", http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, 90 * time.Second, true},
+		{"retry-after in the past", http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0, true},
+		{"openai durations", http.Header{"X-Ratelimit-Reset-Requests": {"1s"}, "X-Ratelimit-Reset-Tokens": {"6m0s"}}, 6 * time.Minute, true},
+		{"github epoch", http.Header{"X-Ratelimit-Reset": {strconv.FormatInt(now.Add(30*time.Second).Unix(), 10)}}, 30 * time.Second, true},
+		{"invalid", http.Header{"Retry-After": {"soon"}}, 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rateLimitReset(tt.header, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("rateLimitReset = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPostJSONRateLimit(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		header   http.Header
+		requests int32
+		wantErr  bool
+	}{
+		{"waits out a short reset", http.Header{"Retry-After-Ms": {"10"}}, 2, false},
+		{"fails fast on a reset an hour away", http.Header{"Retry-After": {"3600"}}, 1, true},
+		{"fails fast on a far future epoch", http.Header{"X-Ratelimit-Reset": {strconv.FormatInt(time.Now().Add(6*time.Hour).Unix(), 10)}}, 1, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					for name, values := range tt.header {
+						w.Header()[name] = values
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte("{}"))
+			}))
+			defer srv.Close()
+			client := NewAzureClient(srv.Client(), "test-token", NewDefaultAzureClientConfig())
+
+			start := time.Now()
+			resp, err := client.postJSON(context.Background(), srv.URL, map[string]string{}, false)
+			if err == nil {
+				resp.Body.Close()
+			}
+			var rateLimitErr *RateLimitError
+			if tt.wantErr && (!errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter < time.Hour) {
+				t.Errorf("err = %v, want a *RateLimitError at least an hour away", err)
+			}
+			if !tt.wantErr && (err != nil || resp.StatusCode != http.StatusOK) {
+				t.Errorf("postJSON = %v, want the retried response", err)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("sent %d requests, want %d", got, tt.requests)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestPostJSONRetriesServerErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		status     int
+		idempotent bool
+		requests   int32
+	}{
+		{"retries an idempotent request on 502", http.StatusBadGateway, true, 2},
+		{"does not repeat other requests on 502", http.StatusBadGateway, false, 1},
+		{"retries any request on 429", http.StatusTooManyRequests, false, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Write([]byte("{}"))
+			}))
+			defer srv.Close()
+			client := NewAzureClient(srv.Client(), "test-token", NewDefaultAzureClientConfig()).
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+			resp, err := client.postJSON(context.Background(), srv.URL, map[string]string{}, tt.idempotent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("sent %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// oSeriesModelPattern matches OpenAI o-series reasoning models such as o1, o3-mini and o4-mini.
+var oSeriesModelPattern = regexp.MustCompile(`^o\d`)
+
+// validReasoningEffort reports whether effort is a supported reasoning_effort value.
+func validReasoningEffort(effort string) bool {
+	switch effort {
+	case "low", "medium", "high":
+		return true
+	default:
+		return false
+	}
+}
+
+// usesDeveloperRole reports whether model expects developer messages in place of system messages.
+func usesDeveloperRole(model string) bool {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return oSeriesModelPattern.MatchString(name)
+}
+
+// mapDeveloperRole returns messages with system messages sent as developer messages
+// when model expects them. The input slice is not modified.
+func mapDeveloperRole(model string, messages []ChatMessage) []ChatMessage {
+	if !usesDeveloperRole(model) {
+		return messages
+	}
+
+	mapped := make([]ChatMessage, len(messages))
+	for i, m := range messages {
+		if m.Role == ChatMessageRoleSystem {
+			m.Role = ChatMessageRoleDeveloper
+		}
+		mapped[i] = m
+	}
+	return mapped
+}
+
+// usesMaxCompletionTokens reports whether model limits output with
+// max_completion_tokens, which reasoning models take in place of max_tokens.
+func usesMaxCompletionTokens(model string) bool {
+	return usesDeveloperRole(model)
+}
+
+// mapMaxTokens returns req with MaxTokens sent as max_completion_tokens when the
+// model expects it.
+func mapMaxTokens(req ChatCompletionOptions) ChatCompletionOptions {
+	if req.MaxTokens != nil && usesMaxCompletionTokens(req.Model) {
+		req.MaxCompletionTokens, req.MaxTokens = req.MaxTokens, nil
+	}
+	return req
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestValidReasoningEffort(t *testing.T) {
+	for effort, want := range map[string]bool{"low": true, "medium": true, "high": true, "": false, "max": false, "HIGH": false} {
+		if got := validReasoningEffort(effort); got != want {
+			t.Errorf("validReasoningEffort(%q) = %v, want %v", effort, got, want)
+		}
+	}
+}
+
+func TestUsesDeveloperRole(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"openai/o1", true},
+		{"openai/o3-mini", true},
+		{"OpenAI/O4-mini", true},
+		{"o1-preview", true},
+		{"openai/gpt-4o", false},
+		{"openai/gpt-4.1", false},
+		{"meta/llama-3.3-70b-instruct", false},
+		{"openai/omni-moderation-latest", false},
+	}
+	for _, tt := range tests {
+		if got := usesDeveloperRole(tt.model); got != tt.want {
+			t.Errorf("usesDeveloperRole(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+		if got := usesMaxCompletionTokens(tt.model); got != tt.want {
+			t.Errorf("usesMaxCompletionTokens(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestMapDeveloperRole(t *testing.T) {
+	system, user := "be brief", "hi"
+	messages := []ChatMessage{
+		{Role: ChatMessageRoleSystem, Content: &system},
+		{Role: ChatMessageRoleUser, Content: &user},
+	}
+	tests := []struct {
+		model string
+		want  []ChatMessageRole
+	}{
+		{"openai/o3-mini", []ChatMessageRole{ChatMessageRoleDeveloper, ChatMessageRoleUser}},
+		{"openai/gpt-4o", []ChatMessageRole{ChatMessageRoleSystem, ChatMessageRoleUser}},
+	}
+	for _, tt := range tests {
+		var roles []ChatMessageRole
+		for _, m := range mapDeveloperRole(tt.model, messages) {
+			roles = append(roles, m.Role)
+		}
+		if !reflect.DeepEqual(roles, tt.want) {
+			t.Errorf("mapDeveloperRole(%q) roles = %v, want %v", tt.model, roles, tt.want)
+		}
+	}
+	if messages[0].Role != ChatMessageRoleSystem {
+		t.Error("mapDeveloperRole modified its input")
+	}
+}
+
+func TestMapMaxTokens(t *testing.T) {
+	limit := 100
+	tests := []struct {
+		name                string
+		model               string
+		maxTokens           *int
+		wantMaxTokens       *int
+		wantCompletionLimit *int
+	}{
+		{name: "reasoning model", model: "openai/o3-mini", maxTokens: &limit, wantCompletionLimit: &limit},
+		{name: "chat model", model: "openai/gpt-4o", maxTokens: &limit, wantMaxTokens: &limit},
+		{name: "no limit", model: "openai/o3-mini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapMaxTokens(ChatCompletionOptions{Model: tt.model, MaxTokens: tt.maxTokens})
+			if got.MaxTokens != tt.wantMaxTokens || got.MaxCompletionTokens != tt.wantCompletionLimit {
+				t.Errorf("mapMaxTokens = max_tokens %v, max_completion_tokens %v", got.MaxTokens, got.MaxCompletionTokens)
+			}
+		})
+	}
+}
+
+func TestReasoningRequest(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"ok"}})
+	system, limit := "be brief", 50
+	req := testRequest("hi")
+	req.Model = "openai/o3-mini"
+	req.Messages = append([]ChatMessage{{Role: ChatMessageRoleSystem, Content: &system}}, req.Messages...)
+	req.MaxTokens = &limit
+	req.ReasoningEffort = "high"
+	if _, err := newTestClient(srv).streamCompletion(context.Background(), req, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent struct {
+		ReasoningEffort     string        `json:"reasoning_effort"`
+		MaxTokens           *int          `json:"max_tokens"`
+		MaxCompletionTokens int           `json:"max_completion_tokens"`
+		Messages            []ChatMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(srv.Requests()[0].Body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.ReasoningEffort != "high" || sent.MaxTokens != nil || sent.MaxCompletionTokens != limit || sent.Messages[0].Role != ChatMessageRoleDeveloper {
+		t.Errorf("sent %+v, want reasoning_effort, max_completion_tokens and a developer message", sent)
+	}
+}
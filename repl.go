@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/abatilo/ghmodelsproxy/conversation"
+)
+
+const replHelp = `Commands:
+  /system [prompt]      Show the system prompt, or replace it
+  /model [name]         Show the model of the tab, or change it
+  /temperature [value]  Show the temperature of the tab, or change it
+  /reset                Forget the conversation, keeping the system prompt
+  /tab <name> [model]   Switch to a tab, opening it if needed with the system prompt and options of this one
+  /tabs                 List the tabs
+  /close                Close this tab, stopping its response
+  /exit                 Leave (or press Ctrl-D)
+Responses keep streaming in background tabs and are shown when you switch to them.
+Lines typed while a response streams run after it, except /tab and /tabs.
+Ctrl-C stops the response being generated, or leaves if there is none.`
+
+// repl is an interactive chat that keeps the conversation across turns and resends
+// the full history with each one. Conversations are held in tabs, which stream
+// independently.
+type repl struct {
+	client *AzureClient
+	// req, conv and session are those of the first tab; req holds the options of
+	// every turn, and its messages are replaced by the history.
+	req    ChatCompletionOptions
+	conv   *conversation.Conversation
+	colors palette
+	// session, if set, is where the first tab's conversation is saved after every
+	// change.
+	session string
+
+	in  *bufio.Scanner
+	out io.Writer
+
+	tabs []*replTab
+	// mu guards tab and the output of background tabs, which turns write to.
+	mu  sync.Mutex
+	tab *replTab
+	// done receives the turns that finished, of which running are still streaming,
+	// including those of closed tabs.
+	done    chan turnResult
+	running int
+}
+
+// replTab is one conversation of the chat.
+type replTab struct {
+	name    string
+	req     ChatCompletionOptions
+	conv    *conversation.Conversation
+	session string
+	out     *tabWriter
+
+	// cancel stops the response being streamed, and is nil if there is none.
+	cancel context.CancelFunc
+	// queued holds the lines entered while the tab was streaming.
+	queued []string
+}
+
+// tabWriter writes the output of a tab to the terminal while it is in the
+// foreground, and keeps it for when it is switched to otherwise.
+type tabWriter struct {
+	r      *repl
+	tab    *replTab
+	unseen bytes.Buffer
+}
+
+func (w *tabWriter) Write(p []byte) (int, error) {
+	w.r.mu.Lock()
+	defer w.r.mu.Unlock()
+	if w.r.tab == w.tab {
+		return w.r.out.Write(p)
+	}
+	return w.unseen.Write(p)
+}
+
+// turnResult is the outcome of the turn of a tab.
+type turnResult struct {
+	tab *replTab
+	msg ChatMessage
+	err error
+	// interrupted reports whether the turn was stopped rather than failing.
+	interrupted bool
+}
+
+// run reads prompts until /exit or the end of input. A pending user message in the
+// conversation, such as a prompt given on the command line, is answered first. At
+// the end of input, run returns once every tab has finished.
+func (r *repl) run() error {
+	r.done = make(chan turnResult)
+	r.tabs = nil
+	r.tab = r.newTab("main", r.req, r.conv, r.session)
+	fmt.Fprintln(r.out, "Chatting with "+r.req.Model+". Type /help for commands.")
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	defer r.stopAll()
+
+	lines := make(chan string)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(lines)
+		for r.in.Scan() {
+			select {
+			case lines <- r.in.Text():
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	if n := len(r.conv.Messages); n > 0 && r.conv.Messages[n-1].Role == ChatMessageRoleUser {
+		r.startTurn(r.tab)
+	} else {
+		r.prompt()
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil
+				fmt.Fprintln(r.tab.out)
+				if r.idle() {
+					return r.in.Err()
+				}
+				continue
+			}
+			if exit := r.enter(strings.TrimSpace(line)); exit {
+				return nil
+			}
+		case result := <-r.done:
+			r.finishTurn(result)
+			if exit := r.runQueued(result.tab); exit {
+				return nil
+			}
+			if lines == nil && r.idle() {
+				return r.in.Err()
+			}
+		case <-interrupts:
+			if r.tab.cancel == nil {
+				fmt.Fprintln(r.tab.out)
+				return nil
+			}
+			r.tab.cancel()
+		}
+	}
+}
+
+func (r *repl) newTab(name string, req ChatCompletionOptions, conv *conversation.Conversation, session string) *replTab {
+	tab := &replTab{name: name, req: req, conv: conv, session: session}
+	tab.out = &tabWriter{r: r, tab: tab}
+	r.tabs = append(r.tabs, tab)
+	return tab
+}
+
+// enter handles a line entered in the foreground tab, returning true to leave.
+func (r *repl) enter(line string) bool {
+	if line == "" {
+		if r.tab.cancel == nil {
+			r.prompt()
+		}
+		return false
+	}
+	if command, arg, isCommand := parseREPLCommand(line); isCommand {
+		switch command {
+		case "/tab":
+			r.switchTab(arg)
+			return false
+		case "/tabs":
+			r.listTabs()
+			if r.tab.cancel == nil {
+				r.prompt()
+			}
+			return false
+		}
+	}
+	if r.tab.cancel != nil {
+		r.tab.queued = append(r.tab.queued, line)
+		return false
+	}
+	exit := r.execute(r.tab, line)
+	if !exit && r.tab.cancel == nil {
+		r.prompt()
+	}
+	return exit
+}
+
+// execute runs a command or sends a prompt in tab, returning true to leave.
+func (r *repl) execute(tab *replTab, line string) bool {
+	command, arg, isCommand := parseREPLCommand(line)
+	if !isCommand {
+		tab.conv.AddMessage(ChatMessageRoleUser, line)
+		r.startTurn(tab)
+		return false
+	}
+
+	switch command {
+	case "/exit", "/quit":
+		return true
+	case "/reset":
+		tab.conv.Messages = nil
+		tab.conv.Prefill = ""
+		r.save(tab)
+		fmt.Fprintln(tab.out, "Conversation cleared.")
+	case "/system":
+		if arg == "" {
+			fmt.Fprintln(tab.out, tab.conv.SystemPrompt)
+		} else {
+			tab.conv.SystemPrompt = arg
+			r.save(tab)
+			fmt.Fprintln(tab.out, "System prompt updated.")
+		}
+	case "/model":
+		if arg != "" {
+			tab.req.Model = resolveModel(arg)
+		}
+		fmt.Fprintln(tab.out, tab.req.Model)
+	case "/temperature":
+		if arg != "" {
+			temperature, err := strconv.ParseFloat(arg, 64)
+			if err != nil || temperature < 0 || temperature > 2 {
+				fmt.Fprintln(tab.out, "The temperature must be a number from 0 to 2.")
+				break
+			}
+			tab.req.Temperature = &temperature
+		}
+		if tab.req.Temperature == nil {
+			fmt.Fprintln(tab.out, "default")
+		} else {
+			fmt.Fprintln(tab.out, strconv.FormatFloat(*tab.req.Temperature, 'g', -1, 64))
+		}
+	case "/close":
+		r.closeTab(tab)
+	case "/help":
+		fmt.Fprintln(tab.out, replHelp)
+	default:
+		fmt.Fprintf(tab.out, "Unknown command %s. Type /help for commands.\n", command)
+	}
+	return false
+}
+
+// runQueued runs the lines entered in tab while it was streaming, until one of them
+// starts another turn. It returns true to leave.
+func (r *repl) runQueued(tab *replTab) bool {
+	foreground := tab == r.tab
+	for len(tab.queued) > 0 && tab.cancel == nil {
+		line := tab.queued[0]
+		tab.queued = tab.queued[1:]
+		if r.execute(tab, line) {
+			return true
+		}
+	}
+	if foreground && r.tab.cancel == nil {
+		r.prompt()
+	}
+	return false
+}
+
+// switchTab brings the tab named in arg to the foreground, opening it if there is
+// none with the system prompt and options of the current tab and the model, if
+// given, in arg.
+func (r *repl) switchTab(arg string) {
+	name, model, _ := strings.Cut(arg, " ")
+	model = strings.TrimSpace(model)
+	if name == "" {
+		fmt.Fprintln(r.tab.out, "Usage: /tab <name> [model]")
+		if r.tab.cancel == nil {
+			r.prompt()
+		}
+		return
+	}
+
+	var tab *replTab
+	for _, t := range r.tabs {
+		if t.name == name {
+			tab = t
+		}
+	}
+	if tab == nil {
+		req := r.tab.req
+		req.Messages = nil
+		tab = r.newTab(name, req, &conversation.Conversation{SystemPrompt: r.tab.conv.SystemPrompt}, "")
+	}
+	if model != "" {
+		tab.req.Model = resolveModel(model)
+	}
+
+	r.show(tab)
+	if tab.cancel == nil {
+		r.prompt()
+	}
+}
+
+// show brings tab to the foreground, printing what it streamed in the background.
+func (r *repl) show(tab *replTab) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tab = tab
+	fmt.Fprintln(r.out, r.colors.paint(r.colors.theme.Warning, fmt.Sprintf("--- %s (%s) ---", tab.name, tab.req.Model)))
+	_, _ = tab.out.unseen.WriteTo(r.out)
+}
+
+// listTabs prints the tabs with their model and state.
+func (r *repl) listTabs() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tab := range r.tabs {
+		marker := " "
+		if tab == r.tab {
+			marker = "*"
+		}
+		var state []string
+		if tab.cancel != nil {
+			state = append(state, "streaming")
+		}
+		if tab.out.unseen.Len() > 0 {
+			state = append(state, "new output")
+		}
+		line := fmt.Sprintf("%s %s\t%s", marker, tab.name, tab.req.Model)
+		if len(state) > 0 {
+			line += "\t(" + strings.Join(state, ", ") + ")"
+		}
+		fmt.Fprintln(r.out, line)
+	}
+}
+
+// closeTab stops and removes tab, switching to the previous tab if it was in the
+// foreground. The last tab cannot be closed.
+func (r *repl) closeTab(tab *replTab) {
+	if len(r.tabs) == 1 {
+		fmt.Fprintln(tab.out, "This is the only tab; use /exit to leave.")
+		return
+	}
+	if tab.cancel != nil {
+		tab.cancel()
+	}
+	tab.queued = nil
+	i := 0
+	for i < len(r.tabs) && r.tabs[i] != tab {
+		i++
+	}
+	r.tabs = append(r.tabs[:i], r.tabs[i+1:]...)
+	if r.tab == tab {
+		r.show(r.tabs[max(i-1, 0)])
+	}
+}
+
+// startTurn sends the history of tab and streams the response in the background,
+// reporting the outcome on r.done.
+func (r *repl) startTurn(tab *replTab) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tab.cancel = cancel
+	r.running++
+
+	var display io.Writer = tab.out
+	var code *codeHighlighter
+	if r.colors.enabled {
+		code = newCodeHighlighter(tab.out, r.colors.theme.Code)
+		display = code
+	}
+	if tab.conv.Prefill != "" {
+		fmt.Fprint(display, tab.conv.Prefill)
+	}
+
+	req := tab.req
+	req.Messages = tab.conv.GetMessages()
+	go func() {
+		msg, err := r.client.streamCompletion(ctx, req, display)
+		if code != nil {
+			_ = code.Flush()
+		}
+		fmt.Fprintln(tab.out)
+		r.done <- turnResult{tab: tab, msg: msg, err: err, interrupted: ctx.Err() != nil}
+	}()
+}
+
+// finishTurn records the response of a turn. A failed turn is forgotten, so the
+// prompt can be sent again; an interrupted one keeps what was received.
+func (r *repl) finishTurn(result turnResult) {
+	tab := result.tab
+	tab.cancel()
+	tab.cancel = nil
+	r.running--
+
+	content := ""
+	if result.msg.Content != nil {
+		content = *result.msg.Content
+	}
+	switch {
+	case result.err == nil:
+	case result.interrupted && content != "":
+		fmt.Fprintln(tab.out, r.colors.paint(r.colors.theme.Warning, "(interrupted)"))
+	default:
+		if !result.interrupted {
+			message := "error: " + result.err.Error()
+			if len(r.tabs) > 1 {
+				message = tab.name + ": " + message
+			}
+			fmt.Fprintln(os.Stderr, r.colors.paint(r.colors.theme.Error, message))
+		}
+		tab.conv.Messages = tab.conv.Messages[:len(tab.conv.Messages)-1]
+		return
+	}
+
+	if tab.conv.Prefill != "" {
+		tab.conv.CompletePrefill(content)
+	} else {
+		tab.conv.AddMessage(ChatMessageRoleAssistant, content)
+	}
+	r.save(tab)
+}
+
+// idle reports whether no tab is streaming or has lines waiting.
+func (r *repl) idle() bool {
+	if r.running > 0 {
+		return false
+	}
+	for _, tab := range r.tabs {
+		if len(tab.queued) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// stopAll stops the responses of every tab and waits for them to end.
+func (r *repl) stopAll() {
+	for _, tab := range r.tabs {
+		if tab.cancel != nil {
+			tab.cancel()
+		}
+	}
+	for r.running > 0 {
+		r.finishTurn(<-r.done)
+	}
+}
+
+// prompt shows that the foreground tab is waiting for input.
+func (r *repl) prompt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprint(r.out, r.colors.paint(r.colors.theme.User, ">>> "))
+}
+
+// parseREPLCommand splits a line such as "/system be brief" into its command and
+// argument.
+func parseREPLCommand(line string) (command, arg string, ok bool) {
+	if !strings.HasPrefix(line, "/") {
+		return "", "", false
+	}
+	command, arg, _ = strings.Cut(line, " ")
+	return command, strings.TrimSpace(arg), true
+}
+
+// save writes the conversation of tab to its session file, if it has one.
+func (r *repl) save(tab *replTab) {
+	if tab.session == "" {
+		return
+	}
+	if err := tab.conv.Save(tab.session); err != nil {
+		fmt.Fprintln(os.Stderr, r.colors.paint(r.colors.theme.Error, "error: saving the session: "+err.Error()))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/conversation"
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestREPLResendsHistory(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.Enqueue(modelstest.Response{Chunks: []string{"first answer"}})
+	srv.Enqueue(modelstest.Response{Chunks: []string{"second answer"}})
+
+	conv := &conversation.Conversation{SystemPrompt: "be brief"}
+	chat := &repl{
+		client: newTestClient(srv),
+		req:    testRequest(""),
+		conv:   conv,
+		in:     bufio.NewScanner(strings.NewReader("one\n/system be briefer\ntwo\n/exit\n")),
+		out:    io.Discard,
+	}
+	if err := chat.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	var last ChatCompletionOptions
+	if err := json.Unmarshal(requests[1].Body, &last); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, msg := range last.Messages {
+		got = append(got, string(msg.Role)+": "+*msg.Content)
+	}
+	want := []string{"system: be briefer", "user: one", "assistant: first answer", "user: two"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("second turn sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if n := len(conv.Messages); n != 4 {
+		t.Errorf("conversation has %d messages, want 4", n)
+	}
+}
+
+func TestREPLTabs(t *testing.T) {
+	srv := modelstest.NewServer(t)
+	srv.ChunkDelay = 50 * time.Millisecond
+	srv.Enqueue(modelstest.Response{Chunks: []string{"an", "swer"}}, modelstest.Response{Chunks: []string{"an", "swer"}})
+
+	conv := &conversation.Conversation{SystemPrompt: "be brief"}
+	var out strings.Builder
+	chat := &repl{
+		client: newTestClient(srv),
+		req:    testRequest(""),
+		conv:   conv,
+		in:     bufio.NewScanner(strings.NewReader("one\n/tab side openai/gpt-4.1\ntwo\n/tab main\n")),
+		out:    &out,
+	}
+	if err := chat.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want one per tab", len(requests))
+	}
+	sent := map[string]string{}
+	for _, request := range requests {
+		var req ChatCompletionOptions
+		if err := json.Unmarshal(request.Body, &req); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, msg := range req.Messages {
+			got = append(got, string(msg.Role)+": "+*msg.Content)
+		}
+		sent[req.Model] = strings.Join(got, "\n")
+	}
+	if want := "system: be brief\nuser: two"; sent["openai/gpt-4.1"] != want {
+		t.Errorf("the side tab sent\n%s\nwant\n%s", sent["openai/gpt-4.1"], want)
+	}
+	if n := len(conv.Messages); n != 2 {
+		t.Errorf("the main tab has %d messages, want 2", n)
+	}
+	if !strings.Contains(out.String(), "--- side (openai/gpt-4.1) ---") {
+		t.Errorf("output does not show the switch to the side tab:\n%s", out.String())
+	}
+	// The side tab was in the background when its answer arrived
+	if strings.Count(out.String(), "answer") != 1 || !strings.Contains(chat.tabs[1].out.unseen.String(), "answer") {
+		t.Errorf("want only the main tab's answer shown:\n%s", out.String())
+	}
+}
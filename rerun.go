@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+)
+
+// lastInvocation is the most recent request made with the main command, replayed by
+// the rerun subcommand.
+type lastInvocation struct {
+	// Flags holds the flags as given, and Args the prompt arguments after them.
+	Flags []string `json:"flags"`
+	Args  []string `json:"args"`
+}
+
+// lastInvocationPath returns the file storing the last invocation.
+func lastInvocationPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "last.json"), nil
+}
+
+// saveLastInvocation records the flags and prompt arguments of a request. Failing to
+// record it never fails the request.
+func saveLastInvocation(flags, args []string) {
+	path, err := lastInvocationPath()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(lastInvocation{Flags: flags, Args: args}, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// parseInvocation parses the main command's flags from args into fs, replaying the
+// last invocation first for the rerun subcommand. It returns the invocation to record
+// and the names of the flags given explicitly, which take precedence over saved
+// prompts, sessions and configured defaults.
+func parseInvocation(fs *flag.FlagSet, args []string) (lastInvocation, map[string]bool, error) {
+	var invocation lastInvocation
+	if len(args) > 0 && args[0] == "rerun" {
+		var err error
+		if invocation, err = parseRerun(fs, args[1:]); err != nil {
+			return lastInvocation{}, nil, err
+		}
+	} else {
+		if err := fs.Parse(args); err != nil {
+			return lastInvocation{}, nil, err
+		}
+		invocation = lastInvocation{Flags: args[:len(args)-fs.NArg()], Args: fs.Args()}
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return invocation, explicit, nil
+}
+
+// parseRerun parses the last invocation into fs, followed by args. Flags in args take
+// precedence over the recorded ones, and prompt arguments in args replace the recorded
+// prompt. It returns the resulting invocation.
+func parseRerun(fs *flag.FlagSet, args []string) (lastInvocation, error) {
+	path, err := lastInvocationPath()
+	if err != nil {
+		return lastInvocation{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return lastInvocation{}, errors.New("nothing to rerun: no request has been made yet")
+	}
+	if err != nil {
+		return lastInvocation{}, err
+	}
+	var last lastInvocation
+	if err := json.Unmarshal(data, &last); err != nil {
+		return lastInvocation{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if err := fs.Parse(last.Flags); err != nil {
+		return lastInvocation{}, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return lastInvocation{}, err
+	}
+	next := lastInvocation{
+		Flags: append(append([]string{}, last.Flags...), args[:len(args)-fs.NArg()]...),
+		Args:  fs.Args(),
+	}
+	if len(next.Args) == 0 {
+		next.Args = last.Args
+	}
+	// Parsing stops at "--", leaving only the prompt as arguments
+	return next, fs.Parse(append([]string{"--"}, next.Args...))
+}
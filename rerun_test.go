@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseInvocation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	newFlags := func() (*flag.FlagSet, *string, *string) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		return fs, fs.String("model", "default", ""), fs.String("system", "", "")
+	}
+
+	fs, model, _ := newFlags()
+	if _, _, err := parseInvocation(fs, []string{"rerun"}); err == nil || !strings.Contains(err.Error(), "nothing to rerun") {
+		t.Errorf("rerun before any request = %v", err)
+	}
+
+	fs, model, _ = newFlags()
+	invocation, explicit, err := parseInvocation(fs, []string{"-model", "openai/gpt-4o", "tell", "me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(invocation.Flags, " ") != "-model openai/gpt-4o" || strings.Join(invocation.Args, " ") != "tell me" || *model != "openai/gpt-4o" {
+		t.Errorf("invocation = %+v with -model %s", invocation, *model)
+	}
+	if len(explicit) != 1 || !explicit["model"] {
+		t.Errorf("explicit flags = %v, want only model", explicit)
+	}
+	saveLastInvocation(invocation.Flags, invocation.Args)
+
+	// A rerun counts the recorded flags as explicit, along with those given to it
+	fs, model, system := newFlags()
+	invocation, explicit, err = parseInvocation(fs, []string{"rerun", "-system", "Be brief."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *model != "openai/gpt-4o" || *system != "Be brief." || strings.Join(fs.Args(), " ") != "tell me" {
+		t.Errorf("rerun parsed -model %s -system %s and arguments %q", *model, *system, fs.Args())
+	}
+	if strings.Join(invocation.Flags, " ") != "-model openai/gpt-4o -system Be brief." || strings.Join(invocation.Args, " ") != "tell me" {
+		t.Errorf("rerun invocation = %+v", invocation)
+	}
+	if len(explicit) != 2 || !explicit["model"] || !explicit["system"] {
+		t.Errorf("explicit flags of a rerun = %v, want model and system", explicit)
+	}
+}
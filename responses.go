@@ -0,0 +1,576 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/abatilo/ghmodelsproxy/stream"
+)
+
+const defaultResponsesURL = "https://models.github.ai/inference/responses"
+
+// Responses API streaming event types.
+const (
+	ResponseEventCreated           = "response.created"
+	ResponseEventOutputTextDelta   = "response.output_text.delta"
+	ResponseEventFunctionArgsDelta = "response.function_call_arguments.delta"
+	ResponseEventOutputItemAdded   = "response.output_item.added"
+	ResponseEventOutputItemDone    = "response.output_item.done"
+	ResponseEventCompleted         = "response.completed"
+	ResponseEventIncomplete        = "response.incomplete"
+	ResponseEventFailed            = "response.failed"
+	ResponseEventError             = "error"
+)
+
+const (
+	responseItemTypeMessage        = "message"
+	responseItemTypeFunctionCall   = "function_call"
+	responseItemTypeFunctionOutput = "function_call_output"
+	responseContentTypeInputText   = "input_text"
+	responseContentTypeOutputText  = "output_text"
+	responseToolTypeFunction       = "function"
+	responseStatusInProgress       = "in_progress"
+	responseStatusCompleted        = "completed"
+	responseStatusIncomplete       = "incomplete"
+	responseIncompleteMaxTokens    = "max_output_tokens"
+	responseIncompleteFilter       = "content_filter"
+)
+
+// ResponseContent represents a content part of a Responses API message item.
+type ResponseContent struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// ResponseItem represents an input or output item of the Responses API. Messages carry
+// Role and Content, function calls carry CallID, Name and Arguments, and function call
+// outputs carry CallID and Output. Built-in tool results such as web_search_call keep
+// their Type and Status, with the remaining fields in Raw.
+type ResponseItem struct {
+	Type      string            `json:"type"`
+	ID        string            `json:"id,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	Role      ChatMessageRole   `json:"role,omitempty"`
+	Content   []ResponseContent `json:"content,omitempty"`
+	CallID    string            `json:"call_id,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Arguments string            `json:"arguments,omitempty"`
+	Output    string            `json:"output,omitempty"`
+	Raw       json.RawMessage   `json:"-"`
+}
+
+// UnmarshalJSON decodes an item, keeping the raw payload for item types this client
+// does not model. Input messages may give their content as a string and leave out
+// the item type.
+func (i *ResponseItem) UnmarshalJSON(data []byte) error {
+	type item ResponseItem
+	var raw struct {
+		*item
+		Content json.RawMessage `json:"content,omitempty"`
+	}
+	raw.item = (*item)(i)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var text string
+	if err := json.Unmarshal(raw.Content, &text); err == nil {
+		i.Content = []ResponseContent{{Type: responseContentTypeInputText, Text: text}}
+	} else if len(raw.Content) > 0 && !isJSONNull(raw.Content) {
+		if err := json.Unmarshal(raw.Content, &i.Content); err != nil {
+			return fmt.Errorf("content: %w", err)
+		}
+	}
+	if i.Type == "" && i.Role != "" {
+		i.Type = responseItemTypeMessage
+	}
+	i.Raw = append(json.RawMessage{}, data...)
+	return nil
+}
+
+// Text returns the concatenated text content of a message item.
+func (i ResponseItem) Text() string {
+	var text string
+	for _, c := range i.Content {
+		text += c.Text
+	}
+	return text
+}
+
+// ResponseTool represents a tool offered to the model in the Responses API, which
+// flattens the function definition into the tool itself.
+type ResponseTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ResponseUsage represents the token usage of a response.
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ResponseError represents an error reported by the Responses API.
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ResponseIncompleteDetails explains why a response is incomplete.
+type ResponseIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// Response represents a Responses API response object.
+type Response struct {
+	ID                string                     `json:"id"`
+	Object            string                     `json:"object,omitempty"`
+	CreatedAt         int64                      `json:"created_at,omitempty"`
+	Model             string                     `json:"model"`
+	Status            string                     `json:"status"`
+	Output            []ResponseItem             `json:"output"`
+	Usage             *ResponseUsage             `json:"usage,omitempty"`
+	Error             *ResponseError             `json:"error,omitempty"`
+	IncompleteDetails *ResponseIncompleteDetails `json:"incomplete_details,omitempty"`
+}
+
+// OutputText returns the text of all message items in the output.
+func (r *Response) OutputText() string {
+	var text string
+	for _, item := range r.Output {
+		if item.Type == responseItemTypeMessage {
+			text += item.Text()
+		}
+	}
+	return text
+}
+
+// ResponseEvent represents a streamed Responses API event.
+type ResponseEvent struct {
+	Type           string        `json:"type"`
+	SequenceNumber int           `json:"sequence_number"`
+	ItemID         string        `json:"item_id,omitempty"`
+	OutputIndex    int           `json:"output_index"`
+	ContentIndex   int           `json:"content_index"`
+	Delta          string        `json:"delta,omitempty"`
+	Item           *ResponseItem `json:"item,omitempty"`
+	Response       *Response     `json:"response,omitempty"`
+	Code           string        `json:"code,omitempty"`
+	Message        string        `json:"message,omitempty"`
+}
+
+// ResponsesOptions represents the options for a Responses API request.
+type ResponsesOptions struct {
+	Model              string              `json:"model"`
+	Input              []ResponseItem      `json:"input"`
+	Instructions       string              `json:"instructions,omitempty"`
+	Tools              []ResponseTool      `json:"tools,omitempty"`
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	MaxOutputTokens    *int                `json:"max_output_tokens,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	TopP               *float64            `json:"top_p,omitempty"`
+	ToolChoice         *ResponseToolChoice `json:"tool_choice,omitempty"`
+	Reasoning          *ResponseReasoning  `json:"reasoning,omitempty"`
+	Text               *ResponseText       `json:"text,omitempty"`
+	User               string              `json:"user,omitempty"`
+	PromptCacheKey     string              `json:"prompt_cache_key,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+}
+
+// UnmarshalJSON decodes options, accepting a string input as a single user message.
+func (o *ResponsesOptions) UnmarshalJSON(data []byte) error {
+	type options ResponsesOptions
+	var raw struct {
+		*options
+		Input json.RawMessage `json:"input"`
+	}
+	raw.options = (*options)(o)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var text string
+	if err := json.Unmarshal(raw.Input, &text); err == nil {
+		o.Input = []ResponseItem{{Type: responseItemTypeMessage, Role: ChatMessageRoleUser, Content: []ResponseContent{{Type: responseContentTypeInputText, Text: text}}}}
+		return nil
+	}
+	o.Input = nil
+	if len(raw.Input) == 0 || isJSONNull(raw.Input) {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Input, &o.Input); err != nil {
+		return fmt.Errorf("input: %w", err)
+	}
+	return nil
+}
+
+// ResponseToolChoice is a ToolChoice in the Responses API, which names a forced
+// function without nesting it.
+type ResponseToolChoice ToolChoice
+
+// MarshalJSON implements json.Marshaler.
+func (c ResponseToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Function != "" {
+		return json.Marshal(map[string]string{"type": responseToolTypeFunction, "name": c.Function})
+	}
+	return json.Marshal(c.Mode)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Only modes and functions can be chosen.
+func (c *ResponseToolChoice) UnmarshalJSON(data []byte) error {
+	*c = ResponseToolChoice{}
+	if err := json.Unmarshal(data, &c.Mode); err == nil {
+		return nil
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &choice); err != nil {
+		return err
+	}
+	if choice.Type != responseToolTypeFunction || choice.Name == "" {
+		return fmt.Errorf("unsupported tool_choice %s", data)
+	}
+	c.Function = choice.Name
+	return nil
+}
+
+// ResponseReasoning configures the reasoning of models that support it.
+type ResponseReasoning struct {
+	Effort string `json:"effort,omitempty"`
+}
+
+// ResponseText configures the text output of a response.
+type ResponseText struct {
+	Format ResponseTextFormat `json:"format"`
+}
+
+// ResponseTextFormat is a ResponseFormat in the Responses API, which flattens the
+// JSON schema into the format itself.
+type ResponseTextFormat struct {
+	Type   string          `json:"type"`
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	Strict bool            `json:"strict,omitempty"`
+}
+
+// ResponseStream represents a streamed Responses API response.
+type ResponseStream struct {
+	Reader stream.Reader[ResponseEvent]
+}
+
+// GetResponseStream returns a stream of Responses API events using the given options.
+func (c *AzureClient) GetResponseStream(ctx context.Context, req ResponsesOptions) (*ResponseStream, error) {
+	req.Stream = true
+
+	// Responses are stored upstream, so a failed request is not repeated
+	resp, err := c.postJSON(ctx, c.cfg.ResponsesURL, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.handleHTTPError(resp)
+	}
+
+	return &ResponseStream{Reader: stream.NewEventReader[ResponseEvent](resp.Body)}, nil
+}
+
+// ResponsesOptionsFromChat translates a chat completion request into the equivalent
+// Responses API request. System messages become the instructions. Options the
+// Responses API has no equivalent for are reported as an error rather than dropped.
+func ResponsesOptionsFromChat(req ChatCompletionOptions) (ResponsesOptions, error) {
+	var unsupported []string
+	for name, set := range map[string]bool{
+		"stop":              len(req.Stop) > 0,
+		"seed":              req.Seed != nil,
+		"logit_bias":        len(req.LogitBias) > 0,
+		"presence_penalty":  req.PresencePenalty != nil,
+		"frequency_penalty": req.FrequencyPenalty != nil,
+	} {
+		if set {
+			unsupported = append(unsupported, name)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return ResponsesOptions{}, fmt.Errorf("the Responses API does not support %s; use the chat completions API", strings.Join(unsupported, ", "))
+	}
+
+	opts := ResponsesOptions{
+		Model:           req.Model,
+		MaxOutputTokens: req.MaxTokens,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		User:            req.User,
+		PromptCacheKey:  req.PromptCacheKey,
+	}
+	if req.MaxCompletionTokens != nil {
+		opts.MaxOutputTokens = req.MaxCompletionTokens
+	}
+	if req.ToolChoice != nil {
+		choice := ResponseToolChoice(*req.ToolChoice)
+		opts.ToolChoice = &choice
+	}
+	if req.ReasoningEffort != "" {
+		opts.Reasoning = &ResponseReasoning{Effort: req.ReasoningEffort}
+	}
+	if f := req.ResponseFormat; f != nil {
+		format := ResponseTextFormat{Type: f.Type}
+		if f.JSONSchema != nil {
+			format.Name, format.Schema, format.Strict = f.JSONSchema.Name, f.JSONSchema.Schema, f.JSONSchema.Strict
+		}
+		opts.Text = &ResponseText{Format: format}
+	}
+	for _, m := range req.Messages {
+		var content string
+		if m.Content != nil {
+			content = *m.Content
+		}
+
+		switch m.Role {
+		case ChatMessageRoleSystem:
+			if opts.Instructions != "" {
+				opts.Instructions += "\n\n"
+			}
+			opts.Instructions += content
+		case ChatMessageRoleTool:
+			opts.Input = append(opts.Input, ResponseItem{Type: responseItemTypeFunctionOutput, CallID: m.ToolCallID, Output: content})
+		default:
+			contentType := responseContentTypeInputText
+			if m.Role == ChatMessageRoleAssistant {
+				contentType = responseContentTypeOutputText
+			}
+			if content != "" {
+				opts.Input = append(opts.Input, ResponseItem{
+					Type:    responseItemTypeMessage,
+					Role:    m.Role,
+					Content: []ResponseContent{{Type: contentType, Text: content}},
+				})
+			}
+			for _, call := range m.ToolCalls {
+				opts.Input = append(opts.Input, ResponseItem{
+					Type:      responseItemTypeFunctionCall,
+					CallID:    call.ID,
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				})
+			}
+		}
+	}
+
+	for _, tool := range req.Tools {
+		opts.Tools = append(opts.Tools, ResponseTool{
+			Type:        responseToolTypeFunction,
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+
+	return opts, nil
+}
+
+// ChatMessageFromResponse translates the output of a completed response into the
+// equivalent chat completion assistant message.
+func ChatMessageFromResponse(resp *Response) ChatMessage {
+	msg := ChatMessage{Role: ChatMessageRoleAssistant}
+	if text := resp.OutputText(); text != "" {
+		msg.Content = &text
+	}
+	for _, item := range resp.Output {
+		if item.Type == responseItemTypeFunctionCall {
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       item.CallID,
+				Type:     responseToolTypeFunction,
+				Function: FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			})
+		}
+	}
+	return msg
+}
+
+// ChatFinishReasonFromResponse maps a response status to a chat completion finish_reason.
+func ChatFinishReasonFromResponse(resp *Response) string {
+	switch resp.Status {
+	case responseStatusIncomplete:
+		if resp.IncompleteDetails != nil && resp.IncompleteDetails.Reason == responseIncompleteMaxTokens {
+			return "length"
+		}
+		return "content_filter"
+	case responseStatusCompleted:
+		for _, item := range resp.Output {
+			if item.Type == responseItemTypeFunctionCall {
+				return "tool_calls"
+			}
+		}
+		return "stop"
+	default:
+		return ""
+	}
+}
+
+// ChatOptionsFromResponses translates a Responses API request into the equivalent chat
+// completion request, the inverse of ResponsesOptionsFromChat. The instructions become
+// a system message. Requests relying on state kept by the Responses API, such as a
+// previous_response_id, or on built-in tools are reported as an error.
+func ChatOptionsFromResponses(opts ResponsesOptions) (ChatCompletionOptions, error) {
+	if opts.PreviousResponseID != "" {
+		return ChatCompletionOptions{}, errors.New("previous_response_id is not supported; send the whole conversation as input")
+	}
+
+	req := ChatCompletionOptions{
+		Model:          opts.Model,
+		Stream:         opts.Stream,
+		MaxTokens:      opts.MaxOutputTokens,
+		Temperature:    opts.Temperature,
+		TopP:           opts.TopP,
+		User:           opts.User,
+		PromptCacheKey: opts.PromptCacheKey,
+	}
+	if opts.ToolChoice != nil {
+		choice := ToolChoice(*opts.ToolChoice)
+		req.ToolChoice = &choice
+	}
+	if opts.Reasoning != nil {
+		req.ReasoningEffort = opts.Reasoning.Effort
+	}
+	if opts.Text != nil && opts.Text.Format.Type != "" && opts.Text.Format.Type != "text" {
+		f := opts.Text.Format
+		req.ResponseFormat = &ResponseFormat{Type: f.Type}
+		if f.Schema != nil {
+			req.ResponseFormat.JSONSchema = &JSONSchemaSpec{Name: f.Name, Schema: f.Schema, Strict: f.Strict}
+		}
+	}
+	if opts.Instructions != "" {
+		instructions := opts.Instructions
+		req.Messages = append(req.Messages, ChatMessage{Role: ChatMessageRoleSystem, Content: &instructions})
+	}
+
+	for _, item := range opts.Input {
+		switch item.Type {
+		case responseItemTypeMessage:
+			for _, c := range item.Content {
+				if c.Type != responseContentTypeInputText && c.Type != responseContentTypeOutputText {
+					return ChatCompletionOptions{}, fmt.Errorf("unsupported %s content in the input", c.Type)
+				}
+			}
+			role := item.Role
+			if role == "" {
+				role = ChatMessageRoleUser
+			}
+			content := item.Text()
+			req.Messages = append(req.Messages, ChatMessage{Role: role, Content: &content})
+		case responseItemTypeFunctionCall:
+			call := ToolCall{ID: item.CallID, Type: responseToolTypeFunction, Function: FunctionCall{Name: item.Name, Arguments: item.Arguments}}
+			// Calls following an assistant message were made in the same turn
+			if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == ChatMessageRoleAssistant {
+				req.Messages[n-1].ToolCalls = append(req.Messages[n-1].ToolCalls, call)
+			} else {
+				req.Messages = append(req.Messages, ChatMessage{Role: ChatMessageRoleAssistant, ToolCalls: []ToolCall{call}})
+			}
+		case responseItemTypeFunctionOutput:
+			output := item.Output
+			req.Messages = append(req.Messages, ChatMessage{Role: ChatMessageRoleTool, ToolCallID: item.CallID, Content: &output})
+		default:
+			return ChatCompletionOptions{}, fmt.Errorf("unsupported input item type %q", item.Type)
+		}
+	}
+
+	for _, tool := range opts.Tools {
+		if tool.Type != responseToolTypeFunction {
+			return ChatCompletionOptions{}, fmt.Errorf("unsupported %s tool; only function tools can be used", tool.Type)
+		}
+		req.Tools = append(req.Tools, ToolDefinition{
+			Type:     responseToolTypeFunction,
+			Function: FunctionDefinition{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+
+	return req, nil
+}
+
+// ResponseFromChat translates a chat completion assistant message, its finish_reason
+// and usage into the equivalent response, the inverse of ChatMessageFromResponse. The
+// message comes first in the output, followed by a function_call item for each tool call.
+func ResponseFromChat(msg ChatMessage, finishReason string, usage *Usage) *Response {
+	resp := &Response{Status: responseStatusCompleted, Output: []ResponseItem{}}
+	switch finishReason {
+	case "length":
+		resp.Status = responseStatusIncomplete
+		resp.IncompleteDetails = &ResponseIncompleteDetails{Reason: responseIncompleteMaxTokens}
+	case "content_filter":
+		resp.Status = responseStatusIncomplete
+		resp.IncompleteDetails = &ResponseIncompleteDetails{Reason: responseIncompleteFilter}
+	}
+	if msg.Content != nil && *msg.Content != "" {
+		resp.Output = append(resp.Output, ResponseItem{
+			Type:    responseItemTypeMessage,
+			Status:  resp.Status,
+			Role:    ChatMessageRoleAssistant,
+			Content: []ResponseContent{{Type: responseContentTypeOutputText, Text: *msg.Content}},
+		})
+	}
+	for _, call := range msg.ToolCalls {
+		resp.Output = append(resp.Output, ResponseItem{
+			Type:      responseItemTypeFunctionCall,
+			Status:    responseStatusCompleted,
+			CallID:    call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	if usage != nil {
+		resp.Usage = &ResponseUsage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens, TotalTokens: usage.TotalTokens}
+	}
+	return resp
+}
+
+// runResponses sends req through the Responses API and writes the streamed text to out.
+func runResponses(ctx context.Context, client *AzureClient, req ChatCompletionOptions, out io.Writer) error {
+	opts, err := ResponsesOptionsFromChat(req)
+	if err != nil {
+		return err
+	}
+	resp, err := client.GetResponseStream(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer resp.Reader.Close()
+
+	for {
+		event, err := resp.Reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("response is incomplete: %w", err)
+		}
+
+		switch event.Type {
+		case ResponseEventOutputTextDelta:
+			if _, err := io.WriteString(out, event.Delta); err != nil {
+				return err
+			}
+		case ResponseEventError:
+			return fmt.Errorf("response error: %s: %s", event.Code, event.Message)
+		case ResponseEventFailed:
+			if event.Response != nil && event.Response.Error != nil {
+				return fmt.Errorf("response failed: %s: %s", event.Response.Error.Code, event.Response.Error.Message)
+			}
+			return errors.New("response failed")
+		case ResponseEventCompleted, ResponseEventIncomplete:
+			_, err := io.WriteString(out, "\n")
+			return err
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResponsesOptionsFromChat(t *testing.T) {
+	system, prompt, maxTokens := "Be brief.", "Hi", 50
+	opts, err := ResponsesOptionsFromChat(ChatCompletionOptions{
+		Model:               "openai/o3-mini",
+		Messages:            []ChatMessage{{Role: ChatMessageRoleSystem, Content: &system}, {Role: ChatMessageRoleUser, Content: &prompt}},
+		ToolChoice:          &ToolChoice{Function: "search"},
+		ReasoningEffort:     "high",
+		MaxCompletionTokens: &maxTokens,
+		User:                "u1",
+		ResponseFormat:      &ResponseFormat{Type: "json_schema", JSONSchema: &JSONSchemaSpec{Name: "answer", Schema: json.RawMessage(`{"type":"object"}`), Strict: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"instructions":"Be brief."`,
+		`"max_output_tokens":50`,
+		`"tool_choice":{"name":"search","type":"function"}`,
+		`"reasoning":{"effort":"high"}`,
+		`"text":{"format":{"type":"json_schema","name":"answer","schema":{"type":"object"},"strict":true}}`,
+		`"user":"u1"`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("request %s is missing %s", got, want)
+		}
+	}
+
+	opts, _ = ResponsesOptionsFromChat(ChatCompletionOptions{ToolChoice: &ToolChoice{Mode: ToolChoiceRequired}})
+	if got, _ := json.Marshal(opts.ToolChoice); string(got) != `"required"` {
+		t.Errorf("tool_choice = %s, want \"required\"", got)
+	}
+
+	seed := 1
+	_, err = ResponsesOptionsFromChat(ChatCompletionOptions{Stop: []string{"\n"}, Seed: &seed})
+	if err == nil || !strings.Contains(err.Error(), "seed, stop") {
+		t.Errorf("translating stop and seed = %v, want an error naming them", err)
+	}
+}
+
+func TestChatOptionsFromResponses(t *testing.T) {
+	var opts ResponsesOptions
+	err := json.Unmarshal([]byte(`{
+		"model": "openai/gpt-4o-mini",
+		"instructions": "Be brief.",
+		"input": [
+			{"role": "user", "content": "What is 1+2?"},
+			{"type": "message", "role": "assistant", "content": [{"type": "output_text", "text": "Let me add."}]},
+			{"type": "function_call", "call_id": "call_1", "name": "add", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "3"}
+		],
+		"tools": [{"type": "function", "name": "add", "parameters": {"type": "object"}}],
+		"tool_choice": {"type": "function", "name": "add"},
+		"max_output_tokens": 20,
+		"text": {"format": {"type": "json_schema", "name": "answer", "schema": {"type": "object"}}}
+	}`), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := ChatOptionsFromResponses(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`{"content":"Be brief.","role":"system"}`,
+		`{"content":"What is 1+2?","role":"user"}`,
+		`{"content":"Let me add.","role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"add","arguments":"{}"}}]}`,
+		`{"content":"3","role":"tool","tool_call_id":"call_1"}`,
+		`"tools":[{"type":"function","function":{"name":"add","parameters":{"type":"object"}}}]`,
+		`"tool_choice":{"function":{"name":"add"},"type":"function"}`,
+		`"max_tokens":20`,
+		`"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object"}}}`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("request %s is missing %s", got, want)
+		}
+	}
+
+	var short ResponsesOptions
+	if err := json.Unmarshal([]byte(`{"model":"m","input":"Hi"}`), &short); err != nil {
+		t.Fatal(err)
+	}
+	if req, _ := ChatOptionsFromResponses(short); len(req.Messages) != 1 || *req.Messages[0].Content != "Hi" || req.Messages[0].Role != ChatMessageRoleUser {
+		t.Errorf("a string input = %+v, want one user message", req.Messages)
+	}
+
+	for _, tt := range []struct {
+		input string
+		want  string
+	}{
+		{`{"model":"m","input":"Hi","previous_response_id":"resp_1"}`, "previous_response_id"},
+		{`{"model":"m","input":"Hi","tools":[{"type":"web_search"}]}`, "web_search"},
+		{`{"model":"m","input":[{"role":"user","content":[{"type":"input_image"}]}]}`, "input_image"},
+	} {
+		var opts ResponsesOptions
+		if err := json.Unmarshal([]byte(tt.input), &opts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ChatOptionsFromResponses(opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("translating %s = %v, want an error naming %s", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestResponseFromChat(t *testing.T) {
+	content := "Hello"
+	for _, tt := range []struct {
+		finishReason string
+		status       string
+		reason       string
+	}{
+		{"stop", "completed", ""},
+		{"tool_calls", "completed", ""},
+		{"length", "incomplete", "max_output_tokens"},
+		{"content_filter", "incomplete", "content_filter"},
+	} {
+		msg := ChatMessage{Role: ChatMessageRoleAssistant, Content: &content, ToolCalls: []ToolCall{{ID: "call_1", Function: FunctionCall{Name: "add", Arguments: "{}"}}}}
+		resp := ResponseFromChat(msg, tt.finishReason, &Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5})
+		var reason string
+		if resp.IncompleteDetails != nil {
+			reason = resp.IncompleteDetails.Reason
+		}
+		if resp.Status != tt.status || reason != tt.reason {
+			t.Errorf("finish_reason %s: status %s and reason %q, want %s and %q", tt.finishReason, resp.Status, reason, tt.status, tt.reason)
+		}
+		if resp.OutputText() != "Hello" || len(resp.Output) != 2 || resp.Output[1].CallID != "call_1" {
+			t.Errorf("finish_reason %s: output = %+v", tt.finishReason, resp.Output)
+		}
+		if resp.Usage == nil || resp.Usage.InputTokens != 3 || resp.Usage.OutputTokens != 2 {
+			t.Errorf("finish_reason %s: usage = %+v", tt.finishReason, resp.Usage)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how requests are retried when they are rate limited (429) or,
+// for idempotent requests, fail with a transient server error (500, 502, 503 or 504).
+// Delays advertised by Retry-After or x-ratelimit-reset headers are used when present;
+// other retries back off exponentially.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first; 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, doubling with each retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff.
+	MaxDelay time.Duration
+	// MaxWait caps the delays advertised by response headers. A rate limited request
+	// that would wait longer fails with a *RateLimitError instead, and a failing one
+	// returns its response. Zero means no cap beyond the context deadline.
+	MaxWait time.Duration
+	// Jitter is the fraction from 0 to 1 by which backoffs are randomly shortened, so
+	// that clients failing together do not retry together.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the retry policy of clients that do not set one.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	MaxWait:     2 * time.Minute,
+	Jitter:      0.2,
+}
+
+// WithRetryPolicy sets how failed requests are retried.
+func (c *AzureClient) WithRetryPolicy(policy RetryPolicy) *AzureClient {
+	c.retry = policy
+	return c
+}
+
+// retryPolicy returns the client's retry policy, or the default if none was set.
+func (c *AzureClient) retryPolicy() RetryPolicy {
+	if c.retry.MaxAttempts == 0 {
+		return DefaultRetryPolicy
+	}
+	return c.retry
+}
+
+// backoff returns the delay before retry number retry, counting from zero.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < retry && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 {
+		delay = min(delay, p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// isTransientStatus reports whether a request failing with a server error status may
+// succeed when retried.
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
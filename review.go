@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+	"github.com/cli/go-gh/v2/pkg/repository"
+)
+
+// maxPatchChars bounds how much of a single file's patch is sent to the model.
+const maxPatchChars = 30000
+
+// noIssuesResponse is what the model is asked to answer for files without feedback.
+const noIssuesResponse = "LGTM"
+
+const reviewPrompt = `You are an experienced code reviewer. You are shown the title and description
+of a pull request followed by the diff of a single file from it. Point out bugs, security problems,
+missing error handling, confusing code and missing tests, referring to the new line numbers of the
+diff where possible. Be specific and concise and skip praise and restating the change.
+If you have no substantive feedback for the file, respond with exactly "` + noIssuesResponse + `".`
+
+var pullURLPattern = regexp.MustCompile(`^https?://[^/]+/([^/]+)/([^/]+)/pull/(\d+)`)
+
+type pullRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Head  struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+type pullRequestFile struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"`
+	Patch    string `json:"patch"`
+}
+
+// runReview implements the `review` subcommand.
+func runReview(args []string) int {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	repoFlag := fs.String("R", "", "Repository in OWNER/REPO format. Defaults to the current repository")
+	model := modelFlag(fs, "model", "OpenAI/gpt-4.1", "Model to use for chat completion")
+	post := fs.Bool("post", false, "Post the feedback as file comments on the pull request")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s review [flags] <number | url>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	owner, repo, number, err := resolvePullRequest(fs.Arg(0), *repoFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	gh, err := api.DefaultRESTClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	prPath := fmt.Sprintf("repos/%s/%s/pulls/%d", url.PathEscape(owner), url.PathEscape(repo), number)
+
+	var pr pullRequest
+	if err := gh.Get(prPath, &pr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	files, err := pullRequestFiles(gh, prPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	client := newCLIClient()
+	systemPrompt := reviewPrompt
+
+	for _, file := range files {
+		if file.Patch == "" {
+			// Binary and very large files have no patch to review
+			continue
+		}
+
+		input := reviewInput(pr, file)
+
+		fmt.Printf("## %s\n\n", file.Filename)
+		msg, err := client.streamCompletion(context.TODO(), ChatCompletionOptions{
+			Model: *model,
+			Messages: []ChatMessage{
+				{Role: ChatMessageRoleSystem, Content: &systemPrompt},
+				{Role: ChatMessageRoleUser, Content: &input},
+			},
+		}, os.Stdout)
+		fmt.Print("\n\n")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if !*post || msg.Content == nil {
+			continue
+		}
+		feedback := strings.TrimSpace(*msg.Content)
+		if feedback == "" || feedback == noIssuesResponse {
+			continue
+		}
+		if err := postFileComment(gh, prPath, pr.Head.SHA, file.Filename, feedback); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// reviewInput returns the user message asking for a review of file.
+func reviewInput(pr pullRequest, file pullRequestFile) string {
+	patch := file.Patch
+	if len(patch) > maxPatchChars {
+		patch = truncateUTF8(patch, maxPatchChars) + "\n[patch truncated]"
+	}
+	return fmt.Sprintf("Title: %s\n\nDescription:\n%s\n\nFile: %s (%s)\n\n%s", pr.Title, pr.Body, file.Filename, file.Status, patch)
+}
+
+// resolvePullRequest parses a pull request number or URL into its repository and number.
+func resolvePullRequest(arg, repoFlag string) (string, string, int, error) {
+	if m := pullURLPattern.FindStringSubmatch(arg); m != nil {
+		number, _ := strconv.Atoi(m[3])
+		return m[1], m[2], number, nil
+	}
+
+	number, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid pull request: %q", arg)
+	}
+
+	var repo repository.Repository
+	if repoFlag != "" {
+		repo, err = repository.Parse(repoFlag)
+	} else {
+		repo, err = repository.Current()
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	return repo.Owner, repo.Name, number, nil
+}
+
+// pullRequestFiles lists every changed file of a pull request.
+func pullRequestFiles(gh *api.RESTClient, prPath string) ([]pullRequestFile, error) {
+	var files []pullRequestFile
+	for page := 1; ; page++ {
+		var batch []pullRequestFile
+		if err := gh.Get(fmt.Sprintf("%s/files?per_page=100&page=%d", prPath, page), &batch); err != nil {
+			return nil, err
+		}
+		files = append(files, batch...)
+		if len(batch) < 100 {
+			return files, nil
+		}
+	}
+}
+
+// postFileComment posts feedback as a file-level review comment.
+func postFileComment(gh *api.RESTClient, prPath, commitID, path, body string) error {
+	payload, err := json.Marshal(map[string]string{
+		"body":         body,
+		"commit_id":    commitID,
+		"path":         path,
+		"subject_type": "file",
+	})
+	if err != nil {
+		return err
+	}
+	return gh.Post(prPath+"/comments", bytes.NewReader(payload), nil)
+}
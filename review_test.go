@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+func TestResolvePullRequest(t *testing.T) {
+	tests := []struct {
+		arg, repo   string
+		owner, name string
+		number      int
+		wantErr     bool
+	}{
+		{arg: "https://github.com/cli/cli/pull/42", owner: "cli", name: "cli", number: 42},
+		{arg: "https://github.example.com/octo/app/pull/7/files", repo: "ignored/repo", owner: "octo", name: "app", number: 7},
+		{arg: "12", repo: "octo/app", owner: "octo", name: "app", number: 12},
+		{arg: "#12", repo: "octo/app", owner: "octo", name: "app", number: 12},
+		{arg: "main", repo: "octo/app", wantErr: true},
+		{arg: "12", repo: "not a repository", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			owner, name, number, err := resolvePullRequest(tt.arg, tt.repo)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("resolvePullRequest(%q, %q) succeeded", tt.arg, tt.repo)
+				}
+				return
+			}
+			if err != nil || owner != tt.owner || name != tt.name || number != tt.number {
+				t.Errorf("resolvePullRequest(%q, %q) = %s/%s#%d, %v", tt.arg, tt.repo, owner, name, number, err)
+			}
+		})
+	}
+}
+
+func TestReviewInput(t *testing.T) {
+	pr := pullRequest{Title: "Add caching", Body: "Caches responses."}
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{name: "small patch", patch: "@@ -1 +1 @@\n-a\n+b", want: "Title: Add caching\n\nDescription:\nCaches responses.\n\nFile: cache.go (modified)\n\n@@ -1 +1 @@\n-a\n+b"},
+		{name: "large patch", patch: strings.Repeat("x", maxPatchChars-1) + "é" + "tail", want: "x\n[patch truncated]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reviewInput(pr, pullRequestFile{Filename: "cache.go", Status: "modified", Patch: tt.patch})
+			if !strings.HasSuffix(got, tt.want) || !utf8.ValidString(got) {
+				t.Errorf("reviewInput = %q, want it to end with %q", got[max(0, len(got)-60):], tt.want)
+			}
+		})
+	}
+}
+
+// rewriteHost sends every request to the test server at target.
+type rewriteHost struct{ target *url.URL }
+
+func (r rewriteHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestPullRequestFiles(t *testing.T) {
+	const total = 150
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/octo/app/pulls/7/files" || r.URL.Query().Get("per_page") != "100" {
+			http.NotFound(w, r)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		files := []pullRequestFile{}
+		for i := (page - 1) * 100; i < min(page*100, total); i++ {
+			files = append(files, pullRequestFile{Filename: fmt.Sprintf("file%d.go", i)})
+		}
+		json.NewEncoder(w).Encode(files)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	gh, err := api.NewRESTClient(api.ClientOptions{Host: "github.com", AuthToken: "test-token", Transport: rewriteHost{target}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := pullRequestFiles(gh, "repos/octo/app/pulls/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != total || files[0].Filename != "file0.go" || files[total-1].Filename != fmt.Sprintf("file%d.go", total-1) {
+		t.Errorf("got %d files, want all %d pages of them", len(files), total)
+	}
+}
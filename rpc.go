@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// maxRPCMessageBytes bounds the size of a single request line.
+const maxRPCMessageBytes = 16 * 1024 * 1024
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type startParams struct {
+	Model    string        `json:"model,omitempty"`
+	System   string        `json:"system,omitempty"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+type appendParams struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+type cancelParams struct {
+	ID string `json:"id"`
+}
+
+type completionParams struct {
+	ID           string `json:"id"`
+	Content      string `json:"content,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// rpcSession is a conversation driven by an editor over JSON-RPC.
+type rpcSession struct {
+	model    string
+	messages []ChatMessage
+	cancel   context.CancelFunc
+	running  bool
+}
+
+// rpcServer speaks newline-delimited JSON-RPC 2.0 over a reader and writer.
+type rpcServer struct {
+	client *AzureClient
+	model  string
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu       sync.Mutex
+	sessions map[string]*rpcSession
+	nextID   int
+	wg       sync.WaitGroup
+}
+
+// runRPC implements the `rpc` subcommand.
+func runRPC(args []string) int {
+	fs := flag.NewFlagSet("rpc", flag.ExitOnError)
+	model := modelFlag(fs, "model", "OpenAI/gpt-4.1", "Default model for completions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s rpc [flags]\n\nSpeaks newline-delimited JSON-RPC 2.0 on stdin/stdout. Methods:\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "  completion/start  {model?, system?, messages}  -> {id}")
+		fmt.Fprintln(fs.Output(), "  completion/append {id, content}                -> {id}")
+		fmt.Fprintln(fs.Output(), "  completion/cancel {id}                         -> {}")
+		fmt.Fprintln(fs.Output(), "  shutdown")
+		fmt.Fprintln(fs.Output(), "Notifications: completion/delta, completion/done, completion/error")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	server := &rpcServer{
+		client:   newCLIClient(),
+		model:    *model,
+		enc:      json.NewEncoder(os.Stdout),
+		sessions: map[string]*rpcSession{},
+	}
+	if err := server.serve(os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// serve handles requests from r until it is closed or shutdown is requested.
+func (s *rpcServer) serve(r io.Reader) error {
+	defer s.wg.Wait()
+	defer s.cancelAll()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRPCMessageBytes)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.respond(json.RawMessage("null"), nil, &rpcError{Code: rpcParseError, Message: err.Error()})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			s.respond(req.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "invalid request"})
+			continue
+		}
+
+		if req.Method == "shutdown" {
+			s.respond(req.ID, struct{}{}, nil)
+			return nil
+		}
+
+		result, rerr, after := s.handle(req)
+		// Requests without an id are notifications and get no response
+		if len(req.ID) > 0 {
+			s.respond(req.ID, result, rerr)
+		}
+		// Start streaming only once the client knows the completion id
+		if after != nil {
+			after()
+		}
+	}
+
+	return scanner.Err()
+}
+
+// handle executes a request. The returned function, if any, is run after the response is written.
+func (s *rpcServer) handle(req rpcRequest) (any, *rpcError, func()) {
+	switch req.Method {
+	case "completion/start":
+		var params startParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.Messages) == 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "messages are required"}, nil
+		}
+
+		session := &rpcSession{model: resolveModel(params.Model)}
+		if session.model == "" {
+			session.model = s.model
+		}
+		if params.System != "" {
+			system := params.System
+			session.messages = append(session.messages, ChatMessage{Role: ChatMessageRoleSystem, Content: &system})
+		}
+		session.messages = append(session.messages, params.Messages...)
+
+		s.mu.Lock()
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		s.sessions[id] = session
+		s.mu.Unlock()
+
+		return map[string]string{"id": id}, nil, func() { s.start(id, session) }
+
+	case "completion/append":
+		var params appendParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.ID == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "id is required"}, nil
+		}
+
+		s.mu.Lock()
+		session, ok := s.sessions[params.ID]
+		if ok && session.running {
+			s.mu.Unlock()
+			return nil, &rpcError{Code: rpcInvalidRequest, Message: "completion " + params.ID + " is still running"}, nil
+		}
+		if ok {
+			content := params.Content
+			session.messages = append(session.messages, ChatMessage{Role: ChatMessageRoleUser, Content: &content})
+		}
+		s.mu.Unlock()
+		if !ok {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown completion " + params.ID}, nil
+		}
+
+		return map[string]string{"id": params.ID}, nil, func() { s.start(params.ID, session) }
+
+	case "completion/cancel":
+		var params cancelParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}, nil
+		}
+
+		s.mu.Lock()
+		session, ok := s.sessions[params.ID]
+		if ok && session.cancel != nil {
+			session.cancel()
+		}
+		s.mu.Unlock()
+		if !ok {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "unknown completion " + params.ID}, nil
+		}
+		return struct{}{}, nil, nil
+
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}, nil
+	}
+}
+
+// start runs a completion for the session in the background, streaming notifications.
+func (s *rpcServer) start(id string, session *rpcSession) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	session.cancel = cancel
+	session.running = true
+	req := ChatCompletionOptions{Model: session.model, Messages: append([]ChatMessage{}, session.messages...)}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+
+		acc := newCompletionAccumulator()
+		err := func() error {
+			resp, err := s.client.GetChatCompletionStream(ctx, req)
+			if err != nil {
+				return err
+			}
+			defer resp.Reader.Close()
+			return readCompletions(resp.Reader, func(completion ChatCompletion) error {
+				if content := acc.add(completion); content != "" {
+					s.notify("completion/delta", completionParams{ID: id, Content: content})
+				}
+				return nil
+			})
+		}()
+		if err == nil {
+			// A completion stopped by the content filter is not added to the session
+			err = acc.filter.err()
+		}
+
+		msg := acc.message()
+
+		s.mu.Lock()
+		session.running = false
+		session.cancel = nil
+		if err == nil {
+			session.messages = append(session.messages, msg)
+		}
+		s.mu.Unlock()
+
+		var content string
+		if msg.Content != nil {
+			content = *msg.Content
+		}
+
+		if err != nil {
+			var finishReason string
+			var filterErr *ContentFilterError
+			if errors.As(err, &filterErr) {
+				finishReason = finishReasonContentFilter
+			} else if errors.Is(err, context.Canceled) {
+				err = errors.New("canceled")
+			}
+			// Include whatever was streamed so the editor can keep the partial text
+			s.notify("completion/error", completionParams{ID: id, Content: content, FinishReason: finishReason, Message: err.Error()})
+			return
+		}
+		s.notify("completion/done", completionParams{ID: id, Content: content, FinishReason: acc.finishReason})
+	}()
+}
+
+func (s *rpcServer) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.cancel != nil {
+			session.cancel()
+		}
+	}
+}
+
+func (s *rpcServer) respond(id json.RawMessage, result any, rerr *rpcError) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if rerr == nil && result == nil {
+		result = struct{}{}
+	}
+	s.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rerr})
+}
+
+func (s *rpcServer) notify(method string, params any) {
+	s.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *rpcServer) write(v any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := s.enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rpcMessage is a response or notification written by the rpc server.
+type rpcMessage struct {
+	ID     json.RawMessage  `json:"id"`
+	Result json.RawMessage  `json:"result"`
+	Error  *rpcError        `json:"error"`
+	Method string           `json:"method"`
+	Params completionParams `json:"params"`
+}
+
+// rpcUpstream answers completion requests in order with the given handlers and
+// records their bodies.
+type rpcUpstream struct {
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+	bodies   [][]byte
+}
+
+func (u *rpcUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	u.mu.Lock()
+	n := len(u.bodies)
+	u.bodies = append(u.bodies, body)
+	u.mu.Unlock()
+	if n >= len(u.handlers) {
+		http.Error(w, "no more responses", http.StatusInternalServerError)
+		return
+	}
+	u.handlers[n](w, r)
+}
+
+func (u *rpcUpstream) requests() [][]byte {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([][]byte(nil), u.bodies...)
+}
+
+// streamChunks returns a handler streaming content as chat completion chunks.
+func streamChunks(chunks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", data)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}
+}
+
+// startRPC serves JSON-RPC against upstream and returns functions to send a request
+// line and to read the next message written.
+func startRPC(t *testing.T, upstream *rpcUpstream) (send func(string), next func() rpcMessage) {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+	cfg := NewDefaultAzureClientConfig()
+	cfg.InferenceURL = srv.URL
+	client := NewAzureClient(srv.Client(), "test-token", cfg)
+
+	in, input := io.Pipe()
+	output, out := io.Pipe()
+	server := &rpcServer{client: client, model: "openai/gpt-4o-mini", enc: json.NewEncoder(out), sessions: map[string]*rpcSession{}}
+	done := make(chan error, 1)
+	go func() { done <- server.serve(in) }()
+	t.Cleanup(func() {
+		input.Close()
+		output.Close()
+		<-done
+	})
+
+	// Messages are decoded as they are written, since the decoder may leave the
+	// end of a line unread and block the server's write until the next message
+	messages := make(chan rpcMessage, 100)
+	go func() {
+		defer close(messages)
+		dec := json.NewDecoder(output)
+		for {
+			var msg rpcMessage
+			if err := dec.Decode(&msg); err != nil {
+				return
+			}
+			messages <- msg
+		}
+	}()
+
+	send = func(line string) {
+		t.Helper()
+		if _, err := io.WriteString(input, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next = func() rpcMessage {
+		t.Helper()
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				t.Fatal("the rpc server stopped writing")
+			}
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a message from the rpc server")
+		}
+		return rpcMessage{}
+	}
+	return send, next
+}
+
+func TestRPCFraming(t *testing.T) {
+	send, next := startRPC(t, &rpcUpstream{})
+
+	for _, tt := range []struct {
+		request string
+		id      string
+		code    int
+	}{
+		{`{not json`, "null", rpcParseError},
+		{`{"id":1,"method":"completion/start"}`, "1", rpcInvalidRequest},
+		{`{"jsonrpc":"2.0","id":"a"}`, `"a"`, rpcInvalidRequest},
+		{`{"jsonrpc":"2.0","id":2,"method":"completion/nope"}`, "2", rpcMethodNotFound},
+		{`{"jsonrpc":"2.0","id":3,"method":"completion/start","params":{"messages":[]}}`, "3", rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":4,"method":"completion/append","params":{"id":"9","content":"hi"}}`, "4", rpcInvalidParams},
+		{`{"jsonrpc":"2.0","id":5,"method":"completion/cancel","params":{"id":"9"}}`, "5", rpcInvalidParams},
+	} {
+		send(tt.request)
+		msg := next()
+		if string(msg.ID) != tt.id || msg.Error == nil || msg.Error.Code != tt.code {
+			t.Errorf("response to %s = id %s error %+v, want id %s code %d", tt.request, msg.ID, msg.Error, tt.id, tt.code)
+		}
+	}
+
+	// A request without an id is a notification and gets no response, so the next
+	// message is the response to shutdown
+	send(`{"jsonrpc":"2.0","method":"completion/nope"}`)
+	send(`{"jsonrpc":"2.0","id":6,"method":"shutdown"}`)
+	if msg := next(); string(msg.ID) != "6" || msg.Error != nil || string(msg.Result) != "{}" {
+		t.Errorf("response to shutdown = %+v", msg)
+	}
+}
+
+func TestRPCCompletion(t *testing.T) {
+	upstream := &rpcUpstream{handlers: []http.HandlerFunc{streamChunks("Hel", "lo"), streamChunks("Again")}}
+	send, next := startRPC(t, upstream)
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"completion/start","params":{"model":"openai/gpt-4o-mini","system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}}`)
+	// The response comes before any notification so the editor knows the id
+	if msg := next(); string(msg.ID) != "1" || string(msg.Result) != `{"id":"1"}` {
+		t.Fatalf("response to start = %+v", msg)
+	}
+	var deltas []string
+	msg := next()
+	for ; msg.Method == "completion/delta"; msg = next() {
+		deltas = append(deltas, msg.Params.Content)
+	}
+	if strings.Join(deltas, "") != "Hello" || msg.Method != "completion/done" || msg.Params.ID != "1" || msg.Params.Content != "Hello" || msg.Params.FinishReason != "stop" {
+		t.Fatalf("deltas %q then %+v, want Hello then completion/done", deltas, msg)
+	}
+
+	send(`{"jsonrpc":"2.0","id":2,"method":"completion/append","params":{"id":"1","content":"More"}}`)
+	if msg := next(); string(msg.ID) != "2" || string(msg.Result) != `{"id":"1"}` {
+		t.Fatalf("response to append = %+v", msg)
+	}
+	for msg = next(); msg.Method == "completion/delta"; msg = next() {
+	}
+	if msg.Method != "completion/done" || msg.Params.Content != "Again" {
+		t.Fatalf("appended completion ended with %+v", msg)
+	}
+
+	requests := upstream.requests()
+	if len(requests) != 2 {
+		t.Fatalf("upstream got %d requests, want 2", len(requests))
+	}
+	var body ChatCompletionOptions
+	if err := json.Unmarshal(requests[1], &body); err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, m := range body.Messages {
+		roles = append(roles, string(m.Role)+":"+*m.Content)
+	}
+	if want := "system:Be brief. user:Hi assistant:Hello user:More"; strings.Join(roles, " ") != want {
+		t.Errorf("appended request has messages %v, want %s", roles, want)
+	}
+}
+
+func TestRPCCompletionErrors(t *testing.T) {
+	send, next := startRPC(t, &rpcUpstream{handlers: []http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":"bad","message":"bad request"}}`))
+		},
+		// The connection closes before [DONE]
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Partial"}}]}` + "\n\n"))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Filtered"},"finish_reason":"content_filter","content_filter_results":{"violence":{"filtered":true,"severity":"high"}}}]}` + "\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+		},
+	}})
+
+	start := `{"jsonrpc":"2.0","id":1,"method":"completion/start","params":{"messages":[{"role":"user","content":"Hi"}]}}`
+	send(start)
+	next()
+	if msg := next(); msg.Method != "completion/error" || msg.Params.ID != "1" || !strings.Contains(msg.Params.Message, "bad request") {
+		t.Errorf("a rejected request notified %+v, want completion/error", msg)
+	}
+
+	// A stream that ends early reports the error with the partial content
+	send(start)
+	next()
+	msg := next()
+	for ; msg.Method == "completion/delta"; msg = next() {
+	}
+	if msg.Method != "completion/error" || msg.Params.ID != "2" || msg.Params.Content != "Partial" || msg.Params.Message == "" {
+		t.Errorf("an incomplete stream notified %+v, want completion/error with the partial content", msg)
+	}
+
+	// A filtered completion is an error with the content_filter finish reason
+	send(start)
+	next()
+	for msg = next(); msg.Method == "completion/delta"; msg = next() {
+	}
+	if msg.Method != "completion/error" || msg.Params.ID != "3" || msg.Params.FinishReason != "content_filter" || !strings.Contains(msg.Params.Message, "violence") {
+		t.Errorf("a filtered completion notified %+v, want completion/error with the content_filter reason", msg)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// maxStopSequences is the number of stop sequences the API accepts.
+const maxStopSequences = 4
+
+// stopSequences is the repeatable -stop flag. Sequences are kept verbatim, so they
+// may contain commas.
+type stopSequences []string
+
+func (s *stopSequences) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stopSequences) Set(value string) error {
+	if value == "" {
+		return fmt.Errorf("stop sequence must not be empty")
+	}
+	if len(*s) == maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+// samplingOptions holds the sampling flags. They are sent only when given or
+// configured, so the model's defaults apply otherwise.
+type samplingOptions struct {
+	fs *flag.FlagSet
+	// configured holds the flags with defaults from the configuration, which are
+	// sent as if given.
+	configured map[string]bool
+
+	temperature      *float64
+	topP             *float64
+	maxTokens        *int
+	presencePenalty  *float64
+	frequencyPenalty *float64
+	seed             *int
+	stop             stopSequences
+}
+
+// addSamplingFlags registers -temperature, -top-p, -max-tokens, -stop,
+// -presence-penalty, -frequency-penalty and -seed on fs.
+func addSamplingFlags(fs *flag.FlagSet) *samplingOptions {
+	s := &samplingOptions{fs: fs}
+	s.temperature = fs.Float64("temperature", 0, "Sampling temperature from 0 (focused) to 2 (random); the model default if not given")
+	s.topP = fs.Float64("top-p", 0, "Nucleus sampling: sample only from the tokens making up this probability mass, from 0 to 1")
+	s.maxTokens = fs.Int("max-tokens", 0, "Maximum number of tokens to generate")
+	s.presencePenalty = fs.Float64("presence-penalty", 0, "Penalty from -2 to 2 for tokens that already appeared, encouraging new topics")
+	s.frequencyPenalty = fs.Float64("frequency-penalty", 0, "Penalty from -2 to 2 scaled by how often tokens appeared, discouraging repetition")
+	s.seed = fs.Int("seed", 0, "Seed for deterministic sampling, where the model supports it")
+	fs.Var(&s.stop, "stop", "Sequence at which the model stops generating; repeatable up to 4 times")
+	return s
+}
+
+// visit calls fn for the flags that were given or configured.
+func (s *samplingOptions) visit(fn func(f *flag.Flag)) {
+	s.fs.VisitAll(func(f *flag.Flag) {
+		if s.configured[f.Name] {
+			fn(f)
+		}
+	})
+	s.fs.Visit(func(f *flag.Flag) {
+		if !s.configured[f.Name] {
+			fn(f)
+		}
+	})
+}
+
+// validate checks the ranges of the sampling flags that were given.
+func (s *samplingOptions) validate() error {
+	var err error
+	s.visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "temperature":
+			err = checkRange(f.Name, *s.temperature, 0, 2)
+		case "top-p":
+			err = checkRange(f.Name, *s.topP, 0, 1)
+		case "max-tokens":
+			if *s.maxTokens < 1 {
+				err = fmt.Errorf("-max-tokens must be at least 1")
+			}
+		case "presence-penalty":
+			err = checkRange(f.Name, *s.presencePenalty, -2, 2)
+		case "frequency-penalty":
+			err = checkRange(f.Name, *s.frequencyPenalty, -2, 2)
+		}
+	})
+	return err
+}
+
+// apply sets the sampling flags that were given on req.
+func (s *samplingOptions) apply(req *ChatCompletionOptions) {
+	s.visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "temperature":
+			req.Temperature = s.temperature
+		case "top-p":
+			req.TopP = s.topP
+		case "max-tokens":
+			req.MaxTokens = s.maxTokens
+		case "presence-penalty":
+			req.PresencePenalty = s.presencePenalty
+		case "frequency-penalty":
+			req.FrequencyPenalty = s.frequencyPenalty
+		case "seed":
+			req.Seed = s.seed
+		case "stop":
+			req.Stop = s.stop
+		}
+	})
+}
+
+// checkRange returns an error if the value of the named flag is outside [lo, hi].
+func checkRange(name string, v, lo, hi float64) error {
+	if v < lo || v > hi {
+		return fmt.Errorf("-%s must be between %g and %g", name, lo, hi)
+	}
+	return nil
+}
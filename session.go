@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/abatilo/ghmodelsproxy/conversation"
+)
+
+// sessionPath returns where the named session is stored.
+func sessionPath(name string) (string, error) {
+	if !promptNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions", name+".json"), nil
+}
+
+// loadSession returns the conversation saved at path, or nil if the session is new.
+func loadSession(path string) (*conversation.Conversation, error) {
+	conv, err := conversation.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return conv, err
+}
@@ -2,12 +2,53 @@ package stream
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
 	"strings"
 )
 
+// ErrIncompleteStream is returned when the stream ends without the [DONE] sentinel,
+// typically because the connection was closed early.
+var ErrIncompleteStream = errors.New("incomplete stream")
+
+// MalformedEventError is returned when an event cannot be interpreted. Reading may
+// continue with the next event.
+type MalformedEventError struct {
+	// Field is the SSE field name of the offending line.
+	Field string
+	// Data is the raw field value.
+	Data string
+	// Err is the underlying decoding error, if any.
+	Err error
+}
+
+func (e *MalformedEventError) Error() string {
+	if e.Err != nil {
+		return "malformed " + e.Field + " event: " + e.Err.Error()
+	}
+	return "unexpected event type: " + e.Field
+}
+
+func (e *MalformedEventError) Unwrap() error {
+	return e.Err
+}
+
+// ReadError is returned when the underlying stream fails, such as when the network
+// connection drops mid-stream.
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return "reading stream: " + e.Err.Error()
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
 // Reader is an interface for reading events from an SSE stream.
 type Reader[T any] interface {
 	// Read reads the next event from the stream.
@@ -17,16 +58,38 @@ type Reader[T any] interface {
 	Close() error
 }
 
-// EventReader streams events dynamically from an OpenAI endpoint.
+// EventReader streams events dynamically from an OpenAI endpoint. Characters split
+// across events are rejoined before decoding.
 type EventReader[T any] struct {
 	reader  io.ReadCloser // Required for Closing
 	scanner *bufio.Scanner
+	strict  bool
+	stitch  stitcher
+	// unterminated is set when the last scanned line had no line ending.
+	unterminated bool
 }
 
 // NewEventReader creates an EventReader that provides access to messages of
 // type T from r.
 func NewEventReader[T any](r io.ReadCloser) *EventReader[T] {
-	return &EventReader[T]{reader: r, scanner: bufio.NewScanner(r)}
+	er := &EventReader[T]{reader: r, scanner: bufio.NewScanner(r)}
+	er.scanner.Split(er.scanLines)
+	return er
+}
+
+// scanLines is bufio.ScanLines, recording whether the final line was cut short.
+func (er *EventReader[T]) scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	er.unterminated = atEOF && token != nil && (advance == 0 || data[advance-1] != '\n')
+	return advance, token, err
+}
+
+// DisallowUnknownFields causes Read to return a *MalformedEventError when an event has
+// fields that T does not declare, so changes to the backend's schema are noticed
+// instead of silently dropped.
+func (er *EventReader[T]) DisallowUnknownFields() *EventReader[T] {
+	er.strict = true
+	return er
 }
 
 // Read reads the next event from the stream.
@@ -34,37 +97,65 @@ func NewEventReader[T any](r io.ReadCloser) *EventReader[T] {
 func (er *EventReader[T]) Read() (T, error) {
 	// https://html.spec.whatwg.org/multipage/server-sent-events.html
 	for er.scanner.Scan() { // Scan while no error
-		line := er.scanner.Text() // Get the line & interpret the event stream:
-
-		if line == "" || line[0] == ':' { // If the line is blank or is a comment, skip it
+		line := er.scanner.Text()
+		// A line without an ending is either the end of the stream or a dropped
+		// connection, which must not be mistaken for a malformed event
+		if er.unterminated && !er.scanner.Scan() && er.scanner.Err() != nil {
+			break
+		}
+		field, value, ok := ParseLine(line)
+		if !ok {
 			continue
 		}
 
-		if strings.Contains(line, ":") { // If the line contains a U+003A COLON character (:), process the field
-			tokens := strings.SplitN(line, ":", 2)
-			tokens[0], tokens[1] = strings.TrimSpace(tokens[0]), strings.TrimSpace(tokens[1])
-			var data T
-			switch tokens[0] {
-			case "data": // return the deserialized JSON object
-				if tokens[1] == "[DONE]" { // If data is [DONE], end of stream was reached
-					return data, io.EOF
-				}
-				err := json.Unmarshal([]byte(tokens[1]), &data)
-				return data, err
-			default: // Any other event type is an unexpected
-				return data, errors.New("unexpected event type: " + tokens[0])
+		var data T
+		switch field {
+		case "data": // return the deserialized JSON object
+			if value == "[DONE]" { // If data is [DONE], end of stream was reached
+				return data, io.EOF
+			}
+			if err := er.decode(er.stitch.stitch([]byte(value)), &data); err != nil {
+				return data, &MalformedEventError{Field: field, Data: value, Err: err}
 			}
-			// Unreachable
+			return data, nil
+		case "event", "id", "retry": // Event metadata is not needed since payloads carry their own type
+			continue
+		default: // Any other event type is an unexpected
+			return data, &MalformedEventError{Field: field, Data: value}
 		}
 	}
 
 	scannerErr := er.scanner.Err()
 
 	if scannerErr == nil {
-		return *new(T), errors.New("incomplete stream")
+		return *new(T), ErrIncompleteStream
 	}
 
-	return *new(T), scannerErr
+	return *new(T), &ReadError{Err: scannerErr}
+}
+
+func (er *EventReader[T]) decode(data []byte, v *T) error {
+	if !er.strict {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ParseLine parses one line of an SSE stream into its field name and value, with
+// surrounding whitespace trimmed from both. It returns false for blank lines, comments
+// and lines without a field separator, which carry no event data.
+func ParseLine(line string) (field, value string, ok bool) {
+	// https://html.spec.whatwg.org/multipage/server-sent-events.html
+	if line == "" || line[0] == ':' { // If the line is blank or is a comment, skip it
+		return "", "", false
+	}
+	field, value, ok = strings.Cut(line, ":")
+	if !ok {
+		return "", "", false
+	}
+	return strings.TrimSpace(field), strings.TrimSpace(value), true
 }
 
 // Close closes the EventReader and any applicable inner stream state.
@@ -0,0 +1,297 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingReader returns data and then err.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestEventReaderErrors(t *testing.T) {
+	type event struct {
+		Delta string `json:"delta"`
+	}
+	dropped := errors.New("connection reset by peer")
+	tests := []struct {
+		name  string
+		input io.Reader
+		// strict makes the reader reject unknown fields
+		strict bool
+		// want lists the outcome of each Read: a delta, or the error it returns
+		want []string
+		// check inspects the final error
+		check func(t *testing.T, err error)
+	}{
+		{
+			name:  "no [DONE]",
+			input: strings.NewReader("data: {\"delta\":\"a\"}\n\n"),
+			want:  []string{"a", "incomplete stream"},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrIncompleteStream) {
+					t.Errorf("err = %v, want ErrIncompleteStream", err)
+				}
+			},
+		},
+		{
+			name:  "dropped connection",
+			input: &failingReader{data: "data: {\"delta\":\"a\"}\n\n", err: dropped},
+			want:  []string{"a", "reading stream: connection reset by peer"},
+			check: func(t *testing.T, err error) {
+				var readErr *ReadError
+				if !errors.As(err, &readErr) || !errors.Is(err, dropped) {
+					t.Errorf("err = %v, want a *ReadError wrapping the read failure", err)
+				}
+			},
+		},
+		{
+			// The cut off event is not reported as malformed
+			name:  "dropped mid-event",
+			input: &failingReader{data: "data: {\"delta\":\"a\"}\n\ndata: {\"del", err: dropped},
+			want:  []string{"a", "reading stream: connection reset by peer"},
+		},
+		{
+			name:  "malformed JSON",
+			input: strings.NewReader("data: {\"delta\":\n\ndata: {\"delta\":\"b\"}\n\ndata: [DONE]\n\n"),
+			want:  []string{"malformed data event: unexpected end of JSON input", "b", "EOF"},
+		},
+		{
+			name:  "unexpected field",
+			input: strings.NewReader("oops: 1\n\ndata: [DONE]\n\n"),
+			want:  []string{"unexpected event type: oops", "EOF"},
+		},
+		{
+			name:   "unknown JSON field",
+			input:  strings.NewReader("data: {\"delta\":\"a\",\"extra\":1}\n\ndata: [DONE]\n\n"),
+			strict: true,
+			want:   []string{`malformed data event: json: unknown field "extra"`, "EOF"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewEventReader[event](io.NopCloser(tt.input))
+			if tt.strict {
+				reader.DisallowUnknownFields()
+			}
+			defer reader.Close()
+
+			var got []string
+			var err error
+			for range tt.want {
+				var e event
+				e, err = reader.Read()
+				if err != nil {
+					got = append(got, err.Error())
+					var malformed *MalformedEventError
+					if errors.As(err, &malformed) && malformed.Field == "" {
+						t.Errorf("a malformed event has no field: %+v", malformed)
+					}
+					continue
+				}
+				got = append(got, e.Delta)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("reads = %q, want %q", got, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, err)
+			}
+		})
+	}
+}
+
+func TestMalformedEventError(t *testing.T) {
+	reader := NewEventReader[map[string]any](io.NopCloser(strings.NewReader("data: [1,\n\n")))
+	_, err := reader.Read()
+	var malformed *MalformedEventError
+	if !errors.As(err, &malformed) || malformed.Field != "data" || malformed.Data != "[1," {
+		t.Fatalf("err = %#v, want a *MalformedEventError with the raw data", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("err = %v, want it to wrap the decoding error", err)
+	}
+}
+
+func TestEventReaderStitchesSplitCharacters(t *testing.T) {
+	type event struct {
+		Delta string `json:"delta"`
+		Done  string `json:"done"`
+	}
+	tests := []struct {
+		name   string
+		events []string
+		want   string
+	}{
+		{"utf-8 bytes", []string{"{\"delta\":\"a\xf0\x9f\"}", "{\"delta\":\"\x98\x80b\"}"}, "a😀b"},
+		{"surrogate escapes", []string{`{"delta":"a\ud83d"}`, `{"delta":"\ude00b"}`}, "a😀b"},
+		{"a fragment split again", []string{"{\"delta\":\"\xf0\"}", "{\"delta\":\"\x9f\x98\"}", "{\"delta\":\"\x80\"}"}, "😀"},
+		{"another field between", []string{"{\"delta\":\"\xc3\",\"done\":\"\"}", "{\"done\":\"x\"}", "{\"delta\":\"\xa9\"}"}, "é"},
+		{"an escaped backslash", []string{`{"delta":"\\ud83d"}`, `{"delta":"!"}`}, `\ud83d!`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input strings.Builder
+			for _, e := range tt.events {
+				input.WriteString("data: " + e + "\n\n")
+			}
+			input.WriteString("data: [DONE]\n\n")
+			reader := NewEventReader[event](io.NopCloser(strings.NewReader(input.String())))
+			defer reader.Close()
+
+			var got strings.Builder
+			for {
+				e, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got.WriteString(e.Delta)
+			}
+			if got.String() != tt.want {
+				t.Errorf("deltas = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+// maxEvents bounds how many events a fuzzed stream is read for.
+const maxEvents = 10000
+
+// addStreamCorpus seeds f with the recorded and malformed streams under testdata/streams.
+func addStreamCorpus(f *testing.F) {
+	f.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "streams", "*.sse"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	if len(paths) == 0 {
+		f.Fatal("no seed streams found")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+}
+
+func FuzzParseLine(f *testing.F) {
+	for _, line := range []string{"", ":", ": keep-alive", "data: [DONE]", "data:{}", "event: x", "no colon", " data : padded ", "data: a: b"} {
+		f.Add(line)
+	}
+	addStreamCorpus(f)
+
+	f.Fuzz(func(t *testing.T, line string) {
+		field, value, ok := ParseLine(line)
+		if !ok {
+			if field != "" || value != "" {
+				t.Fatalf("ParseLine(%q) returned %q, %q without ok", line, field, value)
+			}
+			return
+		}
+		if strings.Contains(field, ":") {
+			t.Fatalf("ParseLine(%q) field %q contains a colon", line, field)
+		}
+		if field != strings.TrimSpace(field) || value != strings.TrimSpace(value) {
+			t.Fatalf("ParseLine(%q) = %q, %q is not trimmed", line, field, value)
+		}
+	})
+}
+
+func FuzzEventReader(f *testing.F) {
+	addStreamCorpus(f)
+
+	f.Fuzz(func(t *testing.T, input string) {
+		reader := NewEventReader[map[string]any](io.NopCloser(strings.NewReader(input)))
+		defer reader.Close()
+
+		for range maxEvents {
+			_, err := reader.Read()
+			if err == nil {
+				continue
+			}
+			var malformed *MalformedEventError
+			var readErr *ReadError
+			switch {
+			case errors.Is(err, io.EOF), errors.Is(err, ErrIncompleteStream):
+				return
+			case errors.As(err, &malformed), errors.As(err, &readErr):
+				// Readers may continue past malformed events; a read error ends the stream
+				if readErr != nil {
+					return
+				}
+			default:
+				t.Fatalf("Read() returned an untyped error: %v", err)
+			}
+		}
+	})
+}
+
+func TestEventReaderCorpus(t *testing.T) {
+	tests := []struct {
+		file      string
+		events    int
+		malformed int
+		end       error
+	}{
+		{"chat_completion.sse", 5, 0, io.EOF},
+		{"tool_calls.sse", 6, 0, io.EOF},
+		{"responses_api.sse", 3, 0, ErrIncompleteStream},
+		{"keepalive_crlf.sse", 1, 0, io.EOF},
+		{"malformed.sse", 1, 3, io.EOF},
+		{"truncated.sse", 1, 1, ErrIncompleteStream},
+		{"unicode.sse", 1, 0, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "streams", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := NewEventReader[map[string]any](f)
+			defer reader.Close()
+
+			var events, malformed int
+			for {
+				_, err := reader.Read()
+				if err == nil {
+					events++
+					continue
+				}
+				var malformedErr *MalformedEventError
+				if errors.As(err, &malformedErr) {
+					malformed++
+					continue
+				}
+				if !errors.Is(err, tt.end) {
+					t.Fatalf("stream ended with %v, want %v", err, tt.end)
+				}
+				break
+			}
+			if events != tt.events || malformed != tt.malformed {
+				t.Errorf("got %d events and %d malformed, want %d and %d", events, malformed, tt.events, tt.malformed)
+			}
+		})
+	}
+}
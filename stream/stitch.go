@@ -0,0 +1,153 @@
+package stream
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// stitcher rejoins characters split across events before they are decoded. A
+// backend may end one event's string with the first bytes of a multi-byte UTF-8
+// sequence, or with the high half of a \uD83D\uDE00 surrogate pair escape, and send
+// the rest at the start of the same string in the next event. Decoding either half
+// alone yields U+FFFD, so the trailing fragment is held back and prepended to the
+// string at the same JSON path in the next event instead.
+type stitcher struct {
+	// pending maps the JSON path of a string to its held back fragment.
+	pending map[string][]byte
+}
+
+// container is an object or array being walked, with the position in it.
+type container struct {
+	array bool
+	// key is the current key of an object, and expectKey is set until its colon.
+	key       string
+	expectKey bool
+	index     int
+}
+
+// stitch returns data with fragments held back from earlier events prepended to
+// their strings, and any fragment ending a string in data held back.
+func (s *stitcher) stitch(data []byte) []byte {
+	if len(s.pending) == 0 && utf8.Valid(data) && !bytes.Contains(bytes.ToLower(data), []byte(`\ud`)) {
+		return data
+	}
+	if s.pending == nil {
+		s.pending = map[string][]byte{}
+	}
+
+	out := make([]byte, 0, len(data))
+	var stack []container
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '"':
+			end := stringEnd(data, i)
+			if end < 0 { // not valid JSON; leave it to the decoder to report
+				return data
+			}
+			literal := data[i+1 : end]
+			i = end
+			if n := len(stack); n > 0 && !stack[n-1].array && stack[n-1].expectKey {
+				stack[n-1].key = string(literal)
+				out = append(append(append(out, '"'), literal...), '"')
+				continue
+			}
+			path := jsonPath(stack)
+			if fragment, ok := s.pending[path]; ok {
+				literal = append(append([]byte(nil), fragment...), literal...)
+				delete(s.pending, path)
+			}
+			if cut := fragmentStart(literal); cut < len(literal) {
+				s.pending[path] = append([]byte(nil), literal[cut:]...)
+				literal = literal[:cut]
+			}
+			out = append(append(append(out, '"'), literal...), '"')
+			continue
+		case '{', '[':
+			stack = append(stack, container{array: c == '[', expectKey: c == '{'})
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ':':
+			if n := len(stack); n > 0 {
+				stack[n-1].expectKey = false
+			}
+		case ',':
+			if n := len(stack); n > 0 {
+				if stack[n-1].array {
+					stack[n-1].index++
+				} else {
+					stack[n-1].expectKey = true
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// stringEnd returns the offset of the quote closing the string literal opened at
+// start, or -1 if it is not closed.
+func stringEnd(data []byte, start int) int {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonPath identifies the value at the top of stack, such as choices/0/delta/content.
+func jsonPath(stack []container) string {
+	var b strings.Builder
+	for i, c := range stack {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		if c.array {
+			b.WriteString(strconv.Itoa(c.index))
+		} else {
+			b.WriteString(c.key)
+		}
+	}
+	return b.String()
+}
+
+// fragmentStart returns the offset of the incomplete character ending the raw string
+// literal s, either a partial UTF-8 sequence or a high surrogate escape, or len(s)
+// if s ends in a complete one.
+func fragmentStart(s []byte) int {
+	// Bytes of a UTF-8 sequence are never part of an escape, so they can be checked
+	// without regard to backslashes
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRune(s[i:]) {
+				return i
+			}
+			break
+		}
+	}
+
+	start := len(s) - 6
+	if start < 0 || s[start] != '\\' || s[start+1] != 'u' {
+		return len(s)
+	}
+	// The backslash only starts an escape if it is not itself escaped
+	backslashes := 0
+	for i := start; i >= 0 && s[i] == '\\'; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 0 {
+		return len(s)
+	}
+	if r, err := strconv.ParseUint(string(s[start+2:]), 16, 16); err == nil && r >= 0xD800 && r <= 0xDBFF {
+		return start
+	}
+	return len(s)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinStyles are the snippets -style adds to the system prompt.
+var builtinStyles = map[string]string{
+	"terse":       "Be terse: answer in as few words as the question allows.",
+	"detailed":    "Explain your answer in detail, step by step.",
+	"no-comments": "Do not add comments to code.",
+	"plain":       "Answer in plain text, without Markdown formatting.",
+	"formal":      "Use a formal tone.",
+}
+
+// styleSnippets returns the snippets of the comma-separated style names, looking
+// them up in custom before the built-in styles.
+func styleSnippets(names string, custom map[string]string) ([]string, error) {
+	var snippets []string
+	for _, name := range splitList(names) {
+		snippet, ok := custom[name]
+		if !ok {
+			snippet, ok = builtinStyles[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown style %q; available styles: %s", name, strings.Join(styleNames(custom), ", "))
+		}
+		snippets = append(snippets, snippet)
+	}
+	return snippets, nil
+}
+
+func styleNames(custom map[string]string) []string {
+	var names []string
+	for name := range builtinStyles {
+		if _, ok := custom[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// composeSystemPrompt appends the language and style constraints to prompt. Those
+// already in it are not repeated, so that resumed sessions do not accumulate them.
+func composeSystemPrompt(prompt, lang string, snippets []string) string {
+	if lang != "" {
+		snippets = append([]string{"Answer in " + lang + "."}, snippets...)
+	}
+	var missing []string
+	for _, snippet := range snippets {
+		if !strings.Contains(prompt, snippet) {
+			missing = append(missing, snippet)
+		}
+	}
+	if len(missing) == 0 {
+		return prompt
+	}
+	if prompt == "" {
+		return strings.Join(missing, " ")
+	}
+	return prompt + "\n\n" + strings.Join(missing, " ")
+}
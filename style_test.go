@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestComposeSystemPrompt(t *testing.T) {
+	snippets, err := styleSnippets("terse,pirate", map[string]string{"pirate": "Talk like a pirate."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := composeSystemPrompt("You are a coding assistant", "German", snippets)
+	want := "You are a coding assistant\n\nAnswer in German. " + builtinStyles["terse"] + " Talk like a pirate."
+	if got != want {
+		t.Errorf("composed %q, want %q", got, want)
+	}
+	// A resumed session already holds the constraints
+	if again := composeSystemPrompt(got, "German", snippets); again != got {
+		t.Errorf("composed again %q, want %q", again, got)
+	}
+
+	if _, err := styleSnippets("sarcastic", nil); err == nil {
+		t.Error("expected an error for an unknown style")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// executionSummary holds the metrics reported after a completion finishes.
+type executionSummary struct {
+	// Model and RequestID identify the request in the JSON metrics.
+	Model            string
+	RequestID        string
+	TotalDuration    time.Duration
+	TimeToFirstToken time.Duration
+	// EstimatedTokens estimates the output tokens from the received text, for
+	// backends that report no usage.
+	EstimatedTokens int
+	// Usage is the usage reported by the backend, if any.
+	Usage *Usage
+	// Price is the configured price of the model, if any, for estimating the cost.
+	Price *modelPrice
+}
+
+// Cost returns the estimated cost of the request in USD, if the model has a price
+// and the backend reported usage.
+func (s executionSummary) Cost() (float64, bool) {
+	if s.Price == nil || s.Usage == nil {
+		return 0, false
+	}
+	return (float64(s.Usage.PromptTokens)*s.Price.Input + float64(s.Usage.CompletionTokens)*s.Price.Output) / 1e6, true
+}
+
+// OutputTokens returns the completion tokens reported by the backend, or the
+// estimate if it reported none.
+func (s executionSummary) OutputTokens() int {
+	if s.Usage != nil {
+		return s.Usage.CompletionTokens
+	}
+	return s.EstimatedTokens
+}
+
+// TokensPerSecond returns the output throughput over the whole request.
+func (s executionSummary) TokensPerSecond() float64 {
+	return float64(s.OutputTokens()) / s.TotalDuration.Seconds()
+}
+
+// write renders the summary in the format printed by the CLI.
+func (s executionSummary) write(w io.Writer) {
+	fmt.Fprintf(w, "\nExecution Summary:\n")
+	fmt.Fprintf(w, "Total duration:          %v\n", s.TotalDuration)
+	fmt.Fprintf(w, "Time to first token:     %v\n", s.TimeToFirstToken)
+	if s.Usage != nil {
+		fmt.Fprintf(w, "Prompt tokens:           %d\n", s.Usage.PromptTokens)
+		fmt.Fprintf(w, "Completion tokens:       %d\n", s.Usage.CompletionTokens)
+		fmt.Fprintf(w, "Total tokens:            %d\n", s.Usage.TotalTokens)
+	} else {
+		fmt.Fprintf(w, "Completion tokens:       ~%d (estimated, no usage reported)\n", s.EstimatedTokens)
+	}
+	fmt.Fprintf(w, "Tokens per second:       %.2f\n", s.TokensPerSecond())
+	if s.Usage != nil {
+		fmt.Fprintf(w, "Cached prompt tokens:    %d of %d\n", s.Usage.CachedTokens(), s.Usage.PromptTokens)
+		if reasoningTokens := s.Usage.ReasoningTokens(); reasoningTokens > 0 {
+			fmt.Fprintf(w, "Reasoning tokens:        %d of %d\n", reasoningTokens, s.Usage.CompletionTokens)
+		}
+	}
+	if cost, ok := s.Cost(); ok {
+		fmt.Fprintf(w, "Estimated cost:          $%.6f\n", cost)
+	}
+}
+
+// summaryMetrics is the JSON form of an execution summary.
+type summaryMetrics struct {
+	Model            string   `json:"model"`
+	RequestID        string   `json:"request_id,omitempty"`
+	DurationMS       float64  `json:"duration_ms"`
+	TimeToFirstToken float64  `json:"time_to_first_token_ms"`
+	Usage            *Usage   `json:"usage"`
+	EstimatedTokens  int      `json:"estimated_tokens,omitempty"`
+	TokensPerSecond  float64  `json:"tokens_per_second"`
+	CostUSD          *float64 `json:"cost_usd,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	// Partial holds what was received of a response cut short.
+	Partial *partialMetrics `json:"partial,omitempty"`
+}
+
+// partialMetrics is the JSON form of a *PartialCompletion.
+type partialMetrics struct {
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Tokens    int        `json:"tokens"`
+	Estimated bool       `json:"estimated,omitempty"`
+	Cause     string     `json:"cause"`
+}
+
+// writeJSON writes the summary as a single line of JSON, with the error that ended
+// the response, if any.
+func (s executionSummary) writeJSON(w io.Writer, runErr error) error {
+	metrics := summaryMetrics{
+		Model:            s.Model,
+		RequestID:        s.RequestID,
+		DurationMS:       milliseconds(s.TotalDuration),
+		TimeToFirstToken: milliseconds(s.TimeToFirstToken),
+		Usage:            s.Usage,
+		TokensPerSecond:  s.TokensPerSecond(),
+	}
+	if s.Usage == nil {
+		metrics.EstimatedTokens = s.EstimatedTokens
+	}
+	if cost, ok := s.Cost(); ok {
+		metrics.CostUSD = &cost
+	}
+	if runErr != nil {
+		metrics.Error = runErr.Error()
+	}
+	var partial *PartialCompletion
+	if errors.As(runErr, &partial) {
+		metrics.Partial = &partialMetrics{
+			Content:   partial.Content(),
+			ToolCalls: partial.Message.ToolCalls,
+			Tokens:    partial.Tokens,
+			Estimated: partial.Estimated,
+			Cause:     partial.Cause.Error(),
+		}
+	}
+	return json.NewEncoder(w).Encode(metrics)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abatilo/ghmodelsproxy/modelstest"
+)
+
+func TestExecutionSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary executionSummary
+	}{
+		{"summary_text", executionSummary{TotalDuration: 2 * time.Second, TimeToFirstToken: 300 * time.Millisecond, EstimatedTokens: 42}},
+		{"summary_usage", executionSummary{
+			TotalDuration:    1500 * time.Millisecond,
+			TimeToFirstToken: 120 * time.Millisecond,
+			EstimatedTokens:  10,
+			Usage: &Usage{
+				PromptTokens:            5000,
+				CompletionTokens:        300,
+				TotalTokens:             5300,
+				PromptTokensDetails:     &PromptTokensDetails{CachedTokens: 4096},
+				CompletionTokensDetails: &CompletionTokensDetails{ReasoningTokens: 200},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			tt.summary.write(&out)
+			modelstest.AssertGolden(t, "testdata/"+tt.name+".golden", out.String())
+		})
+	}
+}
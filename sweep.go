@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// parseSeeds parses a comma-separated list of seeds and inclusive ranges, such as
+// "1..10" or "1,5,20..22".
+func parseSeeds(value string) ([]int, error) {
+	var seeds []int
+	for _, part := range splitList(value) {
+		from, to, isRange := strings.Cut(part, "..")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil || end < start {
+				return nil, fmt.Errorf("invalid seed range %q", part)
+			}
+		}
+		for seed := start; seed <= end; seed++ {
+			seeds = append(seeds, seed)
+		}
+	}
+	if len(seeds) == 0 {
+		return nil, errors.New("no seeds given")
+	}
+	return seeds, nil
+}
+
+// parseTemperatures parses a comma-separated list of temperatures.
+func parseTemperatures(value string) ([]*float64, error) {
+	if value == "" {
+		// The model's default temperature
+		return []*float64{nil}, nil
+	}
+	var temperatures []*float64
+	for _, part := range splitList(value) {
+		t, err := strconv.ParseFloat(part, 64)
+		if err != nil || t < 0 || t > 2 {
+			return nil, fmt.Errorf("invalid temperature %q: must be between 0 and 2", part)
+		}
+		temperatures = append(temperatures, &t)
+	}
+	if len(temperatures) == 0 {
+		return nil, errors.New("no temperatures given")
+	}
+	return temperatures, nil
+}
+
+// similarity returns how similar two outputs are, from 0 to 1, as the share of words
+// in their longest common subsequence.
+func similarity(a, b string) float64 {
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	if len(wordsA)+len(wordsB) == 0 {
+		return 1
+	}
+	common := 0
+	for _, op := range diffTokens(wordsA, wordsB) {
+		if op.kind == ' ' {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wordsA)+len(wordsB))
+}
+
+// sweepRun is one request of a sweep.
+type sweepRun struct {
+	Seed        int
+	Temperature *float64
+	Output      string
+	Err         error
+}
+
+// sweepStats summarizes how much the outputs of a sweep diverge.
+type sweepStats struct {
+	Runs     int
+	Distinct int
+	// MeanSimilarity and MinSimilarity are taken over all pairs of outputs.
+	MeanSimilarity float64
+	MinSimilarity  float64
+	// Similarity holds each output's mean similarity to the other outputs.
+	Similarity []float64
+}
+
+func computeSweepStats(outputs []string) sweepStats {
+	stats := sweepStats{Runs: len(outputs), MinSimilarity: 1, MeanSimilarity: 1, Similarity: make([]float64, len(outputs))}
+	distinct := map[string]bool{}
+	for _, output := range outputs {
+		distinct[output] = true
+	}
+	stats.Distinct = len(distinct)
+	if len(outputs) < 2 {
+		for i := range stats.Similarity {
+			stats.Similarity[i] = 1
+		}
+		return stats
+	}
+
+	var total float64
+	pairs := 0
+	for i := range outputs {
+		for j := i + 1; j < len(outputs); j++ {
+			s := similarity(outputs[i], outputs[j])
+			total += s
+			pairs++
+			stats.MinSimilarity = min(stats.MinSimilarity, s)
+			stats.Similarity[i] += s
+			stats.Similarity[j] += s
+		}
+	}
+	stats.MeanSimilarity = total / float64(pairs)
+	for i := range stats.Similarity {
+		stats.Similarity[i] /= float64(len(outputs) - 1)
+	}
+	return stats
+}
+
+// runSweep implements the `sweep` subcommand.
+func runSweep(args []string) int {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	model := modelFlag(fs, "model", "OpenAI/gpt-4.1", "Model to sweep")
+	seedsFlag := fs.String("seeds", "1..5", "Seeds to run, as a comma-separated list of seeds and ranges such as 1..10")
+	temperaturesFlag := fs.String("temperatures", "", "Comma-separated temperatures to run each seed at; defaults to the model's default")
+	parallel := fs.Int("parallel", 4, "Number of requests in flight at once")
+	showOutputs := fs.Bool("show-outputs", false, "Print each distinct output after the statistics")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s sweep [flags] <prompt>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 || *parallel < 1 {
+		fs.Usage()
+		return 2
+	}
+	seeds, err := parseSeeds(*seedsFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	temperatures, err := parseTemperatures(*temperaturesFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var runs []*sweepRun
+	for _, temperature := range temperatures {
+		for _, seed := range seeds {
+			runs = append(runs, &sweepRun{Seed: seed, Temperature: temperature})
+		}
+	}
+
+	client := newCLIClient()
+	prompt := fs.Arg(0)
+	ctx := context.TODO()
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			req := ChatCompletionOptions{
+				Model:       *model,
+				Messages:    []ChatMessage{{Role: ChatMessageRoleUser, Content: &prompt}},
+				Seed:        &run.Seed,
+				Temperature: run.Temperature,
+			}
+			msg, err := client.streamCompletion(ctx, req, nil)
+			run.Err = err
+			if msg.Content != nil {
+				run.Output = *msg.Content
+			}
+		}()
+	}
+	wg.Wait()
+
+	var succeeded []*sweepRun
+	var outputs []string
+	for _, run := range runs {
+		if run.Err != nil {
+			fmt.Fprintf(os.Stderr, "seed %d: %v\n", run.Seed, run.Err)
+			continue
+		}
+		succeeded = append(succeeded, run)
+		outputs = append(outputs, run.Output)
+	}
+	if len(succeeded) == 0 {
+		return 1
+	}
+	stats := computeSweepStats(outputs)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEED\tTEMPERATURE\tWORDS\tSIMILARITY\t")
+	for i, run := range succeeded {
+		temperature := "default"
+		if run.Temperature != nil {
+			temperature = strconv.FormatFloat(*run.Temperature, 'f', -1, 64)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%.2f\t\n", run.Seed, temperature, len(strings.Fields(run.Output)), stats.Similarity[i])
+	}
+	tw.Flush()
+
+	fmt.Printf("\n%d runs, %d distinct outputs\n", stats.Runs, stats.Distinct)
+	fmt.Printf("Mean pairwise similarity: %.2f\n", stats.MeanSimilarity)
+	fmt.Printf("Min pairwise similarity:  %.2f\n", stats.MinSimilarity)
+
+	if *showOutputs {
+		seen := map[string]bool{}
+		for _, run := range succeeded {
+			if seen[run.Output] {
+				continue
+			}
+			seen[run.Output] = true
+			fmt.Printf("\n=== seed %d ===\n%s\n", run.Seed, run.Output)
+		}
+	}
+
+	if len(succeeded) < len(runs) {
+		return 1
+	}
+	return 0
+}
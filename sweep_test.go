@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseSeeds(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr string
+	}{
+		{value: "1..3", want: []int{1, 2, 3}},
+		{value: "1,5,20..22", want: []int{1, 5, 20, 21, 22}},
+		{value: " 7 ", want: []int{7}},
+		{value: "4..4", want: []int{4}},
+		{value: "-2..0", want: []int{-2, -1, 0}},
+		{value: "3..1", wantErr: `invalid seed range "3..1"`},
+		{value: "1..y", wantErr: `invalid seed range "1..y"`},
+		{value: "x", wantErr: `invalid seed "x"`},
+		{value: "", wantErr: "no seeds given"},
+		{value: " , ", wantErr: "no seeds given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSeeds(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSeeds(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemperatures(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []float64 // -1 for the model's default
+		wantErr string
+	}{
+		{value: "", want: []float64{-1}},
+		{value: "0, 0.7,2", want: []float64{0, 0.7, 2}},
+		{value: "2.5", wantErr: `invalid temperature "2.5": must be between 0 and 2`},
+		{value: "-1", wantErr: `invalid temperature "-1": must be between 0 and 2`},
+		{value: "hot", wantErr: `invalid temperature "hot": must be between 0 and 2`},
+		{value: ",", wantErr: "no temperatures given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTemperatures(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var values []float64
+			for _, temperature := range got {
+				if temperature == nil {
+					values = append(values, -1)
+				} else {
+					values = append(values, *temperature)
+				}
+			}
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("parseTemperatures(%q) = %v, want %v", tt.value, values, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"a b c", "a b c", 1},
+		{"", "", 1},
+		{"a b", "", 0},
+		{"the cat sat", "the dog sat", 2.0 / 3},
+		{"a  b\n", "a b", 1},
+		{"one two three four", "four three two one", 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeSweepStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []string
+		want    sweepStats
+	}{
+		{"none", nil, sweepStats{MeanSimilarity: 1, MinSimilarity: 1, Similarity: []float64{}}},
+		{"one", []string{"x"}, sweepStats{Runs: 1, Distinct: 1, MeanSimilarity: 1, MinSimilarity: 1, Similarity: []float64{1}}},
+		{"identical", []string{"a b", "a b"}, sweepStats{Runs: 2, Distinct: 1, MeanSimilarity: 1, MinSimilarity: 1, Similarity: []float64{1, 1}}},
+		{"diverging", []string{"a b", "a b", "c d"}, sweepStats{Runs: 3, Distinct: 2, MeanSimilarity: 1.0 / 3, MinSimilarity: 0, Similarity: []float64{0.5, 0.5, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeSweepStats(tt.outputs)
+			near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+			ok := got.Runs == tt.want.Runs && got.Distinct == tt.want.Distinct &&
+				near(got.MeanSimilarity, tt.want.MeanSimilarity) && near(got.MinSimilarity, tt.want.MinSimilarity) &&
+				len(got.Similarity) == len(tt.want.Similarity)
+			for i := range got.Similarity {
+				ok = ok && near(got.Similarity[i], tt.want.Similarity[i])
+			}
+			if !ok {
+				t.Errorf("computeSweepStats(%q) = %+v, want %+v", tt.outputs, got, tt.want)
+			}
+		})
+	}
+}
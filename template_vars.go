@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// charsPerToken is a rough average used to estimate token counts without a tokenizer.
+const charsPerToken = 4
+
+// estimateTokens returns a rough token count of s.
+func estimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + charsPerToken - 1) / charsPerToken
+}
+
+// templateVarPattern matches names usable as {{.name}} in a template.
+var templateVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templateVar is a variable given with -var, holding text, @file or - for stdin.
+type templateVar struct {
+	name   string
+	source string
+}
+
+// templateVars is the repeatable -var flag.
+type templateVars []templateVar
+
+func (v *templateVars) String() string {
+	var parts []string
+	for _, tv := range *v {
+		parts = append(parts, tv.name+"="+tv.source)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (v *templateVars) Set(s string) error {
+	name, source, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid variable %q: want name=value, name=@file or name=-", s)
+	}
+	if !templateVarPattern.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: use letters, digits and underscores", name)
+	}
+	// A later value replaces an earlier one, so that rerun can override variables
+	for i, tv := range *v {
+		if tv.name == name {
+			(*v)[i].source = source
+			return nil
+		}
+	}
+	*v = append(*v, templateVar{name: name, source: source})
+	return nil
+}
+
+// readsStdin reports whether any variable is read from stdin.
+func (v templateVars) readsStdin() bool {
+	for _, tv := range v {
+		if tv.source == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve reads the variables' values, rejecting values larger than maxBytes or
+// estimated at more than maxTokens tokens. Zero disables a limit.
+func (v templateVars) resolve(maxBytes, maxTokens int) (map[string]string, error) {
+	values := map[string]string{}
+	for _, tv := range v {
+		value, err := readPromptText(tv.source)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", tv.name, err)
+		}
+		if maxBytes > 0 && len(value) > maxBytes {
+			return nil, fmt.Errorf("variable %s is %d bytes, more than the limit of %d", tv.name, len(value), maxBytes)
+		}
+		if tokens := estimateTokens(value); maxTokens > 0 && tokens > maxTokens {
+			return nil, fmt.Errorf("variable %s is about %d tokens, more than the limit of %d", tv.name, tokens, maxTokens)
+		}
+		values[tv.name] = value
+	}
+	return values, nil
+}
+
+// renderPrompt renders text as a template with the variables, as in {{.name}}. Using
+// a variable that was not given is an error.
+func renderPrompt(text string, values map[string]string) (string, error) {
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, values); err != nil {
+		var execErr template.ExecError
+		if errors.As(err, &execErr) {
+			return "", fmt.Errorf("rendering prompt: %w", execErr.Err)
+		}
+		return "", err
+	}
+	return sb.String(), nil
+}
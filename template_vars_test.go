@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateVarsSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    templateVars
+		stdin   bool
+		wantErr string
+	}{
+		{name: "text", args: []string{"lang=Go"}, want: templateVars{{"lang", "Go"}}},
+		{name: "equals in value", args: []string{"expr=a=b"}, want: templateVars{{"expr", "a=b"}}},
+		{name: "empty value", args: []string{"note="}, want: templateVars{{"note", ""}}},
+		{name: "file and stdin", args: []string{"code=@main.go", "input=-"}, want: templateVars{{"code", "@main.go"}, {"input", "-"}}, stdin: true},
+		{name: "later value wins", args: []string{"lang=Go", "tone=terse", "lang=Rust"}, want: templateVars{{"lang", "Rust"}, {"tone", "terse"}}},
+		{name: "no value", args: []string{"lang"}, wantErr: `invalid variable "lang": want name=value, name=@file or name=-`},
+		{name: "no name", args: []string{"=Go"}, wantErr: `invalid variable "=Go"`},
+		{name: "invalid name", args: []string{"my-lang=Go"}, wantErr: `invalid variable name "my-lang": use letters, digits and underscores`},
+		{name: "leading digit", args: []string{"1st=Go"}, wantErr: `invalid variable name "1st"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vars templateVars
+			var err error
+			for _, arg := range tt.args {
+				if err = vars.Set(arg); err != nil {
+					break
+				}
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(vars, tt.want) {
+				t.Errorf("vars = %v, want %v", vars, tt.want)
+			}
+			if got := vars.readsStdin(); got != tt.stdin {
+				t.Errorf("readsStdin() = %v, want %v", got, tt.stdin)
+			}
+		})
+	}
+}
+
+func TestTemplateVarsResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "code.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name                string
+		vars                templateVars
+		maxBytes, maxTokens int
+		want                map[string]string
+		wantErr             string
+	}{
+		{name: "none", want: map[string]string{}},
+		{name: "text and file", vars: templateVars{{"lang", "Go"}, {"code", "@" + path}}, want: map[string]string{"lang": "Go", "code": "package main\n"}},
+		{name: "missing file", vars: templateVars{{"code", "@" + path + ".missing"}}, wantErr: "variable code: open"},
+		{name: "within limits", vars: templateVars{{"code", "@" + path}}, maxBytes: 13, maxTokens: 4, want: map[string]string{"code": "package main\n"}},
+		{name: "too many bytes", vars: templateVars{{"code", "@" + path}}, maxBytes: 12, wantErr: "variable code is 13 bytes, more than the limit of 12"},
+		{name: "too many tokens", vars: templateVars{{"code", "@" + path}}, maxTokens: 3, wantErr: "variable code is about 4 tokens, more than the limit of 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.vars.resolve(tt.maxBytes, tt.maxTokens)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	values := map[string]string{"lang": "Go", "code": "x := 1"}
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+	}{
+		{name: "plain text", text: "Explain closures", want: "Explain closures"},
+		{name: "variables", text: "Review this {{.lang}}:\n{{.code}}", want: "Review this Go:\nx := 1"},
+		{name: "functions", text: `{{if .lang}}{{printf "%q" .lang}}{{end}}`, want: `"Go"`},
+		{name: "not escaped", text: "{{.code}} < 2", want: "x := 1 < 2"},
+		{name: "missing variable", text: "Translate to {{.target}}", wantErr: `map has no entry for key "target"`},
+		{name: "malformed", text: "Hello {{.lang", wantErr: "unclosed action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderPrompt(tt.text, values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("renderPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"héllo wörld", 3}, // counted in characters, not bytes
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.s); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCLITemplateVars(t *testing.T) {
+	stdout, _ := runCLI(t, "-var", "name=World", "-var", "greeting=Hello", "{{.greeting}},{{.name}}!")
+	if stdout != "Hello,World!" {
+		t.Errorf("stdout = %q, want the rendered prompt echoed", stdout)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/abatilo/ghmodelsproxy/tools"
+)
+
+// maxToolIterations bounds how many rounds of tool calls a single RunWithTools may perform.
+const maxToolIterations = 10
+
+// ErrTooManyToolIterations is returned when the model keeps calling tools without producing an answer.
+var ErrTooManyToolIterations = errors.New("too many tool call iterations")
+
+// toolDefinitions converts the tools in a registry to their wire representation.
+func toolDefinitions(registry *tools.Registry) []ToolDefinition {
+	var defs []ToolDefinition
+	for _, tool := range registry.Tools() {
+		defs = append(defs, ToolDefinition{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// parseToolChoice parses -tool-choice: auto, none, required or the name of a tool in
+// registry.
+func parseToolChoice(value string, registry *tools.Registry) (*ToolChoice, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		return &ToolChoice{Mode: value}, nil
+	}
+	for _, tool := range registry.Tools() {
+		if tool.Name == value {
+			return &ToolChoice{Function: value}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown tool choice: %s (want auto, none, required or an enabled tool)", value)
+}
+
+// ToolRunOptions configures RunWithTools.
+type ToolRunOptions struct {
+	// Out receives streamed content. May be nil.
+	Out io.Writer
+	// OnToolCall is called before each tool call is executed.
+	OnToolCall func(call ToolCall)
+	// OnToolResult is called with the result sent back to the model for each tool call.
+	OnToolResult func(call ToolCall, result string)
+	// OnTurn is called with the finish reason and usage of each completion.
+	OnTurn func(finishReason string, usage *Usage)
+}
+
+// RunWithTools runs the tool-call loop: it offers the registered tools to the model,
+// executes any calls it makes, appends the results to the conversation and continues
+// until the model produces a final answer. req.ToolChoice other than none applies to
+// the first request only. Parallel tool calls are executed in the
+// order the model listed them. The returned messages are the full conversation
+// including the final assistant message.
+func (c *AzureClient) RunWithTools(ctx context.Context, req ChatCompletionOptions, registry *tools.Registry, opts ToolRunOptions) ([]ChatMessage, error) {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+	req.Tools = toolDefinitions(registry)
+	messages := append([]ChatMessage{}, req.Messages...)
+
+	for i := 0; i < maxToolIterations; i++ {
+		req.Messages = messages
+
+		acc, err := c.streamAccumulated(ctx, req, out)
+		if opts.OnTurn != nil {
+			opts.OnTurn(acc.finishReason, acc.usage)
+		}
+		if err != nil {
+			return messages, err
+		}
+		msg := acc.message()
+
+		messages = append(messages, msg)
+		if len(msg.ToolCalls) == 0 {
+			return messages, nil
+		}
+		// A forced tool call applies to the first round only, so the model can then answer
+		if req.ToolChoice != nil && req.ToolChoice.Mode != ToolChoiceNone {
+			req.ToolChoice = nil
+		}
+
+		for _, call := range msg.ToolCalls {
+			if opts.OnToolCall != nil {
+				opts.OnToolCall(call)
+			}
+			result, err := registry.Call(ctx, call.Function.Name, json.RawMessage(call.Function.Arguments))
+			if err != nil {
+				// Report failures back to the model so it can recover
+				result = fmt.Sprintf("error: %v", err)
+			}
+			if opts.OnToolResult != nil {
+				opts.OnToolResult(call, result)
+			}
+			messages = append(messages, ChatMessage{
+				Role:       ChatMessageRoleTool,
+				Content:    &result,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	return messages, ErrTooManyToolIterations
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/tools"
+)
+
+// newToolLoopClient returns a client whose requests are answered in order by the
+// given streams, each a list of SSE data payloads, and a function returning the
+// number of requests made.
+func newToolLoopClient(t *testing.T, streams ...[]string) (*AzureClient, func() int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n := requests
+		requests++
+		mu.Unlock()
+		if n >= len(streams) {
+			http.Error(w, "no more responses", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range streams[n] {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	cfg := NewDefaultAzureClientConfig()
+	cfg.InferenceURL = srv.URL
+	return NewAzureClient(srv.Client(), "test-token", cfg), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestRunWithTools(t *testing.T) {
+	client, _ := newToolLoopClient(t,
+		// Three parallel calls, the first with its arguments split across chunks
+		[]string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"add","arguments":"{\"a\":1,"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"missing","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"b\":2}"}},{"index":2,"id":"call_3","type":"function","function":{"name":"fail","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		},
+		[]string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":"The sum "}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"is 3."},"finish_reason":"stop"}]}`,
+		},
+	)
+	registry := tools.NewRegistry()
+	_ = registry.Register(tools.Func("add", "", nil, func(_ context.Context, args struct{ A, B int }) (string, error) {
+		return fmt.Sprint(args.A + args.B), nil
+	}))
+	_ = registry.Register(tools.Tool{Name: "fail", Handler: func(context.Context, json.RawMessage) (string, error) {
+		return "", errors.New("boom")
+	}})
+
+	prompt := "add 1 and 2"
+	var out strings.Builder
+	var called, results []string
+	messages, err := client.RunWithTools(context.Background(), ChatCompletionOptions{Model: "openai/gpt-4o-mini", Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: &prompt}}}, registry, ToolRunOptions{
+		Out:          &out,
+		OnToolCall:   func(call ToolCall) { called = append(called, call.Function.Name) },
+		OnToolResult: func(call ToolCall, result string) { results = append(results, call.ID+"="+result) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "The sum is 3." {
+		t.Errorf("streamed output = %q", out.String())
+	}
+	// Parallel calls run in the order the model listed them
+	if strings.Join(called, " ") != "add missing fail" || strings.Join(results, "|") != "call_1=3|call_2=error: unknown tool: missing|call_3=error: boom" {
+		t.Errorf("OnToolCall saw %q and OnToolResult %q", called, results)
+	}
+
+	// The user message, the tool calls, a result for each and the answer
+	if len(messages) != 6 {
+		t.Fatalf("got %d messages, want 6: %+v", len(messages), messages)
+	}
+	var calls []string
+	for _, call := range messages[1].ToolCalls {
+		calls = append(calls, call.ID+" "+call.Function.Name+" "+call.Function.Arguments)
+	}
+	if want := `call_1 add {"a":1,"b":2}|call_2 missing {}|call_3 fail {}`; strings.Join(calls, "|") != want {
+		t.Errorf("merged tool calls = %q, want %q", calls, want)
+	}
+	for i, want := range []struct{ id, content string }{
+		{"call_1", "3"},
+		{"call_2", "error: unknown tool: missing"},
+		{"call_3", "error: boom"},
+	} {
+		got := messages[2+i]
+		if got.Role != ChatMessageRoleTool || got.ToolCallID != want.id || got.Content == nil || *got.Content != want.content {
+			t.Errorf("tool result %d = %+v, want %q for %s", i+1, got, want.content, want.id)
+		}
+	}
+	if got := messages[5]; got.Content == nil || *got.Content != "The sum is 3." {
+		t.Errorf("final message = %+v", got)
+	}
+}
+
+func TestRunWithToolsIterationLimit(t *testing.T) {
+	var streams [][]string
+	for range maxToolIterations + 1 {
+		streams = append(streams, []string{`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"again","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`})
+	}
+	client, requests := newToolLoopClient(t, streams...)
+	registry := tools.NewRegistry()
+	_ = registry.Register(tools.Tool{Name: "again", Handler: func(context.Context, json.RawMessage) (string, error) {
+		return "call me again", nil
+	}})
+
+	prompt := "loop"
+	_, err := client.RunWithTools(context.Background(), ChatCompletionOptions{Model: "openai/gpt-4o-mini", Messages: []ChatMessage{{Role: ChatMessageRoleUser, Content: &prompt}}}, registry, ToolRunOptions{})
+	if !errors.Is(err, ErrTooManyToolIterations) {
+		t.Errorf("error = %v, want ErrTooManyToolIterations", err)
+	}
+	if got := requests(); got != maxToolIterations {
+		t.Errorf("sent %d requests, want %d", got, maxToolIterations)
+	}
+}
+
+func TestRunToolsDataStream(t *testing.T) {
+	client, _ := newToolLoopClient(t,
+		[]string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"add","arguments":"{\"a\":1,\"b\":2}"}}]},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`,
+		},
+		[]string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":"3"},"finish_reason":"length"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":1,"total_tokens":21}}`,
+		},
+	)
+	registry := tools.NewRegistry()
+	_ = registry.Register(tools.Func("add", "", nil, func(_ context.Context, args struct{ A, B int }) (string, error) {
+		return fmt.Sprint(args.A + args.B), nil
+	}))
+
+	var out strings.Builder
+	if err := runTools(context.Background(), client, testRequest("add 1 and 2"), registry, "aisdk", &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// The finish parts carry the last turn's reason and the usage of both turns
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`e:{"finishReason":"length","usage":{"promptTokens":30,"completionTokens":5},"isContinued":false}`,
+		`d:{"finishReason":"length","usage":{"promptTokens":30,"completionTokens":5}}`,
+	}
+	if len(lines) < 2 || strings.Join(lines[len(lines)-2:], "\n") != strings.Join(want, "\n") {
+		t.Errorf("data stream = %s\nwant it to end with\n%s", out.String(), strings.Join(want, "\n"))
+	}
+}
+
+func TestRunToolsOutput(t *testing.T) {
+	streams := [][]string{
+		{`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"add","arguments":"{\"a\":1,\"b\":2}"}}]},"finish_reason":"tool_calls"}]}`},
+		{`{"choices":[{"index":0,"delta":{"role":"assistant","content":"3"},"finish_reason":"stop"}]}`},
+	}
+	tests := []struct {
+		output   string
+		wantOut  []string
+		wantLogs string
+	}{
+		{output: "text", wantOut: []string{"3\n"}, wantLogs: "\n[tool] add {\"a\":1,\"b\":2}\n"},
+		{output: "aisdk", wantOut: []string{
+			`9:{"toolCallId":"call_1","toolName":"add","args":{"a":1,"b":2}}`,
+			`a:{"toolCallId":"call_1","result":"3"}`,
+			`0:"3"`,
+			`d:{"finishReason":"stop"}`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			client, _ := newToolLoopClient(t, streams...)
+			registry := tools.NewRegistry()
+			_ = registry.Register(tools.Func("add", "", nil, func(_ context.Context, args struct{ A, B int }) (string, error) {
+				return fmt.Sprint(args.A + args.B), nil
+			}))
+
+			var out, logs strings.Builder
+			if err := runTools(context.Background(), client, testRequest("add 1 and 2"), registry, tt.output, &out, &logs); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output = %s\nwant it to contain %s", out.String(), want)
+				}
+			}
+			if logs.String() != tt.wantLogs {
+				t.Errorf("log = %q, want %q", logs.String(), tt.wantLogs)
+			}
+		})
+	}
+}
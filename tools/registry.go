@@ -0,0 +1,104 @@
+// Package tools provides a registry of Go functions that models can call.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Handler executes a tool call with the raw JSON arguments supplied by the model and
+// returns the result that is sent back to the model.
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// Tool represents a function the model may call.
+type Tool struct {
+	// Name is the function name exposed to the model.
+	Name string
+	// Description tells the model when and how to use the tool.
+	Description string
+	// Parameters is the JSON schema describing the arguments object.
+	Parameters json.RawMessage
+	// Handler is invoked when the model calls the tool.
+	Handler Handler
+}
+
+// ErrUnknownTool is returned when the model calls a tool that is not registered.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// Registry holds the tools available to a model, in registration order.
+type Registry struct {
+	tools map[string]Tool
+	order []string
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]Tool{}}
+}
+
+// Register adds a tool to the registry.
+func (r *Registry) Register(tool Tool) error {
+	if tool.Name == "" {
+		return errors.New("tool name is required")
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %q has no handler", tool.Name)
+	}
+	if _, ok := r.tools[tool.Name]; ok {
+		return fmt.Errorf("tool %q is already registered", tool.Name)
+	}
+	if len(tool.Parameters) == 0 {
+		tool.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	if !json.Valid(tool.Parameters) {
+		return fmt.Errorf("tool %q has an invalid parameter schema", tool.Name)
+	}
+
+	r.tools[tool.Name] = tool
+	r.order = append(r.order, tool.Name)
+	return nil
+}
+
+// Tools returns the registered tools in registration order.
+func (r *Registry) Tools() []Tool {
+	tools := make([]Tool, len(r.order))
+	for i, name := range r.order {
+		tools[i] = r.tools[name]
+	}
+	return tools
+}
+
+// Len returns the number of registered tools.
+func (r *Registry) Len() int {
+	return len(r.order)
+}
+
+// Call invokes the named tool with the given arguments.
+func (r *Registry) Call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	tool, ok := r.tools[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTool, name)
+	}
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	return tool.Handler(ctx, args)
+}
+
+// Func returns a Tool whose handler decodes the model's arguments into T before calling fn.
+func Func[T any](name, description string, parameters json.RawMessage, fn func(context.Context, T) (string, error)) Tool {
+	return Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  parameters,
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var v T
+			if err := json.Unmarshal(args, &v); err != nil {
+				return "", fmt.Errorf("invalid arguments for %s: %w", name, err)
+			}
+			return fn(ctx, v)
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	echo := func(_ context.Context, args json.RawMessage) (string, error) { return string(args), nil }
+	r := NewRegistry()
+	if err := r.Register(Tool{Name: "b", Handler: echo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(Func("a", "", json.RawMessage(`{"type":"object"}`), func(_ context.Context, args struct{ N int }) (string, error) {
+		return strings.Repeat("x", args.N), nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		tool Tool
+	}{
+		{"no name", Tool{Handler: echo}},
+		{"no handler", Tool{Name: "c"}},
+		{"duplicate", Tool{Name: "b", Handler: echo}},
+		{"invalid schema", Tool{Name: "c", Handler: echo, Parameters: json.RawMessage("{")}},
+	} {
+		if err := r.Register(tt.tool); err == nil {
+			t.Errorf("registering a tool with %s succeeded", tt.name)
+		}
+	}
+
+	tools := r.Tools()
+	if len(tools) != 2 || tools[0].Name != "b" || tools[1].Name != "a" || r.Len() != 2 {
+		t.Fatalf("tools = %+v, want b and a in registration order", tools)
+	}
+	if string(tools[0].Parameters) != `{"type":"object","properties":{}}` {
+		t.Errorf("default parameters = %s", tools[0].Parameters)
+	}
+
+	ctx := context.Background()
+	if got, err := r.Call(ctx, "b", nil); err != nil || got != "{}" {
+		t.Errorf("calling with no arguments = %q, %v, want {}", got, err)
+	}
+	if got, err := r.Call(ctx, "a", json.RawMessage(`{"n":3}`)); err != nil || got != "xxx" {
+		t.Errorf("calling a Func tool = %q, %v", got, err)
+	}
+	if _, err := r.Call(ctx, "a", json.RawMessage(`{"n":"three"}`)); err == nil || !strings.Contains(err.Error(), "invalid arguments for a") {
+		t.Errorf("calling with invalid arguments = %v", err)
+	}
+	if _, err := r.Call(ctx, "missing", nil); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("calling an unknown tool = %v, want ErrUnknownTool", err)
+	}
+}
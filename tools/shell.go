@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	defaultShellTimeout   = 30 * time.Second
+	maxShellOutputBytes   = 16 * 1024
+	shellMetacharacters   = ";&|`$<>()\\\n"
+	shellToolName         = "run_shell_command"
+	shellToolDescription  = "Run a shell command on the user's machine and return its combined stdout and stderr. The user may refuse to run the command."
+	shellToolParameterDoc = `{"type":"object","properties":{"command":{"type":"string","description":"The shell command to run"}},"required":["command"]}`
+)
+
+// ErrCommandRefused is returned to the model when a command is not run.
+var ErrCommandRefused = errors.New("command refused")
+
+// ConfirmFunc asks the user whether command may be run.
+type ConfirmFunc func(command string) (bool, error)
+
+// ShellOptions configures the shell tool.
+type ShellOptions struct {
+	// Confirm is asked before running any command that is not allowlisted. When nil,
+	// only allowlisted commands are run.
+	Confirm ConfirmFunc
+	// Allowlist holds program names that run without confirmation. Allowlisted commands
+	// are executed directly rather than through a shell, so they may not contain shell
+	// metacharacters.
+	Allowlist []string
+	// Dir is the working directory for commands. Defaults to the current directory.
+	Dir string
+	// Timeout bounds how long a command may run. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+type shellArgs struct {
+	Command string `json:"command"`
+}
+
+// Shell returns a tool that lets the model propose shell commands.
+func Shell(opts ShellOptions) Tool {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultShellTimeout
+	}
+	// The model is told the platform so that it proposes commands for the right shell
+	description := shellToolDescription + " Commands run on " + runtime.GOOS + "."
+	return Func(shellToolName, description, []byte(shellToolParameterDoc), func(ctx context.Context, args shellArgs) (string, error) {
+		command := strings.TrimSpace(args.Command)
+		if command == "" {
+			return "", errors.New("command is required")
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+
+		var cmd *exec.Cmd
+		switch {
+		case opts.allowed(command):
+			fields := strings.Fields(command)
+			cmd = exec.CommandContext(ctx, fields[0], fields[1:]...)
+		case opts.Confirm != nil:
+			ok, err := opts.Confirm(command)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", fmt.Errorf("%w: the user declined to run it", ErrCommandRefused)
+			}
+			cmd = shellCommand(ctx, command)
+		default:
+			return "", fmt.Errorf("%w: %q is not in the allowlist", ErrCommandRefused, command)
+		}
+
+		cmd.Dir = opts.Dir
+		out := &limitedBuffer{limit: maxShellOutputBytes}
+		cmd.Stdout = out
+		cmd.Stderr = out
+
+		err := cmd.Run()
+		result := out.String()
+		if out.truncated {
+			result += "\n[output truncated]"
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return result, fmt.Errorf("command timed out after %v", opts.Timeout)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Sprintf("%s\n[exit status %d]", result, exitErr.ExitCode()), nil
+		}
+		if err != nil {
+			return result, err
+		}
+		return result, nil
+	})
+}
+
+// shellCommand runs command with the platform's shell: cmd on Windows, sh elsewhere.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// allowed reports whether command may run without confirmation.
+func (o ShellOptions) allowed(command string) bool {
+	if strings.ContainsAny(command, shellMetacharacters) {
+		return false
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, name := range o.Allowlist {
+		if fields[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PromptConfirm returns a ConfirmFunc that shows each command on out and reads a
+// y/n answer from in.
+func PromptConfirm(in io.Reader, out io.Writer) ConfirmFunc {
+	reader := bufio.NewReader(in)
+	return func(command string) (bool, error) {
+		fmt.Fprintf(out, "\nThe model wants to run:\n  %s\nAllow? [y/N] ", command)
+		answer, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	}
+}
+
+// limitedBuffer keeps at most limit bytes of output.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
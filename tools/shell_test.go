@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands assume a POSIX shell")
+	}
+	deny := func(string) (bool, error) { return false, nil }
+	allow := func(string) (bool, error) { return true, nil }
+
+	type shellTest struct {
+		name    string
+		opts    ShellOptions
+		command string
+		// confirmed is whether the command must be shown to Confirm
+		confirmed bool
+		want      string
+		wantErr   error
+		errText   string
+	}
+	tests := []shellTest{
+		{name: "allowlisted", opts: ShellOptions{Allowlist: []string{"echo"}, Confirm: deny}, command: "echo hello", want: "hello\n"},
+		{name: "not allowlisted", opts: ShellOptions{Allowlist: []string{"echo"}}, command: "ls", wantErr: ErrCommandRefused},
+		{name: "confirm denies", opts: ShellOptions{Confirm: deny}, command: "echo hello", confirmed: true, wantErr: ErrCommandRefused},
+		{name: "confirm allows", opts: ShellOptions{Confirm: allow}, command: "echo hello | tr a-z A-Z", confirmed: true, want: "HELLO\n"},
+		{name: "exit status", opts: ShellOptions{Allowlist: []string{"false"}}, command: "false", want: "\n[exit status 1]"},
+		{name: "truncated output", opts: ShellOptions{Allowlist: []string{"head"}}, command: "head -c 20000 /dev/zero", want: strings.Repeat("\x00", maxShellOutputBytes) + "\n[output truncated]"},
+		{name: "timeout", opts: ShellOptions{Allowlist: []string{"sleep"}, Timeout: 50 * time.Millisecond}, command: "sleep 10", errText: "timed out"},
+	}
+	// Allowlisted programs are not run through a shell, so any metacharacter sends
+	// the command to Confirm instead
+	for _, c := range shellMetacharacters {
+		tests = append(tests, shellTest{name: "metacharacter " + string(c), opts: ShellOptions{Allowlist: []string{"echo"}, Confirm: deny}, command: "echo a" + string(c) + "b", confirmed: true, wantErr: ErrCommandRefused})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked []string
+			if confirm := tt.opts.Confirm; confirm != nil {
+				tt.opts.Confirm = func(command string) (bool, error) {
+					asked = append(asked, command)
+					return confirm(command)
+				}
+			}
+			args, _ := json.Marshal(shellArgs{Command: tt.command})
+			start := time.Now()
+			got, err := Shell(tt.opts).Handler(context.Background(), args)
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.errText != "" && (err == nil || !strings.Contains(err.Error(), tt.errText)) {
+				t.Errorf("error = %v, want one containing %q", err, tt.errText)
+			}
+			if tt.wantErr == nil && tt.errText == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("output = %q, want %q", got, tt.want)
+				}
+			}
+			if confirmed := len(asked) > 0; confirmed != tt.confirmed {
+				t.Errorf("Confirm asked about %q, want asked %v", asked, tt.confirmed)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("the command ran for %v", elapsed)
+			}
+		})
+	}
+}
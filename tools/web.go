@@ -0,0 +1,286 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	maxFetchBodyBytes = 2 * 1024 * 1024
+	maxFetchTextChars = 20000
+	defaultSearchHits = 5
+)
+
+var (
+	fetchToolParameters  = json.RawMessage(`{"type":"object","properties":{"url":{"type":"string","description":"The http or https URL to fetch"}},"required":["url"]}`)
+	searchToolParameters = json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"The search query"},"limit":{"type":"integer","description":"Maximum number of results"}},"required":["query"]}`)
+)
+
+// ErrPrivateAddress is returned to the model when a fetch would connect to a
+// loopback, private or link-local address.
+var ErrPrivateAddress = errors.New("refusing to fetch a private address")
+
+// FetchOptions configures the URL fetch tool.
+type FetchOptions struct {
+	// Client performs the requests. Defaults to a client that refuses to connect to
+	// private addresses, including after redirects. A Client given here is used as
+	// is and must do its own checking.
+	Client *http.Client
+	// MaxChars bounds the length of the returned text. Defaults to 20000.
+	MaxChars int
+	// AllowPrivate lets the default client fetch loopback, private and link-local
+	// addresses, such as a development server on localhost.
+	AllowPrivate bool
+}
+
+type fetchArgs struct {
+	URL string `json:"url"`
+}
+
+// Fetch returns a tool that downloads a URL and returns its readable text.
+func Fetch(opts FetchOptions) Tool {
+	if opts.Client == nil {
+		opts.Client = fetchClient(opts.AllowPrivate)
+	}
+	if opts.MaxChars == 0 {
+		opts.MaxChars = maxFetchTextChars
+	}
+	return Func("fetch_url", "Fetch a web page and return its main text content.", fetchToolParameters, func(ctx context.Context, args fetchArgs) (string, error) {
+		u, err := url.Parse(args.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return "", fmt.Errorf("invalid URL: %q", args.URL)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.5")
+
+		resp, err := opts.Client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("unexpected response from %s: %s", u, resp.Status)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBodyBytes))
+		if err != nil {
+			return "", err
+		}
+
+		text := string(body)
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "" {
+			text = ExtractText(text)
+		}
+		if cut, ok := truncateChars(text, opts.MaxChars); ok {
+			text = cut + "\n[content truncated]"
+		}
+		return text, nil
+	})
+}
+
+// truncateChars cuts s to at most n characters and reports whether it was cut.
+func truncateChars(s string, n int) (string, bool) {
+	chars := 0
+	for i := range s {
+		if chars == n {
+			return s[:i], true
+		}
+		chars++
+	}
+	return s, false
+}
+
+// fetchClient returns the default client of the fetch tool. The model chooses the
+// URLs, so unless allowPrivate is set the addresses are checked as they are dialed,
+// after name resolution, where neither a redirect nor DNS can get around it. The
+// proxy from the environment is not used since it would be the one dialed.
+func fetchClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, Control: refusePrivate}).DialContext
+	}
+	return &http.Client{Transport: transport}
+}
+
+// refusePrivate is a net.Dialer Control function that refuses connections to
+// loopback, private, link-local and unspecified addresses.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// SearchResult represents a single web search hit.
+type SearchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// SearchProvider performs web searches for the search tool.
+type SearchProvider interface {
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
+type searchArgs struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+// Search returns a tool that searches the web using provider.
+func Search(provider SearchProvider) Tool {
+	return Func("web_search", "Search the web and return matching page titles, URLs and snippets. Use fetch_url to read a result.", searchToolParameters, func(ctx context.Context, args searchArgs) (string, error) {
+		if strings.TrimSpace(args.Query) == "" {
+			return "", errors.New("query is required")
+		}
+		if args.Limit <= 0 {
+			args.Limit = defaultSearchHits
+		}
+
+		results, err := provider.Search(ctx, args.Query, args.Limit)
+		if err != nil {
+			return "", err
+		}
+
+		out, err := json.Marshal(results)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	})
+}
+
+// SearXNG is a SearchProvider backed by a SearXNG instance with the JSON format enabled.
+type SearXNG struct {
+	// BaseURL is the instance root, e.g. http://localhost:8888.
+	BaseURL string
+	// Client performs the requests. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Search queries the SearXNG instance.
+func (s *SearXNG) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	u := strings.TrimSuffix(s.BaseURL, "/") + "/search?" + url.Values{"q": {query}, "format": {"json"}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from the search provider: %s", resp.Status)
+	}
+
+	var body struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, r := range body.Results {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return results, nil
+}
+
+// boilerplatePatterns match the elements whose content is never part of the readable
+// text; the title is added back in front of it. Each pattern matches one element type
+// up to its own closing tag, as regexp has no backreferences.
+var boilerplatePatterns = func() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, name := range []string{"script", "style", "noscript", "svg", "template", "iframe", "nav", "header", "footer", "aside", "form", "title"} {
+		patterns = append(patterns, regexp.MustCompile(`(?is)<`+name+`\b.*?</`+name+`\s*>`))
+	}
+	return patterns
+}()
+
+var (
+	commentPattern    = regexp.MustCompile(`(?s)<!--.*?-->`)
+	mainPattern       = regexp.MustCompile(`(?is)<(article|main)\b[^>]*>(.*)</(article|main)>`)
+	titlePattern      = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+	blockTagPattern   = regexp.MustCompile(`(?i)</?(p|div|section|br|li|ul|ol|h[1-6]|tr|table|pre|blockquote)\b[^>]*>`)
+	tagPattern        = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacePattern      = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesPattern = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// ExtractText returns the readable text of an HTML document, preferring the
+// <article> or <main> element when present and dropping navigation and scripts.
+func ExtractText(doc string) string {
+	var title string
+	if m := titlePattern.FindStringSubmatch(doc); m != nil {
+		title = strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(m[1], "")))
+	}
+
+	doc = commentPattern.ReplaceAllString(doc, "")
+	for _, pattern := range boilerplatePatterns {
+		doc = pattern.ReplaceAllString(doc, "")
+	}
+	if m := mainPattern.FindStringSubmatch(doc); m != nil {
+		doc = m[2]
+	}
+	doc = blockTagPattern.ReplaceAllString(doc, "\n")
+	doc = tagPattern.ReplaceAllString(doc, "")
+	doc = html.UnescapeString(doc)
+	doc = spacePattern.ReplaceAllString(doc, " ")
+
+	var lines []string
+	for _, line := range strings.Split(doc, "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	text := strings.TrimSpace(blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+
+	if title != "" {
+		return title + "\n\n" + text
+	}
+	return text
+}
@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	doc := `<html><head><title>Go &amp; you</title><style>p { color: red }</style></head>
+<body>
+<nav><a href="/">Home</a></nav>
+<!-- a comment -->
+<main>
+  <h1>Hello</h1>
+  <p>First   paragraph with <b>bold</b> text.</p>
+
+  <script>alert("hi")</script>
+  <ul><li>one</li><li>two &lt;3</li></ul>
+</main>
+<footer>Copyright</footer>
+</body></html>`
+	want := "Go & you\n\nHello\n\nFirst paragraph with bold text.\n\none\n\ntwo <3"
+	if got := ExtractText(doc); got != want {
+		t.Errorf("ExtractText =\n%q\nwant\n%q", got, want)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{name: "no document", doc: "plain <i>text</i>", want: "plain text"},
+		{
+			name: "header nested in an article",
+			doc:  `<article><header><nav><a href="/">Home</a></nav><p>Byline</p></header><p>Story</p></article>`,
+			want: "Story",
+		},
+		{
+			name: "mismatched closing tag",
+			doc:  `<body><nav><a href="/">Home</a></nav><p>Kept</p><!-- no footer here --></footer><p>Also kept</p></body>`,
+			want: "Kept\n\nAlso kept",
+		},
+		{
+			name: "non-ASCII content",
+			doc:  `<title>Café</title><main><p>Grüße, 世界 &amp; 😀</p></main><footer>© 2024</footer>`,
+			want: "Café\n\nGrüße, 世界 & 😀",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractText(tt.doc); got != tt.want {
+				t.Errorf("ExtractText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefusePrivate(t *testing.T) {
+	for address, refused := range map[string]bool{
+		"127.0.0.1:80":          true,
+		"10.1.2.3:80":           true,
+		"172.16.0.1:80":         true,
+		"192.168.1.1:443":       true,
+		"169.254.169.254:80":    true,
+		"0.0.0.0:80":            true,
+		"[::1]:80":              true,
+		"[fe80::1]:80":          true,
+		"[fd00::1]:80":          true,
+		"[::ffff:127.0.0.1]:80": true,
+		"93.184.216.34:443":     false,
+		"[2606:4700::1111]:443": false,
+		"172.32.0.1:80":         false,
+	} {
+		err := refusePrivate("tcp", address, nil)
+		if got := errors.Is(err, ErrPrivateAddress); got != refused {
+			t.Errorf("refusePrivate(%s) = %v, want refused %v", address, err, refused)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<title>T</title><p>Body</p>"))
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("<p>kept</p>"))
+		case "/unicode":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("日本語のテキスト"))
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	fetch := func(opts FetchOptions, path string) (string, error) {
+		args, _ := json.Marshal(fetchArgs{URL: srv.URL + path})
+		return Fetch(opts).Handler(context.Background(), args)
+	}
+
+	// The test server listens on loopback, which the default client refuses
+	for _, path := range []string{"/page", "/redirect"} {
+		if _, err := fetch(FetchOptions{}, path); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("fetching %s by default = %v, want ErrPrivateAddress", path, err)
+		}
+	}
+
+	allow := FetchOptions{AllowPrivate: true}
+	if got, err := fetch(allow, "/redirect"); err != nil || got != "T\n\nBody" {
+		t.Errorf("fetching HTML = %q, %v", got, err)
+	}
+	if got, err := fetch(allow, "/text"); err != nil || got != "<p>kept</p>" {
+		t.Errorf("fetching plain text = %q, %v", got, err)
+	}
+	if got, err := fetch(FetchOptions{AllowPrivate: true, MaxChars: 3}, "/text"); err != nil || got != "<p>\n[content truncated]" {
+		t.Errorf("fetching with MaxChars = %q, %v", got, err)
+	}
+	// MaxChars counts characters, not bytes, so no character is split
+	if got, err := fetch(FetchOptions{AllowPrivate: true, MaxChars: 3}, "/unicode"); err != nil || got != "日本語\n[content truncated]" {
+		t.Errorf("fetching non-ASCII text with MaxChars = %q, %v", got, err)
+	}
+	if _, err := fetch(allow, "/missing"); err == nil {
+		t.Error("fetching a missing page succeeded")
+	}
+	if _, err := Fetch(allow).Handler(context.Background(), json.RawMessage(`{"url":"file:///etc/passwd"}`)); err == nil {
+		t.Error("fetching a file URL succeeded")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// transcript writes an exchange to a Markdown file as the response streams in, so
+// the response never has to be held in memory.
+type transcript struct {
+	f *os.File
+}
+
+// createTranscript creates the transcript file at path and writes the prompt to it.
+func createTranscript(path, model, prompt string) (*transcript, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(f, "## User\n\n%s\n\n## Assistant (%s)\n\n", prompt, model); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &transcript{f: f}, nil
+}
+
+// Write appends streamed response text.
+func (t *transcript) Write(p []byte) (int, error) {
+	return t.f.Write(p)
+}
+
+// Close ends the response and closes the file.
+func (t *transcript) Close() error {
+	if _, err := io.WriteString(t.f, "\n"); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
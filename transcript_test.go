@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "streamed",
+			prompt: "hi",
+			chunks: []string{"Hel", "lo", "!"},
+			want:   "## User\n\nhi\n\n## Assistant (openai/gpt-4.1)\n\nHello!\n",
+		},
+		{
+			name:   "multiline prompt",
+			prompt: "line one\nline two",
+			chunks: []string{"ok"},
+			want:   "## User\n\nline one\nline two\n\n## Assistant (openai/gpt-4.1)\n\nok\n",
+		},
+		{
+			name:   "no response",
+			prompt: "hi",
+			want:   "## User\n\nhi\n\n## Assistant (openai/gpt-4.1)\n\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "transcript.md")
+			tee, err := createTranscript(path, "openai/gpt-4.1", tt.prompt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, chunk := range tt.chunks {
+				if _, err := io.WriteString(tee, chunk); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tee.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("transcript = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTranscriptError(t *testing.T) {
+	if _, err := createTranscript(filepath.Join(t.TempDir(), "missing", "transcript.md"), "openai/gpt-4.1", "hi"); err == nil {
+		t.Error("createTranscript() in a missing directory succeeded")
+	}
+}
+
+func TestCLITee(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.md")
+	stdout, _ := runCLI(t, "-model", "openai/gpt-4.1", "-tee", path, "pipeline")
+	if stdout != "pipeline" {
+		t.Errorf("stdout = %q, want the response", stdout)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "## User\n\npipeline\n\n## Assistant (openai/gpt-4.1)\n\npipeline\n"; string(data) != want {
+		t.Errorf("transcript = %q, want %q", data, want)
+	}
+}
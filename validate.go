@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// approxCharsPerToken is the rough number of characters per token used for size estimates.
+const approxCharsPerToken = 4
+
+// ValidationError is returned when a request uses a model or parameter the model does not support.
+type ValidationError struct {
+	Model   string
+	Problem string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("model %s %s", e.Model, e.Problem)
+}
+
+// ValidateRequest checks req against the cached model catalog before it is sent, so
+// unsupported models and parameters fail with an actionable error instead of an opaque
+// upstream response. Validation is skipped if the catalog is unavailable.
+func (c *AzureClient) ValidateRequest(ctx context.Context, req ChatCompletionOptions) error {
+	models, err := c.cachedCatalog(ctx)
+	if err != nil {
+		return nil
+	}
+	return validateAgainstCatalog(models, req)
+}
+
+func validateAgainstCatalog(models []*ModelSummary, req ChatCompletionOptions) error {
+	model := findModel(models, req.Model)
+	if model == nil {
+		problem := "is not in the GitHub Models catalog"
+		if suggestions := similarModels(models, req.Model); len(suggestions) > 0 {
+			problem += "; did you mean " + strings.Join(suggestions, ", ") + "?"
+		}
+		return &ValidationError{Model: req.Model, Problem: problem}
+	}
+
+	if len(req.Tools) > 0 && len(model.Capabilities) > 0 && !model.HasCapability(ModelCapabilityToolCalling) {
+		return &ValidationError{Model: model.ID, Problem: "does not support tool calling"}
+	}
+
+	if len(model.SupportedInputModalities) > 0 && !model.SupportsInput("text") {
+		return &ValidationError{Model: model.ID, Problem: "does not support text input"}
+	}
+
+	if req.MaxTokens != nil && model.Limits.MaxOutputTokens > 0 && *req.MaxTokens > model.Limits.MaxOutputTokens {
+		return &ValidationError{
+			Model:   model.ID,
+			Problem: fmt.Sprintf("generates at most %d output tokens, but %d were requested", model.Limits.MaxOutputTokens, *req.MaxTokens),
+		}
+	}
+
+	if model.Limits.MaxInputTokens > 0 {
+		chars := 0
+		for _, m := range req.Messages {
+			if m.Content != nil {
+				chars += len(*m.Content)
+			}
+		}
+		if estimate := chars / approxCharsPerToken; estimate > model.Limits.MaxInputTokens {
+			return &ValidationError{
+				Model:   model.ID,
+				Problem: fmt.Sprintf("accepts at most %d input tokens, but the prompt is roughly %d tokens", model.Limits.MaxInputTokens, estimate),
+			}
+		}
+	}
+
+	return nil
+}
+
+// similarModels returns up to three catalog model ids resembling id.
+func similarModels(models []*ModelSummary, id string) []string {
+	name := strings.ToLower(id)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	var matches []string
+	for _, m := range models {
+		candidate := strings.ToLower(m.ID)
+		if strings.Contains(candidate, name) || strings.Contains(name, candidate[strings.LastIndex(candidate, "/")+1:]) {
+			matches = append(matches, m.ID)
+			if len(matches) == 3 {
+				break
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abatilo/ghmodelsproxy/conversation"
+)
+
+var validationCatalog = []*ModelSummary{
+	{
+		ID:                       "openai/gpt-4.1",
+		Capabilities:             []string{ModelCapabilityToolCalling, "streaming"},
+		SupportedInputModalities: []string{"text", "image"},
+		Limits:                   ModelLimits{MaxInputTokens: 100, MaxOutputTokens: 50},
+	},
+	{ID: "openai/gpt-4.1-mini", Capabilities: []string{"streaming"}},
+	{ID: "openai/gpt-4.1-nano"},
+	{ID: "openai/gpt-4o"},
+	{ID: "microsoft/phi-4"},
+	{ID: "openai/whisper", SupportedInputModalities: []string{"audio"}},
+}
+
+func TestValidateAgainstCatalog(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     func(*ChatCompletionOptions)
+		wantErr string
+	}{
+		{name: "valid", req: func(req *ChatCompletionOptions) {}},
+		{name: "model case", req: func(req *ChatCompletionOptions) { req.Model = "OpenAI/GPT-4.1" }},
+		{name: "unknown model", req: func(req *ChatCompletionOptions) { req.Model = "openai/gpt-5" }, wantErr: "model openai/gpt-5 is not in the GitHub Models catalog"},
+		{name: "unknown model with suggestions", req: func(req *ChatCompletionOptions) { req.Model = "gpt-4.1-mini" }, wantErr: "did you mean openai/gpt-4.1, openai/gpt-4.1-mini?"},
+		{name: "tools without tool calling", req: func(req *ChatCompletionOptions) {
+			req.Model = "openai/gpt-4.1-mini"
+			req.Tools = []ToolDefinition{{Type: "function"}}
+		}, wantErr: "model openai/gpt-4.1-mini does not support tool calling"},
+		{name: "tools with unknown capabilities", req: func(req *ChatCompletionOptions) {
+			req.Model = "openai/gpt-4.1-nano"
+			req.Tools = []ToolDefinition{{Type: "function"}}
+		}},
+		{name: "no text input", req: func(req *ChatCompletionOptions) { req.Model = "openai/whisper" }, wantErr: "model openai/whisper does not support text input"},
+		{name: "too many output tokens", req: func(req *ChatCompletionOptions) { req.MaxTokens = conversation.Ptr(51) }, wantErr: "model openai/gpt-4.1 generates at most 50 output tokens, but 51 were requested"},
+		{name: "output token limit", req: func(req *ChatCompletionOptions) { req.MaxTokens = conversation.Ptr(50) }},
+		{name: "prompt too long", req: func(req *ChatCompletionOptions) {
+			req.Messages = append(req.Messages, ChatMessage{Role: ChatMessageRoleUser, Content: conversation.Ptr(strings.Repeat("x", 404))})
+		}, wantErr: "model openai/gpt-4.1 accepts at most 100 input tokens, but the prompt is roughly 101 tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testRequest("hi")
+			req.Model = "openai/gpt-4.1"
+			tt.req(&req)
+			err := validateAgainstCatalog(validationCatalog, req)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("err = %v, want a *ValidationError", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSimilarModels(t *testing.T) {
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{"phi-4", []string{"microsoft/phi-4"}},
+		{"azure/phi-4", []string{"microsoft/phi-4"}},
+		{"GPT-4O", []string{"openai/gpt-4o"}},
+		{"gpt-4", []string{"openai/gpt-4.1", "openai/gpt-4.1-mini", "openai/gpt-4.1-nano"}},
+		{"phi-4-reasoning", []string{"microsoft/phi-4"}},
+		{"llama", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := similarModels(validationCatalog, tt.id); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("similarModels(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}